@@ -0,0 +1,110 @@
+package campaign
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/lateralusd/lateralus/email"
+	mail "github.com/xhit/go-simple-mail/v2"
+)
+
+// loadAttachments reads the files once, so that every mail gets the same
+// content even if they change during the campaign
+func loadAttachments(paths []string) ([]email.Attachment, error) {
+	var attachments []email.Attachment
+	for _, p := range paths {
+		a, err := email.NewAttachment(p)
+		if err != nil {
+			return nil, fmt.Errorf("loadAttachments: %v", err)
+		}
+		attachments = append(attachments, a)
+	}
+	return attachments, nil
+}
+
+// attach adds the attachments to m, which becomes multipart/mixed
+func attach(m *mail.Email, attachments []email.Attachment) {
+	for _, a := range attachments {
+		m.Attach(&mail.File{
+			Name:     a.Filename,
+			MimeType: a.ContentType,
+			Data:     a.Data,
+		})
+	}
+}
+
+// inlineImage is image embedded into multipart/related part of the mail
+// and referenced from HTML body as cid:<CID>
+type inlineImage struct {
+	CID string
+	email.Attachment
+}
+
+// loadInlineImages reads the images, sorted by content id
+func loadInlineImages(images map[string]string) ([]inlineImage, error) {
+	var cids []string
+	for cid := range images {
+		cids = append(cids, cid)
+	}
+	sort.Strings(cids)
+
+	var loaded []inlineImage
+	for _, cid := range cids {
+		a, err := email.NewAttachment(images[cid])
+		if err != nil {
+			return nil, fmt.Errorf("loadInlineImages: %v", err)
+		}
+		loaded = append(loaded, inlineImage{CID: cid, Attachment: a})
+	}
+	return loaded, nil
+}
+
+func attachInline(m *mail.Email, images []inlineImage) {
+	for _, img := range images {
+		m.Attach(&mail.File{
+			Name:     img.Filename,
+			MimeType: img.ContentType,
+			Data:     img.Data,
+			Inline:   true,
+		})
+	}
+}
+
+// generatedContentID matches Content-ID headers go-simple-mail generates
+// for inline files from the current time
+var generatedContentID = regexp.MustCompile(`(?mi)^Content-Id: <[0-9.]+@mail\.0>\r?$`)
+
+// setContentIDs replaces generated content ids of inline images with the
+// configured ones. Inline parts are written after the bodies in the order
+// they were attached, so they are the last ones with Content-ID header.
+func setContentIDs(data string, images []inlineImage) (string, error) {
+	if len(images) == 0 {
+		return data, nil
+	}
+
+	locs := generatedContentID.FindAllStringIndex(data, -1)
+	if len(locs) < len(images) {
+		return "", fmt.Errorf("setContentIDs: found %d inline parts, expected %d", len(locs), len(images))
+	}
+	locs = locs[len(locs)-len(images):]
+
+	var b strings.Builder
+	last := 0
+	for i, loc := range locs {
+		b.WriteString(data[last:loc[0]])
+		fmt.Fprintf(&b, "Content-ID: <%s>", images[i].CID)
+		if strings.HasSuffix(data[loc[0]:loc[1]], "\r") {
+			b.WriteByte('\r')
+		}
+		last = loc[1]
+	}
+	b.WriteString(data[last:])
+
+	return b.String(), nil
+}
+
+// contentIDChars are allowed in configured content ids, so that they can
+// be used in Content-ID header and cid: URL without escaping
+var contentIDChars = regexp.MustCompile(`^[A-Za-z0-9._@+-]+$`)
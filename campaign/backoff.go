@@ -0,0 +1,62 @@
+package campaign
+
+import (
+	"errors"
+	"math/rand"
+	"net/textproto"
+	"time"
+)
+
+const (
+	defaultMaxBackoff = 5 * time.Minute
+	baseBackoff       = 5 * time.Second
+)
+
+// backoff holds exponential back-off state for a single mail server
+type backoff struct {
+	attempt int
+	max     time.Duration
+	rnd     *rand.Rand
+}
+
+func newBackoff(max time.Duration) *backoff {
+	if max <= 0 {
+		max = defaultMaxBackoff
+	}
+	return &backoff{
+		max: max,
+		rnd: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// next returns how long to wait before the next attempt. Second return
+// value is false once back-off window exceeded the maximum.
+func (b *backoff) next() (time.Duration, bool) {
+	window := baseBackoff << uint(b.attempt)
+	if window > b.max || window <= 0 {
+		return 0, false
+	}
+	b.attempt++
+	// equal jitter, wait anything between half of the window and the whole
+	// window, so that the server is always given at least half of it
+	half := int64(window / 2)
+	return time.Duration(half + b.rnd.Int63n(half+1)), true
+}
+
+func (b *backoff) reset() {
+	b.attempt = 0
+}
+
+// isThrottled reports whether err is temporary rejection because of too many
+// connections (421) or busy mailbox (450)
+func isThrottled(err error) (int, bool) {
+	var tpErr *textproto.Error
+	if !errors.As(err, &tpErr) {
+		return 0, false
+	}
+	switch tpErr.Code {
+	case 421, 450:
+		return tpErr.Code, true
+	}
+	return 0, false
+}
@@ -0,0 +1,326 @@
+package campaign
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lateralusd/lateralus/logging"
+	"github.com/lateralusd/lateralus/notify"
+	"github.com/lateralusd/lateralus/util"
+)
+
+const timeFormat = "2006-01-02 15:04:05"
+
+// Campaign runs the whole lifecycle of phishing campaign: validation,
+// templates rendering, sending of the mails and report generation
+type Campaign struct {
+	Options *Options
+	// ID identifies the campaign, it is sent as envelope id of DSN requests
+	ID string
+
+	// Output is the report filename, default is Subject_startTime
+	Output string
+	// Format of the report: tpl, xml or json
+	Format string
+	// ReportTemplate is used for tpl reports instead of the default one
+	ReportTemplate string
+	// HTMLReport saves also self-contained HTML report, to Output with
+	// .html suffix
+	HTMLReport bool
+	// EMLDir is the directory where every sent mail is saved as <ID>.eml
+	EMLDir string
+	// DryRun builds the mails without connecting to the mail servers, they
+	// are saved into EMLDir or printed to stdout if it is empty
+	DryRun bool
+	// Checkpoint is the file where state of every target is saved while
+	// sending, default is Output with .checkpoint suffix. It is removed once
+	// all mails are sent.
+	Checkpoint string
+	// Resume is checkpoint of interrupted campaign, targets which were sent
+	// the mail are skipped and the checkpoint is continued
+	Resume string
+
+	// SimulateClicks generates fake click events for given percent of sent
+	// mails, used for testing the reporting without real campaign
+	SimulateClicks int
+	// Seed for picking the targets which simulated clicks belong to
+	Seed int64
+}
+
+// New creates campaign for opts
+func New(opts *Options) *Campaign {
+	return &Campaign{
+		Options: opts,
+		ID:      util.GenerateUUID(36),
+		Format:  "tpl",
+	}
+}
+
+// Render loads the targets and renders the mail for every one of them,
+// without connecting to the mail server. Checking the targets is stopped
+// when ctx is done.
+func (c *Campaign) Render(ctx context.Context) ([]SendingMail, error) {
+	opts := c.Options
+
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	logging.Infof("Parsing targets from \"%s\"", opts.targetsSource())
+	targets, err := loadTargets(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if targets, err = selectTargets(opts, targets); err != nil {
+		return nil, err
+	}
+
+	if !opts.Attack.KeepDuplicates {
+		targets = dedupTargets(targets)
+	}
+
+	if targets, err = filterTargets(ctx, opts, targets); err != nil {
+		return nil, err
+	}
+
+	if err := checkTemplateFields(opts, targets); err != nil {
+		return nil, err
+	}
+
+	if err := checkTimezones(targets); err != nil {
+		return nil, err
+	}
+
+	return prepareTemplates(targets, opts)
+}
+
+// Run executes the campaign. Sending is stopped when ctx is done, report is
+// written in any case with the targets prepared so far.
+func (c *Campaign) Run(ctx context.Context) error {
+	opts := c.Options
+	start := time.Now()
+
+	output := c.Output
+	if output == "" {
+		logging.Infof("Output not provided, will use default output (Subject_startTime)")
+		output = strings.ReplaceAll(fmt.Sprintf("%s_%s", opts.Mail.Subject, start.Format(timeFormat)), " ", "")
+	}
+
+	logging.Infof("Output filename will be \"%s\"", output)
+	if c.HTMLReport && c.Format != "html" {
+		logging.Infof("HTML report will be saved in \"%s\"", output+".html")
+	}
+
+	checkpointFile := c.Checkpoint
+	if checkpointFile == "" {
+		checkpointFile = c.Resume
+	}
+	if checkpointFile == "" {
+		checkpointFile = output + ".checkpoint"
+	}
+
+	sendingData, err := c.Render(ctx)
+	if err != nil {
+		return err
+	}
+
+	var resumed []SendingMail
+	if c.Resume != "" {
+		entries, id, err := readCheckpoint(c.Resume)
+		if err != nil {
+			return fmt.Errorf("Run: %v", err)
+		}
+		if id != "" {
+			c.ID = id
+		}
+		resumed, sendingData = resumeMails(sendingData, entries)
+		logging.Infof("Resuming campaign %s, skipping %d targets which were sent the mail", c.ID, len(resumed))
+	}
+
+	if c.DryRun {
+		return c.dryRun(ctx, sendingData)
+	}
+
+	if err := opts.General.waitForStart(ctx); err != nil {
+		return fmt.Errorf("Run: %v", err)
+	}
+	start = time.Now()
+
+	events := notify.NewDispatcher(opts.Notifiers()...)
+	defer events.Close()
+	events.Notify(campaignEvent(notify.CampaignStarted, c.ID, sendingData))
+
+	var poller *modlishkaPoller
+	if opts.Modlishka.URL != "" {
+		interval, _ := opts.Modlishka.interval()
+		poller = newModlishkaPoller(opts.Modlishka)
+		pollCtx, stopPolling := context.WithCancel(ctx)
+		defer stopPolling()
+		go poller.run(pollCtx, interval)
+		logging.Infof("Polling Modlishka at %s every %s", opts.Modlishka.URL, interval)
+	}
+
+	var mailbox *imapPoller
+	if opts.IMAP.Host != "" {
+		interval, _ := opts.IMAP.interval()
+		mailbox, err = newIMAPPoller(opts, start)
+		if err != nil {
+			return fmt.Errorf("Run: %v", err)
+		}
+		pollCtx, stopPolling := context.WithCancel(ctx)
+		defer stopPolling()
+		go mailbox.run(pollCtx, interval)
+		logging.Infof("Polling %s of %s every %s for bounces and replies", opts.IMAP.mailbox(), opts.IMAP.Host, interval)
+	}
+
+	var sendErr error
+	if opts.Slack.Token != "" {
+		logging.Infof("Sending Slack direct messages instead of the mails")
+		sendErr = sendSlack(ctx, sendingData, opts)
+	} else if !opts.SMS.Only {
+		if c.EMLDir != "" {
+			if err := os.MkdirAll(c.EMLDir, 0700); err != nil {
+				return fmt.Errorf("Run: %v", err)
+			}
+			logging.Infof("Saving sent mails into \"%s\"", c.EMLDir)
+		}
+
+		logging.Infof("Starting to send the mails. Hope for the best")
+
+		sender, err := newSender(opts, c.ID)
+		if err != nil {
+			return fmt.Errorf("Run: %v", err)
+		}
+		defer sender.close()
+
+		cp, err := openCheckpoint(checkpointFile, c.ID)
+		if err != nil {
+			return fmt.Errorf("Run: %v", err)
+		}
+		defer cp.close()
+
+		rec := recorders{cp, &eventRecorder{
+			campaign: c.ID,
+			events:   events,
+			total:    len(sendingData),
+			progress: opts.Notifications.Progress,
+		}}
+		sendErr = sendEmails(ctx, sendingData, opts, sender, c.EMLDir, rec)
+		var authErr *ErrSMTPAuth
+		if errors.As(sendErr, &authErr) {
+			return sendErr
+		}
+	}
+
+	if opts.SMS.Provider != "" && sendErr == nil {
+		logging.Infof("Sending SMS through %s from %s", opts.SMS.Provider, opts.SMS.From)
+		sendErr = sendSMS(ctx, sendingData, opts)
+	}
+
+	if opts.Voice.Enabled && sendErr == nil {
+		logging.Infof("Calling targets from %s", opts.Voice.From)
+		sendErr = sendCalls(ctx, sendingData, opts)
+	}
+
+	end := time.Now()
+	logging.Infof("Finished sending mails at %s (%s)", end.Format(timeFormat), end.Sub(start))
+
+	res := Result{
+		ID:           c.ID,
+		StartTime:    start.Format(timeFormat),
+		EndTime:      end.Format(timeFormat),
+		Notes:        opts.Notes,
+		Subject:      opts.Mail.Subject,
+		From:         opts.From(),
+		AttackerName: opts.Mail.Name,
+		URL:          opts.Url.Link,
+		Custom:       opts.Mail.Custom,
+		Targets:      append(resumed, sendingData...),
+	}
+
+	if c.SimulateClicks > 0 {
+		res.Clicks = simulateClicks(res.Targets, c.SimulateClicks, c.Seed, end)
+		logging.Infof("Simulated %d clicks", len(res.Clicks))
+	}
+
+	res.Variants = variantResults(opts.Attack.Variants, opts, res.Targets, res.Clicks)
+
+	if poller != nil {
+		poller.poll(ctx)
+		res.addModlishka(poller.snapshot())
+	}
+
+	if mailbox != nil {
+		mailbox.poll(ctx)
+		mailbox.update(&res)
+	}
+
+	if err := c.writeReport(output, &res); err != nil {
+		if sendErr != nil {
+			logging.Errorf("Error sending mails: %v", sendErr)
+		}
+		return err
+	}
+	events.Notify(campaignEvent(notify.CampaignFinished, c.ID, sendingData))
+
+	if _, err := os.Stat(checkpointFile); err == nil {
+		if sendErr == nil && allSent(sendingData) {
+			if err := os.Remove(checkpointFile); err != nil {
+				logging.Warningf("Error removing checkpoint: %v", err)
+			}
+		} else {
+			logging.Infof("Not all mails were sent, continue with --resume \"%s\"", checkpointFile)
+		}
+	}
+
+	var followers []follower
+	if poller != nil {
+		interval, _ := opts.Modlishka.interval()
+		wait, _ := opts.Modlishka.wait()
+		followers = append(followers, follower{
+			name:     "Modlishka",
+			wait:     wait,
+			interval: interval,
+			found:    "Modlishka captured credentials of %d targets",
+			update: func(res *Result) int {
+				return res.addModlishka(poller.snapshot())
+			},
+		})
+	}
+	if mailbox != nil {
+		interval, _ := opts.IMAP.interval()
+		wait, _ := opts.IMAP.wait()
+		followers = append(followers, follower{
+			name:     "IMAP mailbox",
+			wait:     wait,
+			interval: interval,
+			found:    "Found %d bounces, replies or read receipts",
+			update:   mailbox.update,
+		})
+	}
+	write := func(res *Result) error {
+		return c.writeReport(output, res)
+	}
+	if err := follow(ctx, followers, &res, write); err != nil {
+		logging.Errorf("Error updating report with polled results: %v", err)
+	}
+
+	return sendErr
+}
+
+// writeReport saves the report to output, and the HTML report next to it
+// if it is enabled
+func (c *Campaign) writeReport(output string, res *Result) error {
+	if err := WriteReport(output, c.ReportTemplate, c.Format, res); err != nil {
+		return err
+	}
+	if c.HTMLReport && c.Format != "html" {
+		return WriteReport(output+".html", "", "html", res)
+	}
+	return nil
+}
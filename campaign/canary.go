@@ -0,0 +1,125 @@
+package campaign
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// canarytokensURL creates new tokens at canarytokens.org
+const canarytokensURL = "https://canarytokens.org/generate"
+
+// canaryKey is the config key holding the token. It is not read by
+// lateralus, the name only has to make the URL worth opening.
+const canaryKey = "dashboard"
+
+// CreateCanaryToken registers web bug token at canarytokens.org and returns
+// its URL. Requesting the URL sends an alert to alertTo, which is either
+// email address or webhook URL.
+func CreateCanaryToken(memo, alertTo string) (string, error) {
+	form := url.Values{
+		"token_type": {"web"},
+		"memo":       {memo},
+	}
+	if strings.HasPrefix(alertTo, "http://") || strings.HasPrefix(alertTo, "https://") {
+		form.Set("webhook_url", alertTo)
+	} else if strings.Contains(alertTo, "@") {
+		form.Set("email", alertTo)
+	} else {
+		return "", fmt.Errorf("CreateCanaryToken: %q is neither email address nor webhook URL", alertTo)
+	}
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.PostForm(canarytokensURL, form)
+	if err != nil {
+		return "", fmt.Errorf("CreateCanaryToken: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var res struct {
+		TokenURL     string `json:"token_url"`
+		Error        string `json:"error"`
+		ErrorMessage string `json:"error_message"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return "", fmt.Errorf("CreateCanaryToken: %s: %v", resp.Status, err)
+	}
+
+	if resp.StatusCode != http.StatusOK || res.TokenURL == "" {
+		msg := res.ErrorMessage
+		if msg == "" {
+			msg = res.Error
+		}
+		return "", fmt.Errorf("CreateCanaryToken: %s: %s", resp.Status, msg)
+	}
+
+	return res.TokenURL, nil
+}
+
+// AddCanaryToken appends the token URL to the config under a key which
+// looks like monitoring dashboard. The rest of the config is kept as is.
+func AddCanaryToken(d []byte, tokenURL string) ([]byte, error) {
+	var keys map[string]interface{}
+	if err := yaml.Unmarshal(d, &keys); err != nil {
+		return nil, fmt.Errorf("AddCanaryToken: %v", err)
+	}
+	if _, ok := keys[canaryKey]; ok {
+		return nil, fmt.Errorf("AddCanaryToken: config already has %s key", canaryKey)
+	}
+
+	var buf bytes.Buffer
+	buf.Write(d)
+	if len(d) > 0 && !bytes.HasSuffix(d, []byte("\n")) {
+		buf.WriteByte('\n')
+	}
+	fmt.Fprintf(&buf, "\n# relay monitoring, credentials are the mailServer ones\n%s: %s\n", canaryKey, tokenURL)
+
+	return buf.Bytes(), nil
+}
+
+// GenerateCanaryToken creates canarytokens.org token alerting alertTo and
+// adds it to the config file. Anyone who gets hold of the config and opens
+// the URL triggers the alert.
+func GenerateCanaryToken(filename, alertTo string) (string, error) {
+	d, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "", fmt.Errorf("GenerateCanaryToken: %v", err)
+	}
+	if len(bytes.TrimSpace(d)) == 0 {
+		return "", errors.New("GenerateCanaryToken: config is empty")
+	}
+
+	// check the config before the token is created
+	if _, err := AddCanaryToken(d, ""); err != nil {
+		return "", fmt.Errorf("GenerateCanaryToken: %v", err)
+	}
+
+	tokenURL, err := CreateCanaryToken("lateralus config "+filename, alertTo)
+	if err != nil {
+		return "", fmt.Errorf("GenerateCanaryToken: %v", err)
+	}
+
+	out, err := AddCanaryToken(d, tokenURL)
+	if err != nil {
+		return "", fmt.Errorf("GenerateCanaryToken: %v", err)
+	}
+
+	info, err := os.Stat(filename)
+	if err != nil {
+		return "", fmt.Errorf("GenerateCanaryToken: %v", err)
+	}
+	if err := ioutil.WriteFile(filename, out, info.Mode()); err != nil {
+		return "", fmt.Errorf("GenerateCanaryToken: %v", err)
+	}
+
+	return tokenURL, nil
+}
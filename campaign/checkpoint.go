@@ -0,0 +1,152 @@
+package campaign
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/lateralusd/lateralus/logging"
+)
+
+// checkpointEntry is single line of the checkpoint file, it is written
+// once the mail server accepted or rejected the mail for the target
+type checkpointEntry struct {
+	Campaign     string `json:"campaign"`
+	Email        string `json:"email"`
+	ID           string `json:"id"`
+	URL          string `json:"url"`
+	TrackingHost string `json:"trackingHost,omitempty"`
+	Variant      string `json:"variant,omitempty"`
+	Server       string `json:"server,omitempty"`
+	Status       string `json:"status"`
+	Attempts     int    `json:"attempts"`
+	SendError    string `json:"error,omitempty"`
+	MessageID    string `json:"messageId,omitempty"`
+	SentTime     string `json:"sentTime,omitempty"`
+}
+
+// checkpoint appends state of every processed target to a file, so that
+// interrupted campaign can be resumed
+type checkpoint struct {
+	campaign string
+	f        *os.File
+}
+
+func openCheckpoint(filename, campaignID string) (*checkpoint, error) {
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("openCheckpoint: %v", err)
+	}
+	return &checkpoint{campaign: campaignID, f: f}, nil
+}
+
+// record saves the state of mails, failures are only logged so that the
+// campaign is not interrupted
+func (c *checkpoint) record(mails []SendingMail) {
+	if c == nil {
+		return
+	}
+
+	enc := json.NewEncoder(c.f)
+	for _, m := range mails {
+		err := enc.Encode(checkpointEntry{
+			Campaign:     c.campaign,
+			Email:        m.Email,
+			ID:           m.ID,
+			URL:          m.URL,
+			TrackingHost: m.TrackingHost,
+			Variant:      m.Variant,
+			Server:       m.Server,
+			Status:       m.Status,
+			Attempts:     m.Attempts,
+			SendError:    m.SendError,
+			MessageID:    m.MessageID,
+			SentTime:     m.SentTime,
+		})
+		if err != nil {
+			logging.Errorf("Error writing checkpoint for %s: %v", m.Email, err)
+		}
+	}
+
+	if err := c.f.Sync(); err != nil {
+		logging.Errorf("Error writing checkpoint: %v", err)
+	}
+}
+
+func (c *checkpoint) close() {
+	if c != nil {
+		c.f.Close()
+	}
+}
+
+// readCheckpoint returns the last state of every target in the checkpoint
+// file keyed by email, together with the campaign id
+func readCheckpoint(filename string) (map[string]checkpointEntry, string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, "", fmt.Errorf("readCheckpoint: %v", err)
+	}
+	defer f.Close()
+
+	entries := make(map[string]checkpointEntry)
+	campaignID := ""
+	s := bufio.NewScanner(f)
+	for line := 1; s.Scan(); line++ {
+		if strings.TrimSpace(s.Text()) == "" {
+			continue
+		}
+		var e checkpointEntry
+		if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+			// the last line may be cut short when the campaign was killed
+			logging.Warningf("Skipping line %d of checkpoint \"%s\": %v", line, filename, err)
+			continue
+		}
+		if campaignID != "" && e.Campaign != campaignID {
+			return nil, "", fmt.Errorf("readCheckpoint: line %d belongs to campaign %s, not %s", line, e.Campaign, campaignID)
+		}
+		campaignID = e.Campaign
+		entries[strings.ToLower(e.Email)] = e
+	}
+	if err := s.Err(); err != nil {
+		return nil, "", fmt.Errorf("readCheckpoint: %v", err)
+	}
+
+	return entries, campaignID, nil
+}
+
+// resumeMails splits mails into the ones sent according to entries, with
+// their state restored, and the ones still to be sent
+func resumeMails(mails []SendingMail, entries map[string]checkpointEntry) (sent, pending []SendingMail) {
+	for _, m := range mails {
+		e, ok := entries[strings.ToLower(m.Email)]
+		if !ok || e.Status != MailSent {
+			pending = append(pending, m)
+			continue
+		}
+		m.PixelURL = strings.Replace(m.PixelURL, m.ID, e.ID, 1)
+		m.ID = e.ID
+		m.URL = e.URL
+		m.TrackingHost = e.TrackingHost
+		if e.Variant != "" {
+			m.Variant = e.Variant
+		}
+		m.Server = e.Server
+		m.Status = e.Status
+		m.Attempts = e.Attempts
+		m.MessageID = e.MessageID
+		m.SentTime = e.SentTime
+		sent = append(sent, m)
+	}
+	return sent, pending
+}
+
+func allSent(mails []SendingMail) bool {
+	for _, m := range mails {
+		if m.Status != MailSent {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,100 @@
+package campaign
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckpointResume(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "checkpoint.jsonl")
+	c, err := openCheckpoint(filename, "q3")
+	if err != nil {
+		t.Fatalf("openCheckpoint() error = %v", err)
+	}
+	c.record([]SendingMail{
+		{Target: Target{Email: "john@example.com"}, ID: "id1", URL: "https://phish.example.com/?id=tok1", Server: "smtp.example.com", Status: MailSent, Attempts: 1, MessageID: "<1@example.com>", SentTime: "2026-10-12 09:00:00"},
+		{Target: Target{Email: "jane@example.com"}, ID: "id2", Status: MailFailed, Attempts: 3, SendError: "550 No such user"},
+		{Target: Target{Email: "max@example.com"}, ID: "id3", Status: MailFailed},
+	})
+	c.close()
+
+	// the campaign was killed in the middle of writing, then resumed and
+	// sent the mail to max
+	f, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"campaign":"q3","email":"jane@exa` + "\n\n")
+	f.Close()
+	c, err = openCheckpoint(filename, "q3")
+	if err != nil {
+		t.Fatalf("openCheckpoint() error = %v", err)
+	}
+	c.record([]SendingMail{{Target: Target{Email: "Max@example.com"}, ID: "id4", Variant: "b", Status: MailSent, Attempts: 2}})
+	c.close()
+
+	entries, campaignID, err := readCheckpoint(filename)
+	if err != nil {
+		t.Fatalf("readCheckpoint() error = %v", err)
+	}
+	if campaignID != "q3" || len(entries) != 3 {
+		t.Fatalf("readCheckpoint() = %d entries of %q, want 3 of q3", len(entries), campaignID)
+	}
+
+	// the targets get new ids when the campaign is resumed
+	mails := []SendingMail{
+		{Target: Target{Email: "JOHN@example.com"}, ID: "new1", PixelURL: "https://track.example.com/o/new1.gif"},
+		{Target: Target{Email: "jane@example.com"}, ID: "new2"},
+		{Target: Target{Email: "max@example.com"}, ID: "new3", Variant: "a"},
+		{Target: Target{Email: "anna@example.com"}, ID: "new4"},
+	}
+	sent, pending := resumeMails(mails, entries)
+	if len(sent) != 2 || len(pending) != 2 {
+		t.Fatalf("resumeMails() = %d sent, %d pending, want 2 and 2", len(sent), len(pending))
+	}
+
+	john := sent[0]
+	if john.ID != "id1" || john.URL != "https://phish.example.com/?id=tok1" || john.PixelURL != "https://track.example.com/o/id1.gif" {
+		t.Errorf("john has id %s, url %s, pixel %s, want the ones sent before", john.ID, john.URL, john.PixelURL)
+	}
+	if john.Status != MailSent || john.Server != "smtp.example.com" || john.MessageID != "<1@example.com>" || john.SentTime != "2026-10-12 09:00:00" {
+		t.Errorf("john = %+v, want the state of the sent mail", john)
+	}
+	if max := sent[1]; max.ID != "id4" || max.Variant != "b" || max.Attempts != 2 {
+		t.Errorf("max = %+v, want id4 with variant b after 2 attempts", max)
+	}
+	// failed mails are sent again with new ids
+	if pending[0].Email != "jane@example.com" || pending[0].ID != "new2" || pending[1].Email != "anna@example.com" {
+		t.Errorf("pending = %+v, want jane and anna", pending)
+	}
+
+	if allSent(mails) || !allSent(sent) {
+		t.Errorf("allSent() is wrong")
+	}
+}
+
+func TestReadCheckpointErrors(t *testing.T) {
+	dir := t.TempDir()
+	if _, _, err := readCheckpoint(filepath.Join(dir, "missing.jsonl")); err == nil {
+		t.Errorf("readCheckpoint() of missing file error = nil, want error")
+	}
+
+	filename := filepath.Join(dir, "checkpoint.jsonl")
+	content := `{"campaign":"q3","email":"john@example.com","status":"sent"}
+{"campaign":"q4","email":"jane@example.com","status":"sent"}
+`
+	if err := ioutil.WriteFile(filename, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := readCheckpoint(filename); err == nil {
+		t.Errorf("readCheckpoint() of two campaigns error = nil, want error")
+	}
+}
+
+func TestCheckpointNil(t *testing.T) {
+	var c *checkpoint
+	c.record([]SendingMail{{Status: MailSent}})
+	c.close()
+}
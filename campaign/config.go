@@ -0,0 +1,361 @@
+package campaign
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// Options struct holds all options inside of it
+type Options struct {
+	Mail        Mail        `yaml:"mail"`
+	Attack      Attack      `yaml:"attack"`
+	MailServers MailServers `yaml:"mailServer"`
+	Url         Url         `yaml:"url"`
+	General     General     `yaml:"general"`
+	SMS         SMS         `yaml:"sms"`
+	Voice       Voice       `yaml:"voice"`
+	Slack       Slack       `yaml:"slack"`
+	Tracking    Tracking    `yaml:"tracking"`
+	Landing     Landing     `yaml:"landing"`
+	Webhook     Webhook     `yaml:"webhook"`
+	// Provider replaces MailServers with API of mail provider
+	Provider Provider `yaml:"provider"`
+	// Notifications post progress of the campaign to chat channels
+	Notifications Notifications `yaml:"notifications"`
+	// Modlishka is polled for credentials captured from the targets
+	Modlishka Modlishka `yaml:"modlishka"`
+	// IMAP mailbox of the sender is polled for bounces and replies
+	IMAP IMAP `yaml:"imap"`
+	// Proxy is socks5:// or http:// URL all mail servers, mail providers
+	// and webhooks are connected to through
+	Proxy string `yaml:"proxy"`
+	// Notes about the engagement, e.g. scope limitations, shown in the report
+	Notes     string `yaml:"notes"`
+	Signature string `yaml:"signature" json:"-"`
+
+	// TargetList holds targets provided programmatically, if it is empty
+	// targets are parsed from Attack.Targets file
+	TargetList []Target `yaml:"-" json:"-"`
+}
+
+// Mail struct holds information that will be used to populate mails
+type Mail struct {
+	Name     string `yaml:"name"`
+	From     string `yaml:"from"`
+	Subject  string `yaml:"subject"`
+	Custom   string `yaml:"custom"`
+	Priority string `yaml:"priority"`
+	ReplyTo  string `yaml:"replyTo"`
+	// Address used in From header, defaults to username of the first mail server
+	Address string `yaml:"address"`
+	// EnvelopeFrom is used in MAIL FROM and receives the bounces, defaults
+	// to the From address
+	EnvelopeFrom string `yaml:"envelopeFrom"`
+	// VERPDomain enables per target envelope sender bounce+<id>@VERPDomain
+	VERPDomain string `yaml:"verpDomain"`
+	// ListID is used for List-Id header, e.g. campaign.example.com
+	ListID string `yaml:"listId"`
+	// Precedence is bulk (default), list, junk or none
+	Precedence string `yaml:"precedence"`
+	DSN        DSN    `yaml:"dsn"`
+	DKIM       DKIM   `yaml:"dkim"`
+	// Headers are added to every mail
+	Headers map[string]string `yaml:"headers"`
+	// ReadReceipt is the address read receipts are requested to, it can
+	// use template fields, e.g. receipts+{{.ID}}@example.com
+	ReadReceipt string `yaml:"readReceipt"`
+
+	Charset          string `yaml:"charset"`
+	TransferEncoding string `yaml:"transferEncoding"`
+	ContentType      string `yaml:"contentType"`
+	// DataURIImages embeds <img src="file://..."> images as data: URIs
+	DataURIImages bool `yaml:"dataURIImages"`
+	// InlineImages maps content ids to image files, HTML body references
+	// them as <img src="cid:logo">
+	InlineImages map[string]string `yaml:"inlineImages"`
+	// NormalizeWhitespace collapses repeated spaces and trims lines of the
+	// rendered body
+	NormalizeWhitespace bool `yaml:"normalizeWhitespace"`
+}
+
+// DSN struct requests delivery status notifications from servers which
+// support them
+type DSN struct {
+	// Notify is list of success, failure, delay or never
+	Notify []string `yaml:"notify"`
+	// Return is hdrs or full
+	Return string `yaml:"return"`
+}
+
+// Attack struct holds template targets and mail template used to send mails
+type Attack struct {
+	Targets  string `yaml:"targets"`
+	Template string `yaml:"template"`
+	// TextTemplate is plain text alternative of HTML Template, both are
+	// sent as multipart/alternative
+	TextTemplate string `yaml:"textTemplate"`
+	// Body is used as the template text instead of reading Template file,
+	// e.g. when the lure is taken from EML file
+	Body string `yaml:"-"`
+	// TextBody is used instead of reading TextTemplate file
+	TextBody string `yaml:"-"`
+	// Attachments are files attached to every mail
+	Attachments []string `yaml:"attachments"`
+	// Variants split the targets between several lures
+	Variants []Variant `yaml:"variants"`
+	// Validation checks the target addresses before sending
+	Validation TargetValidation `yaml:"validation"`
+	// KeepDuplicates sends to every row of the same address, by default
+	// only the first one is kept
+	KeepDuplicates bool `yaml:"keepDuplicates"`
+	// Sheet of .xlsx targets file, the first one by default
+	Sheet string `yaml:"sheet"`
+	// Columns maps fields, e.g. email or any template field, to the header
+	// columns they are read from
+	Columns map[string]string `yaml:"columns"`
+	// IncludeTags selects only the targets with any of the tags, from tags
+	// or group column, and ExcludeTags drops the targets with any of them
+	IncludeTags []string `yaml:"includeTags"`
+	ExcludeTags []string `yaml:"excludeTags"`
+	// LDAP directory the targets are read from instead of targets file
+	LDAP LDAP `yaml:"ldap"`
+}
+
+// MailServer struct holds information needed for mail server loging
+type MailServer struct {
+	Encryption string `yaml:"encryption"`
+	Host       string `yaml:"host"`
+	Port       int    `yaml:"port"`
+	Username   string `yaml:"username"`
+	Password   string `yaml:"password"`
+	MaxBackoff string `yaml:"maxBackoff"`
+	// MessagesPerConnection is how many messages are sent before
+	// reconnecting, 0 keeps the connection for the whole campaign
+	MessagesPerConnection int `yaml:"messagesPerConnection"`
+	// Quota is the maximum number of mails sent through the server, after
+	// which the next one is used, 0 means no limit
+	Quota int `yaml:"quota"`
+	// OAuth authenticates with XOAUTH2 instead of the password
+	OAuth *OAuth `yaml:"oauth"`
+	TLS   TLS    `yaml:"tls"`
+}
+
+// MailServers holds one or more mail servers, the first one is used while it
+// works and the others are failed over to. In yaml config it can be either
+// single server or a list of them.
+type MailServers []MailServer
+
+// UnmarshalYAML accepts both single server and list of servers
+func (m *MailServers) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var single MailServer
+	if err := unmarshal(&single); err == nil {
+		*m = MailServers{single}
+		return nil
+	}
+
+	var list []MailServer
+	if err := unmarshal(&list); err != nil {
+		return err
+	}
+	*m = list
+	return nil
+}
+
+// Primary returns the first configured server
+func (m MailServers) Primary() MailServer {
+	if len(m) == 0 {
+		return MailServer{}
+	}
+	return m[0]
+}
+
+func (m MailServer) maxBackoff() (time.Duration, error) {
+	if m.MaxBackoff == "" {
+		return defaultMaxBackoff, nil
+	}
+	return time.ParseDuration(m.MaxBackoff)
+}
+
+// Url struct holds information for mail generation
+type Url struct {
+	Generate bool   `yaml:"generate"`
+	Link     string `yaml:"link"`
+	Length   int    `yaml:"length"`
+	// Hosts replace the host of Link, targets get them in turns
+	Hosts []string `yaml:"hosts"`
+	// Lures are URLs exported from Evilginx2, they replace Link for the
+	// targets
+	Lures string `yaml:"lures"`
+}
+
+// General struct holds general information
+type General struct {
+	Bulk      bool   `yaml:"bulk"`
+	BulkDelay int    `yaml:"bulkDelay"`
+	BulkSize  int    `yaml:"bulkSize"`
+	Delay     int    `yaml:"delay"`
+	Separator string `yaml:"separator"`
+	Bcc       bool   `yaml:"bcc"`
+	// DelayMin and DelayMax replace Delay with random number of seconds
+	// between them, so the mails do not go out in fixed cadence
+	DelayMin int `yaml:"delayMin"`
+	DelayMax int `yaml:"delayMax"`
+	// Rate is the number of mails per minute, or per unit, e.g. 30/h
+	Rate string `yaml:"rate"`
+	// Burst is how many mails can be sent at once within the rate, 1 by default
+	Burst int `yaml:"burst"`
+
+	RecipientsPerMessage int `yaml:"recipientsPerMessage"`
+	// ThrottleByDomain limits mails per recipient domain per minute
+	ThrottleByDomain int   `yaml:"throttleByDomain"`
+	Retry            Retry `yaml:"retry"`
+	// Rotation of multiple mail servers, failover (default) or roundrobin
+	Rotation string `yaml:"rotation"`
+	// StartAt delays sending until the time, e.g. 2021-06-01 09:00
+	StartAt string `yaml:"startAt"`
+	// Window limits sending to part of the week, e.g. Mon-Fri 09:00-17:00
+	Window string `yaml:"window"`
+	// Timezone of StartAt, Window and of the targets without timezone,
+	// local by default
+	Timezone string `yaml:"timezone"`
+	// DeliverAt is the local time of every target the mail is sent at,
+	// e.g. 09:30
+	DeliverAt string `yaml:"deliverAt"`
+}
+
+// Retry struct configures resending of the mails which were rejected
+// temporarily with 4xx reply
+type Retry struct {
+	// Attempts is the maximum number of attempts per mail, 1 by default
+	Attempts int `yaml:"attempts"`
+	// Backoff is the wait before the second attempt, it is doubled for
+	// every next one
+	Backoff string `yaml:"backoff"`
+}
+
+func (r Retry) attempts() int {
+	if r.Attempts < 1 {
+		return 1
+	}
+	return r.Attempts
+}
+
+func (r Retry) backoff() (time.Duration, error) {
+	if r.Backoff == "" {
+		return defaultRetryBackoff, nil
+	}
+	return time.ParseDuration(r.Backoff)
+}
+
+// SMS struct holds information needed to send SMS to targets with phone number
+type SMS struct {
+	// Provider is twilio or bandwidth, SMS are not sent if it is empty
+	Provider string `yaml:"provider"`
+	// From is the sending number in E.164 format, e.g. +15551234567
+	From     string `yaml:"from"`
+	Template string `yaml:"template"`
+	// Account is Twilio Account SID or Bandwidth account id
+	Account string `yaml:"account"`
+	// Application is Bandwidth messaging application id
+	Application string `yaml:"application"`
+	// Username defaults to Account for Twilio
+	Username string `yaml:"username"`
+	// Password is Twilio auth token or Bandwidth API password
+	Password string `yaml:"password"`
+	// Endpoint replaces the provider API url, e.g. regional Twilio endpoint
+	Endpoint string `yaml:"endpoint"`
+	// Only sends SMS without the mails
+	Only bool `yaml:"only"`
+}
+
+// Voice struct holds information needed to call targets with phone number
+// through Twilio
+type Voice struct {
+	Enabled bool `yaml:"enabled"`
+	// From is the calling number in E.164 format, e.g. +15551234567
+	From string `yaml:"from"`
+	// TwiMLURL serves the instructions for the call, e.g. text to say
+	TwiMLURL string `yaml:"twimlUrl"`
+	// Account is Twilio Account SID
+	Account string `yaml:"account"`
+	// Username defaults to Account
+	Username string `yaml:"username"`
+	// Password is Twilio auth token
+	Password string `yaml:"password"`
+	Endpoint string `yaml:"endpoint"`
+}
+
+// Slack struct holds information needed to send Slack direct messages
+// instead of the mails
+type Slack struct {
+	// Token of the bot with users:read.email and chat:write scopes, messages
+	// are sent instead of mails when it is set
+	Token string `yaml:"token"`
+	// Mode is dm, the only supported one
+	Mode string `yaml:"mode"`
+	// Template replaces attack.template for the messages
+	Template string `yaml:"template"`
+	Endpoint string `yaml:"endpoint"`
+}
+
+// ParseConfig reads yaml config, or toml config if filename ends with
+// .toml, from filename and validates it
+func ParseConfig(filename string) (*Options, error) {
+	opts := &Options{}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return &Options{}, &ErrInvalidConfig{Path: filename, Reason: err.Error()}
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if IsTOML(filename) {
+		if r, err = tomlToYAML(f); err != nil {
+			return &Options{}, &ErrInvalidConfig{Path: filename, Reason: err.Error()}
+		}
+	}
+
+	d := yaml.NewDecoder(r)
+
+	if err := d.Decode(&opts); err != nil {
+		return &Options{}, &ErrInvalidConfig{Path: filename, Reason: err.Error()}
+	}
+
+	if err := opts.Validate(); err != nil {
+		var cfgErr *ErrInvalidConfig
+		if errors.As(err, &cfgErr) {
+			cfgErr.Path = filename
+		}
+		return &Options{}, err
+	}
+
+	return opts, nil
+}
+
+// IsTOML reports whether config is in toml format, judging by its extension
+func IsTOML(filename string) bool {
+	return strings.EqualFold(filepath.Ext(filename), ".toml")
+}
+
+// tomlToYAML converts toml config to yaml, so that it is decoded with the
+// same field names and defaults as yaml one
+func tomlToYAML(r io.Reader) (io.Reader, error) {
+	var doc map[string]interface{}
+	if _, err := toml.DecodeReader(r, &doc); err != nil {
+		return nil, err
+	}
+	d, err := yaml.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(d), nil
+}
@@ -0,0 +1,452 @@
+package campaign
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+const testConfig = `
+url:
+  generate: True
+  link: "https://phish.example.com/?id=<CHANGE>"
+  length: 8
+mail:
+  name: Attacker
+  subject: Hello
+attack:
+  targets: targets.csv
+  template: template.html
+mailServer:
+  host: smtp.example.com
+  port: 587
+  username: attacker@example.com
+  encryption: starttls
+general:
+  delay: 5
+  separator: ","
+`
+
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(filename, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func TestParseConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		// field is the invalid field, "" for config which is valid, "-"
+		// for config which cannot be read at all
+		field string
+	}{
+		{
+			name:    "valid yaml",
+			file:    "config.yaml",
+			content: testConfig,
+		},
+		{
+			name: "list of mail servers",
+			file: "config.yaml",
+			content: `
+mailServer:
+  - host: smtp.example.com
+    port: 587
+  - host: smtp.backup.example.com
+    port: 465
+    encryption: ssl
+`,
+		},
+		{
+			name: "single url",
+			file: "config.yaml",
+			content: `
+url:
+  generate: False
+  link: https://phish.example.com/login
+`,
+		},
+		{
+			name: "valid toml",
+			file: "config.toml",
+			content: `
+[url]
+generate = true
+link = "https://phish.example.com/?id=<CHANGE>"
+
+[[mailServer]]
+host = "smtp.example.com"
+port = 587
+encryption = "starttls"
+`,
+		},
+		{
+			name:    "empty",
+			file:    "config.yaml",
+			content: "",
+			field:   "-",
+		},
+		{
+			name:    "yaml syntax error",
+			file:    "config.yaml",
+			content: "mail:\n  name: [Attacker\n",
+			field:   "-",
+		},
+		{
+			name:    "toml syntax error",
+			file:    "config.toml",
+			content: "[mail\nname = \"Attacker\"\n",
+			field:   "-",
+		},
+		{
+			name:    "yaml read as toml",
+			file:    "config.toml",
+			content: testConfig,
+			field:   "-",
+		},
+		{
+			name:    "generated url without placeholder",
+			file:    "config.yaml",
+			content: "url:\n  generate: True\n  link: https://phish.example.com/?id=\n",
+			field:   "url.link",
+		},
+		{
+			name:    "unknown encryption",
+			file:    "config.yaml",
+			content: "mailServer:\n  host: smtp.example.com\n  encryption: tls1.3\n",
+			field:   "mailServer.encryption",
+		},
+		{
+			name:    "unknown encryption of second server",
+			file:    "config.yaml",
+			content: "mailServer:\n  - host: smtp.example.com\n  - host: smtp.backup.example.com\n    encryption: tls1.3\n",
+			field:   "mailServer.encryption",
+		},
+		{
+			name:    "invalid max backoff",
+			file:    "config.yaml",
+			content: "mailServer:\n  host: smtp.example.com\n  maxBackoff: soon\n",
+			field:   "mailServer.maxBackoff",
+		},
+		{
+			name:    "invalid from address",
+			file:    "config.yaml",
+			content: "mailServer:\n  username: not an address\n",
+			field:   "mailServer.username",
+		},
+		{
+			name:    "invalid from address in toml",
+			file:    "config.toml",
+			content: "[mail]\naddress = \"not an address\"\n",
+			field:   "mail.address",
+		},
+		{
+			name:    "unknown priority",
+			file:    "config.yaml",
+			content: "mail:\n  priority: urgent\n",
+			field:   "mail.priority",
+		},
+		{
+			name:    "rate with delay",
+			file:    "config.yaml",
+			content: "general:\n  rate: 10/m\n  delay: 5\n",
+			field:   "general",
+		},
+		{
+			name:    "sheet of csv",
+			file:    "config.yaml",
+			content: "attack:\n  targets: targets.csv\n  sheet: Staff\n",
+			field:   "attack.sheet",
+		},
+		{
+			name:    "ldap and targets file",
+			file:    "config.yaml",
+			content: "attack:\n  targets: targets.csv\n  ldap:\n    host: dc.example.com\n    baseDN: DC=example,DC=com\n",
+			field:   "attack.ldap",
+		},
+		{
+			name:    "empty tag",
+			file:    "config.yaml",
+			content: "attack:\n  includeTags: [finance, \" \"]\n",
+			field:   "attack.includeTags",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filename := writeConfig(t, tt.file, tt.content)
+			opts, err := ParseConfig(filename)
+
+			if tt.field == "" {
+				if err != nil {
+					t.Fatalf("ParseConfig() error = %v", err)
+				}
+				if opts.MailServers.Primary().Host == "" && opts.Url.Link == "" {
+					t.Errorf("ParseConfig() returned empty options")
+				}
+				return
+			}
+
+			var cfgErr *ErrInvalidConfig
+			if !errors.As(err, &cfgErr) {
+				t.Fatalf("ParseConfig() error = %v, want ErrInvalidConfig", err)
+			}
+			if cfgErr.Path != filename {
+				t.Errorf("ParseConfig() error path = %q, want %q", cfgErr.Path, filename)
+			}
+			if tt.field != "-" && cfgErr.Field != tt.field {
+				t.Errorf("ParseConfig() error field = %q, want %q (%v)", cfgErr.Field, tt.field, err)
+			}
+		})
+	}
+}
+
+func TestParseConfigValues(t *testing.T) {
+	for _, name := range []string{"config.yaml", "config.toml"} {
+		t.Run(name, func(t *testing.T) {
+			content := testConfig
+			if IsTOML(name) {
+				content = `
+[url]
+generate = true
+link = "https://phish.example.com/?id=<CHANGE>"
+length = 8
+
+[mail]
+name = "Attacker"
+subject = "Hello"
+
+[attack]
+targets = "targets.csv"
+template = "template.html"
+
+[mailServer]
+host = "smtp.example.com"
+port = 587
+username = "attacker@example.com"
+encryption = "starttls"
+
+[general]
+delay = 5
+separator = ","
+`
+			}
+
+			opts, err := ParseConfig(writeConfig(t, name, content))
+			if err != nil {
+				t.Fatalf("ParseConfig() error = %v", err)
+			}
+
+			if !opts.Url.Generate || opts.Url.Link != "https://phish.example.com/?id=<CHANGE>" || opts.Url.Length != 8 {
+				t.Errorf("url = %+v", opts.Url)
+			}
+			if opts.Mail.Name != "Attacker" || opts.Mail.Subject != "Hello" {
+				t.Errorf("mail = %+v", opts.Mail)
+			}
+			if opts.Attack.Targets != "targets.csv" || opts.Attack.Template != "template.html" {
+				t.Errorf("attack = %+v", opts.Attack)
+			}
+			if len(opts.MailServers) != 1 {
+				t.Fatalf("got %d mail servers, want 1", len(opts.MailServers))
+			}
+			s := opts.MailServers[0]
+			if s.Host != "smtp.example.com" || s.Port != 587 || s.Encryption != encryptionSTARTTLS {
+				t.Errorf("mailServer = %+v", s)
+			}
+			if opts.General.Delay != 5 || opts.General.Separator != "," {
+				t.Errorf("general = %+v", opts.General)
+			}
+			if got := opts.From(); got != "Attacker <attacker@example.com>" {
+				t.Errorf("From() = %q", got)
+			}
+		})
+	}
+}
+
+func TestParseConfigMissingFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "missing.yaml")
+	_, err := ParseConfig(filename)
+
+	var cfgErr *ErrInvalidConfig
+	if !errors.As(err, &cfgErr) || cfgErr.Path != filename {
+		t.Fatalf("ParseConfig() error = %v, want ErrInvalidConfig of %s", err, filename)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   []OptionFunc
+		modify func(*Options)
+		// field is the invalid field, "" if options are valid
+		field string
+	}{
+		{
+			name: "defaults",
+		},
+		{
+			name: "generated url",
+			opts: []OptionFunc{WithGeneratedURL("https://phish.example.com/?id=<CHANGE>", 8)},
+		},
+		{
+			name:  "generated url without placeholder",
+			opts:  []OptionFunc{WithGeneratedURL("https://phish.example.com/login", 8)},
+			field: "url.link",
+		},
+		{
+			name: "single url without placeholder",
+			opts: []OptionFunc{WithURL("https://phish.example.com/login")},
+		},
+		{
+			name: "bulk",
+			opts: []OptionFunc{WithBulk(10, 60)},
+		},
+		{
+			name: "starttls",
+			modify: func(o *Options) {
+				o.MailServers = MailServers{{Host: "smtp.example.com", Encryption: encryptionSTARTTLS}}
+			},
+		},
+		{
+			name: "unknown encryption",
+			modify: func(o *Options) {
+				o.MailServers = MailServers{{Host: "smtp.example.com", Encryption: "tls1.3"}}
+			},
+			field: "mailServer.encryption",
+		},
+		{
+			name: "negative quota",
+			modify: func(o *Options) {
+				o.MailServers = MailServers{{Host: "smtp.example.com", Quota: -1}}
+			},
+			field: "mailServer.quota",
+		},
+		{
+			name: "unknown tls version",
+			modify: func(o *Options) {
+				o.MailServers = MailServers{{Host: "smtp.example.com", TLS: TLS{MinVersion: "1.4"}}}
+			},
+			field: "mailServer.tls",
+		},
+		{
+			name: "invalid reply to",
+			modify: func(o *Options) {
+				o.Mail.ReplyTo = "nobody"
+			},
+			field: "mail.replyTo",
+		},
+		{
+			name: "unknown charset",
+			modify: func(o *Options) {
+				o.Mail.Charset = "klingon"
+			},
+			field: "mail.charset",
+		},
+		{
+			name: "unknown transfer encoding",
+			modify: func(o *Options) {
+				o.Mail.TransferEncoding = "uuencode"
+			},
+			field: "mail.transferEncoding",
+		},
+		{
+			name: "verp with bcc",
+			opts: []OptionFunc{WithBcc()},
+			modify: func(o *Options) {
+				o.Mail.VERPDomain = "bounce.example.com"
+			},
+			field: "mail.verpDomain",
+		},
+		{
+			name: "text template with plain text",
+			modify: func(o *Options) {
+				o.Mail.ContentType = "text/plain"
+				o.Attack.TextTemplate = "template.txt"
+			},
+			field: "attack.textTemplate",
+		},
+		{
+			name: "rate",
+			opts: []OptionFunc{WithDelay(0)},
+			modify: func(o *Options) {
+				o.General.Rate = "100/h"
+			},
+		},
+		{
+			name: "rate with delay",
+			modify: func(o *Options) {
+				o.General.Rate = "100/h"
+			},
+			field: "general",
+		},
+		{
+			name: "delayMax less than delayMin",
+			modify: func(o *Options) {
+				o.General.DelayMin = 10
+				o.General.DelayMax = 5
+			},
+			field: "general.delayMax",
+		},
+		{
+			name: "unknown timezone",
+			modify: func(o *Options) {
+				o.General.Timezone = "Mars/Olympus"
+			},
+			field: "general.timezone",
+		},
+		{
+			name: "recipients per message with generated url",
+			opts: []OptionFunc{WithGeneratedURL("https://phish.example.com/?id=<CHANGE>", 8)},
+			modify: func(o *Options) {
+				o.General.RecipientsPerMessage = 5
+			},
+			field: "general.recipientsPerMessage",
+		},
+		{
+			name: "url hosts without scheme",
+			opts: []OptionFunc{WithURL("phish.example.com/login")},
+			modify: func(o *Options) {
+				o.Url.Hosts = []string{"a.example.com", "b.example.com"}
+			},
+			field: "url.link",
+		},
+		{
+			name: "ldap without base dn",
+			modify: func(o *Options) {
+				o.Attack.LDAP = LDAP{Host: "dc.example.com"}
+			},
+			field: "attack.ldap",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := NewOptions(tt.opts...)
+			if tt.modify != nil {
+				tt.modify(o)
+			}
+			err := o.Validate()
+
+			if tt.field == "" {
+				if err != nil {
+					t.Fatalf("Validate() error = %v", err)
+				}
+				return
+			}
+
+			var cfgErr *ErrInvalidConfig
+			if !errors.As(err, &cfgErr) {
+				t.Fatalf("Validate() error = %v, want ErrInvalidConfig", err)
+			}
+			if cfgErr.Field != tt.field {
+				t.Errorf("Validate() error field = %q, want %q (%v)", cfgErr.Field, tt.field, err)
+			}
+		})
+	}
+}
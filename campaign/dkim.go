@@ -0,0 +1,93 @@
+package campaign
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/lateralusd/lateralus/email"
+)
+
+// DKIM signs the mails with the key published in selector._domainkey.domain
+type DKIM struct {
+	// Domain is d= of the signature, domain of the From address by default
+	Domain   string `yaml:"domain"`
+	Selector string `yaml:"selector"`
+	// PrivateKey is PEM encoded RSA or Ed25519 key, or path to it
+	PrivateKey string `yaml:"privateKey"`
+	// Headers to sign instead of the default ones
+	Headers []string `yaml:"headers"`
+}
+
+func (d DKIM) enabled() bool {
+	return d.Selector != "" || d.PrivateKey != ""
+}
+
+func (d DKIM) keyPEM() ([]byte, error) {
+	if strings.HasPrefix(strings.TrimSpace(d.PrivateKey), "-----BEGIN") {
+		return []byte(d.PrivateKey), nil
+	}
+	return ioutil.ReadFile(d.PrivateKey)
+}
+
+func validateDKIM(d DKIM) error {
+	if !d.enabled() {
+		return nil
+	}
+	if d.Selector == "" || d.PrivateKey == "" {
+		return errors.New("both selector and privateKey are required")
+	}
+	if d.Domain != "" {
+		if err := validateDomain(d.Domain); err != nil {
+			return err
+		}
+	}
+	if !strings.HasPrefix(strings.TrimSpace(d.PrivateKey), "-----BEGIN") {
+		if _, err := os.Stat(d.PrivateKey); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// newDKIMSigner returns nil if DKIM is not configured
+func newDKIMSigner(d DKIM, from string) (*email.DKIMSigner, error) {
+	if !d.enabled() {
+		return nil, nil
+	}
+
+	data, err := d.keyPEM()
+	if err != nil {
+		return nil, fmt.Errorf("newDKIMSigner: %v", err)
+	}
+	key, err := email.ParseDKIMKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("newDKIMSigner: %v", err)
+	}
+
+	domain := d.Domain
+	if domain == "" {
+		domain = from[strings.LastIndex(from, "@")+1:]
+	}
+	return &email.DKIMSigner{
+		Domain:   domain,
+		Selector: d.Selector,
+		Key:      key,
+		Headers:  d.Headers,
+	}, nil
+}
+
+// sign adds DKIM-Signature to the message if signer is set
+func (msg *message) sign(signer *email.DKIMSigner) error {
+	if signer == nil {
+		return nil
+	}
+	data, err := signer.Sign([]byte(msg.data))
+	if err != nil {
+		return err
+	}
+	msg.data = string(data)
+	return nil
+}
@@ -0,0 +1,79 @@
+package campaign
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lateralusd/lateralus/logging"
+)
+
+// dryRunHost is reported as the server of mails built in dry run
+const dryRunHost = "dry-run"
+
+// dryRunSender accepts every message without sending it, writing it to out
+// in mbox format if out is not nil
+type dryRunSender struct {
+	out io.Writer
+}
+
+func (d *dryRunSender) send(ctx context.Context, msg *message) (string, error) {
+	if d.out == nil {
+		return dryRunHost, nil
+	}
+
+	from := msg.from
+	if from == "" {
+		from = "MAILER-DAEMON"
+	}
+	fmt.Fprintf(d.out, "From %s %s\n", from, time.Now().UTC().Format(time.ANSIC))
+	for _, line := range strings.Split(strings.TrimRight(strings.ReplaceAll(msg.data, "\r\n", "\n"), "\n"), "\n") {
+		if strings.HasPrefix(strings.TrimLeft(line, ">"), "From ") {
+			line = ">" + line
+		}
+		fmt.Fprintln(d.out, line)
+	}
+	fmt.Fprintln(d.out)
+
+	return dryRunHost, nil
+}
+
+func (d *dryRunSender) close() {}
+
+// dryRun goes through sending of the mails without delays and without
+// connecting to the mail servers. Mail server config is still checked.
+func (c *Campaign) dryRun(ctx context.Context, mails []SendingMail) error {
+	opts := *c.Options
+	opts.General.Delay = 0
+	opts.General.DelayMax = 0
+	opts.General.BulkDelay = 0
+	opts.General.Rate = ""
+	opts.General.ThrottleByDomain = 0
+	opts.General.Window = ""
+	opts.General.DeliverAt = ""
+
+	if _, err := newSender(&opts, c.ID); err != nil {
+		return fmt.Errorf("dryRun: %v", err)
+	}
+
+	sender := &dryRunSender{out: os.Stdout}
+	if c.EMLDir != "" {
+		if err := os.MkdirAll(c.EMLDir, 0700); err != nil {
+			return fmt.Errorf("dryRun: %v", err)
+		}
+		logging.Infof("Dry run, saving mails into \"%s\"", c.EMLDir)
+		sender.out = nil
+	} else {
+		logging.Infof("Dry run, printing mails instead of sending them")
+	}
+
+	if err := sendEmails(ctx, mails, &opts, sender, c.EMLDir, nil); err != nil {
+		return fmt.Errorf("dryRun: %v", err)
+	}
+
+	logging.Infof("Dry run finished, %d mails built", len(mails))
+	return nil
+}
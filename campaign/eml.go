@@ -0,0 +1,120 @@
+package campaign
+
+import (
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/mail"
+	"os"
+	"path/filepath"
+
+	"github.com/lateralusd/lateralus/email"
+	"github.com/lateralusd/lateralus/logging"
+)
+
+// EMLTemplate is the lure extracted from EML file
+type EMLTemplate struct {
+	Subject     string
+	FromName    string
+	FromAddress string
+	// ContentType is text/html or text/plain, depending on which part
+	// the body was taken from
+	ContentType string
+	Body        string
+	// TextBody is the plain text alternative of HTML Body, if the mail
+	// has both
+	TextBody string
+}
+
+// ParseEML reads subject, sender and body from EML file. HTML part is
+// preferred over plain text in multipart messages, the plain text one is
+// kept as its alternative. Attachments are ignored.
+func ParseEML(filename string) (*EMLTemplate, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("ParseEML: %v", err)
+	}
+	defer f.Close()
+
+	msg, err := email.ParseMessage(f)
+	if err != nil {
+		return nil, fmt.Errorf("ParseEML: %v", err)
+	}
+
+	dec := &mime.WordDecoder{}
+	subject, err := dec.DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		return nil, fmt.Errorf("ParseEML: subject: %v", err)
+	}
+
+	t := &EMLTemplate{Subject: subject}
+
+	if from := msg.Header.Get("From"); from != "" {
+		addr, err := mail.ParseAddress(from)
+		if err != nil {
+			return nil, fmt.Errorf("ParseEML: from: %v", err)
+		}
+		t.FromName = addr.Name
+		t.FromAddress = addr.Address
+	}
+
+	part := msg.Body("text/html")
+	if part == nil {
+		part = msg.Body("text/plain")
+	}
+	if part == nil {
+		return nil, fmt.Errorf("ParseEML: no text/html or text/plain part found")
+	}
+
+	t.ContentType = part.ContentType
+	t.Body, err = part.Text()
+	if err != nil {
+		return nil, fmt.Errorf("ParseEML: %s part: %v", part.ContentType, err)
+	}
+
+	if text := msg.Body("text/plain"); text != nil && text != part {
+		t.TextBody, err = text.Text()
+		if err != nil {
+			return nil, fmt.Errorf("ParseEML: text/plain part: %v", err)
+		}
+	}
+
+	return t, nil
+}
+
+// Apply replaces subject, sender and template of opts with the ones from EML
+func (t *EMLTemplate) Apply(opts *Options, filename string) {
+	opts.Mail.Subject = t.Subject
+	if t.FromAddress != "" {
+		opts.Mail.Name = t.FromName
+		opts.Mail.Address = t.FromAddress
+	}
+	opts.Mail.ContentType = t.ContentType
+	opts.Attack.Template = filename
+	opts.Attack.Body = t.Body
+	opts.Attack.TextTemplate = ""
+	opts.Attack.TextBody = t.TextBody
+}
+
+// ExportAsEML writes msg, the mail exactly as it was sent to m, into
+// <ID>.eml file in dir
+func ExportAsEML(m SendingMail, msg string, dir string) error {
+	filename := filepath.Join(dir, m.ID+".eml")
+	if err := ioutil.WriteFile(filename, []byte(msg), 0600); err != nil {
+		return fmt.Errorf("ExportAsEML: %v", err)
+	}
+	return nil
+}
+
+// exportEMLs writes msg for every mail, failures are only logged so that
+// the campaign is not interrupted
+func exportEMLs(mails []SendingMail, msg string, dir string) {
+	if dir == "" {
+		return
+	}
+	for _, m := range mails {
+		if err := ExportAsEML(m, msg, dir); err != nil {
+			logging.Errorf("Error exporting mail for %s: %v", m.Email, err)
+		}
+	}
+}
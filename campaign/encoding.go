@@ -0,0 +1,117 @@
+package campaign
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	mail "github.com/xhit/go-simple-mail/v2"
+)
+
+const defaultCharset = "utf-8"
+
+// normalizeCharset returns canonical name of the charset, only charsets
+// the body can be converted to are accepted
+func normalizeCharset(charset string) (string, error) {
+	switch strings.ToLower(charset) {
+	case "", "utf-8", "utf8":
+		return defaultCharset, nil
+	case "us-ascii", "ascii":
+		return "us-ascii", nil
+	case "iso-8859-1", "latin1":
+		return "iso-8859-1", nil
+	default:
+		return "", fmt.Errorf("unsupported charset %q, expected utf-8, us-ascii or iso-8859-1", charset)
+	}
+}
+
+// setTransferEncoding sets Content-Transfer-Encoding of the body,
+// quoted-printable is used by default
+func setTransferEncoding(email *mail.Email, encoding string) {
+	switch strings.ToLower(encoding) {
+	case "7bit":
+		email.Encoding = mail.EncodingNone
+	case "base64":
+		email.Encoding = mail.EncodingBase64
+	default:
+		email.Encoding = mail.EncodingQuotedPrintable
+	}
+}
+
+// setContent converts subject and the rendered bodies into charset and sets them on the email,
+// textBody is sent as plain text alternative of HTML body if it is not empty
+func setContent(email *mail.Email, charset, contentType, subject, body, textBody string) error {
+	charset, err := normalizeCharset(charset)
+	if err != nil {
+		return fmt.Errorf("setContent: %v", err)
+	}
+
+	convSubject, err := convertCharset(subject, charset)
+	if err != nil {
+		return fmt.Errorf("setContent: subject: %v", err)
+	}
+
+	convBody, err := convertCharset(body, charset)
+	if err != nil {
+		return fmt.Errorf("setContent: body: %v", err)
+	}
+
+	if email.Encoding == mail.EncodingNone && !isASCII(convBody) {
+		return fmt.Errorf("setContent: body contains non-ASCII characters, use quoted-printable or base64 transfer encoding")
+	}
+
+	email.Charset = charset
+	email.SetSubject(convSubject)
+	if !isHTML(contentType) {
+		email.SetBody(mail.TextPlain, convBody)
+		return nil
+	}
+
+	if textBody == "" {
+		email.SetBody(mail.TextHTML, convBody)
+		return nil
+	}
+
+	convText, err := convertCharset(textBody, charset)
+	if err != nil {
+		return fmt.Errorf("setContent: text body: %v", err)
+	}
+	if email.Encoding == mail.EncodingNone && !isASCII(convText) {
+		return fmt.Errorf("setContent: text body contains non-ASCII characters, use quoted-printable or base64 transfer encoding")
+	}
+
+	// clients show the last alternative they understand, so HTML goes last
+	email.SetBody(mail.TextPlain, convText)
+	email.AddAlternative(mail.TextHTML, convBody)
+	return nil
+}
+
+func convertCharset(body, charset string) (string, error) {
+	switch charset {
+	case "us-ascii":
+		if !isASCII(body) {
+			return "", fmt.Errorf("body contains characters outside of us-ascii")
+		}
+		return body, nil
+	case "iso-8859-1":
+		buf := make([]byte, 0, len(body))
+		for _, r := range body {
+			if r > 0xff || r == utf8.RuneError {
+				return "", fmt.Errorf("character %q cannot be encoded in iso-8859-1", r)
+			}
+			buf = append(buf, byte(r))
+		}
+		return string(buf), nil
+	default:
+		return body, nil
+	}
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
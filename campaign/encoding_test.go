@@ -0,0 +1,206 @@
+package campaign
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+const (
+	testName    = "Jürgen Müller"
+	testSubject = "Grüße aus 東京 ☕"
+	testBody    = "<p>Café, naïve façade, 日本語のテキスト, Ελληνικά, emoji 🎣 and a long line that has to be wrapped by quoted-printable encoding</p>"
+	testText    = "Café 日本語 🎣"
+)
+
+// buildTestMessage renders the mail sent to zoe@example.com from testName
+func buildTestMessage(t *testing.T, charset, encoding, subject, body, text string) *mail.Message {
+	t.Helper()
+	opts := NewOptions(WithMail(Mail{Name: testName, Address: "juergen@example.com", TransferEncoding: encoding}))
+	email := createMail(opts)
+	email.AddTo("Zoë <zoe@example.com>")
+	if err := setContent(email, charset, "", subject, body, text); err != nil {
+		t.Fatalf("setContent() error = %v", err)
+	}
+	msg, err := newMessage(email, "")
+	if err != nil {
+		t.Fatalf("newMessage() error = %v", err)
+	}
+
+	for i, line := range strings.Split(msg.data, "\r\n") {
+		if !isASCII(line) {
+			t.Errorf("line %d of message is not ASCII: %q", i+1, line)
+		}
+	}
+	m, err := mail.ReadMessage(strings.NewReader(msg.data))
+	if err != nil {
+		t.Fatalf("mail.ReadMessage() error = %v", err)
+	}
+	return m
+}
+
+// wordDecoder decodes RFC 2047 words in utf-8 and iso-8859-1
+var wordDecoder = &mime.WordDecoder{
+	CharsetReader: func(charset string, input io.Reader) (io.Reader, error) {
+		if strings.ToLower(charset) != "iso-8859-1" {
+			return nil, fmt.Errorf("unexpected charset %q", charset)
+		}
+		latin1, err := ioutil.ReadAll(input)
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, 0, len(latin1)*2)
+		for _, b := range latin1 {
+			buf = append(buf, string(rune(b))...)
+		}
+		return strings.NewReader(string(buf)), nil
+	},
+}
+
+func TestSetContentHeaders(t *testing.T) {
+	for _, charset := range []string{"utf-8", "iso-8859-1"} {
+		t.Run(charset, func(t *testing.T) {
+			subject := testSubject
+			if charset == "iso-8859-1" {
+				subject = "Grüße aus Köln"
+			}
+			m := buildTestMessage(t, charset, "", subject, "<p>Hallo</p>", "")
+
+			raw := m.Header.Get("Subject")
+			if !strings.HasPrefix(strings.ToLower(raw), "=?"+charset+"?") {
+				t.Errorf("Subject = %q, want RFC 2047 encoded word in %s", raw, charset)
+			}
+			got, err := wordDecoder.DecodeHeader(raw)
+			if err != nil {
+				t.Fatalf("DecodeHeader(%q) error = %v", raw, err)
+			}
+			if got != subject {
+				t.Errorf("decoded Subject = %q, want %q", got, subject)
+			}
+
+			from, err := (&mail.AddressParser{WordDecoder: wordDecoder}).Parse(m.Header.Get("From"))
+			if err != nil {
+				t.Fatalf("parsing From %q: %v", m.Header.Get("From"), err)
+			}
+			if from.Name != testName || from.Address != "juergen@example.com" {
+				t.Errorf("From = %+v, want %s <juergen@example.com>", from, testName)
+			}
+		})
+	}
+}
+
+func TestSetContentBody(t *testing.T) {
+	tests := []struct {
+		name     string
+		encoding string
+		header   string
+	}{
+		{name: "default", encoding: "", header: "quoted-printable"},
+		{name: "quoted-printable", encoding: "quoted-printable", header: "quoted-printable"},
+		{name: "base64", encoding: "base64", header: "base64"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := buildTestMessage(t, "", tt.encoding, testSubject, testBody, testText)
+
+			_, params, err := mime.ParseMediaType(m.Header.Get("Content-Type"))
+			if err != nil {
+				t.Fatalf("parsing Content-Type: %v", err)
+			}
+			parts := multipart.NewReader(m.Body, params["boundary"])
+
+			want := []struct{ contentType, body string }{
+				{"text/plain", testText},
+				{"text/html", testBody},
+			}
+			for _, w := range want {
+				p, err := parts.NextRawPart()
+				if err != nil {
+					t.Fatalf("reading %s part: %v", w.contentType, err)
+				}
+				if ct := p.Header.Get("Content-Type"); ct != w.contentType+"; charset=utf-8" {
+					t.Errorf("Content-Type = %q, want %s; charset=utf-8", ct, w.contentType)
+				}
+				if cte := p.Header.Get("Content-Transfer-Encoding"); cte != tt.header {
+					t.Errorf("Content-Transfer-Encoding = %q, want %q", cte, tt.header)
+				}
+
+				raw, err := ioutil.ReadAll(p)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, line := range strings.Split(string(raw), "\r\n") {
+					if len(line) > 76 {
+						t.Errorf("encoded line has %d characters, limit is 76: %q", len(line), line)
+					}
+				}
+
+				got := decodeBody(t, tt.header, string(raw))
+				if got != w.body {
+					t.Errorf("%s body = %q, want %q", w.contentType, got, w.body)
+				}
+			}
+		})
+	}
+}
+
+func decodeBody(t *testing.T, encoding, raw string) string {
+	t.Helper()
+	var d []byte
+	var err error
+	if encoding == "base64" {
+		d, err = base64.StdEncoding.DecodeString(strings.Replace(raw, "\r\n", "", -1))
+	} else {
+		d, err = ioutil.ReadAll(quotedprintable.NewReader(strings.NewReader(raw)))
+	}
+	if err != nil {
+		t.Fatalf("decoding %s body: %v", encoding, err)
+	}
+	if !utf8.Valid(d) {
+		t.Errorf("decoded body is not valid utf-8: %q", d)
+	}
+	return string(d)
+}
+
+func TestSetContentErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		charset  string
+		encoding string
+		body     string
+	}{
+		{name: "7bit with non-ascii body", encoding: "7bit", body: testBody},
+		{name: "us-ascii with non-ascii body", charset: "us-ascii", body: testBody},
+		{name: "iso-8859-1 with japanese", charset: "iso-8859-1", body: testBody},
+		{name: "unknown charset", charset: "shift_jis", body: "Hello"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := NewOptions(WithMail(Mail{Address: "juergen@example.com", TransferEncoding: tt.encoding}))
+			email := createMail(opts)
+			if err := setContent(email, tt.charset, "", "Hello", tt.body, ""); err == nil {
+				t.Errorf("setContent() error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestConvertCharset(t *testing.T) {
+	got, err := convertCharset("Grüße", "iso-8859-1")
+	if err != nil {
+		t.Fatalf("convertCharset() error = %v", err)
+	}
+	if want := "Gr\xfc\xdfe"; got != want {
+		t.Errorf("convertCharset() = %q, want %q", got, want)
+	}
+}
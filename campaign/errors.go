@@ -0,0 +1,105 @@
+package campaign
+
+import (
+	"errors"
+	"fmt"
+	"net/textproto"
+)
+
+// ErrInvalidConfig is returned when the configuration file cannot be read
+// or contains values that cannot be used together
+type ErrInvalidConfig struct {
+	Path   string
+	Field  string
+	Reason string
+}
+
+func (e *ErrInvalidConfig) Error() string {
+	msg := "invalid config"
+	if e.Path != "" {
+		msg += fmt.Sprintf(" %q", e.Path)
+	}
+	if e.Field != "" {
+		msg += ": " + e.Field
+	}
+	return msg + ": " + e.Reason
+}
+
+// ErrNoTargets is returned when the targets file does not contain any target
+type ErrNoTargets struct {
+	Path string
+}
+
+func (e *ErrNoTargets) Error() string {
+	return fmt.Sprintf("no targets found in %q", e.Path)
+}
+
+// ErrSMTPAuth is returned when the mail server rejects the provided credentials
+type ErrSMTPAuth struct {
+	Host   string
+	User   string
+	Reason string
+}
+
+func (e *ErrSMTPAuth) Error() string {
+	return fmt.Sprintf("authentication to %s as %q failed: %s", e.Host, e.User, e.Reason)
+}
+
+// ErrTemplateRender is returned when the mail template cannot be parsed or executed
+type ErrTemplateRender struct {
+	Template string
+	Target   string
+	Err      error
+}
+
+func (e *ErrTemplateRender) Error() string {
+	if e.Target == "" {
+		return fmt.Sprintf("rendering template %q: %v", e.Template, e.Err)
+	}
+	return fmt.Sprintf("rendering template %q for %q: %v", e.Template, e.Target, e.Err)
+}
+
+func (e *ErrTemplateRender) Unwrap() error {
+	return e.Err
+}
+
+// ErrReportWrite is returned when the campaign report cannot be generated or saved
+type ErrReportWrite struct {
+	Output string
+	Format string
+	Err    error
+}
+
+func (e *ErrReportWrite) Error() string {
+	return fmt.Sprintf("writing %s report to %q: %v", e.Format, e.Output, e.Err)
+}
+
+func (e *ErrReportWrite) Unwrap() error {
+	return e.Err
+}
+
+// isAuthError reports whether err is a SMTP reply rejecting the authentication
+func isAuthError(err error) (*textproto.Error, bool) {
+	var tpErr *textproto.Error
+	if !errors.As(err, &tpErr) {
+		return nil, false
+	}
+	switch tpErr.Code {
+	case 530, 534, 535, 538:
+		return tpErr, true
+	}
+	return nil, false
+}
+
+// ErrInvalidTargets is returned when targets fail validation and the
+// campaign is configured to abort
+type ErrInvalidTargets struct {
+	Invalid []InvalidTarget
+}
+
+func (e *ErrInvalidTargets) Error() string {
+	if len(e.Invalid) == 0 {
+		return "targets are invalid"
+	}
+	return fmt.Sprintf("%d targets are invalid, first on row %d (%s): %s", len(e.Invalid), e.Invalid[0].Row, e.Invalid[0].Email, e.Invalid[0].Reason)
+}
@@ -0,0 +1,213 @@
+package campaign
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/lateralusd/lateralus/logging"
+	"github.com/lateralusd/lateralus/notify"
+)
+
+// Notifications post summaries of the campaign to chat channels or mail them
+type Notifications struct {
+	// Progress is the step in percent of sent mails between progress
+	// summaries, 0 disables them
+	Progress int       `yaml:"progress"`
+	Channels []Channel `yaml:"channels"`
+}
+
+// Channel is single Slack, Telegram, Discord or Teams chat, or mail
+// recipients
+type Channel struct {
+	Provider string `yaml:"provider"`
+	// URL is incoming webhook of Slack, Discord and Teams
+	URL string `yaml:"url"`
+	// Token and ChatID are used with Telegram bot
+	Token  string `yaml:"token"`
+	ChatID string `yaml:"chatId"`
+	// To are the addresses mailed by email provider through the first mail
+	// server
+	To []string `yaml:"to"`
+	// Clicks enables alerts about opens, clicks and submissions
+	Clicks bool `yaml:"clicks"`
+}
+
+func validateNotifications(n Notifications, servers MailServers) error {
+	if n.Progress < 0 || n.Progress > 100 {
+		return fmt.Errorf("progress %d is not between 0 and 100", n.Progress)
+	}
+	for i, c := range n.Channels {
+		switch strings.ToLower(c.Provider) {
+		case notify.Slack, notify.Discord, notify.Teams:
+			if c.URL == "" {
+				return fmt.Errorf("channel %d needs url of %s webhook", i+1, c.Provider)
+			}
+		case notify.Telegram:
+			if c.Token == "" || c.ChatID == "" {
+				return fmt.Errorf("channel %d needs token and chatId of telegram bot", i+1)
+			}
+		case providerEmail:
+			if len(c.To) == 0 {
+				return fmt.Errorf("channel %d needs to addresses", i+1)
+			}
+			for _, to := range c.To {
+				if err := validateAddress(to); err != nil {
+					return fmt.Errorf("channel %d: %v", i+1, err)
+				}
+			}
+			if len(servers) == 0 {
+				return fmt.Errorf("channel %d mails through mailServer, which is not set", i+1)
+			}
+		default:
+			return fmt.Errorf("unknown provider %q of channel %d, expected slack, telegram, discord, teams or email", c.Provider, i+1)
+		}
+	}
+	return nil
+}
+
+// providerEmail mails the notifications instead of posting them to a chat
+const providerEmail = "email"
+
+// Webhook receives events of the campaign as JSON, e.g. email_sent
+type Webhook struct {
+	URL string `yaml:"url"`
+	// Secret signs the events with HMAC-SHA256 if it is set
+	Secret string `yaml:"secret"`
+}
+
+func validateWebhook(w Webhook) error {
+	if w.URL == "" {
+		if w.Secret != "" {
+			return fmt.Errorf("secret is set without url")
+		}
+		return nil
+	}
+	u, err := url.Parse(w.URL)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%q is not http or https url", w.URL)
+	}
+	return nil
+}
+
+// Notifiers returns the destinations of campaign events configured in opts
+func (o *Options) Notifiers() []notify.Notifier {
+	var notifiers []notify.Notifier
+	client := newHTTPClient(o.proxyURL())
+	if o.Webhook.URL != "" {
+		notifiers = append(notifiers, &notify.Webhook{URL: o.Webhook.URL, Secret: o.Webhook.Secret, Client: client})
+	}
+	for _, c := range o.Notifications.Channels {
+		if strings.ToLower(c.Provider) == providerEmail {
+			dialer, err := newDialer(o.MailServers.Primary(), o.proxyURL())
+			if err != nil {
+				logging.Warningf("Notifications to %s are not sent: %v", strings.Join(c.To, ", "), err)
+				continue
+			}
+			notifiers = append(notifiers, &notify.Mail{
+				From:    o.fromAddress(),
+				To:      c.To,
+				Targets: c.Clicks,
+				Dialer:  dialer,
+			})
+			continue
+		}
+		notifiers = append(notifiers, &notify.Chat{
+			Provider: strings.ToLower(c.Provider),
+			URL:      c.URL,
+			Token:    c.Token,
+			ChatID:   c.ChatID,
+			Targets:  c.Clicks,
+			Client:   client,
+		})
+	}
+	return notifiers
+}
+
+// recorder is told about the mails once the mail server accepted or
+// rejected them
+type recorder interface {
+	record(mails []SendingMail)
+}
+
+// recorders passes the mails to all of them
+type recorders []recorder
+
+func (r recorders) record(mails []SendingMail) {
+	for _, rec := range r {
+		rec.record(mails)
+	}
+}
+
+// eventRecorder turns the state of mails into events, every progress
+// percent of total mails it sends progress summary
+type eventRecorder struct {
+	campaign string
+	events   *notify.Dispatcher
+	total    int
+	progress int
+
+	sent, failed int
+	next         int
+}
+
+func (e *eventRecorder) record(mails []SendingMail) {
+	for _, m := range mails {
+		if m.Status == MailSent {
+			e.sent++
+		} else {
+			e.failed++
+		}
+
+		event := notify.Event{
+			Type:     notify.EmailSent,
+			Campaign: e.campaign,
+			ID:       m.ID,
+			Name:     m.Name,
+			Email:    m.Email,
+		}
+		if m.Status != MailSent {
+			event.Type = notify.SendFailed
+			event.Error = m.SendError
+		}
+		e.events.Notify(event)
+	}
+
+	done := e.sent + e.failed
+	if e.progress == 0 || e.total == 0 || done >= e.total {
+		return
+	}
+	if percent := done * 100 / e.total; percent >= e.next {
+		if e.next > 0 {
+			e.events.Notify(notify.Event{
+				Type:     notify.CampaignProgress,
+				Campaign: e.campaign,
+				Total:    e.total,
+				Sent:     e.sent,
+				Failed:   e.failed,
+			})
+		}
+		e.next = (percent/e.progress + 1) * e.progress
+	}
+}
+
+// campaignEvent sums up the mails for campaign started and finished events
+func campaignEvent(eventType, campaign string, mails []SendingMail) notify.Event {
+	e := notify.Event{
+		Type:     eventType,
+		Campaign: campaign,
+		Total:    len(mails),
+	}
+	for _, m := range mails {
+		switch m.Status {
+		case MailSent:
+			e.Sent++
+		case MailFailed, MailDeferred:
+			e.Failed++
+		}
+	}
+	return e
+}
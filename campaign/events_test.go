@@ -0,0 +1,62 @@
+package campaign
+
+import (
+	"testing"
+
+	"github.com/lateralusd/lateralus/tracking"
+)
+
+func TestValidateNotifications(t *testing.T) {
+	servers := MailServers{{Host: "smtp.example.com", Port: 587}}
+	tests := []struct {
+		name    string
+		n       Notifications
+		servers MailServers
+		wantErr bool
+	}{
+		{name: "none"},
+		{name: "teams", n: Notifications{Channels: []Channel{{Provider: "Teams", URL: "https://example.webhook.office.com/x"}}}},
+		{name: "teams without url", n: Notifications{Channels: []Channel{{Provider: "teams"}}}, wantErr: true},
+		{name: "email", n: Notifications{Channels: []Channel{{Provider: "email", To: []string{"redteam@example.com"}}}}, servers: servers},
+		{name: "email without to", n: Notifications{Channels: []Channel{{Provider: "email"}}}, servers: servers, wantErr: true},
+		{name: "email to invalid address", n: Notifications{Channels: []Channel{{Provider: "email", To: []string{"redteam"}}}}, servers: servers, wantErr: true},
+		{name: "email without mail server", n: Notifications{Channels: []Channel{{Provider: "email", To: []string{"redteam@example.com"}}}}, wantErr: true},
+		{name: "telegram without chat", n: Notifications{Channels: []Channel{{Provider: "telegram", Token: "123:abc"}}}, wantErr: true},
+		{name: "unknown provider", n: Notifications{Channels: []Channel{{Provider: "irc", URL: "irc://example.com"}}}, wantErr: true},
+		{name: "progress over 100", n: Notifications{Progress: 101}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateNotifications(tt.n, tt.servers); (err != nil) != tt.wantErr {
+				t.Errorf("validateNotifications() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTrackingTargets(t *testing.T) {
+	r := &Result{
+		URL: "https://phish.example.com/?id=<CHANGE>",
+		Targets: []SendingMail{
+			{Target: Target{Name: "John Doe", Email: "john@example.com"}, ID: "1a2b", URL: "https://phish.example.com/?id=tok1"},
+			{Target: Target{Email: "jane@example.com"}, ID: "3c4d", URL: "https://phish.example.com/?id=tok2"},
+		},
+	}
+
+	got := r.TrackingTargets()
+	want := map[string]tracking.Target{
+		"1a2b": {Name: "John Doe", Email: "john@example.com"},
+		"tok1": {Name: "John Doe", Email: "john@example.com"},
+		"3c4d": {Email: "jane@example.com"},
+		"tok2": {Email: "jane@example.com"},
+	}
+	if len(got) != len(want) {
+		t.Errorf("TrackingTargets() = %v, want %v", got, want)
+	}
+	for id, w := range want {
+		if got[id] != w {
+			t.Errorf("TrackingTargets()[%q] = %+v, want %+v", id, got[id], w)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package campaign
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/lateralusd/lateralus/util"
+)
+
+// CapturedSession is session of the target captured by reverse proxy,
+// Evilginx2 or Modlishka. The password and tokens stay in the proxy, where
+// Session identifies them.
+type CapturedSession struct {
+	// Source is the proxy, evilginx or modlishka
+	Source    string
+	Name      string
+	Email     string
+	Time      string
+	IP        string
+	UserAgent string
+	Phishlet  string
+	Username  string
+	// Password is set when the password was captured
+	Password bool
+	// Tokens is the number of captured session tokens
+	Tokens  int
+	Session string
+}
+
+// Sources of captured sessions
+const (
+	sourceEvilginx  = "evilginx"
+	sourceModlishka = "modlishka"
+)
+
+// loadLures returns Evilginx2 lure URLs keyed by email, nil if url.lures
+// is not set
+func loadLures(opts *Options) (map[string]string, error) {
+	if opts.Url.Lures == "" {
+		return nil, nil
+	}
+	lures, err := util.ParseEvilginxLures(opts.Url.Lures)
+	if err != nil {
+		return nil, fmt.Errorf("loadLures: %v", err)
+	}
+	return lures, nil
+}
+
+// lureURLs returns the lures of the targets, the targets without any are
+// reported at once
+func lureURLs(lures map[string]string, targets []Target) ([]string, error) {
+	urls := make([]string, len(targets))
+	var missing []string
+	for i, t := range targets {
+		u, ok := lures[strings.ToLower(t.Email)]
+		if !ok {
+			missing = append(missing, t.Email)
+			continue
+		}
+		urls[i] = u
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("lureURLs: no evilginx lure for %s", strings.Join(missing, ", "))
+	}
+	return urls, nil
+}
+
+// AddSessions adds the sessions of the targets to the report, the session
+// belongs to the target whose email is its lure param or captured
+// username, or whose URL it landed on. It returns the number of added
+// sessions, sessions already in the report are skipped.
+func (r *Result) AddSessions(sessions []util.EvilginxSession) int {
+	byEmail := make(map[string]SendingMail)
+	for _, t := range r.Targets {
+		byEmail[strings.ToLower(t.Email)] = t
+	}
+
+	seen := make(map[string]bool)
+	for _, s := range r.Sessions {
+		if s.Source == sourceEvilginx {
+			seen[s.Session] = true
+		}
+	}
+
+	added := 0
+	for _, s := range sessions {
+		id := strconv.Itoa(s.ID)
+		if seen[id] {
+			continue
+		}
+		t, ok := sessionTarget(s, byEmail, r.Targets)
+		if !ok {
+			continue
+		}
+		r.Sessions = append(r.Sessions, CapturedSession{
+			Source:    sourceEvilginx,
+			Name:      t.Name,
+			Email:     t.Email,
+			Time:      s.Created.Local().Format(timeFormat),
+			IP:        s.RemoteAddr,
+			UserAgent: s.UserAgent,
+			Phishlet:  s.Phishlet,
+			Username:  s.Username,
+			Password:  s.Password != "",
+			Tokens:    s.Tokens,
+			Session:   id,
+		})
+		added++
+	}
+	return added
+}
+
+func sessionTarget(s util.EvilginxSession, byEmail map[string]SendingMail, targets []SendingMail) (SendingMail, bool) {
+	for k, v := range s.Custom {
+		if strings.EqualFold(k, "email") {
+			if t, ok := byEmail[strings.ToLower(v)]; ok {
+				return t, true
+			}
+		}
+	}
+	if t, ok := byEmail[strings.ToLower(s.Username)]; ok {
+		return t, true
+	}
+	if s.LandingURL != "" {
+		for _, t := range targets {
+			if t.URL != "" && strings.HasPrefix(s.LandingURL, t.URL) {
+				return t, true
+			}
+		}
+	}
+	return SendingMail{}, false
+}
@@ -0,0 +1,231 @@
+package campaign
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/lateralusd/lateralus/logging"
+)
+
+// checkTemplateFields parses the templates before rendering and fails if
+// they use fields which are not available for every target. Columns of the
+// targets file which no template uses are logged, they are often typos.
+func checkTemplateFields(opts *Options, targets []Target) error {
+	available := templateFields(opts, targets)
+	used := make(map[string]bool)
+
+	var templates []namedTemplate
+	if len(opts.Attack.Variants) == 0 {
+		templates = usedTemplates(opts)
+	}
+	for _, v := range opts.Attack.Variants {
+		templates = append(templates, usedTemplates(variantOptions(opts, v))...)
+	}
+
+	for _, t := range templates {
+		fields, err := referencedFields(t.name, t.text)
+		if err != nil {
+			return err
+		}
+
+		var undefined []string
+		for _, f := range fields {
+			used[f] = true
+			if !available[f] {
+				undefined = append(undefined, f)
+			}
+		}
+		if len(undefined) > 0 {
+			err := fmt.Errorf("undefined fields %s", strings.Join(undefined, ", "))
+			if columns := commonColumns(targets); len(columns) > 0 {
+				err = fmt.Errorf("%v, targets file has columns %s", err, strings.Join(columns, ", "))
+			}
+			return &ErrTemplateRender{Template: t.name, Err: err}
+		}
+	}
+
+	var unused []string
+	for _, c := range commonColumns(targets) {
+		switch c {
+		case "Name", "Email", "Phone", "Tags", "Group":
+			continue
+		}
+		if !used[c] {
+			unused = append(unused, c)
+		}
+	}
+	if len(unused) > 0 {
+		logging.Warningf("Columns of targets file are not used by any template: %s", strings.Join(unused, ", "))
+	}
+
+	return nil
+}
+
+// templateFields returns the fields every target can use in templates.
+// Mails sent to several targets at once get only the shared fields.
+func templateFields(opts *Options, targets []Target) map[string]bool {
+	available := make(map[string]bool)
+	for k := range templateData(&SendingMail{}) {
+		available[k] = true
+	}
+	if opts.General.Bcc || opts.General.RecipientsPerMessage > 1 {
+		return available
+	}
+	for _, c := range commonColumns(targets) {
+		available[c] = true
+	}
+	return available
+}
+
+// commonColumns returns sorted columns which every target has
+func commonColumns(targets []Target) []string {
+	if len(targets) == 0 {
+		return nil
+	}
+	var columns []string
+	for c := range targets[0].Fields {
+		common := true
+		for _, t := range targets[1:] {
+			if _, ok := t.Fields[c]; !ok {
+				common = false
+				break
+			}
+		}
+		if common {
+			columns = append(columns, c)
+		}
+	}
+	sort.Strings(columns)
+	return columns
+}
+
+type namedTemplate struct {
+	name string
+	text string
+}
+
+// usedTemplates returns the templates rendered for the campaign
+func usedTemplates(opts *Options) []namedTemplate {
+	var templates []namedTemplate
+	add := func(name, text string) {
+		if name == "" && text == "" {
+			return
+		}
+		if text == "" {
+			d, err := ioutil.ReadFile(name)
+			if err != nil {
+				// reported when the template is rendered
+				return
+			}
+			text = string(d)
+		}
+		templates = append(templates, namedTemplate{name: name, text: text})
+	}
+
+	if !opts.SMS.Only {
+		if opts.Slack.Token != "" && opts.Slack.Template != "" {
+			add(opts.Slack.Template, "")
+		} else {
+			add(opts.Attack.Template, opts.Attack.Body)
+		}
+		if opts.Attack.TextBody != "" {
+			add(opts.Attack.Template, opts.Attack.TextBody)
+		} else {
+			add(opts.Attack.TextTemplate, "")
+		}
+	}
+	if opts.SMS.Provider != "" {
+		add(opts.SMS.Template, "")
+	}
+	if !opts.SMS.Only {
+		if strings.Contains(opts.Mail.ReadReceipt, "{{") {
+			add("readReceipt", opts.Mail.ReadReceipt)
+		}
+		for name, value := range opts.Mail.Headers {
+			if strings.Contains(value, "{{") {
+				add("header "+name, value)
+			}
+		}
+	}
+
+	return templates
+}
+
+// referencedFields returns sorted fields of the template data used by the
+// template, e.g. Department for {{.Department}} or {{$.Department}}
+func referencedFields(name, text string) ([]string, error) {
+	t, err := template.New(filepath.Base(name)).Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, &ErrTemplateRender{Template: name, Err: err}
+	}
+
+	found := make(map[string]bool)
+	for _, tt := range t.Templates() {
+		if tt.Tree != nil {
+			walkFields(tt.Tree.Root, true, found)
+		}
+	}
+
+	fields := make([]string, 0, len(found))
+	for f := range found {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+	return fields, nil
+}
+
+// walkFields collects fields of the template data from node. Inside range
+// and with the dot is something else, so only $ refers to the data there.
+func walkFields(node parse.Node, rootDot bool, found map[string]bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Nodes {
+			walkFields(c, rootDot, found)
+		}
+	case *parse.ActionNode:
+		walkFields(n.Pipe, rootDot, found)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Cmds {
+			walkFields(c, rootDot, found)
+		}
+	case *parse.CommandNode:
+		for _, a := range n.Args {
+			walkFields(a, rootDot, found)
+		}
+	case *parse.ChainNode:
+		walkFields(n.Node, rootDot, found)
+	case *parse.FieldNode:
+		if rootDot {
+			found[n.Ident[0]] = true
+		}
+	case *parse.VariableNode:
+		if n.Ident[0] == "$" && len(n.Ident) > 1 {
+			found[n.Ident[1]] = true
+		}
+	case *parse.IfNode:
+		walkFields(n.Pipe, rootDot, found)
+		walkFields(n.List, rootDot, found)
+		walkFields(n.ElseList, rootDot, found)
+	case *parse.RangeNode:
+		walkFields(n.Pipe, rootDot, found)
+		walkFields(n.List, false, found)
+		walkFields(n.ElseList, rootDot, found)
+	case *parse.WithNode:
+		walkFields(n.Pipe, rootDot, found)
+		walkFields(n.List, false, found)
+		walkFields(n.ElseList, rootDot, found)
+	case *parse.TemplateNode:
+		walkFields(n.Pipe, rootDot, found)
+	}
+}
@@ -0,0 +1,99 @@
+package campaign
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestReferencedFields(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		want    []string
+		wantErr bool
+	}{
+		{name: "plain", text: "Hello {{.Name}}, see {{.URL}}", want: []string{"Name", "URL"}},
+		{name: "nested field", text: "{{.Target.Email}}", want: []string{"Target"}},
+		{name: "pipeline", text: `{{.Department | printf "%s"}} {{json .Manager}}`, want: []string{"Department", "Manager"}},
+		{name: "if and else", text: "{{if .Phone}}{{.Phone}}{{else}}{{.Email}}{{end}}", want: []string{"Email", "Phone"}},
+		{name: "range dot", text: "{{range .Tags}}{{.Label}}{{else}}{{.Name}}{{end}}", want: []string{"Name", "Tags"}},
+		{name: "range root", text: "{{range .Tags}}{{$.Department}}{{end}}", want: []string{"Department", "Tags"}},
+		{name: "with dot", text: "{{with .Fields}}{{.Office}}{{end}}", want: []string{"Fields"}},
+		{name: "variable", text: "{{$name := .Name}}{{$name}}", want: []string{"Name"}},
+		{name: "define", text: `{{define "sig"}}{{.AttackerName}}{{end}}{{template "sig" .}}`, want: []string{"AttackerName"}},
+		{name: "no fields", text: "Hello", want: []string{}},
+		{name: "syntax error", text: "{{.Name", wantErr: true},
+		{name: "unknown function", text: "{{upper .Name}}", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := referencedFields("template.html", tt.text)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("referencedFields() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var renderErr *ErrTemplateRender
+			if err != nil && !errors.As(err, &renderErr) {
+				t.Errorf("referencedFields() error = %T, want ErrTemplateRender", err)
+			}
+			if err == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("referencedFields() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckTemplateFields(t *testing.T) {
+	targets := []Target{
+		{Name: "John", Email: "john@example.com", Fields: map[string]string{"Department": "IT", "Office": "Berlin"}},
+		{Name: "Jane", Email: "jane@example.com", Fields: map[string]string{"Department": "HR"}},
+	}
+
+	tests := []struct {
+		name    string
+		body    string
+		shared  bool
+		wantErr string
+	}{
+		{name: "common column", body: "{{.Name}} from {{.Department}}"},
+		{name: "builtin fields", body: "{{.URL}} {{.AttackerName}} {{.Email}}"},
+		{name: "column of some targets", body: "{{.Office}}", wantErr: "undefined fields Office, targets file has columns Department"},
+		{name: "typo", body: "{{.Departmnet}}", wantErr: "undefined fields Departmnet"},
+		{name: "column of shared mail", body: "{{.Department}}", shared: true, wantErr: "undefined fields Department"},
+		{name: "syntax error", body: "{{.Name", wantErr: "unclosed action"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := &Options{}
+			opts.Attack.Template = "template.html"
+			opts.Attack.Body = tt.body
+			opts.General.Bcc = tt.shared
+			err := checkTemplateFields(opts, targets)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("checkTemplateFields() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("checkTemplateFields() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCommonColumns(t *testing.T) {
+	targets := []Target{
+		{Fields: map[string]string{"Office": "Berlin", "Department": "IT", "Manager": "Anna"}},
+		{Fields: map[string]string{"Department": "HR", "Office": "Paris"}},
+	}
+	if got := commonColumns(targets); !reflect.DeepEqual(got, []string{"Department", "Office"}) {
+		t.Errorf("commonColumns() = %v, want [Department Office]", got)
+	}
+	if got := commonColumns(nil); got != nil {
+		t.Errorf("commonColumns(nil) = %v, want nil", got)
+	}
+}
@@ -0,0 +1,71 @@
+package campaign
+
+import (
+	"context"
+	"time"
+
+	"github.com/lateralusd/lateralus/logging"
+)
+
+// follower adds results polled after the campaign to the report
+type follower struct {
+	name string
+	// wait is how long the polling continues after the mails are sent
+	wait     time.Duration
+	interval time.Duration
+	// found is logged with the number of results added by update
+	found  string
+	update func(res *Result) int
+}
+
+// follow keeps adding the results of followers to the report until their
+// wait is over and saves the report with write whenever some were added
+func follow(ctx context.Context, followers []follower, res *Result, write func(*Result) error) error {
+	var longest, interval time.Duration
+	var active []follower
+	for _, f := range followers {
+		if f.wait <= 0 {
+			continue
+		}
+		logging.Infof("Polling %s for %s, press Ctrl+C to stop", f.name, f.wait)
+		active = append(active, f)
+		if f.wait > longest {
+			longest = f.wait
+		}
+		if interval == 0 || f.interval < interval {
+			interval = f.interval
+		}
+	}
+	if len(active) == 0 {
+		return nil
+	}
+
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(ctx, longest)
+	defer cancel()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		changed := false
+		for _, f := range active {
+			if time.Since(start) > f.wait {
+				continue
+			}
+			if n := f.update(res); n > 0 {
+				logging.Infof(f.found+", updating the report", n)
+				changed = true
+			}
+		}
+		if changed {
+			if err := write(res); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package campaign
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+
+	yaml2 "gopkg.in/yaml.v2"
+	"gopkg.in/yaml.v3"
+)
+
+// FormatConfig reindents yaml config with 2 spaces, keeping the order of the
+// keys and the comments. Formatted config is checked to decode into the same
+// Options as the original one.
+func FormatConfig(d []byte) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(d, &doc); err != nil {
+		return nil, fmt.Errorf("FormatConfig: %v", err)
+	}
+	if doc.Kind == 0 {
+		return nil, errors.New("FormatConfig: config is empty")
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return nil, fmt.Errorf("FormatConfig: %v", err)
+	}
+	if err := enc.Close(); err != nil {
+		return nil, fmt.Errorf("FormatConfig: %v", err)
+	}
+
+	var before, after Options
+	if err := yaml2.Unmarshal(d, &before); err != nil {
+		return nil, fmt.Errorf("FormatConfig: %v", err)
+	}
+	if err := yaml2.Unmarshal(buf.Bytes(), &after); err != nil {
+		return nil, fmt.Errorf("FormatConfig: formatted config can not be parsed: %v", err)
+	}
+	if !reflect.DeepEqual(before, after) {
+		return nil, errors.New("FormatConfig: formatted config is not equivalent to the original")
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,272 @@
+package campaign
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// GophishGroup is group of targets as exported by GoPhish API
+type GophishGroup struct {
+	Name    string          `json:"name"`
+	Targets []GophishTarget `json:"targets"`
+}
+
+// GophishTarget is single member of GophishGroup
+type GophishTarget struct {
+	Email     string `json:"email"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+	Position  string `json:"position"`
+}
+
+// GophishTemplate is email template as exported by GoPhish API
+type GophishTemplate struct {
+	Name        string              `json:"name"`
+	Subject     string              `json:"subject"`
+	Text        string              `json:"text"`
+	HTML        string              `json:"html"`
+	Attachments []GophishAttachment `json:"attachments"`
+}
+
+// GophishAttachment holds base64 encoded content of the file
+type GophishAttachment struct {
+	Name    string `json:"name"`
+	Type    string `json:"type"`
+	Content string `json:"content"`
+}
+
+// Data decodes the content of the attachment
+func (a GophishAttachment) Data() ([]byte, error) {
+	return base64.StdEncoding.DecodeString(a.Content)
+}
+
+// readGophish decodes filename holding single object or a list of them,
+// as returned by /api/groups/1 and /api/groups/, into v which is a slice
+func readGophish(filename string, v interface{}) error {
+	d, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	d = bytes.TrimSpace(d)
+	if len(d) > 0 && d[0] == '{' {
+		d = append(append([]byte{'['}, d...), ']')
+	}
+	return json.Unmarshal(d, v)
+}
+
+// ReadGophishGroups reads groups exported from GoPhish
+func ReadGophishGroups(filename string) ([]GophishGroup, error) {
+	var groups []GophishGroup
+	if err := readGophish(filename, &groups); err != nil {
+		return nil, fmt.Errorf("ReadGophishGroups: %v", err)
+	}
+	return groups, nil
+}
+
+// ReadGophishTemplates reads templates exported from GoPhish
+func ReadGophishTemplates(filename string) ([]GophishTemplate, error) {
+	var templates []GophishTemplate
+	if err := readGophish(filename, &templates); err != nil {
+		return nil, fmt.Errorf("ReadGophishTemplates: %v", err)
+	}
+	return templates, nil
+}
+
+// gophishColumns are the header of targets file created from GoPhish groups,
+// they keep the names of GoPhish template fields
+var gophishColumns = []string{"Name", "Email", "FirstName", "LastName", "Position"}
+
+// WriteGophishTargets writes members of the groups as targets file with
+// header row, targets in more groups are written once
+func WriteGophishTargets(w io.Writer, groups []GophishGroup, sep string) (int, error) {
+	lines := []string{strings.Join(gophishColumns, sep)}
+	seen := make(map[string]bool)
+	for _, g := range groups {
+		for _, t := range g.Targets {
+			email := strings.ToLower(strings.TrimSpace(t.Email))
+			if email == "" || seen[email] {
+				continue
+			}
+			seen[email] = true
+
+			name := strings.TrimSpace(t.FirstName + " " + t.LastName)
+			columns := []string{name, email, t.FirstName, t.LastName, t.Position}
+			for _, c := range columns {
+				if strings.Contains(c, sep) {
+					return 0, fmt.Errorf("WriteGophishTargets: %q of %s contains separator %q", c, email, sep)
+				}
+			}
+			lines = append(lines, strings.Join(columns, sep))
+		}
+	}
+
+	if _, err := io.WriteString(w, strings.Join(lines, "\n")+"\n"); err != nil {
+		return 0, fmt.Errorf("WriteGophishTargets: %v", err)
+	}
+	return len(lines) - 1, nil
+}
+
+// gophishFields maps GoPhish template fields to lateralus ones, FirstName,
+// LastName, Position, Email and URL are the same in both with targets file
+// written by WriteGophishTargets. Tracker is dropped as the pixel is added
+// by tracking.url.
+var gophishFields = map[string]string{
+	"RId":         "{{.ID}}",
+	"From":        "{{.AttackerName}}",
+	"TrackingURL": "{{.PixelURL}}",
+	"Tracker":     "",
+}
+
+var gophishField = regexp.MustCompile(`{{\s*\.(\w+)\s*}}`)
+
+// ConvertGophishTemplate replaces GoPhish template fields in tpl with their
+// lateralus equivalents and returns names of the fields without any, e.g.
+// BaseURL
+func ConvertGophishTemplate(tpl string) (string, []string) {
+	unknown := make(map[string]bool)
+	converted := gophishField.ReplaceAllStringFunc(tpl, func(m string) string {
+		field := gophishField.FindStringSubmatch(m)[1]
+		if r, ok := gophishFields[field]; ok {
+			return r
+		}
+		switch field {
+		case "FirstName", "LastName", "Position", "Email", "URL":
+		default:
+			unknown[field] = true
+		}
+		return m
+	})
+
+	var fields []string
+	for f := range unknown {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+	return converted, fields
+}
+
+// Statuses of GoPhish results
+const (
+	gophishError     = "Error"
+	gophishSent      = "Email Sent"
+	gophishOpened    = "Email Opened"
+	gophishClicked   = "Clicked Link"
+	gophishSubmitted = "Submitted Data"
+)
+
+var gophishResultColumns = []string{
+	"id", "status", "ip", "latitude", "longitude", "send_date", "reported",
+	"modified_date", "email", "first_name", "last_name", "position",
+}
+
+// gophishResult is the furthest the target got in the campaign
+type gophishResult struct {
+	status   string
+	ip       string
+	modified string
+}
+
+// WriteGophishResults writes targets of the report as GoPhish campaign
+// results CSV, status of each target is its last step, e.g. Clicked Link
+func WriteGophishResults(w io.Writer, res *Result) error {
+	sent := gophishTime(res.StartTime)
+	results := make(map[string]*gophishResult)
+	for _, t := range res.Targets {
+		r := &gophishResult{status: gophishSent, modified: sent}
+		if t.Status != "" && t.Status != MailSent {
+			r.status = gophishError
+		}
+		results[t.Email] = r
+	}
+
+	step := func(status, email, at, ip string) {
+		r, ok := results[email]
+		if !ok || r.status == gophishError {
+			return
+		}
+		if gophishRank(status) < gophishRank(r.status) {
+			return
+		}
+		r.status = status
+		r.ip = ip
+		r.modified = gophishTime(at)
+	}
+	for _, o := range res.Opens {
+		step(gophishOpened, o.Email, o.Time, o.IP)
+	}
+	for _, rr := range res.Receipts {
+		if rr.Disposition == dispositionDisplayed {
+			step(gophishOpened, rr.Email, rr.Time, "")
+		}
+	}
+	for _, c := range res.Clicks {
+		step(gophishClicked, c.Email, c.Time, c.IP)
+	}
+	for _, s := range res.Submissions {
+		step(gophishSubmitted, s.Email, s.Time, s.IP)
+	}
+
+	cw := csv.NewWriter(w)
+	if err := cw.Write(gophishResultColumns); err != nil {
+		return fmt.Errorf("WriteGophishResults: %v", err)
+	}
+	for _, t := range res.Targets {
+		r := results[t.Email]
+		first, last := splitName(t)
+		err := cw.Write([]string{
+			t.ID, r.status, r.ip, "0", "0", sent, "false",
+			r.modified, t.Email, first, last, t.Fields["Position"],
+		})
+		if err != nil {
+			return fmt.Errorf("WriteGophishResults: %v", err)
+		}
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return fmt.Errorf("WriteGophishResults: %v", err)
+	}
+	return nil
+}
+
+func gophishRank(status string) int {
+	switch status {
+	case gophishOpened:
+		return 1
+	case gophishClicked:
+		return 2
+	case gophishSubmitted:
+		return 3
+	}
+	return 0
+}
+
+// gophishTime turns time of the report into RFC 3339 used by GoPhish
+func gophishTime(at string) string {
+	t, err := time.ParseInLocation(timeFormat, at, time.Local)
+	if err != nil {
+		return at
+	}
+	return t.Format(time.RFC3339)
+}
+
+// splitName returns first and last name of the target, from the columns of
+// targets file if it has them
+func splitName(t SendingMail) (string, string) {
+	if t.Fields["FirstName"] != "" || t.Fields["LastName"] != "" {
+		return t.Fields["FirstName"], t.Fields["LastName"]
+	}
+	parts := strings.SplitN(strings.TrimSpace(t.Name), " ", 2)
+	if len(parts) == 1 {
+		return parts[0], ""
+	}
+	return parts[0], parts[1]
+}
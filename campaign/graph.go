@@ -0,0 +1,75 @@
+package campaign
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Sign in flows of Microsoft Graph
+const (
+	graphClientCredentials = "client"
+	graphDeviceCode        = "device"
+)
+
+const (
+	graphBase      = "https://graph.microsoft.com"
+	graphAuthority = "https://login.microsoftonline.com"
+)
+
+// graph sends the message as MIME with sendMail of Microsoft Graph. With
+// client credentials the app sends as the from address, with device code
+// as the signed in user.
+func (m *apiMailer) graph(p Provider) error {
+	base, host := apiBase(p, graphBase)
+	m.host = host
+	m.user = p.ClientID
+
+	authority := graphAuthority
+	if p.Authority != "" {
+		authority = strings.TrimSuffix(p.Authority, "/")
+	}
+	token := &oauthToken{
+		tokenURL:     fmt.Sprintf("%s/%s/oauth2/v2.0/token", authority, url.PathEscape(p.Tenant)),
+		clientID:     p.ClientID,
+		clientSecret: p.ClientSecret,
+		scope:        base + "/.default",
+		client:       m.client,
+	}
+
+	flow := p.flow()
+	if flow == graphDeviceCode {
+		token.scope = base + "/Mail.Send offline_access"
+		deviceURL := fmt.Sprintf("%s/%s/oauth2/v2.0/devicecode", authority, url.PathEscape(p.Tenant))
+		if err := token.deviceCode(context.Background(), deviceURL); err != nil {
+			return err
+		}
+	}
+
+	m.request = func(msg *message) (*http.Request, error) {
+		access, err := token.get(context.Background())
+		if err != nil {
+			if _, ok := err.(*tokenError); ok {
+				return nil, &ErrSMTPAuth{Host: m.host, User: m.user, Reason: err.Error()}
+			}
+			return nil, err
+		}
+
+		endpoint := base + "/v1.0/me/sendMail"
+		if flow == graphClientCredentials {
+			endpoint = fmt.Sprintf("%s/v1.0/users/%s/sendMail", base, url.PathEscape(msg.from))
+		}
+		body := base64.StdEncoding.EncodeToString([]byte(msg.data))
+		req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+access)
+		req.Header.Set("Content-Type", "text/plain")
+		return req, nil
+	}
+	return nil
+}
@@ -0,0 +1,193 @@
+package campaign
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/textproto"
+	"strings"
+
+	"github.com/lateralusd/lateralus/util"
+	mail "github.com/xhit/go-simple-mail/v2"
+)
+
+// defaultPrecedence suppresses auto replies such as out of office messages
+const defaultPrecedence = "bulk"
+
+// setPrecedence adds Precedence header, bulk is used if precedence is empty
+// and none disables the header
+func setPrecedence(email *mail.Email, precedence string) {
+	switch p := strings.ToLower(precedence); p {
+	case "none":
+	case "":
+		email.AddHeader("Precedence", defaultPrecedence)
+	default:
+		email.AddHeader("Precedence", p)
+	}
+}
+
+// setListID adds List-Id header (RFC 2919) if id is set
+func setListID(email *mail.Email, id string) {
+	if id = normalizeListID(id); id != "" {
+		email.AddHeader("List-Id", "<"+id+">")
+	}
+}
+
+// normalizeListID strips optional angle brackets around the id
+func normalizeListID(id string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(id), "<"), ">")
+}
+
+// validateListID checks that id is a domain name, e.g. campaign.example.com
+func validateListID(id string) error {
+	return validateDomain(normalizeListID(id))
+}
+
+// validateDomain checks that domain has at least two valid labels
+func validateDomain(domain string) error {
+	labels := strings.Split(domain, ".")
+	if len(labels) < 2 {
+		return fmt.Errorf("%q is not a domain name, e.g. campaign.example.com", domain)
+	}
+	for _, l := range labels {
+		if l == "" || len(l) > 63 || l[0] == '-' || l[len(l)-1] == '-' {
+			return fmt.Errorf("%q is not a valid domain name", domain)
+		}
+		for _, c := range l {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+				return fmt.Errorf("%q is not a valid domain name", domain)
+			}
+		}
+	}
+	return nil
+}
+
+// protectedHeaders are set from dedicated options or built from the body and
+// cannot be overridden with custom headers
+var protectedHeaders = map[string]string{
+	"From":                      "mail.name and mail.address",
+	"Sender":                    "mail.address",
+	"To":                        "targets",
+	"Cc":                        "targets",
+	"Bcc":                       "general.bcc",
+	"Reply-To":                  "mail.replyTo",
+	"Return-Path":               "mail.envelopeFrom",
+	"Subject":                   "mail.subject",
+	"Mime-Version":              "",
+	"Content-Type":              "mail.contentType",
+	"Content-Transfer-Encoding": "mail.transferEncoding",
+}
+
+// validateHeaders checks that custom headers have valid names and values
+// and do not replace the headers lateralus sets itself
+func validateHeaders(headers map[string]string) error {
+	for name, value := range headers {
+		if name == "" || strings.IndexFunc(name, func(r rune) bool {
+			return r <= ' ' || r > '~' || r == ':'
+		}) >= 0 {
+			return fmt.Errorf("%q is not a valid header name", name)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("value of %s header contains line break", name)
+		}
+		if opt, ok := protectedHeaders[textproto.CanonicalMIMEHeaderKey(name)]; ok {
+			if opt == "" {
+				return fmt.Errorf("%s header cannot be set", name)
+			}
+			return fmt.Errorf("%s header cannot be set, use %s instead", name, opt)
+		}
+	}
+	return nil
+}
+
+// setHeaders adds custom headers, replacing the ones with the same name
+// added before, e.g. priority headers
+func setHeaders(email *mail.Email, headers map[string]string) {
+	for name, value := range headers {
+		email.AddHeader(name, value)
+	}
+}
+
+// setMessageID adds Message-ID in the domain of from, unless custom headers
+// set it, and returns it. go-simple-mail leaves it to the mail server,
+// which makes it unknown to lateralus.
+func setMessageID(email *mail.Email, headers map[string]string, from string) string {
+	for name, value := range headers {
+		if strings.EqualFold(name, "Message-Id") {
+			return value
+		}
+	}
+	domain := "localhost"
+	if at := strings.LastIndex(from, "@"); at >= 0 {
+		domain = from[at+1:]
+	}
+	id := "<" + util.GenerateUUID(36) + "@" + domain + ">"
+	email.AddHeader("Message-ID", id)
+	return id
+}
+
+// targetHeaderPrefix marks the columns of targets file which set headers
+const targetHeaderPrefix = "Header:"
+
+// headerColumn returns the header name of "Header: X-Foo" column
+func headerColumn(column string) (string, bool) {
+	column = strings.TrimSpace(column)
+	if len(column) <= len(targetHeaderPrefix) || !strings.EqualFold(column[:len(targetHeaderPrefix)], targetHeaderPrefix) {
+		return "", false
+	}
+	return textproto.CanonicalMIMEHeaderKey(strings.TrimSpace(column[len(targetHeaderPrefix):])), true
+}
+
+// renderHeaders returns custom headers of the mail: read receipt request and
+// the campaign headers are templates rendered with m, and headers of the
+// target replace them
+func renderHeaders(opts *Options, m *SendingMail) (map[string]string, error) {
+	headers := make(map[string]string, len(opts.Mail.Headers)+len(m.Headers)+2)
+	if receipt := opts.Mail.ReadReceipt; receipt != "" {
+		if strings.Contains(receipt, "{{") {
+			v, err := renderText("readReceipt", receipt, m)
+			if err != nil {
+				return nil, err
+			}
+			if err := validateAddress(v); err != nil {
+				return nil, &ErrTemplateRender{Template: "readReceipt", Target: m.Name, Err: err}
+			}
+			receipt = v
+		}
+		headers[headerDispositionNotificationTo] = receipt
+		headers[headerReturnReceiptTo] = receipt
+	}
+	for name, value := range opts.Mail.Headers {
+		if strings.Contains(value, "{{") {
+			v, err := renderText("header "+name, value, m)
+			if err != nil {
+				return nil, err
+			}
+			if strings.ContainsAny(v, "\r\n") {
+				return nil, &ErrTemplateRender{Template: "header " + name, Target: m.Name, Err: errors.New("rendered value contains line break")}
+			}
+			value = v
+		}
+		headers[name] = value
+	}
+	for name, value := range m.Headers {
+		headers[name] = value
+	}
+	return headers, nil
+}
+
+// ReadHeaders reads custom headers from JSON object, e.g. {"X-Foo": "bar"}
+func ReadHeaders(filename string) (map[string]string, error) {
+	d, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("ReadHeaders: %v", err)
+	}
+
+	headers := make(map[string]string)
+	if err := json.Unmarshal(d, &headers); err != nil {
+		return nil, fmt.Errorf("ReadHeaders: %v", err)
+	}
+
+	return headers, nil
+}
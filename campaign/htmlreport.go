@@ -0,0 +1,557 @@
+package campaign
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+var htmlTpl = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Campaign {{ .Subject }}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 0; color: #1f2933; background: #f5f7fa; }
+main { max-width: 1100px; margin: 0 auto; padding: 24px; }
+h1 { font-size: 24px; margin: 0 0 4px; }
+h2 { font-size: 18px; margin: 32px 0 12px; }
+.muted { color: #7b8794; }
+.meta { display: grid; grid-template-columns: max-content 1fr; gap: 4px 16px; margin: 16px 0; }
+.meta dt { color: #7b8794; }
+.meta dd { margin: 0; word-break: break-all; }
+.notes { white-space: pre-wrap; background: #fff; border-left: 4px solid #3e4c59; padding: 12px; }
+.cards { display: grid; grid-template-columns: repeat(auto-fill, minmax(150px, 1fr)); gap: 12px; }
+.card { background: #fff; border-radius: 6px; padding: 12px 16px; box-shadow: 0 1px 2px rgba(0,0,0,.08); }
+.card .value { font-size: 28px; font-weight: 600; }
+.card .label { color: #7b8794; font-size: 13px; }
+.bars .bar { display: grid; grid-template-columns: 110px 1fr 110px; align-items: center; gap: 8px; margin: 6px 0; }
+.bars .track { background: #e4e7eb; border-radius: 3px; height: 18px; }
+.bars .fill { height: 18px; border-radius: 3px; min-width: 1px; }
+.sent { background: #2f80ed; fill: #2f80ed; stroke: #2f80ed; }
+.failed { background: #e12d39; fill: #e12d39; stroke: #e12d39; }
+.deferred { background: #f0b429; fill: #f0b429; stroke: #f0b429; }
+.opened { background: #27ab83; fill: #27ab83; stroke: #27ab83; }
+.clicked { background: #f7813e; fill: #f7813e; stroke: #f7813e; }
+.submitted { background: #9446ed; fill: #9446ed; stroke: #9446ed; }
+.captured { background: #ab091e; fill: #ab091e; stroke: #ab091e; }
+svg polyline { fill: none; stroke-width: 2; }
+svg .axis { stroke: #cbd2d9; }
+svg text { fill: #7b8794; font-size: 11px; }
+.legend span { display: inline-block; width: 10px; height: 10px; border-radius: 2px; margin: 0 4px 0 12px; }
+table { border-collapse: collapse; width: 100%; background: #fff; font-size: 13px; }
+th, td { text-align: left; padding: 6px 8px; border-bottom: 1px solid #e4e7eb; vertical-align: top; }
+th { background: #e4e7eb; position: sticky; top: 0; }
+td.error { color: #e12d39; }
+.yes { color: #27ab83; font-weight: 600; }
+.tag { display: inline-block; background: #e4e7eb; border-radius: 3px; padding: 0 4px; margin: 1px; }
+footer { margin: 32px 0 0; font-size: 12px; }
+</style>
+</head>
+<body>
+<main>
+<h1>{{ .Subject }}</h1>
+<div class="muted">Campaign {{ .ID }}</div>
+
+<dl class="meta">
+<dt>Start time</dt><dd>{{ .StartTime }}</dd>
+<dt>End time</dt><dd>{{ .EndTime }}{{ if .Duration }} ({{ .Duration }}){{ end }}</dd>
+<dt>From</dt><dd>{{ .From }}</dd>
+{{ if .AttackerName }}<dt>Attacker name</dt><dd>{{ .AttackerName }}</dd>{{ end }}
+{{ if .URL }}<dt>URL</dt><dd>{{ .URL }}</dd>{{ end }}
+{{ if .Custom }}<dt>Custom</dt><dd>{{ .Custom }}</dd>{{ end }}
+</dl>
+{{ if .Notes }}<div class="notes">{{ .Notes }}</div>{{ end }}
+
+<h2>Summary</h2>
+<div class="cards">
+{{ range .Stats }}<div class="card"><div class="value">{{ .Count }}</div><div class="label">{{ .Label }}{{ if .Percent }} ({{ .Percent }}){{ end }}</div></div>
+{{ end }}</div>
+
+<h2>Delivery</h2>
+<div class="bars">
+{{ range .Statuses }}<div class="bar"><div>{{ .Label }}</div><div class="track"><div class="fill {{ .Class }}" style="width: {{ .Width }}%"></div></div><div>{{ .Count }} ({{ .Percent }})</div></div>
+{{ end }}</div>
+{{ if .Funnel }}
+<h2>Engagement</h2>
+<div class="bars">
+{{ range .Funnel }}<div class="bar"><div>{{ .Label }}</div><div class="track"><div class="fill {{ .Class }}" style="width: {{ .Width }}%"></div></div><div>{{ .Count }} ({{ .Percent }})</div></div>
+{{ end }}</div>
+<p class="muted">Unique targets, percent of the sent mails.</p>
+{{ end }}{{ with .Timeline }}
+<h2>Timeline</h2>
+<div class="legend">{{ range .Series }}<span class="{{ .Class }}"></span>{{ .Label }} ({{ .Total }}){{ end }} <span class="muted">per {{ .Bucket }}</span></div>
+<svg viewBox="0 0 {{ .Width }} {{ .Height }}" width="100%" role="img">
+{{ range .YTicks }}<line class="axis" x1="{{ $.Timeline.Left }}" y1="{{ .Y }}" x2="{{ $.Timeline.Right }}" y2="{{ .Y }}"/><text x="{{ $.Timeline.LabelX }}" y="{{ .Y }}" text-anchor="end" dy="4">{{ .Label }}</text>
+{{ end }}{{ range .XTicks }}<text x="{{ .X }}" y="{{ $.Timeline.LabelY }}" text-anchor="middle">{{ .Label }}</text>
+{{ end }}{{ range .Series }}<polyline class="{{ .Class }}" points="{{ .Points }}"/>{{ $class := .Class }}{{ range .Dots }}<circle class="{{ $class }}" cx="{{ .X }}" cy="{{ .Y }}" r="2.5"/>{{ end }}
+{{ end }}</svg>
+{{ end }}{{ if .Variants }}
+<h2>Variants</h2>
+<table>
+<tr><th>Name</th><th>Targets</th><th>Sent</th><th>Clicks</th><th>Subject</th><th>Template</th></tr>
+{{ range .Variants }}<tr><td>{{ .Name }}</td><td>{{ .Targets }}</td><td>{{ .Sent }}</td><td>{{ .Clicks }}</td><td>{{ .Subject }}</td><td>{{ .Template }}</td></tr>
+{{ end }}</table>
+{{ end }}
+<h2>Targets</h2>
+<table>
+<tr><th>Name</th><th>Email</th><th>Status</th><th>Sent</th>{{ if .Tracking }}<th>Opened</th><th>Clicked</th><th>Submitted</th>{{ end }}{{ if .HasCaptured }}<th>Captured</th>{{ end }}{{ if .Replies }}<th>Reply</th>{{ end }}{{ if .Variants }}<th>Variant</th>{{ end }}{{ if .HasTags }}<th>Tags</th>{{ end }}</tr>
+{{ range .Rows }}<tr><td>{{ .Name }}</td><td>{{ .Email }}</td><td{{ if .Error }} class="error" title="{{ .Error }}"{{ end }}>{{ .Status }}</td><td>{{ .SentTime }}</td>{{ if $.Tracking }}<td>{{ if .Opened }}<span class="yes">yes</span>{{ end }}</td><td>{{ if .Clicked }}<span class="yes">yes</span>{{ end }}</td><td>{{ if .Submitted }}<span class="yes">yes</span>{{ end }}</td>{{ end }}{{ if $.HasCaptured }}<td>{{ if .Captured }}<span class="yes">yes</span>{{ end }}</td>{{ end }}{{ if $.Replies }}<td>{{ .Reply }}</td>{{ end }}{{ if $.Variants }}<td>{{ .Variant }}</td>{{ end }}{{ if $.HasTags }}<td>{{ range .Tags }}<span class="tag">{{ . }}</span>{{ end }}</td>{{ end }}</tr>
+{{ end }}</table>
+{{ if .Clicks }}
+<h2>Clicks</h2>
+<table>
+<tr><th>Time</th><th>Name</th><th>Email</th><th>IP</th><th>User agent</th></tr>
+{{ range .Clicks }}<tr><td>{{ .Time }}</td><td>{{ .Name }}</td><td>{{ .Email }}</td><td>{{ .IP }}</td><td>{{ .UserAgent }}{{ if .Simulated }} (simulated){{ end }}</td></tr>
+{{ end }}</table>
+{{ end }}{{ if .Opens }}
+<h2>Opens</h2>
+<table>
+<tr><th>Time</th><th>Name</th><th>Email</th><th>IP</th><th>User agent</th></tr>
+{{ range .Opens }}<tr><td>{{ .Time }}</td><td>{{ .Name }}</td><td>{{ .Email }}</td><td>{{ .IP }}</td><td>{{ .UserAgent }}</td></tr>
+{{ end }}</table>
+{{ end }}{{ if .Submissions }}
+<h2>Submissions</h2>
+<table>
+<tr><th>Time</th><th>Name</th><th>Email</th><th>IP</th><th>Fields</th></tr>
+{{ range .Submissions }}<tr><td>{{ .Time }}</td><td>{{ .Name }}</td><td>{{ .Email }}</td><td>{{ .IP }}</td><td>{{ fieldNames .Fields }}</td></tr>
+{{ end }}</table>
+{{ end }}{{ if .Sessions }}
+<h2>Captured sessions</h2>
+<table>
+<tr><th>Time</th><th>Name</th><th>Email</th><th>IP</th><th>Username</th><th>Password</th><th>Tokens</th><th>Source</th></tr>
+{{ range .Sessions }}<tr><td>{{ .Time }}</td><td>{{ .Name }}</td><td>{{ .Email }}</td><td>{{ .IP }}</td><td>{{ .Username }}</td><td>{{ if .Password }}captured{{ else }}-{{ end }}</td><td>{{ .Tokens }}</td><td>{{ .Source }}</td></tr>
+{{ end }}</table>
+{{ end }}{{ if .Receipts }}
+<h2>Read receipts</h2>
+<table>
+<tr><th>Time</th><th>Name</th><th>Email</th><th>Disposition</th><th>Mail client</th></tr>
+{{ range .Receipts }}<tr><td>{{ .Time }}</td><td>{{ .Name }}</td><td>{{ .Email }}</td><td>{{ .Disposition }}</td><td>{{ .ReportingUA }}</td></tr>
+{{ end }}</table>
+{{ end }}{{ if .Replies }}
+<h2>Bounces and replies</h2>
+<table>
+<tr><th>Time</th><th>Name</th><th>Email</th><th>Kind</th><th>Status</th><th>Subject</th></tr>
+{{ range .Replies }}<tr><td>{{ .Time }}</td><td>{{ .Name }}</td><td>{{ .Email }}</td><td>{{ .Kind }}</td><td{{ if .Diagnostic }} title="{{ .Diagnostic }}"{{ end }}>{{ .Status }}</td><td>{{ .Subject }}</td></tr>
+{{ end }}</table>
+{{ end }}
+<footer class="muted">Generated by lateralus at {{ .Generated }}</footer>
+</main>
+</body>
+</html>
+`
+
+// timelineBuckets are the bucket sizes the timeline picks from, the first
+// one giving at most maxTimelineBuckets is used
+var timelineBuckets = []struct {
+	d    time.Duration
+	name string
+}{
+	{time.Minute, "minute"},
+	{5 * time.Minute, "5 minutes"},
+	{15 * time.Minute, "15 minutes"},
+	{time.Hour, "hour"},
+	{3 * time.Hour, "3 hours"},
+	{6 * time.Hour, "6 hours"},
+	{24 * time.Hour, "day"},
+	{7 * 24 * time.Hour, "week"},
+}
+
+const maxTimelineBuckets = 60
+
+// htmlReport is what the HTML report is rendered from
+type htmlReport struct {
+	*Result
+	Generated   string
+	Duration    string
+	Tracking    bool
+	HasCaptured bool
+	HasTags     bool
+	Stats       []htmlBar
+	Statuses    []htmlBar
+	Funnel      []htmlBar
+	Timeline    *htmlTimeline
+	Rows        []htmlTarget
+}
+
+// htmlBar is number of targets, Percent of them is shown and Width is the
+// length of bar relative to the longest one
+type htmlBar struct {
+	Label   string
+	Class   string
+	Count   int
+	Percent string
+	Width   float64
+}
+
+type htmlTarget struct {
+	Name      string
+	Email     string
+	Status    string
+	Error     string
+	SentTime  string
+	Variant   string
+	Tags      []string
+	Reply     string
+	Opened    bool
+	Clicked   bool
+	Submitted bool
+	Captured  bool
+}
+
+// htmlTimeline is SVG chart of events per bucket
+type htmlTimeline struct {
+	Width, Height  int
+	Left, Right    float64
+	LabelX, LabelY float64
+	Bucket         string
+	Series         []htmlSeries
+	XTicks, YTicks []htmlTick
+}
+
+type htmlSeries struct {
+	Label  string
+	Class  string
+	Total  int
+	Points string
+	Dots   []htmlTick
+}
+
+type htmlTick struct {
+	X, Y  float64
+	Label string
+}
+
+func createHTML(w io.Writer, res *Result) error {
+	t, err := template.New("").Funcs(template.FuncMap{
+		"fieldNames": func(fields map[string]string) string {
+			// values can be credentials, they are left out of the report
+			var names []string
+			for k := range fields {
+				names = append(names, k)
+			}
+			sort.Strings(names)
+			return strings.Join(names, ", ")
+		},
+	}).Parse(htmlTpl)
+	if err != nil {
+		return fmt.Errorf("createHTML: %v", err)
+	}
+
+	if err := t.Execute(w, newHTMLReport(res)); err != nil {
+		return fmt.Errorf("createHTML: %v", err)
+	}
+	return nil
+}
+
+func newHTMLReport(res *Result) *htmlReport {
+	r := &htmlReport{
+		Result:    res,
+		Generated: time.Now().Format(timeFormat),
+	}
+	if start, ok := parseReportTime(res.StartTime); ok {
+		if end, ok := parseReportTime(res.EndTime); ok && !end.Before(start) {
+			r.Duration = end.Sub(start).Round(time.Second).String()
+		}
+	}
+
+	byEmail := func(emails ...[]string) map[string]bool {
+		m := make(map[string]bool)
+		for _, list := range emails {
+			for _, e := range list {
+				m[strings.ToLower(e)] = true
+			}
+		}
+		return m
+	}
+	var opens, clicks, submissions, captured []string
+	for _, e := range res.Opens {
+		opens = append(opens, e.Email)
+	}
+	for _, e := range res.Receipts {
+		opens = append(opens, e.Email)
+	}
+	for _, e := range res.Clicks {
+		clicks = append(clicks, e.Email)
+	}
+	for _, e := range res.Submissions {
+		submissions = append(submissions, e.Email)
+	}
+	for _, e := range res.Sessions {
+		captured = append(captured, e.Email)
+	}
+	opened, clicked, submitted, capturedBy := byEmail(opens), byEmail(clicks), byEmail(submissions), byEmail(captured)
+	replies := make(map[string]string)
+	for _, rp := range res.Replies {
+		if _, ok := replies[strings.ToLower(rp.Email)]; !ok {
+			replies[strings.ToLower(rp.Email)] = rp.Kind
+		}
+	}
+
+	counts := make(map[string]int)
+	var nOpened, nClicked, nSubmitted, nCaptured, nBounced int
+	for _, t := range res.Targets {
+		email := strings.ToLower(t.Email)
+		status := t.Status
+		if status == "" {
+			status = "pending"
+		}
+		counts[status]++
+		row := htmlTarget{
+			Name:      t.Name,
+			Email:     t.Email,
+			Status:    status,
+			Error:     t.SendError,
+			SentTime:  t.SentTime,
+			Variant:   t.Variant,
+			Tags:      t.Tags,
+			Reply:     replies[email],
+			Opened:    opened[email],
+			Clicked:   clicked[email],
+			Submitted: submitted[email],
+			Captured:  capturedBy[email],
+		}
+		if t.PixelURL != "" {
+			r.Tracking = true
+		}
+		if len(t.Tags) > 0 {
+			r.HasTags = true
+		}
+		for _, b := range []struct {
+			ok bool
+			n  *int
+		}{{row.Opened, &nOpened}, {row.Clicked, &nClicked}, {row.Submitted, &nSubmitted}, {row.Captured, &nCaptured}} {
+			if b.ok {
+				*b.n++
+			}
+		}
+		if strings.Contains(row.Reply, "bounce") {
+			nBounced++
+		}
+		r.Rows = append(r.Rows, row)
+	}
+	if len(res.Opens)+len(res.Clicks)+len(res.Submissions) > 0 {
+		r.Tracking = true
+	}
+	r.HasCaptured = nCaptured > 0
+
+	total, sent := len(res.Targets), counts[MailSent]
+	r.Stats = []htmlBar{
+		{Label: "targets", Count: total},
+		{Label: "sent", Count: sent, Percent: percent(sent, total)},
+	}
+	if failed := total - sent; failed > 0 {
+		r.Stats = append(r.Stats, htmlBar{Label: "not sent", Count: failed, Percent: percent(failed, total)})
+	}
+	if r.Tracking {
+		r.Stats = append(r.Stats,
+			htmlBar{Label: "opened", Count: nOpened, Percent: percent(nOpened, sent)},
+			htmlBar{Label: "clicked", Count: nClicked, Percent: percent(nClicked, sent)},
+			htmlBar{Label: "submitted", Count: nSubmitted, Percent: percent(nSubmitted, sent)},
+		)
+	}
+	if r.HasCaptured {
+		r.Stats = append(r.Stats, htmlBar{Label: "captured", Count: nCaptured, Percent: percent(nCaptured, sent)})
+	}
+	if len(res.Replies) > 0 {
+		r.Stats = append(r.Stats,
+			htmlBar{Label: "bounced", Count: nBounced, Percent: percent(nBounced, sent)},
+			htmlBar{Label: "replies and bounces", Count: len(res.Replies)},
+		)
+	}
+
+	var statuses []string
+	for s := range counts {
+		statuses = append(statuses, s)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		if (statuses[i] == MailSent) != (statuses[j] == MailSent) {
+			return statuses[i] == MailSent
+		}
+		return statuses[i] < statuses[j]
+	})
+	for _, s := range statuses {
+		r.Statuses = append(r.Statuses, htmlBar{Label: s, Class: statusClass(s), Count: counts[s], Percent: percent(counts[s], total)})
+	}
+	scaleBars(r.Statuses, total)
+
+	if r.Tracking || r.HasCaptured {
+		r.Funnel = []htmlBar{
+			{Label: "sent", Class: "sent", Count: sent, Percent: percent(sent, sent)},
+			{Label: "opened", Class: "opened", Count: nOpened, Percent: percent(nOpened, sent)},
+			{Label: "clicked", Class: "clicked", Count: nClicked, Percent: percent(nClicked, sent)},
+			{Label: "submitted", Class: "submitted", Count: nSubmitted, Percent: percent(nSubmitted, sent)},
+		}
+		if r.HasCaptured {
+			r.Funnel = append(r.Funnel, htmlBar{Label: "captured", Class: "captured", Count: nCaptured, Percent: percent(nCaptured, sent)})
+		}
+		scaleBars(r.Funnel, sent)
+	}
+
+	r.Timeline = newTimeline(res)
+	return r
+}
+
+func statusClass(status string) string {
+	switch status {
+	case MailSent:
+		return "sent"
+	case "deferred", "pending":
+		return "deferred"
+	}
+	return "failed"
+}
+
+func percent(n, total int) string {
+	if total == 0 {
+		return "0%"
+	}
+	return fmt.Sprintf("%.1f%%", float64(n)*100/float64(total))
+}
+
+// scaleBars sets width of the bars relative to total
+func scaleBars(bars []htmlBar, total int) {
+	for i := range bars {
+		if total > 0 {
+			bars[i].Width = math.Round(float64(bars[i].Count)*1000/float64(total)) / 10
+		}
+	}
+}
+
+// parseReportTime parses times of the report, saved in local time
+func parseReportTime(s string) (time.Time, bool) {
+	t, err := time.ParseInLocation(timeFormat, s, time.Local)
+	if err != nil {
+		if t, err = time.Parse(time.RFC3339, s); err != nil {
+			return time.Time{}, false
+		}
+	}
+	return t, true
+}
+
+// newTimeline counts the sent mails, opens, clicks and submissions per
+// bucket, nil if the report has no times
+func newTimeline(res *Result) *htmlTimeline {
+	series := []struct {
+		label, class string
+		times        []time.Time
+	}{
+		{label: "sent", class: "sent"},
+		{label: "opened", class: "opened"},
+		{label: "clicked", class: "clicked"},
+		{label: "submitted", class: "submitted"},
+	}
+	add := func(i int, s string) {
+		if t, ok := parseReportTime(s); ok {
+			series[i].times = append(series[i].times, t)
+		}
+	}
+	for _, t := range res.Targets {
+		add(0, t.SentTime)
+	}
+	for _, e := range res.Opens {
+		add(1, e.Time)
+	}
+	for _, e := range res.Clicks {
+		add(2, e.Time)
+	}
+	for _, e := range res.Submissions {
+		add(3, e.Time)
+	}
+
+	var first, last time.Time
+	for _, s := range series {
+		for _, t := range s.times {
+			if first.IsZero() || t.Before(first) {
+				first = t
+			}
+			if t.After(last) {
+				last = t
+			}
+		}
+	}
+	if first.IsZero() {
+		return nil
+	}
+
+	bucket := timelineBuckets[len(timelineBuckets)-1]
+	for _, b := range timelineBuckets {
+		if int(last.Sub(first.Truncate(b.d))/b.d) < maxTimelineBuckets {
+			bucket = b
+			break
+		}
+	}
+	start := first.Truncate(bucket.d)
+	n := int(last.Sub(start)/bucket.d) + 1
+
+	tl := &htmlTimeline{
+		Width:  900,
+		Height: 260,
+		Left:   48,
+		Right:  890,
+		LabelX: 42,
+		LabelY: 252,
+		Bucket: bucket.name,
+	}
+	top, bottom := 10.0, 230.0
+	step := (tl.Right - tl.Left) / float64(n)
+	x := func(i int) float64 { return math.Round((tl.Left+(float64(i)+0.5)*step)*10) / 10 }
+
+	maxY := 1
+	var buckets [][]int
+	for _, s := range series {
+		counts := make([]int, n)
+		for _, t := range s.times {
+			counts[int(t.Sub(start)/bucket.d)]++
+		}
+		for _, c := range counts {
+			if c > maxY {
+				maxY = c
+			}
+		}
+		buckets = append(buckets, counts)
+	}
+	y := func(v int) float64 { return math.Round((bottom-float64(v)*(bottom-top)/float64(maxY))*10) / 10 }
+
+	for i, s := range series {
+		if len(s.times) == 0 {
+			continue
+		}
+		hs := htmlSeries{Label: s.label, Class: s.class, Total: len(s.times)}
+		var points []string
+		for j, c := range buckets[i] {
+			points = append(points, fmt.Sprintf("%g,%g", x(j), y(c)))
+			if c > 0 {
+				hs.Dots = append(hs.Dots, htmlTick{X: x(j), Y: y(c)})
+			}
+		}
+		hs.Points = strings.Join(points, " ")
+		tl.Series = append(tl.Series, hs)
+	}
+
+	ticks := []int{0, maxY}
+	if maxY >= 4 {
+		ticks = []int{0, maxY / 2, maxY}
+	}
+	for _, v := range ticks {
+		tl.YTicks = append(tl.YTicks, htmlTick{Y: y(v), Label: fmt.Sprint(v)})
+	}
+
+	layout := "15:04"
+	switch {
+	case bucket.d >= 24*time.Hour:
+		layout = "Jan 2"
+	case last.YearDay() != first.YearDay() || last.Year() != first.Year():
+		layout = "Jan 2 15:04"
+	}
+	every := int(math.Ceil(float64(n) / 8))
+	for i := 0; i < n; i += every {
+		tl.XTicks = append(tl.XTicks, htmlTick{X: x(i), Label: start.Add(time.Duration(i) * bucket.d).Format(layout)})
+	}
+	return tl
+}
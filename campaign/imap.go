@@ -0,0 +1,231 @@
+package campaign
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lateralusd/lateralus/email"
+	"github.com/lateralusd/lateralus/logging"
+)
+
+const (
+	defaultIMAPInterval = time.Minute
+	defaultIMAPMailbox  = "INBOX"
+	// imapClockSkew is how much earlier than the campaign start messages
+	// can be dated, clocks of the remote servers are not exact
+	imapClockSkew = 5 * time.Minute
+)
+
+// IMAP is the mailbox of the sender which is polled for bounces, replies
+// and read receipts during and after the campaign
+type IMAP struct {
+	Host string `yaml:"host"`
+	// Port is 993 with ssl encryption and 143 otherwise by default
+	Port int `yaml:"port"`
+	// Encryption is none, starttls or ssl (default)
+	Encryption string `yaml:"encryption"`
+	// Username and Password default to the ones of the first mail server,
+	// together with its OAuth
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	// Mailbox is INBOX by default
+	Mailbox string `yaml:"mailbox"`
+	// Interval between the polls, 1m by default
+	Interval string `yaml:"interval"`
+	// Wait is how long the polling continues after the mails are sent
+	Wait string `yaml:"wait"`
+	TLS  TLS    `yaml:"tls"`
+}
+
+func (m IMAP) interval() (time.Duration, error) {
+	if m.Interval == "" {
+		return defaultIMAPInterval, nil
+	}
+	return time.ParseDuration(m.Interval)
+}
+
+func (m IMAP) wait() (time.Duration, error) {
+	if m.Wait == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(m.Wait)
+}
+
+func (m IMAP) mailbox() string {
+	if m.Mailbox == "" {
+		return defaultIMAPMailbox
+	}
+	return m.Mailbox
+}
+
+// server returns the mailbox as mail server, so that it is dialed the same
+// way, filling in the defaults and credentials of primary
+func (m IMAP) server(primary MailServer) MailServer {
+	s := MailServer{
+		Host:       m.Host,
+		Port:       m.Port,
+		Encryption: m.Encryption,
+		Username:   m.Username,
+		Password:   m.Password,
+		TLS:        m.TLS,
+	}
+	if s.Encryption == "" {
+		s.Encryption = encryptionSSL
+	}
+	if s.Port == 0 {
+		s.Port = 143
+		if s.Encryption == encryptionSSL {
+			s.Port = 993
+		}
+	}
+	if s.Username == "" && s.Password == "" {
+		s.Username, s.Password, s.OAuth = primary.Username, primary.Password, primary.OAuth
+	}
+	return s
+}
+
+func validateIMAP(m IMAP) error {
+	if m.Host == "" {
+		return nil
+	}
+	if err := validateEncryption(m.Encryption); err != nil {
+		return err
+	}
+	if m.Port < 0 || m.Port > 65535 {
+		return fmt.Errorf("port %d is out of range", m.Port)
+	}
+	if d, err := m.interval(); err != nil || d < time.Second {
+		return fmt.Errorf("interval %q is not duration of at least 1s", m.Interval)
+	}
+	if d, err := m.wait(); err != nil || d < 0 {
+		return fmt.Errorf("wait %q is not duration", m.Wait)
+	}
+	if _, err := m.TLS.config(m.Host); err != nil {
+		return err
+	}
+	return nil
+}
+
+// imapPoller keeps the replies and read receipts found in the mailbox
+type imapPoller struct {
+	opts   IMAP
+	dialer *email.Dialer
+	// since is the start of the campaign, older messages are not fetched
+	since time.Time
+	// fetching serializes the polls, mu guards the results
+	fetching sync.Mutex
+	mu       sync.Mutex
+	seen     map[uint32]bool
+	replies  []*email.Reply
+	receipts []*email.MDN
+}
+
+func newIMAPPoller(opts *Options, since time.Time) (*imapPoller, error) {
+	d, err := newDialer(opts.IMAP.server(opts.MailServers.Primary()), opts.proxyURL())
+	if err != nil {
+		return nil, fmt.Errorf("newIMAPPoller: %v", err)
+	}
+	return &imapPoller{
+		opts:   opts.IMAP,
+		dialer: d,
+		since:  since,
+		seen:   make(map[uint32]bool),
+	}, nil
+}
+
+// run polls the mailbox every interval until ctx is done
+func (p *imapPoller) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		p.poll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *imapPoller) poll(ctx context.Context) {
+	if err := p.fetch(); err != nil && ctx.Err() == nil {
+		logging.Warningf("Error polling IMAP mailbox: %v", err)
+	}
+}
+
+// fetch reads the messages received since the start of the campaign which
+// were not read before
+func (p *imapPoller) fetch() error {
+	p.fetching.Lock()
+	defer p.fetching.Unlock()
+
+	c, err := p.dialer.DialIMAP()
+	if err != nil {
+		return fmt.Errorf("fetch: %v", err)
+	}
+	defer c.Logout()
+
+	if err := c.Examine(p.opts.mailbox()); err != nil {
+		return fmt.Errorf("fetch: %v", err)
+	}
+	uids, err := c.SearchSince(p.since)
+	if err != nil {
+		return fmt.Errorf("fetch: %v", err)
+	}
+
+	p.mu.Lock()
+	var unseen []uint32
+	for _, uid := range uids {
+		if !p.seen[uid] {
+			unseen = append(unseen, uid)
+		}
+	}
+	p.mu.Unlock()
+
+	raw, err := c.Fetch(unseen)
+	if err != nil {
+		return fmt.Errorf("fetch: %v", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, uid := range unseen {
+		d, ok := raw[uid]
+		if !ok {
+			continue
+		}
+		p.seen[uid] = true
+		msg, err := email.ParseMessage(bytes.NewReader(d))
+		if err != nil {
+			logging.Warningf("Error parsing message %d of IMAP mailbox: %v", uid, err)
+			continue
+		}
+		// the day of the campaign start is searched whole
+		if date, err := msg.Header.Date(); err == nil && date.Before(p.since.Add(-imapClockSkew)) {
+			continue
+		}
+		if mdn, ok := email.ParseMDN(msg); ok {
+			p.receipts = append(p.receipts, mdn)
+		} else if reply, ok := email.ClassifyReply(msg); ok {
+			p.replies = append(p.replies, reply)
+		}
+	}
+	return nil
+}
+
+// snapshot returns the replies and read receipts found so far
+func (p *imapPoller) snapshot() ([]*email.Reply, []*email.MDN) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]*email.Reply(nil), p.replies...), append([]*email.MDN(nil), p.receipts...)
+}
+
+// update adds what was found in the mailbox to the report and returns the
+// number of added replies and receipts
+func (p *imapPoller) update(res *Result) int {
+	replies, receipts := p.snapshot()
+	return res.AddReplies(replies) + res.AddReceipts(receipts)
+}
@@ -0,0 +1,198 @@
+package campaign
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lateralusd/lateralus/email"
+	"github.com/lateralusd/lateralus/logging"
+)
+
+const (
+	defaultLDAPFilter   = "(mail=*)"
+	defaultLDAPPageSize = 500
+)
+
+// defaultLDAPAttributes are read unless attributes map the fields elsewhere
+var defaultLDAPAttributes = map[string]string{
+	"name":       "displayName",
+	"email":      "mail",
+	"department": "department",
+}
+
+// LDAP is directory, e.g. Active Directory, the targets are read from
+// instead of targets file
+type LDAP struct {
+	Host string `yaml:"host"`
+	// Port is 636 with ssl encryption and 389 otherwise by default
+	Port int `yaml:"port"`
+	// Encryption is none, starttls or ssl (default)
+	Encryption string `yaml:"encryption"`
+	// BindDN is who to bind as, e.g. CN=svc,OU=Users,DC=example,DC=com or
+	// svc@example.com with Active Directory. The bind is anonymous without it.
+	BindDN   string `yaml:"bindDN"`
+	Password string `yaml:"password"`
+	// BaseDN is where the search starts, e.g. OU=Staff,DC=example,DC=com
+	BaseDN string `yaml:"baseDN"`
+	// Filter selects the targets, (mail=*) by default
+	Filter string `yaml:"filter"`
+	// Attributes map template fields to LDAP attributes, added to name,
+	// email and department read from displayName, mail and department
+	Attributes map[string]string `yaml:"attributes"`
+	// PageSize is the number of objects fetched at once, 500 by default
+	PageSize int `yaml:"pageSize"`
+	TLS      TLS `yaml:"tls"`
+}
+
+func (l LDAP) filter() string {
+	if l.Filter == "" {
+		return defaultLDAPFilter
+	}
+	return l.Filter
+}
+
+func (l LDAP) pageSize() int {
+	if l.PageSize == 0 {
+		return defaultLDAPPageSize
+	}
+	return l.PageSize
+}
+
+// attributes returns the template fields with their attributes
+func (l LDAP) attributes() map[string]string {
+	attrs := make(map[string]string)
+	for f, a := range defaultLDAPAttributes {
+		attrs[f] = a
+	}
+	for f, a := range l.Attributes {
+		for d := range defaultLDAPAttributes {
+			if strings.EqualFold(f, d) {
+				delete(attrs, d)
+			}
+		}
+		attrs[f] = a
+	}
+	return attrs
+}
+
+// server returns the directory as mail server, so that it is dialed the
+// same way, filling in the defaults
+func (l LDAP) server() MailServer {
+	s := MailServer{
+		Host:       l.Host,
+		Port:       l.Port,
+		Encryption: l.Encryption,
+		Username:   l.BindDN,
+		Password:   l.Password,
+		TLS:        l.TLS,
+	}
+	if s.Encryption == "" {
+		s.Encryption = encryptionSSL
+	}
+	if s.Port == 0 {
+		s.Port = 389
+		if s.Encryption == encryptionSSL {
+			s.Port = 636
+		}
+	}
+	return s
+}
+
+// url describes the directory in logs, e.g. ldaps://dc.example.com:636/DC=example,DC=com
+func (l LDAP) url() string {
+	s := l.server()
+	scheme := "ldap"
+	if s.Encryption == encryptionSSL {
+		scheme = "ldaps"
+	}
+	return fmt.Sprintf("%s://%s/%s", scheme, net.JoinHostPort(s.Host, strconv.Itoa(s.Port)), l.BaseDN)
+}
+
+func validateLDAP(l LDAP) error {
+	if l.Host == "" {
+		return nil
+	}
+	if l.BaseDN == "" {
+		return fmt.Errorf("baseDN is required")
+	}
+	if err := validateEncryption(l.Encryption); err != nil {
+		return err
+	}
+	if l.Port < 0 || l.Port > 65535 {
+		return fmt.Errorf("port %d is out of range", l.Port)
+	}
+	if l.PageSize < 0 {
+		return fmt.Errorf("pageSize %d is negative", l.PageSize)
+	}
+	if err := email.CheckLDAPFilter(l.filter()); err != nil {
+		return fmt.Errorf("invalid filter %q: %v", l.filter(), err)
+	}
+	for f, a := range l.Attributes {
+		if strings.TrimSpace(f) == "" || strings.TrimSpace(a) == "" {
+			return fmt.Errorf("field %q is mapped to attribute %q, neither can be empty", f, a)
+		}
+	}
+	if _, err := l.TLS.config(l.Host); err != nil {
+		return err
+	}
+	return nil
+}
+
+// readLDAP searches the directory and returns the objects as rows, the
+// first one is header with the template fields. Objects without email are
+// skipped, num of the rows is the position of the object in the results.
+func readLDAP(opts *Options) ([]targetRow, error) {
+	l := opts.Attack.LDAP
+	d, err := newDialer(l.server(), opts.proxyURL())
+	if err != nil {
+		return nil, fmt.Errorf("readLDAP: %v", err)
+	}
+	conn, err := d.DialLDAP()
+	if err != nil {
+		return nil, fmt.Errorf("readLDAP: %v", err)
+	}
+	defer conn.Close()
+
+	attrs := l.attributes()
+	var fields, names []string
+	for f := range attrs {
+		fields = append(fields, f)
+	}
+	sort.Strings(fields)
+	emailAttr := ""
+	for _, f := range fields {
+		names = append(names, attrs[f])
+		if strings.EqualFold(f, "email") {
+			emailAttr = attrs[f]
+		}
+	}
+
+	entries, err := conn.Search(l.BaseDN, l.filter(), names, l.pageSize())
+	if err != nil {
+		return nil, fmt.Errorf("readLDAP: %v", err)
+	}
+
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	rows := []targetRow{{num: 0, cells: fields}}
+	skipped := 0
+	for i, e := range entries {
+		row := targetRow{num: i + 1, cells: make([]string, len(fields))}
+		for j := range fields {
+			row.cells[j] = e.Get(names[j])
+		}
+		if strings.TrimSpace(e.Get(emailAttr)) == "" {
+			skipped++
+			continue
+		}
+		rows = append(rows, row)
+	}
+	if skipped > 0 {
+		logging.Warningf("Skipped %d of %d objects found in LDAP without %s", skipped, len(entries), emailAttr)
+	}
+	return rows, nil
+}
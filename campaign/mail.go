@@ -0,0 +1,683 @@
+package campaign
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/cheggaaa/pb/v3"
+	"github.com/lateralusd/lateralus/email"
+	"github.com/lateralusd/lateralus/logging"
+	"github.com/lateralusd/lateralus/tracking"
+	"github.com/lateralusd/lateralus/util"
+	mail "github.com/xhit/go-simple-mail/v2"
+)
+
+// SendingMail struct holds all the information required to send single mail
+type SendingMail struct {
+	Target
+	// ID identifies the target within the campaign, e.g. in VERP address
+	ID   string
+	Body string
+	// TextBody is plain text alternative of Body, if it is set
+	TextBody     string
+	AttackerName string
+	URL          string
+	Custom       string
+	// Server is the host of the mail server which accepted the mail
+	Server string
+	// Status is the final disposition of the mail: sent, failed or deferred,
+	// SendError holds the last rejection and Attempts the number of tries
+	Status    string
+	SendError string
+	Attempts  int
+	// TrackingHost is the host of URL when it is rotated over url.hosts
+	TrackingHost string
+	// Variant is the name of the lure variant the target got and Subject
+	// the subject of its mail
+	Variant string `json:",omitempty"`
+	Subject string
+	// PixelURL is the tracking pixel of the target, if tracking is enabled
+	PixelURL string `json:",omitempty"`
+	// MessageID of the sent mail, replies are matched with the target by it
+	MessageID string `json:",omitempty"`
+	// SentTime is when the mail server accepted the mail
+	SentTime string `json:",omitempty" xml:",omitempty"`
+	// Group is the number of the mail the target received together with
+	// other targets when sending multiple recipients per message
+	Group int
+	// SMS is the rendered SMS template, SMSSent is set once the provider
+	// accepted it
+	SMS     string
+	SMSSent bool
+	// CallSID identifies the call to target, CallStatus is its last known
+	// status, e.g. completed or no-answer
+	CallSID    CallSID
+	CallStatus string
+
+	// headers are the custom headers rendered for the target
+	headers map[string]string
+}
+
+func prepareTemplates(targets []Target, opts *Options) ([]SendingMail, error) {
+	var mails []SendingMail
+	variants := assignVariants(opts.Attack.Variants, len(targets))
+	var lures []string
+	if opts.Url.Lures != "" {
+		urls, err := loadLures(opts)
+		if err != nil {
+			return []SendingMail{}, fmt.Errorf("prepareTemplates: %v", err)
+		}
+		if lures, err = lureURLs(urls, targets); err != nil {
+			return []SendingMail{}, fmt.Errorf("prepareTemplates: %v", err)
+		}
+	}
+	for i, tgt := range targets {
+		mailOpts := opts
+		variant := ""
+		if len(opts.Attack.Variants) > 0 {
+			v := opts.Attack.Variants[variants[i]]
+			mailOpts = variantOptions(opts, v)
+			variant = v.Name
+		}
+
+		m := SendingMail{
+			ID:           util.GenerateUUID(36),
+			AttackerName: opts.Mail.Name,
+			URL:          createUserURL(opts, i),
+			TrackingHost: trackingHost(opts, i),
+			Custom:       opts.Mail.Custom,
+			Variant:      variant,
+			Subject:      mailOpts.Mail.Subject,
+			Target:       tgt,
+		}
+		if lures != nil {
+			m.URL = lures[i]
+		}
+		if opts.Tracking.URL != "" {
+			m.PixelURL = tracking.PixelURL(opts.Tracking.URL, m.ID)
+		}
+		if !opts.SMS.Only {
+			body, err := parseBody(*mailOpts, m)
+			if err != nil {
+				return []SendingMail{}, fmt.Errorf("prepareTemplates: %w", err)
+			}
+			m.Body = body
+			if m.PixelURL != "" {
+				m.Body = injectPixel(m.Body, m.PixelURL)
+			}
+
+			m.TextBody, err = parseTextBody(*mailOpts, m)
+			if err != nil {
+				return []SendingMail{}, fmt.Errorf("prepareTemplates: %w", err)
+			}
+
+			m.headers, err = renderHeaders(mailOpts, &m)
+			if err != nil {
+				return []SendingMail{}, fmt.Errorf("prepareTemplates: %w", err)
+			}
+		}
+		if opts.SMS.Provider != "" && tgt.Phone != "" {
+			text, err := renderTemplate(opts.SMS.Template, &m)
+			if err != nil {
+				return []SendingMail{}, fmt.Errorf("prepareTemplates: %w", err)
+			}
+			m.SMS = strings.TrimSpace(text)
+		}
+		mails = append(mails, m)
+	}
+
+	return mails, nil
+}
+
+// mailer delivers built messages and returns host of the server which
+// accepted them, it is either SMTP relay pool or API of mail provider
+type mailer interface {
+	send(ctx context.Context, msg *message) (string, error)
+	close()
+}
+
+// newSender returns mailer of the configured provider or relay pool for
+// the configured mail servers
+func newSender(opts *Options, campaignID string) (mailer, error) {
+	if opts.Provider.Name != "" {
+		m, err := newProviderMailer(opts.Provider, opts.proxyURL())
+		if err != nil {
+			return nil, fmt.Errorf("newSender: %v", err)
+		}
+		return m, nil
+	}
+
+	pool, err := newRelayPool(opts.MailServers, opts.General.Rotation, opts.proxyURL())
+	if err != nil {
+		return nil, fmt.Errorf("newSender: %v", err)
+	}
+
+	pool.dsn, err = dsnOptions(opts.Mail.DSN, campaignID)
+	if err != nil {
+		return nil, fmt.Errorf("newSender: %v", err)
+	}
+
+	return pool, nil
+}
+
+// sendEmails sends the mails with sender, saving them into emlDir if it is
+// set and passing their state to rec
+func sendEmails(ctx context.Context, mails []SendingMail, opts *Options, sender mailer, emlDir string, rec recorder) error {
+	if rec == nil {
+		rec = recorders{}
+	}
+
+	attachments, err := loadAttachments(opts.Attack.Attachments)
+	if err != nil {
+		return fmt.Errorf("sendEmails: %v", err)
+	}
+
+	images, err := loadInlineImages(opts.Mail.InlineImages)
+	if err != nil {
+		return fmt.Errorf("sendEmails: %v", err)
+	}
+
+	dkim, err := newDKIMSigner(opts.Mail.DKIM, opts.fromAddress())
+	if err != nil {
+		return fmt.Errorf("sendEmails: %v", err)
+	}
+
+	if opts.General.Bcc {
+		email := createMail(opts)
+
+		email.AddBcc(getBcc(mails)...)
+
+		body, err := parseBody(*opts, sharedMail(opts))
+		if err != nil {
+			return fmt.Errorf("sendEmails: %w", err)
+		}
+		text, err := parseTextBody(*opts, sharedMail(opts))
+		if err != nil {
+			return fmt.Errorf("sendEmails: %w", err)
+		}
+		shared := sharedMail(opts)
+		headers, err := renderHeaders(opts, &shared)
+		if err != nil {
+			return fmt.Errorf("sendEmails: %w", err)
+		}
+		setHeaders(email, headers)
+		if err := setContent(email, opts.Mail.Charset, opts.Mail.ContentType, opts.Mail.Subject, body, text); err != nil {
+			return fmt.Errorf("sendEmails: %v", err)
+		}
+		attachInline(email, images)
+		attach(email, attachments)
+
+		msg, err := newMessage(email, opts.Mail.ContentType)
+		if err != nil {
+			return fmt.Errorf("sendEmails: %v", err)
+		}
+		if msg.data, err = setContentIDs(msg.data, images); err != nil {
+			return fmt.Errorf("sendEmails: %v", err)
+		}
+		if err := msg.sign(dkim); err != nil {
+			return fmt.Errorf("sendEmails: %v", err)
+		}
+
+		if err := opts.General.window().wait(ctx); err != nil {
+			return fmt.Errorf("sendEmails: %v", err)
+		}
+
+		host, attempts, err := sendWithRetry(ctx, sender, msg, opts.General.Retry)
+		if err != nil {
+			if _, ok := rejectionCode(err); !ok {
+				return fmt.Errorf("sendEmails: %w", err)
+			}
+			logging.Errorf("Mail was rejected: %v", err)
+			setFailed(mails, attempts, err)
+			rec.record(mails)
+			return nil
+		}
+
+		setSent(mails, host, attempts)
+		rec.record(mails)
+		exportEMLs(mails, msg.data, emlDir)
+
+		return nil
+	}
+
+	pause := opts.General.pacer()
+	bulkTimeout := 0
+
+	schedule := opts.General.deliverySchedule()
+	schedule.sort(mails)
+
+	var chunks [][]SendingMail
+	if opts.General.Bulk {
+		chunks = createBulks(mails, &opts.General)
+		logging.Infof("Created %d chunks with size %d", len(chunks), opts.General.BulkSize)
+		bulkTimeout = opts.General.BulkDelay
+	} else {
+		chunks = append(chunks, mails)
+	}
+
+	barTmpl := `{{ green "Sending mails:" }} {{ counters .}} {{ bar . "[" "=" (cycle . "=>") "_" "]"}} {{speed . "%s mail/s" | green }} {{percent . | blue}}`
+
+	bar := pb.ProgressBarTemplate(barTmpl).Start64(int64(len(mails)))
+	defer bar.Finish()
+
+	limiter := opts.General.limiter()
+	sendWindow := opts.General.window()
+
+	perMessage := opts.General.RecipientsPerMessage
+	if perMessage < 1 {
+		perMessage = 1
+	}
+
+	groupBody, groupText := "", ""
+	var groupHeaders map[string]string
+	if perMessage > 1 {
+		// grouped mails are not personalized, everyone gets the same body
+		groupBody, err = parseBody(*opts, sharedMail(opts))
+		if err != nil {
+			return fmt.Errorf("sendEmails: %w", err)
+		}
+		groupText, err = parseTextBody(*opts, sharedMail(opts))
+		if err != nil {
+			return fmt.Errorf("sendEmails: %w", err)
+		}
+		shared := sharedMail(opts)
+		groupHeaders, err = renderHeaders(opts, &shared)
+		if err != nil {
+			return fmt.Errorf("sendEmails: %w", err)
+		}
+	}
+
+	throttle := newDomainThrottle(opts.General.ThrottleByDomain, perMessage)
+
+	groupNum := 0
+	for _, chunk := range chunks {
+		queue := splitMails(chunk, perMessage)
+		for len(queue) > 0 {
+			i, wait := throttle.pick(queue)
+			if i < 0 {
+				logging.Infof("Remaining targets are throttled by domain, waiting %s", wait.Truncate(time.Millisecond))
+				if err := sleep(ctx, wait); err != nil {
+					return fmt.Errorf("sendEmails: %v", err)
+				}
+				continue
+			}
+			group := queue[i]
+			queue = append(queue[:i], queue[i+1:]...)
+
+			if err := schedule.wait(ctx, group); err != nil {
+				return fmt.Errorf("sendEmails: %v", err)
+			}
+
+			if err := sendWindow.wait(ctx); err != nil {
+				return fmt.Errorf("sendEmails: %v", err)
+			}
+
+			if err := limiter.Wait(ctx); err != nil {
+				return fmt.Errorf("sendEmails: %v", err)
+			}
+
+			bar.Add(len(group))
+
+			email := createMail(opts)
+
+			body, text, headers := group[0].Body, group[0].TextBody, group[0].headers
+			if perMessage > 1 {
+				body, text, headers = groupBody, groupText, groupHeaders
+			}
+			setHeaders(email, headers)
+			messageID := setMessageID(email, headers, opts.fromAddress())
+			subject := opts.Mail.Subject
+			if group[0].Subject != "" {
+				subject = group[0].Subject
+			}
+
+			for _, tgt := range group {
+				email.AddTo(tgt.Email)
+			}
+
+			if err := setContent(email, opts.Mail.Charset, opts.Mail.ContentType, subject, body, text); err != nil {
+				return fmt.Errorf("sendEmails: %v", err)
+			}
+			attachInline(email, images)
+			attach(email, attachments)
+
+			msg, err := newMessage(email, opts.Mail.ContentType)
+			if err != nil {
+				return fmt.Errorf("sendEmails: %v", err)
+			}
+			if msg.data, err = setContentIDs(msg.data, images); err != nil {
+				return fmt.Errorf("sendEmails: %v", err)
+			}
+			if err := msg.sign(dkim); err != nil {
+				return fmt.Errorf("sendEmails: %v", err)
+			}
+			if opts.Mail.VERPDomain != "" {
+				msg.from = verpAddress(opts.Mail.VERPDomain, group[0].ID)
+			}
+
+			host, attempts, err := sendWithRetry(ctx, sender, msg, opts.General.Retry)
+			if err != nil {
+				if _, ok := rejectionCode(err); !ok {
+					return fmt.Errorf("sendEmails: %w", err)
+				}
+				logging.Errorf("Mail to %v was rejected: %v", msg.to, err)
+				setFailed(group, attempts, err)
+			} else {
+				setSent(group, host, attempts)
+				for i := range group {
+					group[i].MessageID = messageID
+				}
+				exportEMLs(group, msg.data, emlDir)
+			}
+
+			groupNum++
+			if perMessage > 1 {
+				for i := range group {
+					group[i].Group = groupNum
+				}
+			}
+			rec.record(group)
+
+			if err := sleep(ctx, pause()); err != nil {
+				return fmt.Errorf("sendEmails: %v", err)
+			}
+		}
+		if err := sleep(ctx, time.Duration(bulkTimeout)*time.Second); err != nil {
+			return fmt.Errorf("sendEmails: %v", err)
+		}
+	}
+
+	return nil
+}
+
+func setSent(mails []SendingMail, host string, attempts int) {
+	now := time.Now().Format(timeFormat)
+	for i := range mails {
+		mails[i].SentTime = now
+		mails[i].Server = host
+		mails[i].Status = MailSent
+		mails[i].Attempts = attempts
+	}
+}
+
+func setFailed(mails []SendingMail, attempts int, err error) {
+	for i := range mails {
+		mails[i].Status = disposition(err)
+		mails[i].SendError = err.Error()
+		mails[i].Attempts = attempts
+	}
+}
+
+// templateFuncs are available inside of mail templates
+var templateFuncs = template.FuncMap{
+	// json quotes the value so it can be used inside of JSON templates
+	"json": func(v interface{}) (string, error) {
+		d, err := json.Marshal(v)
+		return string(d), err
+	},
+}
+
+// sharedMail is the template data for mails which are sent to several
+// targets at once and can not be personalized
+func sharedMail(opts *Options) SendingMail {
+	return SendingMail{
+		AttackerName: opts.Mail.Name,
+		URL:          createUserURL(opts, 0),
+		Custom:       opts.Mail.Custom,
+		Subject:      opts.Mail.Subject,
+	}
+}
+
+func parseBody(opts Options, data SendingMail) (string, error) {
+	var body string
+	var err error
+	if opts.Slack.Token != "" && opts.Slack.Template != "" {
+		body, err = renderTemplate(opts.Slack.Template, &data)
+	} else if opts.Attack.Body != "" {
+		body, err = renderText(opts.Attack.Template, opts.Attack.Body, &data)
+	} else {
+		body, err = renderTemplate(opts.Attack.Template, &data)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if opts.Mail.NormalizeWhitespace {
+		body = normalizeWhitespace(body, isHTML(opts.Mail.ContentType))
+	}
+
+	if opts.Mail.DataURIImages && isHTML(opts.Mail.ContentType) {
+		body, err = util.InlineImagesAsDataURI(body)
+		if err != nil {
+			return "", &ErrTemplateRender{Template: opts.Attack.Template, Target: data.Name, Err: err}
+		}
+	}
+
+	return body, nil
+}
+
+// parseTextBody renders plain text alternative of the body, it is empty if
+// there is no text template
+func parseTextBody(opts Options, data SendingMail) (string, error) {
+	var text string
+	var err error
+	if opts.Attack.TextBody != "" {
+		text, err = renderText(opts.Attack.Template, opts.Attack.TextBody, &data)
+	} else if opts.Attack.TextTemplate != "" {
+		text, err = renderTemplate(opts.Attack.TextTemplate, &data)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if opts.Mail.NormalizeWhitespace {
+		text = normalizeWhitespace(text, false)
+	}
+
+	return text, nil
+}
+
+// renderTemplate executes template from filename with data
+func renderTemplate(filename string, data *SendingMail) (string, error) {
+	t, err := template.New(filepath.Base(filename)).Funcs(templateFuncs).ParseFiles(filename)
+	if err != nil {
+		return "", &ErrTemplateRender{Template: filename, Err: err}
+	}
+
+	return executeTemplate(t, filename, data)
+}
+
+// renderText executes template text, name is used in errors
+func renderText(name, text string, data *SendingMail) (string, error) {
+	t, err := template.New(filepath.Base(name)).Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return "", &ErrTemplateRender{Template: name, Err: err}
+	}
+
+	return executeTemplate(t, name, data)
+}
+
+func executeTemplate(t *template.Template, name string, data *SendingMail) (string, error) {
+	var buf bytes.Buffer
+	if err := t.Option("missingkey=error").Execute(&buf, templateData(data)); err != nil {
+		return "", &ErrTemplateRender{Template: name, Target: data.Name, Err: err}
+	}
+
+	return buf.String(), nil
+}
+
+// templateData returns fields of m together with the columns of the
+// target, so that templates can use both {{.URL}} and {{.Department}}.
+// Columns do not override the fields of m.
+func templateData(m *SendingMail) map[string]interface{} {
+	data := make(map[string]interface{})
+	for k, v := range m.Fields {
+		data[k] = v
+	}
+	addFields(data, reflect.ValueOf(*m))
+	return data
+}
+
+// addFields adds exported fields of struct v to data, fields of embedded
+// structs are added as well
+func addFields(data map[string]interface{}, v reflect.Value) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		data[f.Name] = v.Field(i).Interface()
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			addFields(data, v.Field(i))
+		}
+	}
+}
+
+// sleep waits for d, returning early with error if ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func createMail(opts *Options) *mail.Email {
+	email := mail.NewMSG()
+	email.SetFrom(opts.From())
+	if opts.Mail.ReplyTo != "" {
+		email.SetReplyTo(opts.Mail.ReplyTo)
+	}
+	if opts.Mail.EnvelopeFrom != "" {
+		// Return-Path is not added as header, it is only used in MAIL FROM
+		email.SetReturnPath(opts.Mail.EnvelopeFrom)
+	}
+	setPriority(email, opts.Mail.Priority)
+	setListID(email, opts.Mail.ListID)
+	setPrecedence(email, opts.Mail.Precedence)
+	setHeaders(email, opts.Mail.Headers)
+	setTransferEncoding(email, opts.Mail.TransferEncoding)
+	return email
+}
+
+// setPriority translates the configured priority into X-Priority, Importance
+// and X-MSMail-Priority headers. Normal priority does not add any headers.
+func setPriority(email *mail.Email, priority string) {
+	switch strings.ToLower(priority) {
+	case "high":
+		email.SetPriority(mail.PriorityHigh)
+	case "low":
+		email.SetPriority(mail.PriorityLow)
+	}
+}
+
+// dsnOptions converts DSN config, nil is returned if notifications are
+// not requested
+func dsnOptions(d DSN, envelopeID string) (*email.DSNOptions, error) {
+	if len(d.Notify) == 0 && d.Return == "" {
+		return nil, nil
+	}
+
+	o := &email.DSNOptions{
+		Return:     email.DSNReturn(strings.ToUpper(d.Return)),
+		EnvelopeID: envelopeID,
+	}
+	for _, n := range d.Notify {
+		o.Notify = append(o.Notify, email.DSNNotify(strings.ToUpper(n)))
+	}
+
+	if err := o.Validate(); err != nil {
+		return nil, err
+	}
+
+	return o, nil
+}
+
+func getBcc(mails []SendingMail) []string {
+	targets := make([]string, len(mails))
+	for _, sMail := range mails {
+		targets = append(targets, sMail.Email)
+	}
+	return targets
+}
+
+func createBulks(targets []SendingMail, general *General) [][]SendingMail {
+	return splitMails(targets, general.BulkSize)
+}
+
+// splitMails splits targets into slices of at most chunkSize mails, sharing
+// the underlying array with targets
+func splitMails(targets []SendingMail, chunkSize int) [][]SendingMail {
+	var ret [][]SendingMail
+	for i := 0; i < len(targets); i += chunkSize {
+		batch := targets[i:min(i+chunkSize, len(targets))]
+		ret = append(ret, batch)
+	}
+
+	return ret
+}
+
+func min(a, b int) int {
+	if a <= b {
+		return a
+	}
+	return b
+}
+
+// createUserURL creates url for i-th target
+func createUserURL(urlOpts *Options, i int) string {
+	confUrl := urlOpts.Url.Link
+	if host := trackingHost(urlOpts, i); host != "" {
+		confUrl = replaceHost(confUrl, host)
+	}
+	if !urlOpts.Url.Generate {
+		return confUrl
+	}
+	p := strings.Index(confUrl, tracking.Placeholder)
+	if p < 0 {
+		// Validate rejects such link, append the generated part anyway
+		// rather than sending the same url to everyone
+		p = len(confUrl)
+	}
+	url := confUrl[:p] + util.GenerateUUID(urlOpts.Url.Length)
+	return url
+}
+
+// trackingHost returns the host of url for i-th target, empty if hosts are
+// not rotated
+func trackingHost(opts *Options, i int) string {
+	hosts := opts.Url.Hosts
+	if len(hosts) == 0 {
+		return ""
+	}
+	return hosts[i%len(hosts)]
+}
+
+// replaceHost replaces host of link, which cannot be parsed with url.Parse
+// as it can hold <CHANGE> placeholder
+func replaceHost(link, host string) string {
+	i := strings.Index(link, "://")
+	if i < 0 {
+		return link
+	}
+	start := i + len("://")
+	end := strings.IndexAny(link[start:], "/?#")
+	if end < 0 {
+		return link[:start] + host
+	}
+	return link[:start] + host + link[start+end:]
+}
@@ -0,0 +1,230 @@
+package campaign
+
+import (
+	"errors"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update golden files in testdata")
+
+// golden compares got with the content of testdata/name, the file is
+// rewritten instead when running with -update
+func golden(t *testing.T, name, got string) {
+	t.Helper()
+	filename := filepath.Join("testdata", name)
+	if *update {
+		if err := ioutil.WriteFile(filename, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("reading golden file: %v (run go test -update to create it)", err)
+	}
+	if got != string(want) {
+		t.Errorf("%s mismatch\ngot:\n%s\nwant:\n%s", name, got, want)
+	}
+}
+
+func TestPrepareTemplatesGolden(t *testing.T) {
+	opts := NewOptions(
+		WithTargetsFile(filepath.Join("testdata", "targets.csv")),
+		WithTemplate(filepath.Join("testdata", "template.html")),
+		WithTextTemplate(filepath.Join("testdata", "template.txt")),
+		WithURL("https://phish.example.com/report"),
+		WithMail(Mail{Name: "Jane Attacker", Custom: "Sent from the finance portal"}),
+	)
+
+	targets, err := loadTargets(opts)
+	if err != nil {
+		t.Fatalf("loadTargets() error = %v", err)
+	}
+	mails, err := prepareTemplates(targets, opts)
+	if err != nil {
+		t.Fatalf("prepareTemplates() error = %v", err)
+	}
+	if len(mails) != 2 {
+		t.Fatalf("got %d mails, want 2", len(mails))
+	}
+
+	var html, text strings.Builder
+	for _, m := range mails {
+		html.WriteString(m.Body)
+		text.WriteString(m.TextBody)
+	}
+	golden(t, "template.html.golden", html.String())
+	golden(t, "template.txt.golden", text.String())
+}
+
+func TestRenderText(t *testing.T) {
+	data := SendingMail{
+		Target: Target{
+			Name:   "John Doe",
+			Email:  "john@example.com",
+			Fields: map[string]string{"Department": "Finance", "URL": "https://column.example.com"},
+		},
+		AttackerName: "Jane Attacker",
+		URL:          "https://phish.example.com/abc",
+	}
+
+	tests := []struct {
+		name string
+		text string
+		want string
+		// target is the target of ErrTemplateRender, "-" if no error is
+		// expected
+		target string
+	}{
+		{
+			name:   "fields",
+			text:   "Hi {{.Name}} <{{.Email}}>, from {{.AttackerName}}",
+			want:   "Hi John Doe <john@example.com>, from Jane Attacker",
+			target: "-",
+		},
+		{
+			name:   "column",
+			text:   "{{.Department}} team",
+			want:   "Finance team",
+			target: "-",
+		},
+		{
+			name:   "column does not override field",
+			text:   "{{.URL}}",
+			want:   "https://phish.example.com/abc",
+			target: "-",
+		},
+		{
+			name:   "json",
+			text:   `{"name": {{json .Name}}}`,
+			want:   `{"name": "John Doe"}`,
+			target: "-",
+		},
+		{
+			name:   "missing field",
+			text:   "{{.Manager}}",
+			target: "John Doe",
+		},
+		{
+			name:   "parse error",
+			text:   "{{.Name",
+			target: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := renderText("body.html", tt.text, &data)
+			if tt.target == "-" {
+				if err != nil {
+					t.Fatalf("renderText() error = %v", err)
+				}
+				if got != tt.want {
+					t.Errorf("renderText() = %q, want %q", got, tt.want)
+				}
+				return
+			}
+
+			var renderErr *ErrTemplateRender
+			if !errors.As(err, &renderErr) {
+				t.Fatalf("renderText() error = %v, want ErrTemplateRender", err)
+			}
+			if renderErr.Template != "body.html" || renderErr.Target != tt.target {
+				t.Errorf("renderText() error = %+v, want template %q and target %q", renderErr, "body.html", tt.target)
+			}
+		})
+	}
+}
+
+func TestRenderTemplateMissingFile(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "missing.html")
+	_, err := renderTemplate(filename, &SendingMail{})
+
+	var renderErr *ErrTemplateRender
+	if !errors.As(err, &renderErr) || renderErr.Template != filename {
+		t.Fatalf("renderTemplate() error = %v, want ErrTemplateRender of %s", err, filename)
+	}
+}
+
+func TestParseBody(t *testing.T) {
+	data := SendingMail{Target: Target{Name: "John Doe"}, URL: "https://phish.example.com"}
+
+	tests := []struct {
+		name     string
+		modify   func(*Options)
+		wantBody string
+		wantText string
+	}{
+		{
+			name: "html with text alternative",
+			modify: func(o *Options) {
+				o.Attack.Body = `<p>Hi {{.Name}}, <a href="{{.URL}}">login</a></p>`
+				o.Attack.TextBody = "Hi {{.Name}}, login at {{.URL}}"
+			},
+			wantBody: `<p>Hi John Doe, <a href="https://phish.example.com">login</a></p>`,
+			wantText: "Hi John Doe, login at https://phish.example.com",
+		},
+		{
+			name: "html without text alternative",
+			modify: func(o *Options) {
+				o.Attack.Body = "<p>Hi {{.Name}}</p>"
+			},
+			wantBody: "<p>Hi John Doe</p>",
+		},
+		{
+			name: "plain text",
+			modify: func(o *Options) {
+				o.Mail.ContentType = "text/plain"
+				o.Attack.Body = "Hi {{.Name}}"
+			},
+			wantBody: "Hi John Doe",
+		},
+		{
+			name: "text template file",
+			modify: func(o *Options) {
+				o.Attack.Body = "<p>{{.URL}}</p>"
+				o.Attack.TextTemplate = writeConfig(t, "template.txt", "Hi {{.Name}}\n")
+			},
+			wantBody: "<p>https://phish.example.com</p>",
+			wantText: "Hi John Doe\n",
+		},
+		{
+			name: "normalized whitespace",
+			modify: func(o *Options) {
+				o.Mail.NormalizeWhitespace = true
+				o.Attack.Body = "<p>  Hi\t {{.Name}}  </p>\n<pre>  kept  </pre>"
+				o.Attack.TextBody = "  Hi   {{.Name}}  "
+			},
+			wantBody: "<p> Hi John Doe </p>\n<pre>  kept  </pre>",
+			wantText: "Hi John Doe",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := NewOptions()
+			tt.modify(o)
+
+			body, err := parseBody(*o, data)
+			if err != nil {
+				t.Fatalf("parseBody() error = %v", err)
+			}
+			if body != tt.wantBody {
+				t.Errorf("parseBody() = %q, want %q", body, tt.wantBody)
+			}
+
+			text, err := parseTextBody(*o, data)
+			if err != nil {
+				t.Fatalf("parseTextBody() error = %v", err)
+			}
+			if text != tt.wantText {
+				t.Errorf("parseTextBody() = %q, want %q", text, tt.wantText)
+			}
+		})
+	}
+}
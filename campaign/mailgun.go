@@ -0,0 +1,53 @@
+package campaign
+
+import (
+	"bytes"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+)
+
+const (
+	mailgunUS = "https://api.mailgun.net"
+	mailgunEU = "https://api.eu.mailgun.net"
+)
+
+// mailgun sends the message as it is to messages.mime endpoint
+func (m *apiMailer) mailgun(p Provider) error {
+	base := mailgunUS
+	if p.Region == "eu" {
+		base = mailgunEU
+	}
+	base, m.host = apiBase(p, base)
+	m.user = "api"
+	endpoint := fmt.Sprintf("%s/v3/%s/messages.mime", base, p.Domain)
+
+	m.request = func(msg *message) (*http.Request, error) {
+		var body bytes.Buffer
+		w := multipart.NewWriter(&body)
+		for _, to := range msg.to {
+			if err := w.WriteField("to", to); err != nil {
+				return nil, err
+			}
+		}
+		f, err := w.CreateFormFile("message", "message.eml")
+		if err != nil {
+			return nil, err
+		}
+		if _, err := f.Write([]byte(msg.data)); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+
+		req, err := http.NewRequest(http.MethodPost, endpoint, &body)
+		if err != nil {
+			return nil, err
+		}
+		req.SetBasicAuth("api", p.APIKey)
+		req.Header.Set("Content-Type", w.FormDataContentType())
+		return req, nil
+	}
+	return nil
+}
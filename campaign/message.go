@@ -0,0 +1,71 @@
+package campaign
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	mail "github.com/xhit/go-simple-mail/v2"
+)
+
+const (
+	contentTypeHTML = "text/html"
+	contentTypeText = "text/plain"
+	contentTypeJSON = "application/json"
+)
+
+// message is the composed mail ready to be handed over to the mail server
+type message struct {
+	// from is the envelope sender used in MAIL FROM
+	from string
+	to   []string
+	data string
+}
+
+// newMessage builds RFC 822 message from email. go-simple-mail supports only
+// text/plain and text/html bodies, so other content types are sent as
+// text/plain and the header is replaced afterwards.
+func newMessage(email *mail.Email, contentType string) (*message, error) {
+	if email.Error != nil {
+		return nil, fmt.Errorf("newMessage: %v", email.Error)
+	}
+
+	if len(email.GetRecipients()) == 0 {
+		return nil, errors.New("newMessage: no recipient specified")
+	}
+
+	data := email.GetMessage()
+
+	if ct := normalizeContentType(contentType); ct != contentTypeHTML && ct != contentTypeText {
+		headerEnd := strings.Index(data, "\r\n\r\n")
+		if headerEnd < 0 {
+			return nil, errors.New("newMessage: malformed message")
+		}
+		headers := strings.Replace(data[:headerEnd], "Content-Type: "+contentTypeText, "Content-Type: "+ct, 1)
+		data = headers + data[headerEnd:]
+	}
+
+	return &message{
+		from: email.GetFrom(),
+		to:   email.GetRecipients(),
+		data: data,
+	}, nil
+}
+
+func normalizeContentType(contentType string) string {
+	switch strings.ToLower(contentType) {
+	case "", "html", contentTypeHTML:
+		return contentTypeHTML
+	case "text", contentTypeText:
+		return contentTypeText
+	case "json", contentTypeJSON:
+		return contentTypeJSON
+	default:
+		return ""
+	}
+}
+
+// isHTML reports whether body of contentType is sent as text/html
+func isHTML(contentType string) bool {
+	return normalizeContentType(contentType) == contentTypeHTML
+}
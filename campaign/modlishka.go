@@ -0,0 +1,194 @@
+package campaign
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/lateralusd/lateralus/logging"
+	"github.com/lateralusd/lateralus/util"
+)
+
+const defaultModlishkaInterval = time.Minute
+
+// Modlishka is control panel of Modlishka which is polled for captured
+// credentials during and after the campaign
+type Modlishka struct {
+	// URL of the control panel, e.g. https://phish.example.com/SayHello2Modlishka
+	URL string `yaml:"url"`
+	// Username and Password are -controlCreds of Modlishka
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	// Interval between the polls, 1m by default
+	Interval string `yaml:"interval"`
+	// Wait is how long the polling continues after the mails are sent
+	Wait string `yaml:"wait"`
+}
+
+func (m Modlishka) interval() (time.Duration, error) {
+	if m.Interval == "" {
+		return defaultModlishkaInterval, nil
+	}
+	return time.ParseDuration(m.Interval)
+}
+
+func (m Modlishka) wait() (time.Duration, error) {
+	if m.Wait == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(m.Wait)
+}
+
+func validateModlishka(m Modlishka, u Url) error {
+	if m.URL == "" {
+		return nil
+	}
+	parsed, err := url.Parse(m.URL)
+	if err != nil {
+		return err
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("%q is not http or https url", m.URL)
+	}
+	if d, err := m.interval(); err != nil || d < time.Second {
+		return fmt.Errorf("interval %q is not duration of at least 1s", m.Interval)
+	}
+	if d, err := m.wait(); err != nil || d < 0 {
+		return fmt.Errorf("wait %q is not duration", m.Wait)
+	}
+	if !u.Generate {
+		return fmt.Errorf("captures are matched by the generated part of the URL, set url.generate to True")
+	}
+	return nil
+}
+
+// modlishkaCapture is victim of Modlishka and when it was seen first
+type modlishkaCapture struct {
+	util.ModlishkaVictim
+	seen time.Time
+}
+
+// modlishkaPoller keeps the victims seen in the control panel
+type modlishkaPoller struct {
+	opts     Modlishka
+	mu       sync.Mutex
+	captures map[string]modlishkaCapture
+	order    []string
+}
+
+func newModlishkaPoller(opts Modlishka) *modlishkaPoller {
+	return &modlishkaPoller{
+		opts:     opts,
+		captures: make(map[string]modlishkaCapture),
+	}
+}
+
+// run polls the control panel every interval until ctx is done
+func (p *modlishkaPoller) run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		p.poll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *modlishkaPoller) poll(ctx context.Context) {
+	victims, err := util.FetchModlishka(ctx, p.opts.URL, p.opts.Username, p.opts.Password)
+	if err != nil {
+		if ctx.Err() == nil {
+			logging.Warningf("Error polling Modlishka: %v", err)
+		}
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	for _, v := range victims {
+		c, ok := p.captures[v.UUID]
+		if !ok {
+			c.seen = now
+			p.order = append(p.order, v.UUID)
+		}
+		c.ModlishkaVictim = v
+		p.captures[v.UUID] = c
+	}
+}
+
+// snapshot returns the captures in order they were seen
+func (p *modlishkaPoller) snapshot() []modlishkaCapture {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	captures := make([]modlishkaCapture, 0, len(p.order))
+	for _, id := range p.order {
+		captures = append(captures, p.captures[id])
+	}
+	return captures
+}
+
+// AddModlishka adds the victims of Modlishka control panel to the report
+// like the captures polled during the campaign, with the current time as
+// the time they were seen. It returns the number of added or updated sessions.
+func (r *Result) AddModlishka(victims []util.ModlishkaVictim) int {
+	now := time.Now()
+	captures := make([]modlishkaCapture, 0, len(victims))
+	for _, v := range victims {
+		captures = append(captures, modlishkaCapture{ModlishkaVictim: v, seen: now})
+	}
+	return r.addModlishka(captures)
+}
+
+// addModlishka adds the captures of the targets to the report, the UUID of
+// the capture is the generated part of the target URL. Sessions already in
+// the report are updated with credentials captured later. It returns the
+// number of added or updated sessions.
+func (r *Result) addModlishka(captures []modlishkaCapture) int {
+	_, byToken := r.trackingIDs()
+
+	existing := make(map[string]int)
+	for i, s := range r.Sessions {
+		if s.Source == sourceModlishka {
+			existing[s.Session] = i
+		}
+	}
+
+	changed := 0
+	for _, c := range captures {
+		if c.Username == "" && c.Password == "" {
+			continue
+		}
+		if i, ok := existing[c.UUID]; ok {
+			s := &r.Sessions[i]
+			if s.Username != c.Username || s.Password != (c.Password != "") {
+				s.Username = c.Username
+				s.Password = c.Password != ""
+				changed++
+			}
+			continue
+		}
+
+		t, ok := byToken[c.UUID]
+		if !ok {
+			continue
+		}
+		r.Sessions = append(r.Sessions, CapturedSession{
+			Source:   sourceModlishka,
+			Name:     t.Name,
+			Email:    t.Email,
+			Time:     c.seen.Format(timeFormat),
+			Username: c.Username,
+			Password: c.Password != "",
+			Session:  c.UUID,
+		})
+		existing[c.UUID] = len(r.Sessions) - 1
+		changed++
+	}
+	return changed
+}
@@ -0,0 +1,273 @@
+package campaign
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lateralusd/lateralus/logging"
+)
+
+// Token endpoints of the mail services supporting XOAUTH2
+const (
+	oauthGoogle    = "google"
+	oauthMicrosoft = "microsoft"
+
+	googleTokenURL = "https://oauth2.googleapis.com/token"
+	// scope of Office 365 SMTP for client credentials
+	office365Scope = "https://outlook.office365.com/.default"
+)
+
+// OAuth holds the app registration used to get access tokens for SMTP
+type OAuth struct {
+	// Provider is google or microsoft, it can be left out if TokenURL is set
+	Provider string `yaml:"provider"`
+	// Tenant of Microsoft app registration, organizations by default
+	Tenant       string `yaml:"tenant"`
+	ClientID     string `yaml:"clientId"`
+	ClientSecret string `yaml:"clientSecret"`
+	// RefreshToken of the mailbox user. Without it Microsoft tokens are got
+	// with client credentials, Google always needs it.
+	RefreshToken string `yaml:"refreshToken"`
+	// TokenURL replaces token endpoint of the provider
+	TokenURL string `yaml:"tokenUrl"`
+}
+
+func (o *OAuth) tokenURL() string {
+	if o.TokenURL != "" {
+		return o.TokenURL
+	}
+	if o.Provider == oauthGoogle {
+		return googleTokenURL
+	}
+	tenant := o.Tenant
+	if tenant == "" {
+		tenant = "organizations"
+	}
+	return fmt.Sprintf("%s/%s/oauth2/v2.0/token", graphAuthority, url.PathEscape(tenant))
+}
+
+func validateOAuth(o *OAuth) error {
+	switch o.Provider {
+	case oauthGoogle:
+		if o.RefreshToken == "" {
+			return errors.New("google needs refreshToken")
+		}
+	case oauthMicrosoft:
+		if o.RefreshToken == "" && (o.Tenant == "" || o.ClientSecret == "") {
+			return errors.New("microsoft needs refreshToken, or tenant and clientSecret for client credentials")
+		}
+	case "":
+		if o.TokenURL == "" {
+			return errors.New("provider google or microsoft, or tokenUrl is required")
+		}
+	default:
+		return fmt.Errorf("unknown provider %q, expected google or microsoft", o.Provider)
+	}
+	if o.ClientID == "" {
+		return errors.New("clientId is required")
+	}
+	if o.TokenURL != "" {
+		if err := validateHTTPURL(o.TokenURL); err != nil {
+			return fmt.Errorf("tokenUrl %v", err)
+		}
+	}
+	return nil
+}
+
+// newToken returns token source of the mail server, refreshing the token
+// when the connection is opened again after it expired
+func (o *OAuth) newToken(proxy *url.URL) *oauthToken {
+	return &oauthToken{
+		tokenURL:     o.tokenURL(),
+		clientID:     o.ClientID,
+		clientSecret: o.ClientSecret,
+		scope:        office365Scope,
+		refresh:      o.RefreshToken,
+		client:       newHTTPClient(proxy),
+	}
+}
+
+// oauthToken gets access tokens from OAuth 2.0 token endpoint with client
+// credentials or refresh token, renewing them before they expire
+type oauthToken struct {
+	tokenURL     string
+	clientID     string
+	clientSecret string
+	scope        string
+	client       *http.Client
+
+	mu      sync.Mutex
+	refresh string
+	access  string
+	expiry  time.Time
+}
+
+type tokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	RefreshToken     string `json:"refresh_token"`
+	ExpiresIn        int    `json:"expires_in"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// tokenError is error returned by the token endpoint
+type tokenError struct {
+	Code        string
+	Description string
+}
+
+func (e *tokenError) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+	// Azure AD adds trace and correlation ids on the following lines
+	return fmt.Sprintf("%s: %s", e.Code, strings.TrimSpace(strings.SplitN(e.Description, "\n", 2)[0]))
+}
+
+// get returns valid access token
+func (t *oauthToken) get(ctx context.Context) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.access != "" && time.Now().Before(t.expiry) {
+		return t.access, nil
+	}
+
+	form := url.Values{"client_id": {t.clientID}}
+	if t.clientSecret != "" {
+		form.Set("client_secret", t.clientSecret)
+	}
+	if t.refresh != "" {
+		form.Set("grant_type", "refresh_token")
+		form.Set("refresh_token", t.refresh)
+	} else {
+		form.Set("grant_type", "client_credentials")
+		form.Set("scope", t.scope)
+	}
+
+	tok, err := t.post(ctx, t.tokenURL, form)
+	if err != nil {
+		return "", err
+	}
+	t.set(tok)
+	return t.access, nil
+}
+
+func (t *oauthToken) set(tok *tokenResponse) {
+	t.access = tok.AccessToken
+	if tok.RefreshToken != "" {
+		t.refresh = tok.RefreshToken
+	}
+	// renew a minute before it expires
+	t.expiry = time.Now().Add(time.Duration(tok.ExpiresIn)*time.Second - time.Minute)
+}
+
+// deviceCode signs in with device code flow: the user opens the verification
+// URL and enters the code, while the token endpoint is polled
+func (t *oauthToken) deviceCode(ctx context.Context, deviceURL string) error {
+	var code struct {
+		DeviceCode      string `json:"device_code"`
+		UserCode        string `json:"user_code"`
+		VerificationURI string `json:"verification_uri"`
+		ExpiresIn       int    `json:"expires_in"`
+		Interval        int    `json:"interval"`
+		Message         string `json:"message"`
+		Error           string `json:"error"`
+		ErrorDesc       string `json:"error_description"`
+	}
+	form := url.Values{"client_id": {t.clientID}, "scope": {t.scope}}
+	if err := t.postJSON(ctx, deviceURL, form, &code); err != nil {
+		return fmt.Errorf("deviceCode: %v", err)
+	}
+	if code.Error != "" {
+		return fmt.Errorf("deviceCode: %v", &tokenError{code.Error, code.ErrorDesc})
+	}
+
+	if code.Message != "" {
+		logging.Infof("%s", code.Message)
+	} else {
+		logging.Infof("To sign in, open %s and enter the code %s", code.VerificationURI, code.UserCode)
+	}
+
+	interval := time.Duration(code.Interval) * time.Second
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(code.ExpiresIn)*time.Second)
+	defer cancel()
+
+	form = url.Values{
+		"client_id":   {t.clientID},
+		"grant_type":  {"urn:ietf:params:oauth:grant-type:device_code"},
+		"device_code": {code.DeviceCode},
+	}
+	for {
+		if err := sleep(ctx, interval); err != nil {
+			return fmt.Errorf("deviceCode: sign in was not completed: %v", err)
+		}
+		tok, err := t.post(ctx, t.tokenURL, form)
+		if e, ok := err.(*tokenError); ok {
+			switch e.Code {
+			case "authorization_pending":
+				continue
+			case "slow_down":
+				interval += 5 * time.Second
+				continue
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("deviceCode: %v", err)
+		}
+
+		t.mu.Lock()
+		t.set(tok)
+		t.mu.Unlock()
+		return nil
+	}
+}
+
+// post requests token, errors of the endpoint are returned as *tokenError
+func (t *oauthToken) post(ctx context.Context, endpoint string, form url.Values) (*tokenResponse, error) {
+	var tok tokenResponse
+	if err := t.postJSON(ctx, endpoint, form, &tok); err != nil {
+		return nil, err
+	}
+	if tok.Error != "" {
+		return nil, &tokenError{tok.Error, tok.ErrorDescription}
+	}
+	if tok.AccessToken == "" {
+		return nil, fmt.Errorf("%s returned no access token", endpoint)
+	}
+	return &tok, nil
+}
+
+func (t *oauthToken) postJSON(ctx context.Context, endpoint string, form url.Values, v interface{}) error {
+	req, err := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := t.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return err
+	}
+	// errors are JSON too, with 400 or 401 status
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("%s returned %s", endpoint, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,795 @@
+package campaign
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lateralusd/lateralus/tracking"
+	"golang.org/x/time/rate"
+)
+
+// OptionFunc modifies Options created with NewOptions
+type OptionFunc func(*Options)
+
+// NewOptions creates Options without reading the config file, so that
+// lateralus can be configured programmatically. Defaults match the ones
+// from generated sample config.
+func NewOptions(opts ...OptionFunc) *Options {
+	o := &Options{
+		Url: Url{
+			Length: 10,
+		},
+		General: General{
+			Delay:     5,
+			Separator: ",",
+		},
+	}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return o
+}
+
+// WithTargets sets the targets directly instead of parsing them from targets file
+func WithTargets(targets []Target) OptionFunc {
+	return func(o *Options) {
+		o.TargetList = targets
+	}
+}
+
+// WithTargetsFile sets the file from which targets will be parsed
+func WithTargetsFile(filename string) OptionFunc {
+	return func(o *Options) {
+		o.Attack.Targets = filename
+	}
+}
+
+// WithTemplate sets the mail template file
+func WithTemplate(filename string) OptionFunc {
+	return func(o *Options) {
+		o.Attack.Template = filename
+	}
+}
+
+// WithTextTemplate sets plain text alternative of the HTML template
+func WithTextTemplate(filename string) OptionFunc {
+	return func(o *Options) {
+		o.Attack.TextTemplate = filename
+	}
+}
+
+// WithAttachments sets files attached to every mail
+func WithAttachments(filenames ...string) OptionFunc {
+	return func(o *Options) {
+		o.Attack.Attachments = filenames
+	}
+}
+
+// WithVariants splits the targets between several lures
+func WithVariants(variants ...Variant) OptionFunc {
+	return func(o *Options) {
+		o.Attack.Variants = variants
+	}
+}
+
+// WithMail sets the information used to populate mails
+func WithMail(mail Mail) OptionFunc {
+	return func(o *Options) {
+		o.Mail = mail
+	}
+}
+
+// WithMailServer sets the mail servers used for sending, the ones after the
+// first are used when previous fail
+func WithMailServer(servers ...MailServer) OptionFunc {
+	return func(o *Options) {
+		o.MailServers = servers
+	}
+}
+
+// WithURL sets single url for every target
+func WithURL(link string) OptionFunc {
+	return func(o *Options) {
+		o.Url.Generate = false
+		o.Url.Link = link
+	}
+}
+
+// WithGeneratedURL sets url in which <CHANGE> is replaced with random part of given length
+func WithGeneratedURL(link string, length int) OptionFunc {
+	return func(o *Options) {
+		o.Url.Generate = true
+		o.Url.Link = link
+		o.Url.Length = length
+	}
+}
+
+// WithDelay sets the delay in seconds between two mails
+func WithDelay(delay int) OptionFunc {
+	return func(o *Options) {
+		o.General.Delay = delay
+	}
+}
+
+// WithRate limits sending to perMinute mails per minute, disabling the delay
+func WithRate(perMinute int) OptionFunc {
+	return func(o *Options) {
+		o.General.Delay = 0
+		o.General.Rate = strconv.Itoa(perMinute)
+	}
+}
+
+// WithBulk sends mails in chunks of size with delay seconds between chunks
+func WithBulk(size, delay int) OptionFunc {
+	return func(o *Options) {
+		o.General.Bulk = true
+		o.General.BulkSize = size
+		o.General.BulkDelay = delay
+	}
+}
+
+// WithBcc sends single mail with all the targets inside of bcc
+func WithBcc() OptionFunc {
+	return func(o *Options) {
+		o.General.Bcc = true
+	}
+}
+
+// Validate checks whether options can be used together
+func (o *Options) Validate() error {
+	switch strings.ToLower(o.Mail.Priority) {
+	case "", "normal", "low", "high":
+	default:
+		return &ErrInvalidConfig{
+			Field:  "mail.priority",
+			Reason: fmt.Sprintf("unknown priority %q, expected low, normal or high", o.Mail.Priority),
+		}
+	}
+
+	if _, err := normalizeCharset(o.Mail.Charset); err != nil {
+		return &ErrInvalidConfig{
+			Field:  "mail.charset",
+			Reason: err.Error(),
+		}
+	}
+
+	switch strings.ToLower(o.Mail.TransferEncoding) {
+	case "", "7bit", "quoted-printable", "base64":
+	default:
+		return &ErrInvalidConfig{
+			Field:  "mail.transferEncoding",
+			Reason: fmt.Sprintf("unknown encoding %q, expected 7bit, quoted-printable or base64", o.Mail.TransferEncoding),
+		}
+	}
+
+	if normalizeContentType(o.Mail.ContentType) == "" {
+		return &ErrInvalidConfig{
+			Field:  "mail.contentType",
+			Reason: fmt.Sprintf("unknown content type %q, expected text/html, text/plain or application/json", o.Mail.ContentType),
+		}
+	}
+
+	if o.Mail.ReplyTo != "" {
+		if err := validateAddress(o.Mail.ReplyTo); err != nil {
+			return &ErrInvalidConfig{
+				Field:  "mail.replyTo",
+				Reason: fmt.Sprintf("invalid Reply-To address %q: %v", o.Mail.ReplyTo, err),
+			}
+		}
+	}
+
+	switch strings.ToLower(o.Mail.Precedence) {
+	case "", "bulk", "list", "junk", "none":
+	default:
+		return &ErrInvalidConfig{
+			Field:  "mail.precedence",
+			Reason: fmt.Sprintf("unknown precedence %q, expected bulk, list, junk or none", o.Mail.Precedence),
+		}
+	}
+
+	if _, err := dsnOptions(o.Mail.DSN, ""); err != nil {
+		return &ErrInvalidConfig{
+			Field:  "mail.dsn",
+			Reason: err.Error(),
+		}
+	}
+
+	if err := validateHeaders(o.Mail.Headers); err != nil {
+		return &ErrInvalidConfig{
+			Field:  "mail.headers",
+			Reason: err.Error(),
+		}
+	}
+
+	if r := o.Mail.ReadReceipt; r != "" && !strings.Contains(r, "{{") {
+		if err := validateAddress(r); err != nil {
+			return &ErrInvalidConfig{
+				Field:  "mail.readReceipt",
+				Reason: err.Error(),
+			}
+		}
+	}
+
+	if o.Mail.ListID != "" {
+		if err := validateListID(o.Mail.ListID); err != nil {
+			return &ErrInvalidConfig{
+				Field:  "mail.listId",
+				Reason: err.Error(),
+			}
+		}
+	}
+
+	if o.Mail.EnvelopeFrom != "" {
+		if err := validateAddress(o.Mail.EnvelopeFrom); err != nil {
+			return &ErrInvalidConfig{
+				Field:  "mail.envelopeFrom",
+				Reason: fmt.Sprintf("invalid envelope sender %q: %v", o.Mail.EnvelopeFrom, err),
+			}
+		}
+	}
+
+	if o.Mail.VERPDomain != "" {
+		if err := validateDomain(o.Mail.VERPDomain); err != nil {
+			return &ErrInvalidConfig{
+				Field:  "mail.verpDomain",
+				Reason: err.Error(),
+			}
+		}
+		if o.General.Bcc || o.General.RecipientsPerMessage > 1 {
+			return &ErrInvalidConfig{
+				Field:  "mail.verpDomain",
+				Reason: "every target needs its own mail, it cannot be used with bcc or recipientsPerMessage",
+			}
+		}
+	}
+
+	if addr := o.fromAddress(); addr != "" {
+		field := "mailServer.username"
+		if o.Mail.Address != "" {
+			field = "mail.address"
+		}
+		if err := validateAddress(o.From()); err != nil {
+			return &ErrInvalidConfig{
+				Field:  field,
+				Reason: fmt.Sprintf("invalid From address %q: %v", addr, err),
+			}
+		}
+	}
+
+	if err := validateDKIM(o.Mail.DKIM); err != nil {
+		return &ErrInvalidConfig{
+			Field:  "mail.dkim",
+			Reason: err.Error(),
+		}
+	}
+
+	if err := o.validateProvider(); err != nil {
+		return err
+	}
+
+	if o.Proxy != "" {
+		if err := validateProxy(o.Proxy); err != nil {
+			return &ErrInvalidConfig{
+				Field:  "proxy",
+				Reason: err.Error(),
+			}
+		}
+	}
+
+	for _, s := range o.MailServers {
+		if _, err := s.maxBackoff(); err != nil {
+			return &ErrInvalidConfig{
+				Field:  "mailServer.maxBackoff",
+				Reason: err.Error(),
+			}
+		}
+		if err := validateEncryption(s.Encryption); err != nil {
+			return &ErrInvalidConfig{
+				Field:  "mailServer.encryption",
+				Reason: err.Error(),
+			}
+		}
+		if _, err := s.TLS.config(s.Host); err != nil {
+			return &ErrInvalidConfig{
+				Field:  "mailServer.tls",
+				Reason: err.Error(),
+			}
+		}
+		if s.MessagesPerConnection < 0 {
+			return &ErrInvalidConfig{
+				Field:  "mailServer.messagesPerConnection",
+				Reason: "must not be negative",
+			}
+		}
+		if s.Quota < 0 {
+			return &ErrInvalidConfig{
+				Field:  "mailServer.quota",
+				Reason: "quota cannot be negative",
+			}
+		}
+		if s.OAuth == nil {
+			continue
+		}
+		if err := validateOAuth(s.OAuth); err != nil {
+			return &ErrInvalidConfig{
+				Field:  "mailServer.oauth",
+				Reason: err.Error(),
+			}
+		}
+		if s.Username == "" {
+			return &ErrInvalidConfig{
+				Field:  "mailServer.username",
+				Reason: "mailbox user is required with oauth",
+			}
+		}
+	}
+
+	if err := validateSMS(o.SMS); err != nil {
+		return &ErrInvalidConfig{
+			Field:  "sms",
+			Reason: err.Error(),
+		}
+	}
+
+	if err := validateVoice(o.Voice); err != nil {
+		return &ErrInvalidConfig{
+			Field:  "voice",
+			Reason: err.Error(),
+		}
+	}
+
+	if err := validateSlack(o.Slack); err != nil {
+		return &ErrInvalidConfig{
+			Field:  "slack",
+			Reason: err.Error(),
+		}
+	}
+
+	limit, err := parseRate(o.General.Rate)
+	if err != nil {
+		return &ErrInvalidConfig{
+			Field:  "general.rate",
+			Reason: err.Error(),
+		}
+	}
+
+	if o.General.Burst < 0 {
+		return &ErrInvalidConfig{
+			Field:  "general.burst",
+			Reason: "burst cannot be negative",
+		}
+	}
+
+	if o.General.Timezone != "" {
+		if _, err := time.LoadLocation(o.General.Timezone); err != nil {
+			return &ErrInvalidConfig{
+				Field:  "general.timezone",
+				Reason: err.Error(),
+			}
+		}
+	}
+
+	if o.General.DeliverAt != "" {
+		if _, err := parseClock(o.General.DeliverAt); err != nil {
+			return &ErrInvalidConfig{
+				Field:  "general.deliverAt",
+				Reason: err.Error(),
+			}
+		}
+		if o.General.Bcc {
+			return &ErrInvalidConfig{
+				Field:  "general",
+				Reason: "bcc and deliverAt options cannot be used together",
+			}
+		}
+	}
+
+	if o.General.StartAt != "" {
+		if _, err := parseStartAt(o.General.StartAt, o.General.location()); err != nil {
+			return &ErrInvalidConfig{
+				Field:  "general.startAt",
+				Reason: err.Error(),
+			}
+		}
+	}
+
+	if o.General.Window != "" {
+		if _, err := parseWindow(o.General.Window); err != nil {
+			return &ErrInvalidConfig{
+				Field:  "general.window",
+				Reason: err.Error(),
+			}
+		}
+	}
+
+	if o.General.DelayMin < 0 || o.General.DelayMax < 0 {
+		return &ErrInvalidConfig{
+			Field:  "general",
+			Reason: "delayMin and delayMax cannot be negative",
+		}
+	}
+
+	if o.General.DelayMax > 0 && o.General.DelayMax < o.General.DelayMin {
+		return &ErrInvalidConfig{
+			Field:  "general.delayMax",
+			Reason: "delayMax cannot be less than delayMin",
+		}
+	}
+
+	if limit != rate.Inf && o.General.DelayMax > 0 {
+		return &ErrInvalidConfig{
+			Field:  "general",
+			Reason: "rate and delayMax options cannot be used together",
+		}
+	}
+
+	if limit != rate.Inf && o.General.Delay > 0 {
+		return &ErrInvalidConfig{
+			Field:  "general",
+			Reason: "rate and delay options cannot be used together, set delay to 0",
+		}
+	}
+
+	if o.Url.Generate && !strings.Contains(o.Url.Link, tracking.Placeholder) {
+		return &ErrInvalidConfig{
+			Field:  "url.link",
+			Reason: fmt.Sprintf("%q has no %s placeholder for the generated part, set url.generate to False to send it as it is", o.Url.Link, tracking.Placeholder),
+		}
+	}
+
+	for _, h := range o.Url.Hosts {
+		host := h
+		if hp, _, err := net.SplitHostPort(h); err == nil {
+			host = hp
+		}
+		if err := validateDomain(host); err != nil {
+			return &ErrInvalidConfig{
+				Field:  "url.hosts",
+				Reason: err.Error(),
+			}
+		}
+	}
+
+	if len(o.Url.Hosts) > 0 && !strings.Contains(o.Url.Link, "://") {
+		return &ErrInvalidConfig{
+			Field:  "url.link",
+			Reason: fmt.Sprintf("%q has no scheme, so its host cannot be replaced with url.hosts", o.Url.Link),
+		}
+	}
+
+	if o.Url.Lures != "" {
+		if o.Url.Generate || len(o.Url.Hosts) > 0 {
+			return &ErrInvalidConfig{
+				Field:  "url.lures",
+				Reason: "targets get evilginx lures, set url.generate to False and remove url.hosts",
+			}
+		}
+		if o.General.RecipientsPerMessage > 1 || o.General.Bcc {
+			return &ErrInvalidConfig{
+				Field:  "url.lures",
+				Reason: "lures are personal, they cannot be used with bcc or recipientsPerMessage",
+			}
+		}
+	}
+
+	if o.General.RecipientsPerMessage > 1 {
+		if o.Url.Generate {
+			return &ErrInvalidConfig{
+				Field:  "general.recipientsPerMessage",
+				Reason: "every recipient of the message gets the same url, set url.generate to False",
+			}
+		}
+		if o.General.Bcc {
+			return &ErrInvalidConfig{
+				Field:  "general",
+				Reason: "bcc and recipientsPerMessage options cannot be used together",
+			}
+		}
+	}
+
+	if (o.Attack.TextTemplate != "" || o.Attack.TextBody != "") && !isHTML(o.Mail.ContentType) {
+		return &ErrInvalidConfig{
+			Field:  "attack.textTemplate",
+			Reason: "plain text alternative can be used only with text/html content type",
+		}
+	}
+
+	if err := validateWebhook(o.Webhook); err != nil {
+		return &ErrInvalidConfig{
+			Field:  "webhook",
+			Reason: err.Error(),
+		}
+	}
+
+	if err := validateModlishka(o.Modlishka, o.Url); err != nil {
+		return &ErrInvalidConfig{
+			Field:  "modlishka",
+			Reason: err.Error(),
+		}
+	}
+
+	if err := validateTargetValidation(o.Attack.Validation); err != nil {
+		return &ErrInvalidConfig{
+			Field:  "attack.validation",
+			Reason: err.Error(),
+		}
+	}
+
+	if o.Attack.Sheet != "" && !isXLSX(o.Attack.Targets) {
+		return &ErrInvalidConfig{
+			Field:  "attack.sheet",
+			Reason: "sheet can only be used with .xlsx targets file",
+		}
+	}
+
+	if err := validateTags(o.Attack.IncludeTags); err != nil {
+		return &ErrInvalidConfig{
+			Field:  "attack.includeTags",
+			Reason: err.Error(),
+		}
+	}
+
+	if err := validateTags(o.Attack.ExcludeTags); err != nil {
+		return &ErrInvalidConfig{
+			Field:  "attack.excludeTags",
+			Reason: err.Error(),
+		}
+	}
+
+	if err := validateLDAP(o.Attack.LDAP); err != nil {
+		return &ErrInvalidConfig{
+			Field:  "attack.ldap",
+			Reason: err.Error(),
+		}
+	}
+
+	if o.Attack.LDAP.Host != "" && o.Attack.Targets != "" {
+		return &ErrInvalidConfig{
+			Field:  "attack.ldap",
+			Reason: "targets are read either from attack.targets or from LDAP, not both",
+		}
+	}
+
+	for field, col := range o.Attack.Columns {
+		if strings.TrimSpace(field) == "" || strings.TrimSpace(col) == "" {
+			return &ErrInvalidConfig{
+				Field:  "attack.columns",
+				Reason: fmt.Sprintf("field %q is mapped to column %q, neither can be empty", field, col),
+			}
+		}
+	}
+
+	if err := validateIMAP(o.IMAP); err != nil {
+		return &ErrInvalidConfig{
+			Field:  "imap",
+			Reason: err.Error(),
+		}
+	}
+
+	if err := validateNotifications(o.Notifications, o.MailServers); err != nil {
+		return &ErrInvalidConfig{
+			Field:  "notifications",
+			Reason: err.Error(),
+		}
+	}
+
+	if err := validateTracking(o.Tracking); err != nil {
+		return &ErrInvalidConfig{
+			Field:  "tracking.url",
+			Reason: err.Error(),
+		}
+	}
+
+	if o.Tracking.URL != "" {
+		if o.General.Bcc || o.General.RecipientsPerMessage > 1 {
+			return &ErrInvalidConfig{
+				Field:  "tracking.url",
+				Reason: "every target needs its own mail, it cannot be used with bcc or recipientsPerMessage",
+			}
+		}
+		if !isHTML(o.Mail.ContentType) {
+			return &ErrInvalidConfig{
+				Field:  "tracking.url",
+				Reason: "tracking pixel can be used only with text/html content type",
+			}
+		}
+	}
+
+	if err := validateVariants(o.Attack.Variants); err != nil {
+		return &ErrInvalidConfig{
+			Field:  "attack.variants",
+			Reason: err.Error(),
+		}
+	}
+
+	if len(o.Attack.Variants) > 0 {
+		if o.General.Bcc || o.General.RecipientsPerMessage > 1 {
+			return &ErrInvalidConfig{
+				Field:  "attack.variants",
+				Reason: "every target needs its own mail, it cannot be used with bcc or recipientsPerMessage",
+			}
+		}
+		for _, v := range o.Attack.Variants {
+			if v.TextTemplate != "" && !isHTML(o.Mail.ContentType) {
+				return &ErrInvalidConfig{
+					Field:  "attack.variants",
+					Reason: "plain text alternative can be used only with text/html content type",
+				}
+			}
+		}
+	}
+
+	for _, a := range o.Attack.Attachments {
+		info, err := os.Stat(a)
+		if err == nil && info.IsDir() {
+			err = fmt.Errorf("%s is a directory", a)
+		}
+		if err != nil {
+			return &ErrInvalidConfig{
+				Field:  "attack.attachments",
+				Reason: err.Error(),
+			}
+		}
+	}
+
+	for cid, filename := range o.Mail.InlineImages {
+		if !contentIDChars.MatchString(cid) {
+			return &ErrInvalidConfig{
+				Field:  "mail.inlineImages",
+				Reason: fmt.Sprintf("content id %q can contain only letters, digits and ._@+-", cid),
+			}
+		}
+		if _, err := os.Stat(filename); err != nil {
+			return &ErrInvalidConfig{
+				Field:  "mail.inlineImages",
+				Reason: err.Error(),
+			}
+		}
+	}
+
+	if len(o.Mail.InlineImages) > 0 && !isHTML(o.Mail.ContentType) {
+		return &ErrInvalidConfig{
+			Field:  "mail.inlineImages",
+			Reason: "inline images can be used only with text/html content type",
+		}
+	}
+
+	if len(o.Attack.Attachments) > 0 && normalizeContentType(o.Mail.ContentType) == contentTypeJSON {
+		return &ErrInvalidConfig{
+			Field:  "attack.attachments",
+			Reason: "attachments cannot be sent with application/json content type",
+		}
+	}
+
+	if o.General.Retry.Attempts < 0 {
+		return &ErrInvalidConfig{
+			Field:  "general.retry.attempts",
+			Reason: "attempts cannot be negative",
+		}
+	}
+
+	if d, err := o.General.Retry.backoff(); err != nil || d < 0 {
+		reason := "backoff cannot be negative"
+		if err != nil {
+			reason = err.Error()
+		}
+		return &ErrInvalidConfig{
+			Field:  "general.retry.backoff",
+			Reason: reason,
+		}
+	}
+
+	switch o.General.Rotation {
+	case "", rotationFailover, rotationRoundRobin:
+	default:
+		return &ErrInvalidConfig{
+			Field:  "general.rotation",
+			Reason: fmt.Sprintf("unknown rotation %q, use failover or roundrobin", o.General.Rotation),
+		}
+	}
+
+	if o.General.ThrottleByDomain < 0 {
+		return &ErrInvalidConfig{
+			Field:  "general.throttleByDomain",
+			Reason: "throttleByDomain cannot be negative",
+		}
+	}
+
+	if o.General.Bcc && o.General.ThrottleByDomain > 0 {
+		return &ErrInvalidConfig{
+			Field:  "general",
+			Reason: "bcc and throttleByDomain options cannot be used together",
+		}
+	}
+
+	if o.General.Bcc && o.General.Bulk {
+		return &ErrInvalidConfig{
+			Field:  "general",
+			Reason: "bcc and bulk options cannot be used together",
+		}
+	}
+
+	return nil
+}
+
+// validateProvider checks the provider and the options which need SMTP
+func (o *Options) validateProvider() error {
+	if err := validateProvider(o.Provider); err != nil {
+		return &ErrInvalidConfig{
+			Field:  "provider",
+			Reason: err.Error(),
+		}
+	}
+	if o.Provider.Name == "" {
+		return nil
+	}
+
+	if o.fromAddress() == "" {
+		return &ErrInvalidConfig{
+			Field:  "mail.address",
+			Reason: "sender address is required with provider",
+		}
+	}
+	if o.Mail.VERPDomain != "" || len(o.Mail.DSN.Notify) > 0 || o.Mail.DSN.Return != "" {
+		return &ErrInvalidConfig{
+			Field:  "provider",
+			Reason: "envelope sender and DSN are set by the provider, remove mail.verpDomain and mail.dsn",
+		}
+	}
+	if o.Mail.DKIM.enabled() {
+		return &ErrInvalidConfig{
+			Field:  "mail.dkim",
+			Reason: "providers sign the mails with their own keys, set up DKIM of the domain with the provider",
+		}
+	}
+	if o.Provider.Name == providerGraph && o.General.Bcc {
+		return &ErrInvalidConfig{
+			Field:  "provider",
+			Reason: "graph takes the recipients from the headers, it cannot be used with bcc",
+		}
+	}
+	if o.Provider.Name == providerSendGrid {
+		if o.General.Bcc {
+			return &ErrInvalidConfig{
+				Field:  "provider",
+				Reason: "sendgrid needs To header, it cannot be used with bcc",
+			}
+		}
+		if charset, _ := normalizeCharset(o.Mail.Charset); charset != defaultCharset {
+			return &ErrInvalidConfig{
+				Field:  "mail.charset",
+				Reason: "sendgrid accepts only utf-8 content",
+			}
+		}
+	}
+	return nil
+}
+
+func validateAddress(address string) error {
+	if _, err := mail.ParseAddress(address); err != nil {
+		return errors.New(strings.TrimPrefix(err.Error(), "mail: "))
+	}
+	return nil
+}
+
+// fromAddress returns the address mails are sent from, username of the first
+// mail server is used unless mail.address is set
+func (o *Options) fromAddress() string {
+	if o.Mail.Address != "" {
+		return o.Mail.Address
+	}
+	return o.MailServers.Primary().Username
+}
+
+// From returns the From header of the mails
+func (o *Options) From() string {
+	return fmt.Sprintf("%s <%s>", o.Mail.Name, o.fromAddress())
+}
@@ -0,0 +1,60 @@
+package campaign
+
+import (
+	"context"
+	"fmt"
+)
+
+// previewHost is reported as the server of mails built for preview
+const previewHost = "preview"
+
+// PreviewMail is the message built for targets without sending it
+type PreviewMail struct {
+	// To holds the recipients, more of them with bcc or recipientsPerMessage
+	To []string
+	// Data is the message exactly as it would be sent
+	Data string
+}
+
+// previewSender keeps the messages instead of sending them
+type previewSender struct {
+	mails []PreviewMail
+}
+
+func (p *previewSender) send(ctx context.Context, msg *message) (string, error) {
+	p.mails = append(p.mails, PreviewMail{
+		To:   msg.to,
+		Data: msg.data,
+	})
+	return previewHost, nil
+}
+
+func (p *previewSender) close() {}
+
+// Preview builds the mails for the first limit targets, or all of them if
+// limit is 0, without connecting to the mail servers
+func (c *Campaign) Preview(ctx context.Context, limit int) ([]PreviewMail, error) {
+	mails, err := c.Render(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("Preview: %w", err)
+	}
+	if limit > 0 && limit < len(mails) {
+		mails = mails[:limit]
+	}
+
+	opts := *c.Options
+	opts.General.Delay = 0
+	opts.General.DelayMax = 0
+	opts.General.BulkDelay = 0
+	opts.General.Rate = ""
+	opts.General.ThrottleByDomain = 0
+	opts.General.Window = ""
+	opts.General.DeliverAt = ""
+
+	sender := &previewSender{}
+	if err := sendEmails(ctx, mails, &opts, sender, "", nil); err != nil {
+		return nil, fmt.Errorf("Preview: %w", err)
+	}
+
+	return sender.mails, nil
+}
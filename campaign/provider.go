@@ -0,0 +1,260 @@
+package campaign
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lateralusd/lateralus/logging"
+)
+
+// Mail providers with HTTP API
+const (
+	providerSendGrid = "sendgrid"
+	providerMailgun  = "mailgun"
+	providerSES      = "ses"
+	providerGraph    = "graph"
+)
+
+// Provider sends the mails through API of transactional mail service
+// instead of mailServer
+type Provider struct {
+	// Name is sendgrid, mailgun, ses or graph
+	Name string `yaml:"name"`
+	// APIKey of SendGrid or Mailgun
+	APIKey string `yaml:"apiKey"`
+	// Domain is Mailgun sending domain
+	Domain string `yaml:"domain"`
+	// Region is us or eu for Mailgun and AWS region for SES
+	Region string `yaml:"region"`
+	// AccessKey and SecretKey of SES, AWS_ACCESS_KEY_ID and
+	// AWS_SECRET_ACCESS_KEY are used if they are not set
+	AccessKey string `yaml:"accessKey"`
+	SecretKey string `yaml:"secretKey"`
+	// Tenant, ClientID and ClientSecret of Microsoft Graph app registration
+	Tenant       string `yaml:"tenant"`
+	ClientID     string `yaml:"clientId"`
+	ClientSecret string `yaml:"clientSecret"`
+	// Flow is client for client credentials or device for device code
+	// sign in of Microsoft Graph, client by default
+	Flow string `yaml:"flow"`
+	// Authority replaces https://login.microsoftonline.com, e.g. for
+	// national clouds
+	Authority string `yaml:"authority"`
+	// Endpoint replaces base URL of the API
+	Endpoint string `yaml:"endpoint"`
+	// MaxBackoff is the longest wait when the provider rate limits the
+	// requests, 5m by default
+	MaxBackoff string `yaml:"maxBackoff"`
+}
+
+func (p Provider) maxBackoff() (time.Duration, error) {
+	if p.MaxBackoff == "" {
+		return defaultMaxBackoff, nil
+	}
+	return time.ParseDuration(p.MaxBackoff)
+}
+
+func (p Provider) flow() string {
+	if p.Flow == "" {
+		return graphClientCredentials
+	}
+	return p.Flow
+}
+
+func validateProvider(p Provider) error {
+	switch p.Name {
+	case "":
+		return nil
+	case providerSendGrid:
+		if p.APIKey == "" {
+			return errors.New("sendgrid needs apiKey")
+		}
+	case providerMailgun:
+		if p.APIKey == "" || p.Domain == "" {
+			return errors.New("mailgun needs apiKey and domain")
+		}
+		if p.Region != "" && p.Region != "us" && p.Region != "eu" {
+			return fmt.Errorf("mailgun region %q is not us or eu", p.Region)
+		}
+	case providerSES:
+		if p.Region == "" {
+			return errors.New("ses needs region, e.g. us-east-1")
+		}
+		if (p.AccessKey == "") != (p.SecretKey == "") {
+			return errors.New("ses needs both accessKey and secretKey, or neither to use AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+		}
+	case providerGraph:
+		if p.Tenant == "" || p.ClientID == "" {
+			return errors.New("graph needs tenant and clientId")
+		}
+		switch p.flow() {
+		case graphClientCredentials:
+			if p.ClientSecret == "" {
+				return errors.New("graph needs clientSecret with client flow")
+			}
+		case graphDeviceCode:
+		default:
+			return fmt.Errorf("graph flow %q is not client or device", p.Flow)
+		}
+		if p.Authority != "" {
+			if err := validateHTTPURL(p.Authority); err != nil {
+				return fmt.Errorf("authority %v", err)
+			}
+		}
+	default:
+		return fmt.Errorf("unknown provider %q, expected sendgrid, mailgun, ses or graph", p.Name)
+	}
+
+	if p.Endpoint != "" {
+		if err := validateHTTPURL(p.Endpoint); err != nil {
+			return fmt.Errorf("endpoint %v", err)
+		}
+	}
+	if _, err := p.maxBackoff(); err != nil {
+		return fmt.Errorf("maxBackoff: %v", err)
+	}
+	return nil
+}
+
+func validateHTTPURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%q is not http or https url", s)
+	}
+	return nil
+}
+
+// apiMailer sends the mails with requests built by the provider, waiting
+// out its rate limits
+type apiMailer struct {
+	name string
+	// host is reported as the server which accepted the mails
+	host string
+	// user is reported when the provider rejects the credentials
+	user    string
+	client  *http.Client
+	backoff *backoff
+	request func(msg *message) (*http.Request, error)
+	// throttled tells rate limiting responses apart, 429 always is
+	throttled func(status int, body string) bool
+}
+
+func newProviderMailer(p Provider, proxy *url.URL) (*apiMailer, error) {
+	maxBackoff, err := p.maxBackoff()
+	if err != nil {
+		return nil, fmt.Errorf("newProviderMailer: %v", err)
+	}
+
+	m := &apiMailer{
+		name:    p.Name,
+		client:  newHTTPClient(proxy),
+		backoff: newBackoff(maxBackoff),
+	}
+	switch p.Name {
+	case providerSendGrid:
+		err = m.sendGrid(p)
+	case providerMailgun:
+		err = m.mailgun(p)
+	case providerSES:
+		err = m.ses(p)
+	case providerGraph:
+		err = m.graph(p)
+	default:
+		err = fmt.Errorf("unknown provider %q", p.Name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("newProviderMailer: %v", err)
+	}
+	return m, nil
+}
+
+// apiBase returns the endpoint of the provider unless it is replaced
+func apiBase(p Provider, base string) (string, string) {
+	if p.Endpoint != "" {
+		base = strings.TrimSuffix(p.Endpoint, "/")
+	}
+	u, _ := url.Parse(base)
+	return base, u.Host
+}
+
+func (m *apiMailer) send(ctx context.Context, msg *message) (string, error) {
+	for {
+		req, err := m.request(msg)
+		if err != nil {
+			return "", err
+		}
+
+		resp, err := m.client.Do(req.WithContext(ctx))
+		if err != nil {
+			return "", err
+		}
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 64<<10))
+		resp.Body.Close()
+
+		if resp.StatusCode/100 == 2 {
+			m.backoff.reset()
+			return m.host, nil
+		}
+
+		reply := strings.TrimSpace(string(body))
+		if resp.StatusCode != http.StatusTooManyRequests && (m.throttled == nil || !m.throttled(resp.StatusCode, reply)) {
+			return "", m.apiError(resp.StatusCode, resp.Status, reply)
+		}
+
+		wait, ok := m.backoff.next()
+		if !ok {
+			m.backoff.reset()
+			// deferred, so that general.retry can try it later
+			return "", &textproto.Error{Code: 421, Msg: fmt.Sprintf("%s keeps rate limiting: %s", m.name, reply)}
+		}
+		if hint := retryAfter(resp.Header, time.Now()); hint > wait && hint <= m.backoff.max {
+			wait = hint
+		}
+		logging.Warningf("%s rate limit reached, waiting %s", m.name, wait.Round(time.Second))
+		if err := sleep(ctx, wait); err != nil {
+			return "", err
+		}
+	}
+}
+
+// apiError turns rejected request into SMTP like error, so that it is
+// handled as rejection by the mail server: 5xx of the API is temporary and
+// 4xx permanent failure. Rejected credentials stop the campaign.
+func (m *apiMailer) apiError(code int, status, reply string) error {
+	if len(reply) > 500 {
+		reply = reply[:500]
+	}
+	if code == http.StatusUnauthorized || code == http.StatusForbidden {
+		return &ErrSMTPAuth{Host: m.host, User: m.user, Reason: fmt.Sprintf("%s: %s", status, reply)}
+	}
+	msg := fmt.Sprintf("%s API returned %s: %s", m.name, status, reply)
+	if code >= 500 {
+		return &textproto.Error{Code: 451, Msg: msg}
+	}
+	return &textproto.Error{Code: 550, Msg: msg}
+}
+
+// retryAfter returns the wait the provider asked for with Retry-After
+// seconds or X-RateLimit-Reset unix time
+func retryAfter(h http.Header, now time.Time) time.Duration {
+	if s, err := strconv.Atoi(h.Get("Retry-After")); err == nil && s > 0 {
+		return time.Duration(s) * time.Second
+	}
+	if reset, err := strconv.ParseInt(h.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		if d := time.Unix(reset, 0).Sub(now); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+func (m *apiMailer) close() {}
@@ -0,0 +1,47 @@
+package campaign
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// validateProxy checks that proxy is socks5:// or http:// URL
+func validateProxy(proxy string) error {
+	u, err := url.Parse(proxy)
+	if err != nil {
+		return err
+	}
+	switch u.Scheme {
+	case "socks5", "socks5h", "http":
+	default:
+		return fmt.Errorf("unsupported scheme %q, use socks5 or http", u.Scheme)
+	}
+	if u.Hostname() == "" || u.Port() == "" {
+		return fmt.Errorf("%q has no host and port", proxy)
+	}
+	return nil
+}
+
+// proxyURL returns the configured proxy, nil if there is none
+func (o *Options) proxyURL() *url.URL {
+	if o.Proxy == "" {
+		return nil
+	}
+	u, err := url.Parse(o.Proxy)
+	if err != nil {
+		return nil
+	}
+	return u
+}
+
+// newHTTPClient returns client for the APIs, connecting through proxy if
+// it is not nil
+func newHTTPClient(proxy *url.URL) *http.Client {
+	client := &http.Client{Timeout: 30 * time.Second}
+	if proxy != nil {
+		client.Transport = &http.Transport{Proxy: http.ProxyURL(proxy)}
+	}
+	return client
+}
@@ -0,0 +1,85 @@
+package campaign
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+var rateUnits = map[string]time.Duration{
+	"s":    time.Second,
+	"sec":  time.Second,
+	"m":    time.Minute,
+	"min":  time.Minute,
+	"h":    time.Hour,
+	"hour": time.Hour,
+	"d":    24 * time.Hour,
+	"day":  24 * time.Hour,
+}
+
+// parseRate parses number of mails per unit, e.g. 30/h, number without
+// unit is per minute. Empty rate or 0 means unlimited.
+func parseRate(s string) (rate.Limit, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return rate.Inf, nil
+	}
+
+	count, unit := s, "m"
+	if i := strings.IndexByte(s, '/'); i >= 0 {
+		count, unit = strings.TrimSpace(s[:i]), strings.ToLower(strings.TrimSpace(s[i+1:]))
+	}
+
+	n, err := strconv.Atoi(count)
+	if err != nil {
+		return 0, fmt.Errorf("invalid rate %q, expected e.g. 120 or 30/h", s)
+	}
+	if n < 0 {
+		return 0, errors.New("rate cannot be negative")
+	}
+	per, ok := rateUnits[unit]
+	if !ok {
+		return 0, fmt.Errorf("unknown rate unit %q, expected s, m, h or d", unit)
+	}
+	if n == 0 {
+		return rate.Inf, nil
+	}
+
+	return rate.Every(per / time.Duration(n)), nil
+}
+
+// limiter returns token bucket allowing the configured rate of mails, with
+// up to Burst of them sent at once
+func (g General) limiter() *rate.Limiter {
+	limit, err := parseRate(g.Rate)
+	if err != nil || limit == rate.Inf {
+		return rate.NewLimiter(rate.Inf, 1)
+	}
+	burst := g.Burst
+	if burst < 1 {
+		burst = 1
+	}
+	return rate.NewLimiter(limit, burst)
+}
+
+// pacer returns function giving the wait after every mail, Delay seconds or
+// random time between DelayMin and DelayMax if DelayMax is set
+func (g General) pacer() func() time.Duration {
+	if g.DelayMax <= 0 {
+		return func() time.Duration {
+			return time.Duration(g.Delay) * time.Second
+		}
+	}
+
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	min := time.Duration(g.DelayMin) * time.Second
+	spread := int64(time.Duration(g.DelayMax-g.DelayMin)*time.Second/time.Millisecond) + 1
+	return func() time.Duration {
+		return min + time.Duration(rnd.Int63n(spread))*time.Millisecond
+	}
+}
@@ -0,0 +1,92 @@
+package campaign
+
+import (
+	"strings"
+
+	"github.com/lateralusd/lateralus/email"
+)
+
+// Headers requesting read receipt, Disposition-Notification-To is the
+// standard one and Return-Receipt-To is still honored by some clients
+const (
+	headerDispositionNotificationTo = "Disposition-Notification-To"
+	headerReturnReceiptTo           = "Return-Receipt-To"
+)
+
+// dispositionDisplayed is disposition of receipt sent when the mail was opened
+const dispositionDisplayed = "displayed"
+
+// ReadReceipt is read receipt sent by mail client of the target
+type ReadReceipt struct {
+	Name  string
+	Email string
+	Time  string
+	// Disposition is displayed when the mail was opened, or e.g. deleted
+	Disposition string
+	ReportingUA string `json:",omitempty" xml:",omitempty"`
+}
+
+// AddReceipts adds read receipts of the targets to the report. The target is
+// found by its id tagged to the receipt address, e.g. receipts+<id>@domain,
+// or by the recipient the receipt reports. It returns the number of added
+// receipts.
+func (r *Result) AddReceipts(mdns []*email.MDN) int {
+	byID, _ := r.trackingIDs()
+	byEmail := make(map[string]SendingMail, len(r.Targets))
+	for _, t := range r.Targets {
+		byEmail[strings.ToLower(t.Email)] = t
+	}
+
+	seen := make(map[string]bool)
+	key := func(email, time, disposition string) string {
+		return strings.Join([]string{email, time, disposition}, "\x00")
+	}
+	for _, rr := range r.Receipts {
+		seen[key(rr.Email, rr.Time, rr.Disposition)] = true
+	}
+
+	added := 0
+	for _, m := range mdns {
+		t, ok := byID[receiptTag(m.To)]
+		if !ok {
+			t, ok = byEmail[m.FinalRecipient]
+		}
+		if !ok {
+			t, ok = byEmail[m.OriginalRecipient]
+		}
+		if !ok {
+			continue
+		}
+
+		at := m.Date.Local().Format(timeFormat)
+		k := key(t.Email, at, m.Disposition)
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+
+		r.Receipts = append(r.Receipts, ReadReceipt{
+			Name:        t.Name,
+			Email:       t.Email,
+			Time:        at,
+			Disposition: m.Disposition,
+			ReportingUA: m.ReportingUA,
+		})
+		added++
+	}
+	return added
+}
+
+// receiptTag returns the tag of the local part, e.g. id of receipts+<id>@domain
+func receiptTag(address string) string {
+	at := strings.LastIndex(address, "@")
+	if at < 0 {
+		return ""
+	}
+	local := address[:at]
+	plus := strings.IndexByte(local, '+')
+	if plus < 0 {
+		return ""
+	}
+	return local[plus+1:]
+}
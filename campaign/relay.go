@@ -0,0 +1,261 @@
+package campaign
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/lateralusd/lateralus/email"
+	"github.com/lateralusd/lateralus/logging"
+)
+
+// Rotation of the mail servers
+const (
+	// rotationFailover uses the first server until it fails
+	rotationFailover = "failover"
+	// rotationRoundRobin sends every mail through the next server
+	rotationRoundRobin = "roundrobin"
+)
+
+// relay is single configured mail server together with its connection and
+// back-off state
+type relay struct {
+	config  MailServer
+	dialer  *email.Dialer
+	conn    *email.SMTP
+	backoff *backoff
+	// until holds the time before which relay should not be used, after
+	// it failed to connect or responded with throttling
+	until time.Time
+	// dead relay is not used anymore, because its quota is reached or it
+	// keeps failing
+	dead bool
+	// sent counts mails accepted by the relay, for its quota
+	sent int
+}
+
+// relayPool sends mails through the first usable relay, failing over to
+// the next one on connection errors, throttling responses and reached
+// quota. With round-robin rotation every mail goes through the next relay.
+type relayPool struct {
+	relays     []*relay
+	current    int
+	roundRobin bool
+	// dsn is requested for every message if it is not nil
+	dsn *email.DSNOptions
+}
+
+func newRelayPool(servers MailServers, rotation string, proxy *url.URL) (*relayPool, error) {
+	if len(servers) == 0 {
+		return nil, errors.New("newRelayPool: no mail server configured")
+	}
+
+	p := &relayPool{roundRobin: rotation == rotationRoundRobin}
+	for _, s := range servers {
+		maxBackoff, err := s.maxBackoff()
+		if err != nil {
+			return nil, fmt.Errorf("newRelayPool: %v", err)
+		}
+		dialer, err := newDialer(s, proxy)
+		if err != nil {
+			return nil, fmt.Errorf("newRelayPool: %v", err)
+		}
+		if s.TLS.InsecureSkipVerify {
+			logging.Warningf("Certificate of server %s is not verified", s.Host)
+		}
+		p.relays = append(p.relays, &relay{
+			config:  s,
+			dialer:  dialer,
+			backoff: newBackoff(maxBackoff),
+		})
+	}
+
+	return p, nil
+}
+
+func newDialer(s MailServer, proxy *url.URL) (*email.Dialer, error) {
+	tlsConfig, err := s.TLS.config(s.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &email.Dialer{
+		Host:      s.Host,
+		Port:      s.Port,
+		Username:  s.Username,
+		Password:  s.Password,
+		Timeout:   10 * time.Second,
+		Proxy:     proxy,
+		TLSConfig: tlsConfig,
+	}
+	if s.OAuth != nil {
+		token := s.OAuth.newToken(proxy)
+		d.Token = func() (string, error) {
+			return token.get(context.Background())
+		}
+	}
+
+	switch s.Encryption {
+	case encryptionSTARTTLS, encryptionTLS:
+		d.Encryption = email.EncryptionSTARTTLS
+	case encryptionSSL:
+		d.Encryption = email.EncryptionSSL
+	default:
+		d.Encryption = email.EncryptionNone
+		// credentials are sent in plain text only when asked for explicitly
+		d.PlainAuth = s.Encryption == encryptionNone
+	}
+
+	return d, nil
+}
+
+// pick returns the relay to send with, waiting if all live relays are backing off
+func (p *relayPool) pick(ctx context.Context) (*relay, error) {
+	for {
+		var earliest *relay
+		for i := 0; i < len(p.relays); i++ {
+			r := p.relays[(p.current+i)%len(p.relays)]
+			if r.dead {
+				continue
+			}
+			if !time.Now().Before(r.until) {
+				p.current = (p.current + i) % len(p.relays)
+				return r, nil
+			}
+			if earliest == nil || r.until.Before(earliest.until) {
+				earliest = r
+			}
+		}
+
+		if earliest == nil {
+			return nil, errors.New("no mail server left to send with")
+		}
+
+		if err := sleep(ctx, time.Until(earliest.until)); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// send delivers the message and returns host of the server which accepted it
+func (p *relayPool) send(ctx context.Context, msg *message) (string, error) {
+	var lastErr error
+	redialed := false
+	for {
+		r, err := p.pick(ctx)
+		if err != nil {
+			if lastErr != nil {
+				return "", lastErr
+			}
+			return "", err
+		}
+
+		if r.conn != nil && !r.conn.Reusable(r.config.MessagesPerConnection) {
+			r.conn.Quit()
+			r.conn = nil
+		}
+
+		if r.conn == nil {
+			conn, err := r.dialer.Dial()
+			if err != nil {
+				lastErr = r.connectError(err)
+				wait, ok := r.backoff.next()
+				if !ok || isPermanent(lastErr) {
+					r.dead = true
+					logging.Warningf("Server %s is not usable: %v", r.config.Host, err)
+					continue
+				}
+				r.until = time.Now().Add(wait)
+				logging.Warningf("Server %s is not usable: %v, trying it again in %s", r.config.Host, err, wait.Round(time.Second))
+				continue
+			}
+			r.conn = conn
+
+			if ok, _ := conn.Extension("DSN"); p.dsn != nil && !ok {
+				logging.Warningf("Server %s does not support DSN, notifications are not requested", r.config.Host)
+			}
+		}
+
+		err = r.conn.SendDSN(msg.from, msg.to, []byte(msg.data), p.dsn)
+		if err == nil {
+			r.backoff.reset()
+			r.sent++
+			if r.config.Quota > 0 && r.sent >= r.config.Quota {
+				r.conn.Quit()
+				r.conn = nil
+				r.dead = true
+				logging.Infof("Server %s reached its quota of %d mails", r.config.Host, r.config.Quota)
+			}
+			if p.roundRobin {
+				p.current = (p.current + 1) % len(p.relays)
+			}
+			return r.config.Host, nil
+		}
+
+		// server dropped the connection before getting the message, send it
+		// again once over new connection
+		var dropped *email.DroppedError
+		if errors.As(err, &dropped) && !redialed {
+			redialed = true
+			r.conn = nil
+			continue
+		}
+
+		code, ok := isThrottled(err)
+		if !ok {
+			return "", err
+		}
+		lastErr = err
+
+		// server closes the connection after 421 and pipelined transaction
+		// may have been aborted by closing it, reconnect after backing off
+		r.conn.Close()
+		r.conn = nil
+
+		wait, ok := r.backoff.next()
+		if !ok {
+			r.dead = true
+			logging.Warningf("Server %s keeps responding with %d, giving up on it", r.config.Host, code)
+			continue
+		}
+
+		r.until = time.Now().Add(wait)
+		logging.Warningf("Server %s responded with %d, not using it for %s", r.config.Host, code, wait.Round(time.Second))
+	}
+}
+
+func (r *relay) connectError(err error) error {
+	var tokenErr *tokenError
+	if errors.As(err, &tokenErr) {
+		return &ErrSMTPAuth{
+			Host:   r.config.Host,
+			User:   r.config.Username,
+			Reason: "getting OAuth token: " + tokenErr.Error(),
+		}
+	}
+	if tpErr, ok := isAuthError(err); ok {
+		return &ErrSMTPAuth{
+			Host:   r.config.Host,
+			User:   r.config.Username,
+			Reason: tpErr.Msg,
+		}
+	}
+	return err
+}
+
+// isPermanent reports whether connecting failed because of the credentials
+// or encryption, which do not get better by trying again
+func isPermanent(err error) bool {
+	var authErr *ErrSMTPAuth
+	return errors.As(err, &authErr) || errors.Is(err, email.ErrNoSTARTTLS) || errors.Is(err, email.ErrPlainAuth)
+}
+
+func (p *relayPool) close() {
+	for _, r := range p.relays {
+		if r.conn != nil {
+			r.conn.Quit()
+		}
+	}
+}
@@ -0,0 +1,362 @@
+package campaign
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// smtpServer is SMTP server on localhost which accepts every mail, unless
+// replies overrides the reply to commands starting with the key
+type smtpServer struct {
+	replies map[string]string
+
+	mu       sync.Mutex
+	received int
+}
+
+// newSMTPServer starts s and returns the mail server config for it
+func newSMTPServer(t *testing.T, s *smtpServer) MailServer {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	p, _ := strconv.Atoi(port)
+	return MailServer{Host: "127.0.0.1", Port: p, Encryption: encryptionNone}
+}
+
+// closedServer returns config of mail server which refuses connections
+func closedServer(t *testing.T) MailServer {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	l.Close()
+	p, _ := strconv.Atoi(port)
+	return MailServer{Host: "127.0.0.1", Port: p, Encryption: encryptionNone}
+}
+
+func (s *smtpServer) messages() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.received
+}
+
+func (s *smtpServer) serve(conn net.Conn) {
+	defer conn.Close()
+	text := textproto.NewConn(conn)
+	r := bufio.NewReader(conn)
+	text.PrintfLine("220 fake.example.com ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.TrimRight(line, "\r\n")
+		verb := strings.ToUpper(strings.Fields(cmd + " ")[0])
+
+		reply := "250 2.0.0 OK"
+		for prefix, r := range s.replies {
+			if strings.HasPrefix(cmd, prefix) {
+				reply = r
+			}
+		}
+		switch {
+		case verb == "EHLO":
+			reply = "250-fake.example.com\r\n250 AUTH PLAIN LOGIN"
+		case verb == "DATA" && reply == "250 2.0.0 OK":
+			text.PrintfLine("354 End data with <CR><LF>.<CR><LF>")
+			for {
+				line, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+			}
+			s.mu.Lock()
+			s.received++
+			s.mu.Unlock()
+			reply = "250 2.0.0 Queued"
+		case verb == "QUIT":
+			text.PrintfLine("221 2.0.0 Bye")
+			return
+		}
+		if err := text.PrintfLine("%s", reply); err != nil {
+			return
+		}
+	}
+}
+
+// testMessage is the message sent through the relays
+var testMessage = &message{
+	from: "attacker@example.com",
+	to:   []string{"john@example.com"},
+	data: "Subject: Hello\r\n\r\nHello\r\n",
+}
+
+func TestRelayPoolFailover(t *testing.T) {
+	tests := []struct {
+		name  string
+		first func(t *testing.T) MailServer
+	}{
+		{name: "connection refused", first: closedServer},
+		{
+			name: "throttled",
+			first: func(t *testing.T) MailServer {
+				return newSMTPServer(t, &smtpServer{replies: map[string]string{"MAIL FROM": "421 4.7.0 Too many connections"}})
+			},
+		},
+		{
+			name: "busy mailbox",
+			first: func(t *testing.T) MailServer {
+				return newSMTPServer(t, &smtpServer{replies: map[string]string{"RCPT TO": "450 4.2.1 Mailbox busy"}})
+			},
+		},
+		{
+			name: "authentication failed",
+			first: func(t *testing.T) MailServer {
+				s := newSMTPServer(t, &smtpServer{replies: map[string]string{"AUTH": "535 5.7.8 Authentication failed"}})
+				s.Username, s.Password = "attacker", "secret"
+				return s
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			second := &smtpServer{}
+			secondConfig := newSMTPServer(t, second)
+			secondConfig.Host = "localhost"
+			p, err := newRelayPool(MailServers{tt.first(t), secondConfig}, rotationFailover, nil)
+			if err != nil {
+				t.Fatalf("newRelayPool() error = %v", err)
+			}
+			defer p.close()
+
+			host, err := p.send(context.Background(), testMessage)
+			if err != nil {
+				t.Fatalf("send() error = %v", err)
+			}
+			if host != "localhost" || second.messages() != 1 {
+				t.Errorf("sent through %s, %d mails received by second server, want the second one", host, second.messages())
+			}
+
+			// the failed server is skipped while it backs off or for good
+			first := p.relays[0]
+			if !first.dead && !first.until.After(time.Now()) {
+				t.Errorf("first server is usable again right after failing")
+			}
+			if host, err := p.send(context.Background(), testMessage); err != nil || host != "localhost" {
+				t.Errorf("second send() = %s, %v, want localhost", host, err)
+			}
+		})
+	}
+}
+
+func TestRelayPoolPermanentFailure(t *testing.T) {
+	s := newSMTPServer(t, &smtpServer{replies: map[string]string{"AUTH": "535 5.7.8 Authentication failed"}})
+	s.Username, s.Password = "attacker", "secret"
+	p, err := newRelayPool(MailServers{s}, rotationFailover, nil)
+	if err != nil {
+		t.Fatalf("newRelayPool() error = %v", err)
+	}
+	defer p.close()
+
+	_, err = p.send(context.Background(), testMessage)
+	var authErr *ErrSMTPAuth
+	if !errors.As(err, &authErr) {
+		t.Fatalf("send() error = %v, want ErrSMTPAuth", err)
+	}
+	if !p.relays[0].dead {
+		t.Errorf("server with rejected credentials is used again")
+	}
+	if _, err := p.send(context.Background(), testMessage); err == nil {
+		t.Errorf("send() without usable server error = nil, want error")
+	}
+}
+
+func TestRelayPoolGivesUp(t *testing.T) {
+	// maximum back-off below the first window gives up right away
+	s := closedServer(t)
+	s.MaxBackoff = "1s"
+	p, err := newRelayPool(MailServers{s}, rotationFailover, nil)
+	if err != nil {
+		t.Fatalf("newRelayPool() error = %v", err)
+	}
+
+	if _, err := p.send(context.Background(), testMessage); err == nil || strings.Contains(err.Error(), "no mail server left") {
+		t.Errorf("send() error = %v, want the connection error", err)
+	}
+	if !p.relays[0].dead {
+		t.Errorf("server is used again after giving up on it")
+	}
+}
+
+func TestRelayPoolRejected(t *testing.T) {
+	first := &smtpServer{replies: map[string]string{"RCPT TO": "550 5.1.1 No such user"}}
+	second := &smtpServer{}
+	p, err := newRelayPool(MailServers{newSMTPServer(t, first), newSMTPServer(t, second)}, rotationFailover, nil)
+	if err != nil {
+		t.Fatalf("newRelayPool() error = %v", err)
+	}
+	defer p.close()
+
+	// permanent rejection of the recipient is not retried elsewhere
+	if _, err := p.send(context.Background(), testMessage); err == nil || !strings.Contains(err.Error(), "550") {
+		t.Errorf("send() error = %v, want 550", err)
+	}
+	if second.messages() != 0 {
+		t.Errorf("rejected mail was sent through the second server")
+	}
+}
+
+func TestRelayPoolWaits(t *testing.T) {
+	s := &smtpServer{}
+	p, err := newRelayPool(MailServers{newSMTPServer(t, s)}, rotationFailover, nil)
+	if err != nil {
+		t.Fatalf("newRelayPool() error = %v", err)
+	}
+	defer p.close()
+
+	// the only server backs off, send waits for it
+	p.relays[0].until = time.Now().Add(200 * time.Millisecond)
+	start := time.Now()
+	if _, err := p.send(context.Background(), testMessage); err != nil {
+		t.Fatalf("send() error = %v", err)
+	}
+	if waited := time.Since(start); waited < 150*time.Millisecond {
+		t.Errorf("send() waited %s, want until the server backed off", waited)
+	}
+
+	// waiting is interrupted by the context
+	p.relays[0].until = time.Now().Add(time.Hour)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := p.send(ctx, testMessage); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("send() error = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestRelayPoolQuota(t *testing.T) {
+	first, second := &smtpServer{}, &smtpServer{}
+	firstConfig := newSMTPServer(t, first)
+	firstConfig.Quota = 2
+	p, err := newRelayPool(MailServers{firstConfig, newSMTPServer(t, second)}, rotationFailover, nil)
+	if err != nil {
+		t.Fatalf("newRelayPool() error = %v", err)
+	}
+	defer p.close()
+
+	for i := 0; i < 5; i++ {
+		if _, err := p.send(context.Background(), testMessage); err != nil {
+			t.Fatalf("send() error = %v", err)
+		}
+	}
+	p.close()
+	if first.messages() != 2 || second.messages() != 3 {
+		t.Errorf("servers received %d and %d mails, want 2 and 3", first.messages(), second.messages())
+	}
+}
+
+func TestRelayPoolRoundRobin(t *testing.T) {
+	servers := []*smtpServer{{}, {}, {}}
+	var configs MailServers
+	for _, s := range servers {
+		configs = append(configs, newSMTPServer(t, s))
+	}
+	p, err := newRelayPool(configs, rotationRoundRobin, nil)
+	if err != nil {
+		t.Fatalf("newRelayPool() error = %v", err)
+	}
+	defer p.close()
+
+	for i := 0; i < 6; i++ {
+		if _, err := p.send(context.Background(), testMessage); err != nil {
+			t.Fatalf("send() error = %v", err)
+		}
+	}
+	for i, s := range servers {
+		if s.messages() != 2 {
+			t.Errorf("server %d received %d mails, want 2", i+1, s.messages())
+		}
+	}
+}
+
+func TestNewRelayPoolErrors(t *testing.T) {
+	if _, err := newRelayPool(nil, rotationFailover, nil); err == nil {
+		t.Errorf("newRelayPool() without servers error = nil, want error")
+	}
+	if _, err := newRelayPool(MailServers{{Host: "smtp.example.com", MaxBackoff: "soon"}}, rotationFailover, nil); err == nil {
+		t.Errorf("newRelayPool() with invalid maxBackoff error = nil, want error")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	b := newBackoff(time.Minute)
+	// windows are 5s, 10s, 20s and 40s, the next one exceeds the maximum
+	for _, window := range []time.Duration{5 * time.Second, 10 * time.Second, 20 * time.Second, 40 * time.Second} {
+		for i := 0; i < 20; i++ {
+			peek := *b
+			wait, ok := peek.next()
+			if !ok || wait < window/2 || wait > window {
+				t.Fatalf("next() = %s, %v, want between %s and %s", wait, ok, window/2, window)
+			}
+		}
+		b.next()
+	}
+	if wait, ok := b.next(); ok {
+		t.Errorf("next() over the maximum = %s, true, want false", wait)
+	}
+
+	b.reset()
+	if wait, ok := b.next(); !ok || wait > baseBackoff {
+		t.Errorf("next() after reset = %s, %v, want at most %s", wait, ok, baseBackoff)
+	}
+
+	if b := newBackoff(0); b.max != defaultMaxBackoff {
+		t.Errorf("newBackoff(0) max = %s, want %s", b.max, defaultMaxBackoff)
+	}
+}
+
+func TestIsThrottled(t *testing.T) {
+	tests := []struct {
+		err  error
+		code int
+		want bool
+	}{
+		{err: &textproto.Error{Code: 421, Msg: "Too many connections"}, code: 421, want: true},
+		{err: &textproto.Error{Code: 450, Msg: "Mailbox busy"}, code: 450, want: true},
+		{err: &textproto.Error{Code: 451, Msg: "Local error"}},
+		{err: &textproto.Error{Code: 550, Msg: "No such user"}},
+		{err: errors.New("connection reset")},
+	}
+	for _, tt := range tests {
+		if code, ok := isThrottled(tt.err); code != tt.code || ok != tt.want {
+			t.Errorf("isThrottled(%v) = %d, %v, want %d, %v", tt.err, code, ok, tt.code, tt.want)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package campaign
+
+import (
+	"strings"
+
+	"github.com/lateralusd/lateralus/email"
+)
+
+// Reply is bounce of the mail to target, its automatic reply or reply
+type Reply struct {
+	Name  string
+	Email string
+	Time  string
+	// Kind is hard bounce, soft bounce, auto reply or reply
+	Kind    string
+	Subject string `json:",omitempty" xml:",omitempty"`
+	// Status is the enhanced status code of bounce, e.g. 5.1.1, and
+	// Diagnostic the response of the remote server
+	Status     string `json:",omitempty" xml:",omitempty"`
+	Diagnostic string `json:",omitempty" xml:",omitempty"`
+}
+
+// AddReplies adds bounces and replies of the targets to the report. The
+// target is found by its VERP address the bounce was sent to, by
+// Message-ID of its mail which the reply refers to, by the recipient the
+// bounce reports or by the sender of the reply. It returns the number of
+// added replies.
+func (r *Result) AddReplies(replies []*email.Reply) int {
+	byID, _ := r.trackingIDs()
+	byEmail := make(map[string]SendingMail, len(r.Targets))
+	byMessageID := make(map[string]SendingMail, len(r.Targets))
+	for _, t := range r.Targets {
+		byEmail[strings.ToLower(t.Email)] = t
+		if t.MessageID != "" {
+			byMessageID[strings.ToLower(t.MessageID)] = t
+		}
+	}
+
+	seen := make(map[string]bool)
+	key := func(email, time, kind string) string {
+		return strings.Join([]string{email, time, kind}, "\x00")
+	}
+	for _, rp := range r.Replies {
+		seen[key(rp.Email, rp.Time, rp.Kind)] = true
+	}
+
+	added := 0
+	for _, rp := range replies {
+		t, ok := replyTarget(rp, byID, byEmail, byMessageID)
+		if !ok {
+			continue
+		}
+
+		at := rp.Date.Local().Format(timeFormat)
+		k := key(t.Email, at, rp.Kind)
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+
+		r.Replies = append(r.Replies, Reply{
+			Name:       t.Name,
+			Email:      t.Email,
+			Time:       at,
+			Kind:       rp.Kind,
+			Subject:    rp.Subject,
+			Status:     rp.Status,
+			Diagnostic: rp.Diagnostic,
+		})
+		added++
+	}
+	return added
+}
+
+func replyTarget(rp *email.Reply, byID, byEmail, byMessageID map[string]SendingMail) (SendingMail, bool) {
+	if id, err := ParseVERP(rp.To); err == nil {
+		if t, ok := byID[id]; ok {
+			return t, true
+		}
+	}
+	for _, ref := range rp.References {
+		if t, ok := byMessageID[strings.ToLower(ref)]; ok {
+			return t, true
+		}
+	}
+	for _, addr := range rp.Recipients {
+		if t, ok := byEmail[addr]; ok {
+			return t, true
+		}
+	}
+	t, ok := byEmail[rp.From]
+	return t, ok
+}
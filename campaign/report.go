@@ -0,0 +1,219 @@
+package campaign
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+var tpl = `Campaign:       {{ .ID }}
+Start time:     {{ .StartTime }}
+End time:       {{ .EndTime }}
+{{ if .Notes }}
+Notes:
+========================================
+{{ .Notes }}
+{{ end }}
+Mail data:
+========================================
+Mail Subject: 	{{ .Subject }}
+From field: 	{{ .From }}
+AttackerName: 	{{ .AttackerName }}
+URL: 		{{ .URL }}
+Custom: 	{{ .Custom }}
+{{ if .Variants }}
+Variants:
+========================================
+Table in format NAME, TARGETS, SENT, CLICKS, SUBJECT, TEMPLATE
+----------------------------------------{{ range .Variants }}
+{{ .Name | printf "%-20s"}} | {{ .Targets }} | {{ .Sent }} | {{ .Clicks }} | {{ .Subject }} | {{ .Template }}
+{{end}}{{ end }}
+Targets:
+========================================
+Total: 			{{ len .Targets }}
+Table in format NAME, EMAIL, URL, SERVER, STATUS, ID{{ if .Variants }}, VARIANT{{ end }}
+----------------------------------------{{ range .Targets }}
+{{ .Name | printf "%-20s"}} | {{ .Email | printf "%-50s"}} | {{ .URL }} | {{ .Server }} | {{ .Status }} | {{ .ID }}{{ if .Variant }} | {{ .Variant }}{{ end }}
+{{end}}{{ if .Clicks }}
+Clicks:
+========================================
+Total: 			{{ len .Clicks }}
+Table in format TIME, NAME, EMAIL, IP, USER AGENT
+----------------------------------------{{ range .Clicks }}
+{{ .Time }} | {{ .Name | printf "%-20s"}} | {{ .Email }} | {{ .IP }} | {{ .UserAgent }}{{ if .Simulated }} (simulated){{ end }}
+{{end}}{{ end }}{{ if .Opens }}
+Opens:
+========================================
+Total: 			{{ len .Opens }}
+Table in format TIME, NAME, EMAIL, IP, USER AGENT
+----------------------------------------{{ range .Opens }}
+{{ .Time }} | {{ .Name | printf "%-20s"}} | {{ .Email }} | {{ .IP }} | {{ .UserAgent }}
+{{end}}{{ end }}{{ if .Receipts }}
+Read receipts:
+========================================
+Total: 			{{ len .Receipts }}
+Table in format TIME, NAME, EMAIL, DISPOSITION, MAIL CLIENT
+----------------------------------------{{ range .Receipts }}
+{{ .Time }} | {{ .Name | printf "%-20s"}} | {{ .Email }} | {{ .Disposition }} | {{ .ReportingUA }}
+{{end}}{{ end }}{{ if .Replies }}
+Bounces and replies:
+========================================
+Total: 			{{ len .Replies }}
+Table in format TIME, NAME, EMAIL, KIND, STATUS, SUBJECT
+----------------------------------------{{ range .Replies }}
+{{ .Time }} | {{ .Name | printf "%-20s"}} | {{ .Email }} | {{ .Kind }} | {{ .Status }} | {{ .Subject }}
+{{end}}{{ end }}{{ if .Submissions }}
+Submissions:
+========================================
+Total: 			{{ len .Submissions }}
+Table in format TIME, NAME, EMAIL, IP, FIELDS
+----------------------------------------{{ range .Submissions }}
+{{ .Time }} | {{ .Name | printf "%-20s"}} | {{ .Email }} | {{ .IP }} |{{ range $k, $v := .Fields }} {{ $k }}={{ $v }}{{ end }}
+{{end}}{{ end }}{{ if .Sessions }}
+Captured sessions:
+========================================
+Total: 			{{ len .Sessions }}
+Table in format TIME, NAME, EMAIL, IP, USERNAME, PASSWORD, TOKENS, SOURCE, SESSION
+----------------------------------------{{ range .Sessions }}
+{{ .Time }} | {{ .Name | printf "%-20s"}} | {{ .Email }} | {{ .IP }} | {{ .Username }} | {{ if .Password }}captured{{ else }}-{{ end }} | {{ .Tokens }} | {{ .Source }} | {{ .Session }}
+{{end}}{{ end }}`
+
+// Result struct holds the information that will be used to generate report
+type Result struct {
+	ID           string
+	StartTime    string
+	EndTime      string
+	Notes        string
+	Subject      string
+	From         string
+	AttackerName string
+	URL          string
+	Custom       string
+	Targets      []SendingMail
+	Clicks       []ClickEvent
+	Opens        []OpenEvent  `json:",omitempty" xml:",omitempty"`
+	Submissions  []Submission `json:",omitempty" xml:"-"`
+	// Sessions are captured by Evilginx2
+	Sessions []CapturedSession `json:",omitempty" xml:",omitempty"`
+	// Receipts are read receipts sent by the mail clients
+	Receipts []ReadReceipt `json:",omitempty" xml:",omitempty"`
+	// Replies are bounces and replies found in the mailbox of the sender
+	Replies []Reply `json:",omitempty" xml:",omitempty"`
+	// Variants break the results down by lure variant
+	Variants []VariantResult `json:",omitempty" xml:",omitempty"`
+}
+
+// WriteReport saves the report to output in given format: tpl, xml, json or
+// html.
+// templatePath replaces the default template for tpl format.
+func WriteReport(output, templatePath, format string, res *Result) error {
+	f, err := os.OpenFile(output, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return &ErrReportWrite{Output: output, Format: format, Err: err}
+	}
+	defer f.Close()
+
+	if err := RenderReport(f, templatePath, format, res); err != nil {
+		return &ErrReportWrite{Output: output, Format: format, Err: err}
+	}
+
+	return nil
+}
+
+// RenderReport writes the report to w in given format
+func RenderReport(w io.Writer, templatePath, format string, res *Result) error {
+	var err error
+	switch format {
+	case "json":
+		err = createJson(w, res)
+	case "xml":
+		err = createXml(w, res)
+	case "html":
+		err = createHTML(w, res)
+	default:
+		err = createTemplate(w, templatePath, res)
+	}
+
+	if err != nil {
+		return fmt.Errorf("RenderReport: %v", err)
+	}
+
+	return nil
+}
+
+// ReadReport parses report previously saved in json or xml format
+func ReadReport(filename string) (*Result, error) {
+	d, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("ReadReport: %v", err)
+	}
+
+	res := &Result{}
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".xml":
+		err = xml.Unmarshal(d, res)
+	default:
+		err = json.Unmarshal(d, res)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("ReadReport: %v", err)
+	}
+
+	return res, nil
+}
+
+func createTemplate(w io.Writer, templatePath string, res *Result) error {
+	var t *template.Template
+	var err error
+
+	if templatePath == "" {
+		t, err = template.New("").Parse(tpl)
+		if err != nil {
+			return fmt.Errorf("createTemplate: %v", err)
+		}
+	} else {
+		t, err = template.ParseFiles(templatePath)
+		if err != nil {
+			return fmt.Errorf("createTemplate: %v", err)
+		}
+	}
+
+	if err := t.Execute(w, res); err != nil {
+		return fmt.Errorf("createTemplate: %v", err)
+	}
+
+	return nil
+}
+
+func createJson(w io.Writer, res *Result) error {
+	d, err := json.MarshalIndent(res, "", "  ")
+	if err != nil {
+		return fmt.Errorf("createJson: %v", err)
+	}
+
+	if _, err := w.Write(d); err != nil {
+		return fmt.Errorf("createJson: %v", err)
+	}
+
+	return nil
+}
+
+func createXml(w io.Writer, res *Result) error {
+	d, err := xml.MarshalIndent(res, "", "  ")
+	if err != nil {
+		return fmt.Errorf("createXml: %v", err)
+	}
+
+	if _, err := w.Write(d); err != nil {
+		return fmt.Errorf("createXml: %v", err)
+	}
+
+	return nil
+}
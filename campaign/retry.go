@@ -0,0 +1,71 @@
+package campaign
+
+import (
+	"context"
+	"errors"
+	"net/textproto"
+	"time"
+
+	"github.com/lateralusd/lateralus/logging"
+)
+
+const defaultRetryBackoff = 30 * time.Second
+
+// Final disposition of the mail to target
+const (
+	// MailSent means the server accepted the mail
+	MailSent = "sent"
+	// MailFailed means the server rejected the mail permanently with 5xx
+	MailFailed = "failed"
+	// MailDeferred means the server kept rejecting the mail with 4xx until
+	// all attempts were used
+	MailDeferred = "deferred"
+)
+
+// sendWithRetry sends msg, repeating it on temporary rejections as
+// configured by retry. The number of made attempts is returned.
+func sendWithRetry(ctx context.Context, sender mailer, msg *message, retry Retry) (string, int, error) {
+	wait, err := retry.backoff()
+	if err != nil {
+		return "", 0, err
+	}
+
+	for attempt := 1; ; attempt++ {
+		host, err := sender.send(ctx, msg)
+		if err == nil {
+			return host, attempt, nil
+		}
+
+		code, ok := rejectionCode(err)
+		if !ok || code >= 500 || attempt >= retry.attempts() {
+			return "", attempt, err
+		}
+
+		logging.Warningf("Mail to %v was rejected with %d, retrying in %s (attempt %d of %d)", msg.to, code, wait, attempt+1, retry.attempts())
+		if err := sleep(ctx, wait); err != nil {
+			return "", attempt, err
+		}
+		wait *= 2
+	}
+}
+
+// rejectionCode returns the reply code if err is rejection of the mail by
+// the server, other errors like lost connection stop the campaign
+func rejectionCode(err error) (int, bool) {
+	if _, ok := isAuthError(err); ok {
+		return 0, false
+	}
+	var tpErr *textproto.Error
+	if !errors.As(err, &tpErr) || tpErr.Code < 400 {
+		return 0, false
+	}
+	return tpErr.Code, true
+}
+
+// disposition returns final status of the mail which failed with err
+func disposition(err error) string {
+	if code, _ := rejectionCode(err); code >= 500 {
+		return MailFailed
+	}
+	return MailDeferred
+}
@@ -0,0 +1,279 @@
+package campaign
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lateralusd/lateralus/logging"
+)
+
+var startAtFormats = []string{time.RFC3339, "2006-01-02 15:04", "2006-01-02T15:04"}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// parseStartAt parses RFC 3339 time or local time like 2021-06-01 09:00
+func parseStartAt(s string, loc *time.Location) (time.Time, error) {
+	for _, f := range startAtFormats {
+		if t, err := time.ParseInLocation(f, strings.TrimSpace(s), loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, expected e.g. 2021-06-01 09:00", s)
+}
+
+// window is the part of the week in which mails are sent, e.g. Mon-Fri
+// 09:00-17:00. Window ending before it starts spans midnight and belongs
+// to the day it starts on.
+type window struct {
+	spec string
+	days [7]bool
+	// from and to are minutes since midnight
+	from, to int
+	loc      *time.Location
+}
+
+// parseWindow parses optional days, as range or comma separated list, and
+// the hours, e.g. "Mon-Fri 09:00-17:00", "Mon,Wed 10:00-12:00" or
+// "08:00-18:00" for every day
+func parseWindow(spec string) (*window, error) {
+	w := &window{spec: spec, loc: time.Local}
+	fields := strings.Fields(spec)
+	switch len(fields) {
+	case 1:
+		for i := range w.days {
+			w.days[i] = true
+		}
+	case 2:
+		if err := w.parseDays(fields[0]); err != nil {
+			return nil, err
+		}
+		fields = fields[1:]
+	default:
+		return nil, fmt.Errorf("invalid window %q, expected e.g. Mon-Fri 09:00-17:00", spec)
+	}
+
+	hours := strings.Split(fields[0], "-")
+	if len(hours) != 2 || !strings.Contains(fields[0], ":") {
+		return nil, fmt.Errorf("invalid hours %q, expected e.g. 09:00-17:00", fields[0])
+	}
+	var err error
+	if w.from, err = parseClock(hours[0]); err != nil {
+		return nil, err
+	}
+	if w.to, err = parseClock(hours[1]); err != nil {
+		return nil, err
+	}
+	if w.from == w.to {
+		return nil, fmt.Errorf("window %q is empty", spec)
+	}
+	return w, nil
+}
+
+func (w *window) parseDays(spec string) error {
+	for _, part := range strings.Split(strings.ToLower(spec), ",") {
+		bounds := strings.Split(part, "-")
+		if len(bounds) > 2 {
+			return fmt.Errorf("invalid days %q", spec)
+		}
+		first, ok := weekdays[bounds[0]]
+		if !ok {
+			return fmt.Errorf("unknown day %q, expected Mon, Tue, Wed, Thu, Fri, Sat or Sun", bounds[0])
+		}
+		last := first
+		if len(bounds) == 2 {
+			if last, ok = weekdays[bounds[1]]; !ok {
+				return fmt.Errorf("unknown day %q, expected Mon, Tue, Wed, Thu, Fri, Sat or Sun", bounds[1])
+			}
+		}
+		for d := first; ; d = (d + 1) % 7 {
+			w.days[d] = true
+			if d == last {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// parseClock returns minutes since midnight of 15:04
+func parseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected e.g. 09:00", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// until returns how long after t the window opens, 0 if it is open at t
+func (w *window) until(t time.Time) time.Duration {
+	minute := t.Hour()*60 + t.Minute()
+	day := t.Weekday()
+	if w.from < w.to {
+		if w.days[day] && minute >= w.from && minute < w.to {
+			return 0
+		}
+	} else if (w.days[day] && minute >= w.from) || (w.days[(day+6)%7] && minute < w.to) {
+		return 0
+	}
+
+	for i := 0; i <= 7; i++ {
+		start := time.Date(t.Year(), t.Month(), t.Day()+i, w.from/60, w.from%60, 0, 0, t.Location())
+		if w.days[start.Weekday()] && start.After(t) {
+			return start.Sub(t)
+		}
+	}
+	return 0
+}
+
+// wait blocks until the window is open
+func (w *window) wait(ctx context.Context) error {
+	if w == nil {
+		return nil
+	}
+	d := w.until(time.Now().In(w.loc))
+	if d == 0 {
+		return nil
+	}
+	logging.Infof("Outside of sending window %s, pausing until %s", w.spec, time.Now().Add(d).Format(timeFormat))
+	return sleep(ctx, d)
+}
+
+// window returns the sending window, nil if mails can be sent any time
+func (g General) window() *window {
+	if g.Window == "" {
+		return nil
+	}
+	w, err := parseWindow(g.Window)
+	if err != nil {
+		return nil
+	}
+	w.loc = g.location()
+	return w
+}
+
+// location returns Timezone, local timezone if it is not set
+func (g General) location() *time.Location {
+	if g.Timezone == "" {
+		return time.Local
+	}
+	loc, err := time.LoadLocation(g.Timezone)
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}
+
+// waitForStart blocks until StartAt
+func (g General) waitForStart(ctx context.Context) error {
+	if g.StartAt == "" {
+		return nil
+	}
+	start, err := parseStartAt(g.StartAt, g.location())
+	if err != nil {
+		return err
+	}
+	if !start.After(time.Now()) {
+		return nil
+	}
+	logging.Infof("Campaign starts at %s, waiting %s", start.Format(timeFormat), time.Until(start).Round(time.Second))
+	return sleep(ctx, time.Until(start))
+}
+
+// checkTimezones fails if timezone of some target is unknown
+func checkTimezones(targets []Target) error {
+	for _, t := range targets {
+		if t.Timezone == "" {
+			continue
+		}
+		if _, err := time.LoadLocation(t.Timezone); err != nil {
+			return fmt.Errorf("checkTimezones: target %s has unknown timezone %q", t.Email, t.Timezone)
+		}
+	}
+	return nil
+}
+
+// deliverySchedule holds the time mails are due at in every timezone of
+// the targets, so that they are sent at DeliverAt local time
+type deliverySchedule struct {
+	clock int
+	now   time.Time
+	def   *time.Location
+	// due is cached for every timezone
+	due map[string]time.Time
+}
+
+// deliverySchedule returns nil if DeliverAt is not set
+func (g General) deliverySchedule() *deliverySchedule {
+	if g.DeliverAt == "" {
+		return nil
+	}
+	clock, err := parseClock(g.DeliverAt)
+	if err != nil {
+		return nil
+	}
+	return &deliverySchedule{
+		clock: clock,
+		now:   time.Now(),
+		def:   g.location(),
+		due:   make(map[string]time.Time),
+	}
+}
+
+// dueAt returns the next DeliverAt time in timezone of the target
+func (s *deliverySchedule) dueAt(m SendingMail) time.Time {
+	if due, ok := s.due[m.Timezone]; ok {
+		return due
+	}
+	loc := s.def
+	if m.Timezone != "" {
+		if l, err := time.LoadLocation(m.Timezone); err == nil {
+			loc = l
+		}
+	}
+	t := s.now.In(loc)
+	due := time.Date(t.Year(), t.Month(), t.Day(), s.clock/60, s.clock%60, 0, 0, loc)
+	if due.Before(s.now) {
+		due = due.AddDate(0, 0, 1)
+	}
+	s.due[m.Timezone] = due
+	return due
+}
+
+// sort orders the mails by the time they are due, targets in the same
+// timezone keep their order
+func (s *deliverySchedule) sort(mails []SendingMail) {
+	if s == nil {
+		return
+	}
+	sort.SliceStable(mails, func(i, j int) bool {
+		return s.dueAt(mails[i]).Before(s.dueAt(mails[j]))
+	})
+}
+
+// wait blocks until every mail of group is due
+func (s *deliverySchedule) wait(ctx context.Context, group []SendingMail) error {
+	if s == nil {
+		return nil
+	}
+	var due time.Time
+	for _, m := range group {
+		if d := s.dueAt(m); d.After(due) {
+			due = d
+		}
+	}
+	if !due.After(time.Now()) {
+		return nil
+	}
+	logging.Infof("Waiting until %s to deliver at %s local time of the targets", due.Local().Format(timeFormat), s.format())
+	return sleep(ctx, time.Until(due))
+}
+
+func (s *deliverySchedule) format() string {
+	return fmt.Sprintf("%02d:%02d", s.clock/60, s.clock%60)
+}
@@ -0,0 +1,182 @@
+package campaign
+
+import (
+	"testing"
+	"time"
+)
+
+// at returns time on day of October 2026 in UTC, the 12th is Monday
+func at(day, hour, minute int) time.Time {
+	return time.Date(2026, time.October, day, hour, minute, 0, 0, time.UTC)
+}
+
+func TestParseWindow(t *testing.T) {
+	tests := []struct {
+		spec     string
+		days     string
+		from, to int
+		wantErr  bool
+	}{
+		{spec: "Mon-Fri 09:00-17:00", days: "-MTWTF-", from: 9 * 60, to: 17 * 60},
+		{spec: "mon,wed 10:00-12:30", days: "-M-W---", from: 10 * 60, to: 12*60 + 30},
+		{spec: "Fri-Mon 22:00-06:00", days: "SM---FS", from: 22 * 60, to: 6 * 60},
+		{spec: "Sat,Mon-Tue 08:00-18:00", days: "-MT---S", from: 8 * 60, to: 18 * 60},
+		{spec: "08:00-18:00", days: "SMTWTFS", from: 8 * 60, to: 18 * 60},
+		{spec: "Mon-Fri", wantErr: true},
+		{spec: "Mon-Fri 09:00", wantErr: true},
+		{spec: "Mon-Fri 9-17", wantErr: true},
+		{spec: "Mon-Fri 09:00-25:00", wantErr: true},
+		{spec: "Mon-Fri 09:00-09:00", wantErr: true},
+		{spec: "Mon-Fri-Sun 09:00-17:00", wantErr: true},
+		{spec: "Monday 09:00-17:00", wantErr: true},
+		{spec: "Mon-Fry 09:00-17:00", wantErr: true},
+		{spec: "Mon Fri 09:00-17:00", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			w, err := parseWindow(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseWindow() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			days := []byte("-------")
+			for d, ok := range w.days {
+				if ok {
+					days[d] = "SMTWTFS"[d]
+				}
+			}
+			if string(days) != tt.days || w.from != tt.from || w.to != tt.to {
+				t.Errorf("parseWindow() = %s %d-%d, want %s %d-%d", days, w.from, w.to, tt.days, tt.from, tt.to)
+			}
+		})
+	}
+}
+
+func TestWindowUntil(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+		t    time.Time
+		want time.Duration
+	}{
+		{name: "open", spec: "Mon-Fri 09:00-17:00", t: at(12, 9, 0), want: 0},
+		{name: "last minute", spec: "Mon-Fri 09:00-17:00", t: at(12, 16, 59), want: 0},
+		{name: "before opening", spec: "Mon-Fri 09:00-17:00", t: at(12, 8, 30), want: 30 * time.Minute},
+		{name: "after closing", spec: "Mon-Fri 09:00-17:00", t: at(12, 17, 0), want: 16 * time.Hour},
+		{name: "friday evening", spec: "Mon-Fri 09:00-17:00", t: at(16, 18, 0), want: 2*24*time.Hour + 15*time.Hour},
+		{name: "saturday", spec: "Mon-Fri 09:00-17:00", t: at(17, 12, 0), want: 24*time.Hour + 21*time.Hour},
+		{name: "single day next week", spec: "Mon 09:00-10:00", t: at(12, 10, 0), want: 7*24*time.Hour - time.Hour},
+		{name: "overnight after start", spec: "Fri 22:00-06:00", t: at(16, 23, 0), want: 0},
+		{name: "overnight next morning", spec: "Fri 22:00-06:00", t: at(17, 5, 59), want: 0},
+		{name: "overnight closed", spec: "Fri 22:00-06:00", t: at(17, 6, 0), want: 6*24*time.Hour + 16*time.Hour},
+		{name: "overnight of other day", spec: "Fri 22:00-06:00", t: at(16, 5, 0), want: 17 * time.Hour},
+		{name: "every day", spec: "08:00-18:00", t: at(17, 7, 0), want: time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w, err := parseWindow(tt.spec)
+			if err != nil {
+				t.Fatalf("parseWindow() error = %v", err)
+			}
+			if got := w.until(tt.t); got != tt.want {
+				t.Errorf("until(%s) = %s, want %s", tt.t.Format("Mon 15:04"), got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWindowUntilDST(t *testing.T) {
+	loc, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skip(err)
+	}
+	w, err := parseWindow("Mon-Fri 09:00-17:00")
+	if err != nil {
+		t.Fatalf("parseWindow() error = %v", err)
+	}
+	// clocks go back on Sunday 25 October 2026, the weekend has an extra hour
+	friday := time.Date(2026, time.October, 23, 17, 0, 0, 0, loc)
+	if got, want := w.until(friday), 2*24*time.Hour+16*time.Hour+time.Hour; got != want {
+		t.Errorf("until() over the change of time = %s, want %s", got, want)
+	}
+}
+
+func TestParseStartAt(t *testing.T) {
+	loc := time.FixedZone("UTC+2", 2*60*60)
+	want := time.Date(2026, time.October, 12, 9, 0, 0, 0, loc)
+	for _, s := range []string{"2026-10-12 09:00", "2026-10-12T09:00", " 2026-10-12 09:00 ", "2026-10-12T07:00:00Z"} {
+		got, err := parseStartAt(s, loc)
+		if err != nil || !got.Equal(want) {
+			t.Errorf("parseStartAt(%q) = %v, %v, want %v", s, got, err, want)
+		}
+	}
+	if _, err := parseStartAt("12.10.2026 09:00", loc); err == nil {
+		t.Errorf("parseStartAt() of other format error = nil, want error")
+	}
+}
+
+func TestGeneralWindow(t *testing.T) {
+	if w := (General{}).window(); w != nil {
+		t.Errorf("window() without Window = %v, want nil", w)
+	}
+	w := General{Window: "Mon-Fri 09:00-17:00", Timezone: "UTC"}.window()
+	if w == nil || w.loc != time.UTC {
+		t.Fatalf("window() = %+v, want window in UTC", w)
+	}
+	if loc := (General{Timezone: "Mars/Olympus"}).location(); loc != time.Local {
+		t.Errorf("location() of unknown timezone = %s, want Local", loc)
+	}
+}
+
+func TestDeliverySchedule(t *testing.T) {
+	if s := (General{}).deliverySchedule(); s != nil {
+		t.Errorf("deliverySchedule() without DeliverAt = %v, want nil", s)
+	}
+
+	s := General{DeliverAt: "09:00", Timezone: "UTC"}.deliverySchedule()
+	if s == nil {
+		t.Fatal("deliverySchedule() = nil")
+	}
+	s.now = at(12, 8, 0)
+
+	tokyo := SendingMail{Target: Target{Email: "tokyo@example.com", Timezone: "Asia/Tokyo"}}
+	london := SendingMail{Target: Target{Email: "london@example.com", Timezone: "Europe/London"}}
+	utc := SendingMail{Target: Target{Email: "utc@example.com"}}
+	unknown := SendingMail{Target: Target{Email: "unknown@example.com", Timezone: "Mars/Olympus"}}
+
+	tests := []struct {
+		m    SendingMail
+		want time.Time
+	}{
+		// 09:00 in Tokyo passed already at 00:00 UTC, it is next day
+		{m: tokyo, want: at(13, 0, 0)},
+		// London is UTC+1 in October
+		{m: london, want: at(12, 8, 0)},
+		{m: utc, want: at(12, 9, 0)},
+		{m: unknown, want: at(12, 9, 0)},
+	}
+	for _, tt := range tests {
+		if got := s.dueAt(tt.m); !got.Equal(tt.want) {
+			t.Errorf("dueAt(%s) = %v, want %v", tt.m.Email, got.UTC(), tt.want)
+		}
+	}
+
+	mails := []SendingMail{tokyo, utc, london}
+	s.sort(mails)
+	if mails[0].Email != london.Email || mails[1].Email != utc.Email || mails[2].Email != tokyo.Email {
+		t.Errorf("sort() = %s, %s, %s, want london, utc, tokyo", mails[0].Email, mails[1].Email, mails[2].Email)
+	}
+}
+
+func TestCheckTimezones(t *testing.T) {
+	if err := checkTimezones([]Target{{Timezone: "Europe/Berlin"}, {}}); err != nil {
+		t.Errorf("checkTimezones() error = %v", err)
+	}
+	if err := checkTimezones([]Target{{Email: "john@example.com", Timezone: "Mars/Olympus"}}); err == nil {
+		t.Errorf("checkTimezones() of unknown timezone error = nil, want error")
+	}
+}
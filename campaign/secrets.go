@@ -0,0 +1,171 @@
+package campaign
+
+import (
+	"bufio"
+	"math"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// SecretFinding is a value in config file which looks like a secret
+type SecretFinding struct {
+	Line int
+	// Key is the yaml key holding the value
+	Key string
+	// Kind describes what the value looks like, e.g. AWS access key
+	Kind string
+	// Value is redacted, only its first characters are kept
+	Value string
+}
+
+var secretPatterns = []struct {
+	kind string
+	re   *regexp.Regexp
+}{
+	{"AWS access key", regexp.MustCompile(`\b(AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{"Slack token", regexp.MustCompile(`\bxox[abposr]-[0-9A-Za-z-]{10,}`)},
+	{"GitHub token", regexp.MustCompile(`\bgh[pousr]_[0-9A-Za-z]{36}\b`)},
+	{"Google API key", regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`)},
+	{"SendGrid API key", regexp.MustCompile(`\bSG\.[0-9A-Za-z_-]{22}\.[0-9A-Za-z_-]{43}\b`)},
+	{"Twilio API key", regexp.MustCompile(`\bSK[0-9a-fA-F]{32}\b`)},
+	{"private key", regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----`)},
+}
+
+var (
+	// base64Like matches long tokens made of base64 or hex alphabet
+	base64Like = regexp.MustCompile(`[0-9A-Za-z+/_=-]{33,}`)
+	hexLike    = regexp.MustCompile(`^[0-9a-fA-F]+$`)
+	// secretKeys are yaml keys whose values are secrets whatever they look like
+	secretKeys = regexp.MustCompile(`(?i)(password|secret|token|apikey|api_key)$`)
+)
+
+// ScanForSecrets looks for passwords and API keys stored in the config file
+// at path, using known key formats and entropy of long random looking
+// strings. File which can not be read has no findings.
+func ScanForSecrets(path string) []SecretFinding {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	var findings []SecretFinding
+
+	scanner := bufio.NewScanner(f)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		key, value := splitYAMLLine(text)
+		// signature is public and high entropy by design
+		if key == "signature" || value == "" {
+			continue
+		}
+
+		if kind := secretKind(key, value); kind != "" {
+			findings = append(findings, SecretFinding{
+				Line:  line,
+				Key:   key,
+				Kind:  kind,
+				Value: redact(value),
+			})
+		}
+	}
+
+	return findings
+}
+
+// splitYAMLLine splits "key: value" line, dropping the list dash, quotes
+// and trailing comment
+func splitYAMLLine(line string) (string, string) {
+	line = strings.TrimSpace(strings.TrimPrefix(line, "- "))
+	// toml separates the key with =
+	i := strings.IndexAny(line, ":=")
+	if i < 0 {
+		return "", unquote(line)
+	}
+	value := strings.TrimSpace(line[i+1:])
+	if j := strings.Index(value, " #"); j >= 0 {
+		value = strings.TrimSpace(value[:j])
+	}
+	return strings.TrimSpace(line[:i]), unquote(value)
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+func secretKind(key, value string) string {
+	for _, p := range secretPatterns {
+		if p.re.MatchString(value) {
+			return p.kind
+		}
+	}
+
+	if secretKeys.MatchString(key) {
+		return "plain text " + strings.ToLower(key)
+	}
+
+	for _, token := range base64Like.FindAllString(value, -1) {
+		// hex alphabet has at most 4 bits of entropy per character, random
+		// base64 mixes cases and digits unlike long words joined together
+		threshold := 4.0
+		if hexLike.MatchString(token) {
+			threshold = 3.0
+		} else if !mixedCase(token) {
+			continue
+		}
+		if entropy(token) > threshold {
+			return "high entropy string"
+		}
+	}
+
+	return ""
+}
+
+// mixedCase reports whether s contains upper and lower case letters and digits
+func mixedCase(s string) bool {
+	var upper, lower, digit bool
+	for _, r := range s {
+		switch {
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= '0' && r <= '9':
+			digit = true
+		}
+	}
+	return upper && lower && digit
+}
+
+// entropy returns Shannon entropy of s in bits per character
+func entropy(s string) float64 {
+	counts := make(map[rune]int)
+	for _, r := range s {
+		counts[r]++
+	}
+
+	var e float64
+	n := float64(len(s))
+	for _, c := range counts {
+		p := float64(c) / n
+		e -= p * math.Log2(p)
+	}
+	return e
+}
+
+func redact(s string) string {
+	if len(s) <= 4 {
+		return "****"
+	}
+	return s[:4] + "****"
+}
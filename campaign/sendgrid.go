@@ -0,0 +1,228 @@
+package campaign
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/http"
+	"net/mail"
+	"strings"
+)
+
+// sendGrid converts the message into mail send request, SendGrid does not
+// accept raw MIME
+func (m *apiMailer) sendGrid(p Provider) error {
+	base, host := apiBase(p, "https://api.sendgrid.com")
+	m.host = host
+	m.user = "apikey"
+	endpoint := base + "/v3/mail/send"
+
+	m.request = func(msg *message) (*http.Request, error) {
+		payload, err := sendGridPayload(msg)
+		if err != nil {
+			return nil, err
+		}
+		body, err := json.Marshal(payload)
+		if err != nil {
+			return nil, err
+		}
+
+		req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Bearer "+p.APIKey)
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	}
+	return nil
+}
+
+type sendGridMail struct {
+	Personalizations []sendGridPersonalization `json:"personalizations"`
+	From             sendGridAddress           `json:"from"`
+	ReplyTo          *sendGridAddress          `json:"reply_to,omitempty"`
+	Subject          string                    `json:"subject"`
+	Content          []sendGridContent         `json:"content"`
+	Attachments      []sendGridAttachment      `json:"attachments,omitempty"`
+	Headers          map[string]string         `json:"headers,omitempty"`
+}
+
+type sendGridPersonalization struct {
+	To  []sendGridAddress `json:"to"`
+	Bcc []sendGridAddress `json:"bcc,omitempty"`
+}
+
+type sendGridAddress struct {
+	Email string `json:"email"`
+	Name  string `json:"name,omitempty"`
+}
+
+type sendGridContent struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type sendGridAttachment struct {
+	Content     string `json:"content"`
+	Type        string `json:"type,omitempty"`
+	Filename    string `json:"filename"`
+	Disposition string `json:"disposition,omitempty"`
+	ContentID   string `json:"content_id,omitempty"`
+}
+
+// sendGridHeaders are set from the fields of the request or by SendGrid,
+// the other headers of the message are passed as they are
+var sendGridHeaders = map[string]bool{
+	"From": true, "To": true, "Cc": true, "Bcc": true, "Subject": true,
+	"Reply-To": true, "Content-Type": true, "Content-Transfer-Encoding": true,
+	"Mime-Version": true, "Date": true, "Message-Id": true,
+}
+
+var headerDecoder = new(mime.WordDecoder)
+
+// sendGridPayload parses the message back into its addresses, bodies and
+// attachments. Recipients which are not in To header are sent as Bcc.
+func sendGridPayload(msg *message) (*sendGridMail, error) {
+	parsed, err := mail.ReadMessage(strings.NewReader(msg.data))
+	if err != nil {
+		return nil, fmt.Errorf("sendGridPayload: %v", err)
+	}
+	h := parsed.Header
+	parser := &mail.AddressParser{WordDecoder: headerDecoder}
+
+	from, err := parser.Parse(h.Get("From"))
+	if err != nil {
+		return nil, fmt.Errorf("sendGridPayload: From: %v", err)
+	}
+	subject, err := headerDecoder.DecodeHeader(h.Get("Subject"))
+	if err != nil {
+		return nil, fmt.Errorf("sendGridPayload: Subject: %v", err)
+	}
+
+	sg := &sendGridMail{
+		From:    sendGridAddress{Email: from.Address, Name: from.Name},
+		Subject: subject,
+	}
+
+	if replyTo := h.Get("Reply-To"); replyTo != "" {
+		addr, err := parser.Parse(replyTo)
+		if err != nil {
+			return nil, fmt.Errorf("sendGridPayload: Reply-To: %v", err)
+		}
+		sg.ReplyTo = &sendGridAddress{Email: addr.Address, Name: addr.Name}
+	}
+
+	var p sendGridPersonalization
+	visible := make(map[string]bool)
+	if to := h.Get("To"); to != "" {
+		list, err := parser.ParseList(to)
+		if err != nil {
+			return nil, fmt.Errorf("sendGridPayload: To: %v", err)
+		}
+		for _, a := range list {
+			p.To = append(p.To, sendGridAddress{Email: a.Address, Name: a.Name})
+			visible[strings.ToLower(a.Address)] = true
+		}
+	}
+	for _, rcpt := range msg.to {
+		if rcpt != "" && !visible[strings.ToLower(rcpt)] {
+			p.Bcc = append(p.Bcc, sendGridAddress{Email: rcpt})
+		}
+	}
+	if len(p.To) == 0 {
+		return nil, errors.New("sendGridPayload: message has no To header")
+	}
+	sg.Personalizations = []sendGridPersonalization{p}
+
+	for name, values := range h {
+		if !sendGridHeaders[name] && len(values) > 0 {
+			if sg.Headers == nil {
+				sg.Headers = make(map[string]string)
+			}
+			sg.Headers[name] = values[0]
+		}
+	}
+
+	if err := sg.addPart(h.Get("Content-Type"), h.Get("Content-Transfer-Encoding"), "", "", parsed.Body); err != nil {
+		return nil, fmt.Errorf("sendGridPayload: %v", err)
+	}
+	if len(sg.Content) == 0 {
+		return nil, errors.New("sendGridPayload: message has no body")
+	}
+	// text/plain has to go before text/html
+	if len(sg.Content) > 1 && sg.Content[0].Type == contentTypeHTML {
+		sg.Content[0], sg.Content[1] = sg.Content[1], sg.Content[0]
+	}
+	return sg, nil
+}
+
+// addPart adds body of MIME part, descending into multipart parts
+func (sg *sendGridMail) addPart(contentType, encoding, disposition, contentID string, body io.Reader) error {
+	if contentType == "" {
+		contentType = contentTypeText
+	}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return err
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		r := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := r.NextPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			err = sg.addPart(part.Header.Get("Content-Type"), part.Header.Get("Content-Transfer-Encoding"),
+				part.Header.Get("Content-Disposition"), part.Header.Get("Content-ID"), part)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	switch strings.ToLower(encoding) {
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	}
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return err
+	}
+
+	dispType, dispParams, _ := mime.ParseMediaType(disposition)
+	if dispType == "" && contentID == "" && (mediaType == contentTypeText || mediaType == contentTypeHTML || mediaType == contentTypeJSON) {
+		sg.Content = append(sg.Content, sendGridContent{Type: mediaType, Value: string(data)})
+		return nil
+	}
+
+	filename := dispParams["filename"]
+	if filename == "" {
+		filename = params["name"]
+	}
+	a := sendGridAttachment{
+		Content:     base64.StdEncoding.EncodeToString(data),
+		Type:        mediaType,
+		Filename:    filename,
+		Disposition: "attachment",
+	}
+	if contentID != "" {
+		a.Disposition = "inline"
+		a.ContentID = strings.Trim(contentID, "<>")
+	}
+	sg.Attachments = append(sg.Attachments, a)
+	return nil
+}
@@ -0,0 +1,121 @@
+package campaign
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// ses sends the message as raw content with SES v2 API
+func (m *apiMailer) ses(p Provider) error {
+	accessKey, secretKey, token := p.AccessKey, p.SecretKey, ""
+	if accessKey == "" {
+		accessKey = os.Getenv("AWS_ACCESS_KEY_ID")
+		secretKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		token = os.Getenv("AWS_SESSION_TOKEN")
+	}
+	if accessKey == "" || secretKey == "" {
+		return errors.New("ses needs accessKey and secretKey or AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+
+	base, host := apiBase(p, fmt.Sprintf("https://email.%s.amazonaws.com", p.Region))
+	m.host = host
+	m.user = accessKey
+	m.throttled = func(status int, body string) bool {
+		return strings.Contains(body, "Throttling") || strings.Contains(body, "TooManyRequests")
+	}
+	endpoint := base + "/v2/email/outbound-emails"
+
+	m.request = func(msg *message) (*http.Request, error) {
+		body, err := json.Marshal(map[string]interface{}{
+			"Destination": map[string][]string{"ToAddresses": msg.to},
+			"Content": map[string]interface{}{
+				"Raw": map[string]string{"Data": base64.StdEncoding.EncodeToString([]byte(msg.data))},
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("X-Amz-Security-Token", token)
+		}
+		signV4(req, body, accessKey, secretKey, p.Region, "ses", time.Now())
+		return req, nil
+	}
+	return nil
+}
+
+// signV4 adds AWS Signature Version 4 to req, signing its Content-Type, Host,
+// X-Amz-Date and X-Amz-Security-Token headers
+func signV4(req *http.Request, body []byte, accessKey, secretKey, region, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	headers := map[string]string{
+		"content-type": req.Header.Get("Content-Type"),
+		"host":         req.URL.Host,
+		"x-amz-date":   amzDate,
+	}
+	names := []string{"content-type", "host", "x-amz-date"}
+	if t := req.Header.Get("X-Amz-Security-Token"); t != "" {
+		headers["x-amz-security-token"] = t
+		names = append(names, "x-amz-security-token")
+	}
+	var canonicalHeaders strings.Builder
+	for _, n := range names {
+		canonicalHeaders.WriteString(n + ":" + strings.TrimSpace(headers[n]) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonical := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		sha256Hex(body),
+	}, "\n")
+
+	scope := strings.Join([]string{date, region, service, "aws4_request"}, "/")
+	toSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonical))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, toSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
+
+func sha256Hex(d []byte) string {
+	sum := sha256.Sum256(d)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,49 @@
+package campaign
+
+import (
+	"math/rand"
+	"time"
+)
+
+// ClickEvent struct holds information about target visiting its url
+type ClickEvent struct {
+	Name  string
+	Email string
+	URL   string
+	Time  string
+	// IP and UserAgent of the client are recorded by lateralus serve
+	IP        string `json:",omitempty" xml:",omitempty"`
+	UserAgent string `json:",omitempty" xml:",omitempty"`
+	// Simulated is set for events generated with simulateClicks
+	Simulated bool
+}
+
+// simulateClicks generates fake click events for percent of the mails that
+// were accepted by the mail server. Same seed always picks the same targets.
+func simulateClicks(mails []SendingMail, percent int, seed int64, after time.Time) []ClickEvent {
+	var sent []SendingMail
+	for _, m := range mails {
+		if m.Server != "" {
+			sent = append(sent, m)
+		}
+	}
+
+	rnd := rand.New(rand.NewSource(seed))
+	count := len(sent) * percent / 100
+
+	var clicks []ClickEvent
+	for _, i := range rnd.Perm(len(sent))[:count] {
+		m := sent[i]
+		// clicks are spread over the first hour after the campaign
+		at := after.Add(time.Duration(rnd.Int63n(int64(time.Hour))))
+		clicks = append(clicks, ClickEvent{
+			Name:      m.Name,
+			Email:     m.Email,
+			URL:       m.URL,
+			Time:      at.Format(timeFormat),
+			Simulated: true,
+		})
+	}
+
+	return clicks
+}
@@ -0,0 +1,188 @@
+package campaign
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lateralusd/lateralus/logging"
+)
+
+const slackEndpoint = "https://slack.com/api"
+
+// slackClient calls Slack Web API methods with bot token
+type slackClient struct {
+	token    string
+	endpoint string
+	client   *http.Client
+}
+
+type slackResponse struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error"`
+	User  struct {
+		ID string `json:"id"`
+	} `json:"user"`
+}
+
+func newSlackClient(s Slack, proxy *url.URL) *slackClient {
+	endpoint := s.Endpoint
+	if endpoint == "" {
+		endpoint = slackEndpoint
+	}
+	return &slackClient{
+		token:    s.Token,
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		client:   newHTTPClient(proxy),
+	}
+}
+
+// lookupByEmail returns id of the workspace member with email
+func (c *slackClient) lookupByEmail(ctx context.Context, email string) (string, error) {
+	res, err := c.call(ctx, http.MethodGet, "users.lookupByEmail?email="+url.QueryEscape(email), nil)
+	if err != nil {
+		return "", fmt.Errorf("lookupByEmail: %v", err)
+	}
+	return res.User.ID, nil
+}
+
+// postMessage sends text to channel, user id as channel sends direct message
+// from the bot
+func (c *slackClient) postMessage(ctx context.Context, channel, text string) error {
+	d, err := json.Marshal(map[string]string{
+		"channel": channel,
+		"text":    text,
+	})
+	if err != nil {
+		return fmt.Errorf("postMessage: %v", err)
+	}
+
+	if _, err := c.call(ctx, http.MethodPost, "chat.postMessage", d); err != nil {
+		return fmt.Errorf("postMessage: %v", err)
+	}
+
+	return nil
+}
+
+// call executes API method, waiting and retrying when Slack rate limits it
+func (c *slackClient) call(ctx context.Context, httpMethod, method string, body []byte) (*slackResponse, error) {
+	for {
+		var r io.Reader
+		if body != nil {
+			r = bytes.NewReader(body)
+		}
+
+		req, err := http.NewRequest(httpMethod, c.endpoint+"/"+method, r)
+		if err != nil {
+			return nil, err
+		}
+		req = req.WithContext(ctx)
+		req.Header.Set("Authorization", "Bearer "+c.token)
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json; charset=utf-8")
+		}
+
+		resp, err := c.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.StatusCode == http.StatusTooManyRequests {
+			resp.Body.Close()
+			wait, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+			if err != nil || wait < 1 {
+				wait = 1
+			}
+			logging.Warningf("Slack is rate limiting %s, waiting %ds", method, wait)
+			if err := sleep(ctx, time.Duration(wait)*time.Second); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		res := &slackResponse{}
+		err = json.NewDecoder(resp.Body).Decode(res)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", resp.Status, err)
+		}
+		if !res.OK {
+			return nil, fmt.Errorf("%s", res.Error)
+		}
+
+		return res, nil
+	}
+}
+
+// validateSlack checks the slack config when token is set
+func validateSlack(s Slack) error {
+	if s.Token == "" {
+		return nil
+	}
+
+	switch strings.ToLower(s.Mode) {
+	case "", "dm":
+	default:
+		return fmt.Errorf("unknown mode %q, only dm is supported", s.Mode)
+	}
+
+	if !strings.HasPrefix(s.Token, "xoxb-") {
+		return fmt.Errorf("token is not a bot token, it should start with xoxb-")
+	}
+
+	return nil
+}
+
+// sendSlack sends the rendered message to every target as direct message,
+// targets are found by their email
+func sendSlack(ctx context.Context, mails []SendingMail, opts *Options) error {
+	client := newSlackClient(opts.Slack, opts.proxyURL())
+
+	u, err := url.Parse(client.endpoint)
+	if err != nil {
+		return fmt.Errorf("sendSlack: %v", err)
+	}
+
+	limiter := opts.General.limiter()
+	sendWindow := opts.General.window()
+	pause := opts.General.pacer()
+
+	for i := range mails {
+		m := &mails[i]
+
+		if err := sendWindow.wait(ctx); err != nil {
+			return fmt.Errorf("sendSlack: %v", err)
+		}
+
+		if err := limiter.Wait(ctx); err != nil {
+			return fmt.Errorf("sendSlack: %v", err)
+		}
+
+		id, err := client.lookupByEmail(ctx, m.Email)
+		if err != nil {
+			if strings.HasSuffix(err.Error(), "users_not_found") {
+				logging.Warningf("No Slack user with email %s, skipping", m.Email)
+				continue
+			}
+			return fmt.Errorf("sendSlack: %v", err)
+		}
+
+		if err := client.postMessage(ctx, id, m.Body); err != nil {
+			return fmt.Errorf("sendSlack: %s: %v", m.Email, err)
+		}
+		m.Server = u.Host
+
+		if err := sleep(ctx, pause()); err != nil {
+			return fmt.Errorf("sendSlack: %v", err)
+		}
+	}
+
+	return nil
+}
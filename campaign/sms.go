@@ -0,0 +1,260 @@
+package campaign
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lateralusd/lateralus/logging"
+)
+
+// SMSProvider sends text messages to phone numbers
+type SMSProvider interface {
+	Send(to, body string) error
+}
+
+const (
+	twilioEndpoint    = "https://api.twilio.com/2010-04-01"
+	bandwidthEndpoint = "https://messaging.bandwidth.com/api/v2"
+)
+
+var e164 = regexp.MustCompile(`^\+[1-9][0-9]{1,14}$`)
+
+// TwilioSMSProvider sends SMS with Twilio Programmable Messaging API
+type TwilioSMSProvider struct {
+	AccountSID string
+	// Username is API key SID, AccountSID is used if empty
+	Username  string
+	AuthToken string
+	From      string
+	// Endpoint replaces the default Twilio API url
+	Endpoint string
+	Client   *http.Client
+}
+
+// Send sends body to phone number to
+func (t *TwilioSMSProvider) Send(to, body string) error {
+	endpoint := t.Endpoint
+	if endpoint == "" {
+		endpoint = twilioEndpoint
+	}
+
+	form := url.Values{}
+	form.Set("To", to)
+	form.Set("From", t.From)
+	form.Set("Body", body)
+
+	req, err := http.NewRequest(http.MethodPost,
+		fmt.Sprintf("%s/Accounts/%s/Messages.json", endpoint, t.AccountSID),
+		strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("TwilioSMSProvider.Send: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	username := t.Username
+	if username == "" {
+		username = t.AccountSID
+	}
+	req.SetBasicAuth(username, t.AuthToken)
+
+	if err := doProviderRequest(t.Client, req, nil); err != nil {
+		return fmt.Errorf("TwilioSMSProvider.Send: %v", err)
+	}
+
+	return nil
+}
+
+// BandwidthSMSProvider sends SMS with Bandwidth Messaging API v2
+type BandwidthSMSProvider struct {
+	AccountID     string
+	ApplicationID string
+	Username      string
+	Password      string
+	From          string
+	// Endpoint replaces the default Bandwidth API url
+	Endpoint string
+	Client   *http.Client
+}
+
+// Send sends body to phone number to
+func (b *BandwidthSMSProvider) Send(to, body string) error {
+	endpoint := b.Endpoint
+	if endpoint == "" {
+		endpoint = bandwidthEndpoint
+	}
+
+	d, err := json.Marshal(map[string]interface{}{
+		"applicationId": b.ApplicationID,
+		"to":            []string{to},
+		"from":          b.From,
+		"text":          body,
+	})
+	if err != nil {
+		return fmt.Errorf("BandwidthSMSProvider.Send: %v", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost,
+		fmt.Sprintf("%s/users/%s/messages", endpoint, b.AccountID),
+		bytes.NewReader(d))
+	if err != nil {
+		return fmt.Errorf("BandwidthSMSProvider.Send: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth(b.Username, b.Password)
+
+	if err := doProviderRequest(b.Client, req, nil); err != nil {
+		return fmt.Errorf("BandwidthSMSProvider.Send: %v", err)
+	}
+
+	return nil
+}
+
+// doProviderRequest executes req, turning non 2xx responses into errors
+// which contain the message returned by the provider. Successful JSON
+// response is decoded into v if it is not nil.
+func doProviderRequest(client *http.Client, req *http.Request, v interface{}) error {
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		if v != nil {
+			return json.NewDecoder(resp.Body).Decode(v)
+		}
+		io.Copy(ioutil.Discard, resp.Body)
+		return nil
+	}
+
+	d, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+	var apiErr struct {
+		Message     string `json:"message"`
+		Description string `json:"description"`
+	}
+	if json.Unmarshal(d, &apiErr) == nil {
+		if apiErr.Message != "" {
+			return fmt.Errorf("%s: %s", resp.Status, apiErr.Message)
+		}
+		if apiErr.Description != "" {
+			return fmt.Errorf("%s: %s", resp.Status, apiErr.Description)
+		}
+	}
+
+	return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(d)))
+}
+
+func newSMSProvider(s SMS, proxy *url.URL) (SMSProvider, error) {
+	switch strings.ToLower(s.Provider) {
+	case "twilio":
+		return &TwilioSMSProvider{
+			AccountSID: s.Account,
+			Username:   s.Username,
+			AuthToken:  s.Password,
+			From:       s.From,
+			Endpoint:   s.Endpoint,
+			Client:     newHTTPClient(proxy),
+		}, nil
+	case "bandwidth":
+		return &BandwidthSMSProvider{
+			AccountID:     s.Account,
+			ApplicationID: s.Application,
+			Username:      s.Username,
+			Password:      s.Password,
+			From:          s.From,
+			Endpoint:      s.Endpoint,
+			Client:        newHTTPClient(proxy),
+		}, nil
+	default:
+		return nil, fmt.Errorf("newSMSProvider: unknown provider %q", s.Provider)
+	}
+}
+
+// validateSMS checks that everything the provider needs is configured
+func validateSMS(s SMS) error {
+	var required []string
+	switch strings.ToLower(s.Provider) {
+	case "":
+		if s.Only {
+			return fmt.Errorf("provider is required to send only SMS")
+		}
+		return nil
+	case "twilio":
+		required = []string{"account", s.Account, "password", s.Password}
+	case "bandwidth":
+		required = []string{"account", s.Account, "application", s.Application,
+			"username", s.Username, "password", s.Password}
+	default:
+		return fmt.Errorf("unknown provider %q, expected twilio or bandwidth", s.Provider)
+	}
+
+	required = append(required, "template", s.Template)
+	for i := 0; i < len(required); i += 2 {
+		if required[i+1] == "" {
+			return fmt.Errorf("%s is required for %s", required[i], s.Provider)
+		}
+	}
+
+	if !e164.MatchString(s.From) {
+		return fmt.Errorf("from number %q is not in E.164 format, e.g. +15551234567", s.From)
+	}
+
+	return nil
+}
+
+// sendSMS sends the rendered SMS to every target with phone number,
+// respecting the same rate and delay as the mails
+func sendSMS(ctx context.Context, mails []SendingMail, opts *Options) error {
+	provider, err := newSMSProvider(opts.SMS, opts.proxyURL())
+	if err != nil {
+		return fmt.Errorf("sendSMS: %v", err)
+	}
+
+	limiter := opts.General.limiter()
+	sendWindow := opts.General.window()
+	pause := opts.General.pacer()
+
+	for i := range mails {
+		m := &mails[i]
+		if m.Phone == "" {
+			logging.Warningf("Target %s has no phone number, skipping SMS", m.Email)
+			continue
+		}
+		if !e164.MatchString(m.Phone) {
+			logging.Warningf("Phone number %q of %s is not in E.164 format, skipping SMS", m.Phone, m.Email)
+			continue
+		}
+
+		if err := sendWindow.wait(ctx); err != nil {
+			return fmt.Errorf("sendSMS: %v", err)
+		}
+
+		if err := limiter.Wait(ctx); err != nil {
+			return fmt.Errorf("sendSMS: %v", err)
+		}
+
+		if err := provider.Send(m.Phone, m.SMS); err != nil {
+			return fmt.Errorf("sendSMS: %s: %v", m.Phone, err)
+		}
+		m.SMSSent = true
+
+		if err := sleep(ctx, pause()); err != nil {
+			return fmt.Errorf("sendSMS: %v", err)
+		}
+	}
+
+	return nil
+}
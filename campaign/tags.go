@@ -0,0 +1,78 @@
+package campaign
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/lateralusd/lateralus/logging"
+)
+
+// parseTags splits tags column on commas, semicolons and pipes, so that
+// it can hold several tags also in .csv separated by commas
+func parseTags(value string) []string {
+	var tags []string
+	for _, t := range strings.FieldsFunc(value, func(r rune) bool {
+		return r == ',' || r == ';' || r == '|'
+	}) {
+		if t = strings.TrimSpace(t); t != "" {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
+func validateTags(tags []string) error {
+	for _, t := range tags {
+		if strings.TrimSpace(t) == "" {
+			return fmt.Errorf("tag cannot be empty")
+		}
+	}
+	return nil
+}
+
+// hasTag reports whether target has any of tags, compared in any case
+func (t Target) hasTag(tags []string) bool {
+	for _, have := range t.Tags {
+		for _, want := range tags {
+			if strings.EqualFold(have, strings.TrimSpace(want)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// selectTargets keeps the targets which have any of attack.includeTags, if
+// it is set, and none of attack.excludeTags
+func selectTargets(opts *Options, targets []Target) ([]Target, error) {
+	include, exclude := opts.Attack.IncludeTags, opts.Attack.ExcludeTags
+	if len(include) == 0 && len(exclude) == 0 {
+		return targets, nil
+	}
+
+	for _, tag := range include {
+		found := false
+		for _, t := range targets {
+			if t.hasTag([]string{tag}) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			logging.Warningf("No target has tag %q, is tags or group column missing?", tag)
+		}
+	}
+
+	var kept []Target
+	for _, t := range targets {
+		if len(include) > 0 && !t.hasTag(include) || t.hasTag(exclude) {
+			continue
+		}
+		kept = append(kept, t)
+	}
+	logging.Infof("Selected %d of %d targets by tags", len(kept), len(targets))
+	if len(kept) == 0 {
+		return nil, &ErrNoTargets{Path: opts.targetsSource()}
+	}
+	return kept, nil
+}
@@ -0,0 +1,307 @@
+package campaign
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lateralusd/lateralus/email"
+	"github.com/lateralusd/lateralus/logging"
+	"github.com/lateralusd/lateralus/util"
+)
+
+// What happens with targets which fail validation
+const (
+	onInvalidSkip  = "skip"
+	onInvalidAbort = "abort"
+)
+
+// TargetValidation checks the addresses of the targets before sending
+type TargetValidation struct {
+	// OnInvalid is skip, to drop the invalid targets, or abort, to stop
+	// before sending anything. Targets are not validated if it is empty.
+	OnInvalid string `yaml:"onInvalid"`
+	// MX looks up mail servers of the target domains
+	MX bool `yaml:"mx"`
+	// Probe asks the mail server of the domain whether it accepts the
+	// address, with RCPT TO which is never followed by DATA
+	Probe bool `yaml:"probe"`
+	// ProbeFrom is used in MAIL FROM of the probes, the From address by default
+	ProbeFrom string `yaml:"probeFrom"`
+}
+
+func validateTargetValidation(v TargetValidation) error {
+	switch v.OnInvalid {
+	case "", onInvalidSkip, onInvalidAbort:
+	default:
+		return fmt.Errorf("unknown onInvalid %q, expected skip or abort", v.OnInvalid)
+	}
+	if v.ProbeFrom != "" {
+		if err := validateAddress(v.ProbeFrom); err != nil {
+			return fmt.Errorf("invalid probeFrom %q: %v", v.ProbeFrom, err)
+		}
+	}
+	return nil
+}
+
+// InvalidTarget is target whose address failed validation
+type InvalidTarget struct {
+	// Row is the line of targets file
+	Row    int
+	Email  string
+	Reason string
+}
+
+// targetChecker validates addresses, results of the domains are cached
+type targetChecker struct {
+	v     TargetValidation
+	from  string
+	proxy *url.URL
+	// mx holds mail servers of the domains, nil if the domain is invalid
+	mx map[string][]string
+	// domainErr holds why the domain is invalid
+	domainErr map[string]string
+}
+
+// ValidateTargets loads the targets and checks them as configured in
+// attack.validation, also when onInvalid is not set. It returns the invalid
+// ones and the number of targets.
+func (c *Campaign) ValidateTargets(ctx context.Context) ([]InvalidTarget, int, error) {
+	opts := c.Options
+	if err := opts.Validate(); err != nil {
+		return nil, 0, err
+	}
+	targets, err := loadTargets(opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	if targets, err = selectTargets(opts, targets); err != nil {
+		return nil, 0, err
+	}
+	return validateTargets(ctx, opts, targets), len(targets), nil
+}
+
+// validateTargets checks syntax of the addresses, and if enabled, MX
+// records of their domains and whether their mail servers accept them.
+// Targets which could not be checked, e.g. because of DNS timeout or
+// greylisting, are considered valid.
+func validateTargets(ctx context.Context, opts *Options, targets []Target) []InvalidTarget {
+	c := &targetChecker{
+		v:         opts.Attack.Validation,
+		from:      opts.Attack.Validation.ProbeFrom,
+		proxy:     opts.proxyURL(),
+		mx:        make(map[string][]string),
+		domainErr: make(map[string]string),
+	}
+	if c.from == "" {
+		c.from = opts.fromAddress()
+	}
+
+	var invalid []InvalidTarget
+	valid := make(map[string][]string)
+	for i, t := range targets {
+		row := t.row
+		if row == 0 {
+			row = i + 1
+		}
+		reason := c.check(ctx, t.Email)
+		if reason != "" {
+			invalid = append(invalid, InvalidTarget{Row: row, Email: t.Email, Reason: reason})
+			continue
+		}
+		if c.v.Probe {
+			domain := emailDomain(t.Email)
+			valid[domain] = append(valid[domain], t.Email)
+		}
+	}
+
+	if c.v.Probe {
+		rejected := make(map[string]string)
+		for domain, addrs := range valid {
+			for addr, reason := range c.probe(ctx, domain, addrs) {
+				rejected[addr] = reason
+			}
+		}
+		for i, t := range targets {
+			if reason, ok := rejected[t.Email]; ok {
+				row := t.row
+				if row == 0 {
+					row = i + 1
+				}
+				invalid = append(invalid, InvalidTarget{Row: row, Email: t.Email, Reason: reason})
+			}
+		}
+		sort.SliceStable(invalid, func(i, j int) bool { return invalid[i].Row < invalid[j].Row })
+	}
+
+	return invalid
+}
+
+// check returns why the address is invalid, empty if it is valid
+func (c *targetChecker) check(ctx context.Context, address string) string {
+	if address == "" {
+		return "email is empty"
+	}
+	parsed, err := mail.ParseAddress(address)
+	if err != nil {
+		return "invalid syntax: " + strings.TrimPrefix(err.Error(), "mail: ")
+	}
+	if parsed.Address != address || parsed.Name != "" {
+		return "invalid syntax: not a bare address"
+	}
+	domain := emailDomain(address)
+	if !strings.Contains(domain, ".") {
+		return fmt.Sprintf("invalid domain %q", domain)
+	}
+
+	if !c.v.MX && !c.v.Probe {
+		return ""
+	}
+	if _, ok := c.mx[domain]; !ok {
+		c.lookupMX(ctx, domain)
+	}
+	return c.domainErr[domain]
+}
+
+// lookupMX finds the mail servers of domain, falling back to the domain
+// itself if it has address but no MX records (RFC 5321)
+func (c *targetChecker) lookupMX(ctx context.Context, domain string) {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	records, err := net.DefaultResolver.LookupMX(ctx, domain)
+	if err == nil && len(records) == 1 && records[0].Host == "." {
+		c.domainErr[domain] = "domain does not accept mail (null MX)"
+		c.mx[domain] = nil
+		return
+	}
+	if err == nil && len(records) > 0 {
+		for _, r := range records {
+			c.mx[domain] = append(c.mx[domain], strings.TrimSuffix(r.Host, "."))
+		}
+		return
+	}
+	if !util.IsNotFound(err) {
+		logging.Warningf("Error looking up MX of %s, its targets are not checked: %v", domain, err)
+		c.mx[domain] = nil
+		return
+	}
+
+	if _, err := net.DefaultResolver.LookupHost(ctx, domain); err != nil {
+		if util.IsNotFound(err) {
+			c.domainErr[domain] = "domain has no MX or address records"
+		} else {
+			logging.Warningf("Error looking up %s, its targets are not checked: %v", domain, err)
+		}
+		c.mx[domain] = nil
+		return
+	}
+	c.mx[domain] = []string{domain}
+}
+
+// probe sends RCPT TO for every address to the first mail server of domain
+// which answers and returns the rejected ones with the reason
+func (c *targetChecker) probe(ctx context.Context, domain string, addrs []string) map[string]string {
+	rejected := make(map[string]string)
+	hosts := c.mx[domain]
+	if len(hosts) == 0 {
+		return rejected
+	}
+
+	var conn *email.SMTP
+	var err error
+	for _, host := range hosts {
+		d := &email.Dialer{
+			Host:       host,
+			Port:       25,
+			LocalName:  emailDomain(c.from),
+			Encryption: email.EncryptionSTARTTLS,
+			// mail servers of the targets are only asked, not trusted
+			TLSConfig: &tls.Config{ServerName: host, InsecureSkipVerify: true},
+			Proxy:     c.proxy,
+		}
+		conn, err = d.Dial()
+		if errors.Is(err, email.ErrNoSTARTTLS) {
+			// nothing secret is sent, so servers without STARTTLS are
+			// asked in plain text
+			d.Encryption = email.EncryptionNone
+			conn, err = d.Dial()
+		}
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		logging.Warningf("Error connecting to mail servers of %s, its targets are not probed: %v", domain, err)
+		return rejected
+	}
+	defer conn.Quit()
+
+	for _, addr := range addrs {
+		if ctx.Err() != nil {
+			break
+		}
+		err := conn.Verify(c.from, addr)
+		var tpErr *textproto.Error
+		switch {
+		case err == nil:
+		case errors.As(err, &tpErr) && tpErr.Code/100 == 5:
+			rejected[addr] = fmt.Sprintf("rejected by %s: %d %s", domain, tpErr.Code, tpErr.Msg)
+		default:
+			logging.Warningf("Probe of %s was inconclusive: %v", addr, err)
+		}
+	}
+	return rejected
+}
+
+// filterTargets validates the targets as configured, dropping the invalid
+// ones or failing if any was found
+func filterTargets(ctx context.Context, opts *Options, targets []Target) ([]Target, error) {
+	v := opts.Attack.Validation
+	if v.OnInvalid == "" {
+		return targets, nil
+	}
+
+	invalid := validateTargets(ctx, opts, targets)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if len(invalid) == 0 {
+		return targets, nil
+	}
+
+	for _, t := range invalid {
+		logging.Warningf("Row %d (%s) is invalid: %s", t.Row, t.Email, t.Reason)
+	}
+	if v.OnInvalid == onInvalidAbort {
+		return nil, &ErrInvalidTargets{Invalid: invalid}
+	}
+
+	dropped := make(map[int]bool, len(invalid))
+	for _, t := range invalid {
+		dropped[t.Row] = true
+	}
+	var kept []Target
+	for i, t := range targets {
+		row := t.row
+		if row == 0 {
+			row = i + 1
+		}
+		if !dropped[row] {
+			kept = append(kept, t)
+		}
+	}
+	logging.Infof("Dropped %d invalid targets, %d remain", len(invalid), len(kept))
+	if len(kept) == 0 {
+		return nil, &ErrNoTargets{Path: opts.targetsSource()}
+	}
+	return kept, nil
+}
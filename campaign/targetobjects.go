@@ -0,0 +1,103 @@
+package campaign
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// isTargetObjects reports whether the targets file is JSON or YAML list of
+// target objects
+func isTargetObjects(filename string) bool {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".json", ".yaml", ".yml":
+		return true
+	}
+	return false
+}
+
+// readTargetObjects returns the list of target objects as rows, the first
+// one is header with keys of all the objects. Missing keys are empty cells
+// and num of the rows is the position of the object in the list.
+func readTargetObjects(filename string) ([]targetRow, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("readTargetObjects: %v", err)
+	}
+
+	var objects []map[string]interface{}
+	if strings.EqualFold(filepath.Ext(filename), ".json") {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		// phone numbers stay as written
+		dec.UseNumber()
+		err = dec.Decode(&objects)
+	} else {
+		err = yaml.Unmarshal(data, &objects)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("readTargetObjects: %s is not list of targets: %v", filename, err)
+	}
+	if len(objects) == 0 {
+		return nil, nil
+	}
+
+	// keys differing only in case are the same column
+	columns := make(map[string]int)
+	var header []string
+	for _, o := range objects {
+		for k := range o {
+			if _, ok := columns[strings.ToLower(k)]; !ok {
+				columns[strings.ToLower(k)] = -1
+				header = append(header, k)
+			}
+		}
+	}
+	sort.Strings(header)
+	for i, k := range header {
+		columns[strings.ToLower(k)] = i
+	}
+
+	rows := []targetRow{{num: 0, cells: header}}
+	for i, o := range objects {
+		row := targetRow{num: i + 1, cells: make([]string, len(header))}
+		set := make(map[int]bool, len(o))
+		for k, v := range o {
+			col := columns[strings.ToLower(k)]
+			if set[col] {
+				return nil, fmt.Errorf("readTargetObjects: target %d has %s twice", row.num, header[col])
+			}
+			set[col] = true
+			value, err := targetValue(v)
+			if err != nil {
+				return nil, fmt.Errorf("readTargetObjects: %s of target %d %v", k, row.num, err)
+			}
+			row.cells[col] = value
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// targetValue formats scalar value of target object as string
+func targetValue(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case int, int64, uint64, bool:
+		return fmt.Sprint(v), nil
+	}
+	return "", fmt.Errorf("is %T, expected string, number or boolean", v)
+}
@@ -0,0 +1,319 @@
+package campaign
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/lateralusd/lateralus/logging"
+)
+
+// Target struct holds information about single target
+type Target struct {
+	Name  string
+	Email string
+	// Phone is optional third column, used for SMS
+	Phone string
+	// Timezone is IANA name, e.g. Europe/Berlin, from timezone column of
+	// targets file with header row
+	Timezone string `json:",omitempty" xml:",omitempty"`
+	// Tags are read from tags and group columns of targets file with
+	// header row, attack.includeTags and excludeTags select the targets by them
+	Tags []string `json:",omitempty" xml:",omitempty"`
+	// Fields holds every column of targets file with header row, keyed by
+	// the column name turned into template field, e.g. "manager name" is
+	// available as {{.ManagerName}}
+	Fields map[string]string `json:",omitempty" xml:"-"`
+	// Headers are added only to the mail of the target, overriding the
+	// custom headers of the campaign. They are read from the columns named
+	// "Header: X-Foo" of targets file with header row.
+	Headers map[string]string `json:",omitempty" xml:"-"`
+
+	// row is the line of targets file, for reporting invalid targets
+	row int
+}
+
+const utf8BOM = "\ufeff"
+
+// targetRow is line of targets file or row of sheet, num is its number
+type targetRow struct {
+	num   int
+	cells []string
+}
+
+func loadTargets(opts *Options) ([]Target, error) {
+	if len(opts.TargetList) > 0 {
+		return opts.TargetList, nil
+	}
+
+	var rows []targetRow
+	var err error
+	hasHeader := false
+	switch {
+	case opts.Attack.LDAP.Host != "":
+		rows, err = readLDAP(opts)
+		hasHeader = true
+	case isTargetObjects(opts.Attack.Targets):
+		rows, err = readTargetObjects(opts.Attack.Targets)
+		hasHeader = true
+	case isXLSX(opts.Attack.Targets):
+		rows, err = readXLSX(opts.Attack.Targets, opts.Attack.Sheet)
+	default:
+		rows, err = readCSV(opts.Attack.Targets, opts.General.Separator)
+	}
+	if err != nil {
+		return []Target{}, err
+	}
+	return parseTargets(opts.targetsSource(), rows, opts.Attack.Columns, hasHeader)
+}
+
+// targetsSource describes where the targets are read from, for logs
+func (o *Options) targetsSource() string {
+	if o.Attack.LDAP.Host != "" {
+		return o.Attack.LDAP.url()
+	}
+	return o.Attack.Targets
+}
+
+// readCSV splits non-empty lines of targets file on sep
+func readCSV(filename string, sep string) ([]targetRow, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("readCSV: %v", err)
+	}
+	defer f.Close()
+
+	var rows []targetRow
+	scanner := bufio.NewScanner(f)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := scanner.Text()
+		if lineNum == 1 {
+			// files exported from spreadsheets often start with UTF-8 BOM
+			line = strings.TrimPrefix(line, utf8BOM)
+		}
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		rows = append(rows, targetRow{num: lineNum, cells: strings.Split(line, sep)})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("readCSV: %v", err)
+	}
+	return rows, nil
+}
+
+// parseTargets reads targets from rows with name, email and optional phone
+// columns. If the second column of the first row is not an email address,
+// or columns maps fields to the columns, the row is header naming the
+// columns, which can then be in any order. With hasHeader set the first
+// row is always header.
+func parseTargets(filename string, rows []targetRow, columns map[string]string, hasHeader bool) ([]Target, error) {
+	var targets []Target
+	var header []string
+	var err error
+
+	for i, r := range rows {
+		if i == 0 && (hasHeader || len(columns) > 0 || len(r.cells) >= 2 && !strings.Contains(r.cells[1], "@")) {
+			header, err = parseHeader(r.cells, columns)
+			if err != nil {
+				return []Target{}, fmt.Errorf("parseTargets: %v", err)
+			}
+			continue
+		}
+
+		var tgt Target
+		if header != nil {
+			if len(r.cells) != len(header) {
+				return []Target{}, fmt.Errorf("parseTargets: line %d has %d columns, header has %d", r.num, len(r.cells), len(header))
+			}
+			tgt = headerTarget(header, r.cells)
+		} else {
+			if len(r.cells) < 2 {
+				return []Target{}, errors.New("parseTargets: length of line is not 2, is separator ok?")
+			}
+			tgt = Target{
+				Name:  r.cells[0],
+				Email: r.cells[1],
+			}
+			if len(r.cells) > 2 {
+				tgt.Phone = r.cells[2]
+			}
+		}
+		tgt.row = r.num
+		targets = append(targets, normalizeTarget(tgt))
+	}
+
+	if len(targets) == 0 {
+		return []Target{}, &ErrNoTargets{Path: filename}
+	}
+
+	return targets, nil
+}
+
+// parseHeader turns column names into template field names, one of them
+// has to be email. columns maps field names to the columns they are read
+// from, e.g. email: "E-mail Address".
+func parseHeader(cells []string, columns map[string]string) ([]string, error) {
+	header := make([]string, len(cells))
+	seen := make(map[string]bool)
+	mapped := make(map[string]bool)
+	for i, c := range cells {
+		if name, ok := headerColumn(c); ok {
+			if err := validateHeaders(map[string]string{name: ""}); err != nil {
+				return nil, fmt.Errorf("column %d of header: %v", i+1, err)
+			}
+			field := targetHeaderPrefix + name
+			if seen[field] {
+				return nil, fmt.Errorf("header has column %s twice", field)
+			}
+			seen[field] = true
+			header[i] = field
+			continue
+		}
+
+		for f, col := range columns {
+			if strings.EqualFold(strings.TrimSpace(c), strings.TrimSpace(col)) {
+				c = f
+				mapped[f] = true
+			}
+		}
+
+		field := fieldName(c)
+		switch strings.ToLower(field) {
+		case "name", "email", "phone", "timezone", "tags", "group":
+			// E-mail or NAME are still the standard columns
+			field = strings.Title(strings.ToLower(field))
+		}
+		if field == "" {
+			return nil, fmt.Errorf("column %d of header has no name", i+1)
+		}
+		if seen[field] {
+			return nil, fmt.Errorf("header has column %s twice", field)
+		}
+		seen[field] = true
+		header[i] = field
+	}
+	for f, col := range columns {
+		if !mapped[f] {
+			return nil, fmt.Errorf("column %q of %s is not in the header", col, f)
+		}
+	}
+	if !seen["Email"] {
+		return nil, errors.New("header has no email column, is separator ok?")
+	}
+	return header, nil
+}
+
+// headerTarget creates target from columns named by header
+func headerTarget(header, columns []string) Target {
+	tgt := Target{Fields: make(map[string]string)}
+	for i, field := range header {
+		value := strings.TrimSpace(columns[i])
+		if strings.HasPrefix(field, targetHeaderPrefix) {
+			// empty cell keeps the header of the campaign
+			if value != "" {
+				if tgt.Headers == nil {
+					tgt.Headers = make(map[string]string)
+				}
+				tgt.Headers[strings.TrimPrefix(field, targetHeaderPrefix)] = value
+			}
+			continue
+		}
+		tgt.Fields[field] = value
+		switch field {
+		case "Name":
+			tgt.Name = value
+		case "Email":
+			tgt.Email = value
+		case "Phone":
+			tgt.Phone = value
+		case "Timezone":
+			tgt.Timezone = value
+		case "Tags":
+			tgt.Tags = append(tgt.Tags, parseTags(value)...)
+		case "Group":
+			if value != "" {
+				tgt.Tags = append(tgt.Tags, value)
+			}
+		}
+	}
+	return tgt
+}
+
+// fieldName turns column name into exported template field, words are
+// capitalized and everything but letters and digits is dropped, so that
+// "manager name" becomes ManagerName
+func fieldName(column string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range strings.TrimSpace(column) {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if b.Len() == 0 && unicode.IsDigit(r) {
+			// template fields cannot start with digit
+			b.WriteRune('C')
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// normalizeTarget trims the fields, lowercases the email and removes the
+// formatting from the phone number, name keeps its case
+func normalizeTarget(t Target) Target {
+	return Target{
+		Name:     strings.TrimSpace(t.Name),
+		Email:    strings.ToLower(strings.TrimSpace(t.Email)),
+		Phone:    normalizePhone(t.Phone),
+		Timezone: strings.TrimSpace(t.Timezone),
+		Tags:     t.Tags,
+		Fields:   t.Fields,
+		Headers:  t.Headers,
+		row:      t.row,
+	}
+}
+
+// dedupTargets keeps only the first target of every address, the addresses
+// are already normalized
+func dedupTargets(targets []Target) []Target {
+	first := make(map[string]int, len(targets))
+	kept := make([]Target, 0, len(targets))
+	for i, t := range targets {
+		row := t.row
+		if row == 0 {
+			row = i + 1
+		}
+		if firstRow, ok := first[t.Email]; ok {
+			logging.Infof("Row %d duplicates row %d (%s), skipping it", row, firstRow, t.Email)
+			continue
+		}
+		first[t.Email] = row
+		kept = append(kept, t)
+	}
+	if n := len(targets) - len(kept); n > 0 {
+		logging.Warningf("Collapsed %d duplicate targets, %d remain", n, len(kept))
+	}
+	return kept
+}
+
+// normalizePhone drops spaces, dashes, dots and parentheses, so that
+// "+1 (555) 123-4567" becomes "+15551234567"
+func normalizePhone(phone string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '-', '.', '(', ')':
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(phone))
+}
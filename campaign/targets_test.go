@@ -0,0 +1,167 @@
+package campaign
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestLoadTargetsCSV(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		sep     string
+		want    []Target
+	}{
+		{
+			name:    "plain",
+			content: "John Doe,john@example.com\nJane Roe,jane@example.com\n",
+			want: []Target{
+				{Name: "John Doe", Email: "john@example.com"},
+				{Name: "Jane Roe", Email: "jane@example.com"},
+			},
+		},
+		{
+			name:    "byte order mark",
+			content: utf8BOM + "John Doe,john@example.com\n",
+			want:    []Target{{Name: "John Doe", Email: "john@example.com"}},
+		},
+		{
+			name:    "byte order mark before header",
+			content: utf8BOM + "Name,Email\nJohn Doe,john@example.com\n",
+			want: []Target{{
+				Name:   "John Doe",
+				Email:  "john@example.com",
+				Fields: map[string]string{"Name": "John Doe", "Email": "john@example.com"},
+			}},
+		},
+		{
+			name:    "padded and mixed case email",
+			content: "  John Doe ,  John.Doe@Example.COM  , +1 (555) 123-4567\n",
+			want:    []Target{{Name: "John Doe", Email: "john.doe@example.com", Phone: "+15551234567"}},
+		},
+		{
+			name:    "padded header columns",
+			content: " E-mail ; Full name \n JOHN@EXAMPLE.COM ; John Doe\n",
+			sep:     ";",
+			want: []Target{{
+				Email:  "john@example.com",
+				Fields: map[string]string{"Email": "JOHN@EXAMPLE.COM", "FullName": "John Doe"},
+			}},
+		},
+		{
+			name:    "crlf and empty lines",
+			content: "John Doe,john@example.com\r\n\r\n  \r\nJane Roe,jane@example.com\r\n",
+			want: []Target{
+				{Name: "John Doe", Email: "john@example.com"},
+				{Name: "Jane Roe", Email: "jane@example.com"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sep := tt.sep
+			if sep == "" {
+				sep = ","
+			}
+			opts := NewOptions(WithTargetsFile(writeConfig(t, "targets.csv", tt.content)))
+			opts.General.Separator = sep
+
+			got, err := loadTargets(opts)
+			if err != nil {
+				t.Fatalf("loadTargets() error = %v", err)
+			}
+			for i := range got {
+				got[i].row = 0
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("loadTargets() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadTargetsInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{name: "wrong separator", content: "John Doe;john@example.com\n"},
+		{name: "header without email", content: "Name,Department\nJohn Doe,Finance\n"},
+		{name: "short row", content: "Name,Email\nJohn Doe\n"},
+		{name: "duplicate column", content: "Email,E-mail\njohn@example.com,john@example.com\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := NewOptions(WithTargetsFile(writeConfig(t, "targets.csv", tt.content)))
+			if _, err := loadTargets(opts); err == nil {
+				t.Errorf("loadTargets() error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestLoadTargetsEmpty(t *testing.T) {
+	filename := writeConfig(t, "targets.csv", utf8BOM+"\n\n")
+	_, err := loadTargets(NewOptions(WithTargetsFile(filename)))
+
+	var noTargets *ErrNoTargets
+	if !errors.As(err, &noTargets) || noTargets.Path != filename {
+		t.Fatalf("loadTargets() error = %v, want ErrNoTargets of %s", err, filename)
+	}
+}
+
+func TestDedupTargets(t *testing.T) {
+	opts := NewOptions(WithTargetsFile(writeConfig(t, "targets.csv",
+		"John Doe,john@example.com\nJohnny,JOHN@example.com \nJane Roe,jane@example.com\n")))
+	targets, err := loadTargets(opts)
+	if err != nil {
+		t.Fatalf("loadTargets() error = %v", err)
+	}
+
+	got := dedupTargets(targets)
+	if len(got) != 2 || got[0].Name != "John Doe" || got[1].Name != "Jane Roe" {
+		t.Errorf("dedupTargets() = %+v, want John Doe and Jane Roe", got)
+	}
+}
+
+func TestFieldName(t *testing.T) {
+	tests := map[string]string{
+		"manager name":  "ManagerName",
+		" E-mail ":      "EMail",
+		"2fa method":    "C2faMethod",
+		"Straße":        "Straße",
+		"cost_center #": "CostCenter",
+		"":              "",
+	}
+	for column, want := range tests {
+		if got := fieldName(column); got != want {
+			t.Errorf("fieldName(%q) = %q, want %q", column, got, want)
+		}
+	}
+}
+
+func TestErrInvalidTargets(t *testing.T) {
+	tests := []struct {
+		name    string
+		invalid []InvalidTarget
+		want    string
+	}{
+		{name: "none", want: "targets are invalid"},
+		{
+			name:    "two",
+			invalid: []InvalidTarget{{Row: 3, Email: "john@", Reason: "missing domain"}, {Row: 7, Email: "jane", Reason: "missing @"}},
+			want:    "2 targets are invalid, first on row 3 (john@): missing domain",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := &ErrInvalidTargets{Invalid: tt.invalid}
+			if got := err.Error(); got != tt.want {
+				t.Errorf("Error() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
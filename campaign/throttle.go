@@ -0,0 +1,93 @@
+package campaign
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// domainThrottle limits the number of mails sent to every recipient domain
+type domainThrottle struct {
+	perMinute int
+	burst     int
+	// limiters holds *rate.Limiter for every domain
+	limiters sync.Map
+}
+
+// newDomainThrottle allows perMinute mails per domain, burst has to be at
+// least the number of recipients of single mail. Zero perMinute disables
+// throttling and nil is returned.
+func newDomainThrottle(perMinute, burst int) *domainThrottle {
+	if perMinute <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &domainThrottle{
+		perMinute: perMinute,
+		burst:     burst,
+	}
+}
+
+func (t *domainThrottle) limiter(domain string) *rate.Limiter {
+	l, _ := t.limiters.LoadOrStore(domain, rate.NewLimiter(rate.Every(time.Minute/time.Duration(t.perMinute)), t.burst))
+	return l.(*rate.Limiter)
+}
+
+// pick returns index of the first group in queue which can be sent now,
+// reserving it from the limiters of its domains. If every group is
+// throttled, -1 is returned together with the time until one can be sent.
+func (t *domainThrottle) pick(queue [][]SendingMail) (int, time.Duration) {
+	if t == nil {
+		return 0, 0
+	}
+
+	now := time.Now()
+	var wait time.Duration
+	for i, group := range queue {
+		d := t.reserve(group, now)
+		if d == 0 {
+			return i, 0
+		}
+		if wait == 0 || d < wait {
+			wait = d
+		}
+	}
+
+	return -1, wait
+}
+
+// reserve takes tokens for every recipient of group from its domain
+// limiter. If any domain is throttled, nothing is taken and the time until
+// group can be sent is returned.
+func (t *domainThrottle) reserve(group []SendingMail, now time.Time) time.Duration {
+	counts := make(map[string]int)
+	for _, m := range group {
+		counts[emailDomain(m.Email)]++
+	}
+
+	var reservations []*rate.Reservation
+	var wait time.Duration
+	for domain, n := range counts {
+		r := t.limiter(domain).ReserveN(now, n)
+		reservations = append(reservations, r)
+		if d := r.DelayFrom(now); d > wait {
+			wait = d
+		}
+	}
+
+	if wait > 0 {
+		for _, r := range reservations {
+			r.CancelAt(now)
+		}
+	}
+
+	return wait
+}
+
+func emailDomain(email string) string {
+	return strings.ToLower(email[strings.LastIndex(email, "@")+1:])
+}
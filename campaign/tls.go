@@ -0,0 +1,80 @@
+package campaign
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+)
+
+// Encryption of the mail server connection
+const (
+	encryptionNone     = "none"
+	encryptionSTARTTLS = "starttls"
+	// encryptionTLS is STARTTLS too, kept for the older configs
+	encryptionTLS = "tls"
+	// encryptionSSL is implicit TLS, usually on port 465
+	encryptionSSL = "ssl"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// TLS struct configures verification of the mail server certificate
+type TLS struct {
+	// MinVersion is 1.0, 1.1, 1.2 or 1.3, Go default if empty
+	MinVersion string `yaml:"minVersion"`
+	// CAFile is PEM bundle of certificates trusted instead of system ones,
+	// e.g. for relays with self-signed certificates
+	CAFile string `yaml:"caFile"`
+	// ServerName is verified instead of the host
+	ServerName string `yaml:"serverName"`
+	// InsecureSkipVerify accepts any certificate
+	InsecureSkipVerify bool `yaml:"insecureSkipVerify"`
+}
+
+// config returns TLS config for connecting to host
+func (t TLS) config(host string) (*tls.Config, error) {
+	c := &tls.Config{
+		ServerName:         host,
+		InsecureSkipVerify: t.InsecureSkipVerify,
+	}
+	if t.ServerName != "" {
+		c.ServerName = t.ServerName
+	}
+
+	if t.MinVersion != "" {
+		v, ok := tlsVersions[t.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unknown minVersion %q, expected 1.0, 1.1, 1.2 or 1.3", t.MinVersion)
+		}
+		c.MinVersion = v
+	}
+
+	if t.CAFile != "" {
+		d, err := ioutil.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(d) {
+			return nil, fmt.Errorf("no certificate found in %s", t.CAFile)
+		}
+		c.RootCAs = pool
+	}
+
+	return c, nil
+}
+
+func validateEncryption(encryption string) error {
+	switch encryption {
+	case "", encryptionNone, encryptionSTARTTLS, encryptionTLS, encryptionSSL:
+		return nil
+	default:
+		return fmt.Errorf("unknown encryption %q, expected none, starttls or ssl", encryption)
+	}
+}
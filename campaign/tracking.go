@@ -0,0 +1,182 @@
+package campaign
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/lateralusd/lateralus/tracking"
+)
+
+// Tracking configures the server started with lateralus track
+type Tracking struct {
+	// URL is where the tracking server is reachable by the targets, e.g.
+	// https://track.example.com. Tracking pixel is added to every mail if
+	// it is set.
+	URL string `yaml:"url"`
+}
+
+// Landing configures the landing page served with lateralus serve on the
+// URLs of the targets
+type Landing struct {
+	// Template is HTML template of the page, {{.Token}} identifies the target
+	Template string `yaml:"template"`
+	// Redirect is where the target is sent after submitting the form
+	Redirect string `yaml:"redirect"`
+}
+
+// OpenEvent is single load of the tracking pixel by the target
+type OpenEvent struct {
+	Name      string
+	Email     string
+	Time      string
+	IP        string
+	UserAgent string
+}
+
+// Submission is form submitted by the target on the landing page
+type Submission struct {
+	Name      string
+	Email     string
+	Time      string
+	IP        string
+	UserAgent string
+	Fields    map[string]string
+}
+
+var bodyEnd = regexp.MustCompile(`(?i)</body\s*>`)
+
+func validateTracking(t Tracking) error {
+	if t.URL == "" {
+		return nil
+	}
+	u, err := url.Parse(t.URL)
+	if err != nil {
+		return err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%q is not http or https url", t.URL)
+	}
+	return nil
+}
+
+// injectPixel adds the tracking pixel before the end of HTML body, unless
+// the template already placed it with {{.PixelURL}}
+func injectPixel(body, pixelURL string) string {
+	if strings.Contains(body, pixelURL) {
+		return body
+	}
+	img := fmt.Sprintf(`<img src="%s" width="1" height="1" alt="" style="display:none">`, pixelURL)
+	if loc := bodyEnd.FindStringIndex(body); loc != nil {
+		return body[:loc[0]] + img + body[loc[0]:]
+	}
+	return body + img
+}
+
+// trackingIDs returns the targets keyed by their ID, used by tracking
+// pixels, and by the token of their URL
+func (r *Result) trackingIDs() (byID, byToken map[string]SendingMail) {
+	byID = make(map[string]SendingMail)
+	byToken = make(map[string]SendingMail)
+	link, _ := tracking.NewLink(r.URL)
+	for _, t := range r.Targets {
+		byID[t.ID] = t
+		if link == nil {
+			continue
+		}
+		if token, ok := link.Token(t.URL); ok {
+			byToken[token] = t
+		}
+	}
+	return byID, byToken
+}
+
+// TrackingTargets maps IDs and URL tokens of the targets to their names and
+// emails, so that tracking server can tell the targets apart from other
+// visitors
+func (r *Result) TrackingTargets() map[string]tracking.Target {
+	byID, byToken := r.trackingIDs()
+	targets := make(map[string]tracking.Target, len(byID)+len(byToken))
+	for id, t := range byID {
+		targets[id] = tracking.Target{Name: t.Name, Email: t.Email}
+	}
+	for token, t := range byToken {
+		targets[token] = tracking.Target{Name: t.Name, Email: t.Email}
+	}
+	return targets
+}
+
+// AddEvents adds events recorded by the tracking server to the report and
+// returns the number of the added ones. Events of other campaigns and the
+// ones already in the report are skipped.
+func (r *Result) AddEvents(events []tracking.Event) int {
+	byID, byToken := r.trackingIDs()
+
+	seen := make(map[string]bool)
+	key := func(eventType, email, time, ip, userAgent string) string {
+		return strings.Join([]string{eventType, email, time, ip, userAgent}, "\x00")
+	}
+	for _, o := range r.Opens {
+		seen[key(tracking.EventOpen, o.Email, o.Time, o.IP, o.UserAgent)] = true
+	}
+	for _, c := range r.Clicks {
+		seen[key(tracking.EventClick, c.Email, c.Time, c.IP, c.UserAgent)] = true
+	}
+	for _, s := range r.Submissions {
+		seen[key(tracking.EventSubmit, s.Email, s.Time, s.IP, s.UserAgent)] = true
+	}
+
+	added := 0
+	for _, e := range events {
+		targets := byToken
+		if e.Type == tracking.EventOpen {
+			targets = byID
+		}
+		t, ok := targets[e.ID]
+		if !ok {
+			continue
+		}
+
+		at := e.Time.Local().Format(timeFormat)
+		k := key(e.Type, t.Email, at, e.IP, e.UserAgent)
+		if seen[k] {
+			continue
+		}
+
+		switch e.Type {
+		case tracking.EventOpen:
+			r.Opens = append(r.Opens, OpenEvent{
+				Name:      t.Name,
+				Email:     t.Email,
+				Time:      at,
+				IP:        e.IP,
+				UserAgent: e.UserAgent,
+			})
+		case tracking.EventClick:
+			r.Clicks = append(r.Clicks, ClickEvent{
+				Name:      t.Name,
+				Email:     t.Email,
+				URL:       t.URL,
+				Time:      at,
+				IP:        e.IP,
+				UserAgent: e.UserAgent,
+			})
+		case tracking.EventSubmit:
+			r.Submissions = append(r.Submissions, Submission{
+				Name:      t.Name,
+				Email:     t.Email,
+				Time:      at,
+				IP:        e.IP,
+				UserAgent: e.UserAgent,
+				Fields:    e.Fields,
+			})
+		default:
+			continue
+		}
+		seen[k] = true
+		added++
+	}
+
+	return added
+}
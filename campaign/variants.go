@@ -0,0 +1,139 @@
+package campaign
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Variant is one version of the lure. Targets are split between the
+// variants by their weights, so that the lures can be compared.
+type Variant struct {
+	Name string `yaml:"name"`
+	// Template, TextTemplate and Subject replace attack.template,
+	// attack.textTemplate and mail.subject if they are set
+	Template     string `yaml:"template"`
+	TextTemplate string `yaml:"textTemplate"`
+	Subject      string `yaml:"subject"`
+	// Weight is the share of targets getting the variant, 1 by default
+	Weight int `yaml:"weight"`
+}
+
+func (v Variant) weight() int {
+	if v.Weight == 0 {
+		return 1
+	}
+	return v.Weight
+}
+
+// VariantResult sums up the results of single variant in the report
+type VariantResult struct {
+	Name     string
+	Template string
+	Subject  string
+	Targets  int
+	Sent     int
+	Clicks   int
+}
+
+func validateVariants(variants []Variant) error {
+	seen := make(map[string]bool)
+	for i, v := range variants {
+		if v.Name == "" {
+			return fmt.Errorf("variant %d has no name", i+1)
+		}
+		if seen[v.Name] {
+			return fmt.Errorf("variant %s is defined twice", v.Name)
+		}
+		seen[v.Name] = true
+		if v.Weight < 0 {
+			return fmt.Errorf("weight of variant %s cannot be negative", v.Name)
+		}
+	}
+	return nil
+}
+
+// assignVariants returns index of the variant for each of n targets. Smooth
+// weighted round robin interleaves the variants over the targets file, so
+// that the order of targets does not favour any of them.
+func assignVariants(variants []Variant, n int) []int {
+	assigned := make([]int, n)
+	if len(variants) == 0 {
+		return assigned
+	}
+
+	total := 0
+	for _, v := range variants {
+		total += v.weight()
+	}
+
+	current := make([]int, len(variants))
+	for i := range assigned {
+		best := 0
+		for j, v := range variants {
+			current[j] += v.weight()
+			if current[j] > current[best] {
+				best = j
+			}
+		}
+		current[best] -= total
+		assigned[i] = best
+	}
+	return assigned
+}
+
+// variantOptions returns copy of opts rendering the variant
+func variantOptions(opts *Options, v Variant) *Options {
+	o := *opts
+	if v.Template != "" {
+		o.Attack.Template = v.Template
+		o.Attack.Body = ""
+	}
+	if v.TextTemplate != "" {
+		o.Attack.TextTemplate = v.TextTemplate
+		o.Attack.TextBody = ""
+	}
+	if v.Subject != "" {
+		o.Mail.Subject = v.Subject
+	}
+	return &o
+}
+
+// variantResults counts the targets, sent mails and clicks of every variant
+func variantResults(variants []Variant, opts *Options, targets []SendingMail, clicks []ClickEvent) []VariantResult {
+	if len(variants) == 0 {
+		return nil
+	}
+
+	results := make([]VariantResult, len(variants))
+	index := make(map[string]int)
+	for i, v := range variants {
+		vo := variantOptions(opts, v)
+		results[i] = VariantResult{
+			Name:     v.Name,
+			Template: vo.Attack.Template,
+			Subject:  vo.Mail.Subject,
+		}
+		index[v.Name] = i
+	}
+
+	variantOf := make(map[string]string)
+	for _, t := range targets {
+		i, ok := index[t.Variant]
+		if !ok {
+			continue
+		}
+		variantOf[strings.ToLower(t.Email)] = t.Variant
+		results[i].Targets++
+		if t.Status == MailSent {
+			results[i].Sent++
+		}
+	}
+
+	for _, c := range clicks {
+		if v, ok := variantOf[strings.ToLower(c.Email)]; ok {
+			results[index[v]].Clicks++
+		}
+	}
+
+	return results
+}
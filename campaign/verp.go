@@ -0,0 +1,37 @@
+package campaign
+
+import (
+	"fmt"
+	"strings"
+)
+
+// verpPrefix is the local part of VERP addresses before the target id
+const verpPrefix = "bounce+"
+
+// verpAddress returns envelope sender unique for the target, e.g.
+// bounce+<id>@domain, so that bounces can be matched with the target
+func verpAddress(domain, id string) string {
+	return verpPrefix + id + "@" + domain
+}
+
+// ParseVERP returns id of the target from VERP address the bounce was sent
+// to, e.g. from To header of non delivery report
+func ParseVERP(address string) (string, error) {
+	address = strings.Trim(strings.TrimSpace(address), "<>")
+	at := strings.LastIndex(address, "@")
+	if at < 0 {
+		return "", fmt.Errorf("ParseVERP: %q is not an address", address)
+	}
+
+	local := address[:at]
+	if !strings.HasPrefix(strings.ToLower(local), verpPrefix) {
+		return "", fmt.Errorf("ParseVERP: %q is not VERP address", address)
+	}
+
+	id := local[len(verpPrefix):]
+	if id == "" {
+		return "", fmt.Errorf("ParseVERP: %q does not contain target id", address)
+	}
+
+	return id, nil
+}
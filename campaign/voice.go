@@ -0,0 +1,222 @@
+package campaign
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/lateralusd/lateralus/logging"
+)
+
+// CallSID identifies the call placed by VoiceProvider
+type CallSID string
+
+// VoiceProvider places automated voice calls which follow the instructions
+// from twimlURL
+type VoiceProvider interface {
+	Call(to, fromNumber string, twimlURL string) (CallSID, error)
+	// Status returns current status of the call, e.g. queued, in-progress
+	// or completed
+	Status(sid CallSID) (string, error)
+}
+
+const (
+	// callPollInterval is how often the status of unfinished calls is checked
+	callPollInterval = 10 * time.Second
+	// callWaitTimeout is how long to wait for the calls to finish
+	callWaitTimeout = 15 * time.Minute
+)
+
+// TwilioVoiceProvider places calls with Twilio Programmable Voice API
+type TwilioVoiceProvider struct {
+	AccountSID string
+	// Username is API key SID, AccountSID is used if empty
+	Username  string
+	AuthToken string
+	// Endpoint replaces the default Twilio API url
+	Endpoint string
+	Client   *http.Client
+}
+
+type twilioCall struct {
+	SID    string `json:"sid"`
+	Status string `json:"status"`
+}
+
+// Call calls to from fromNumber, Twilio fetches TwiML from twimlURL once
+// the call is answered
+func (t *TwilioVoiceProvider) Call(to, fromNumber string, twimlURL string) (CallSID, error) {
+	form := url.Values{}
+	form.Set("To", to)
+	form.Set("From", fromNumber)
+	form.Set("Url", twimlURL)
+
+	req, err := t.newRequest(http.MethodPost, "/Calls.json", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("TwilioVoiceProvider.Call: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var call twilioCall
+	if err := doProviderRequest(t.Client, req, &call); err != nil {
+		return "", fmt.Errorf("TwilioVoiceProvider.Call: %v", err)
+	}
+
+	return CallSID(call.SID), nil
+}
+
+// Status returns the status of the call
+func (t *TwilioVoiceProvider) Status(sid CallSID) (string, error) {
+	req, err := t.newRequest(http.MethodGet, fmt.Sprintf("/Calls/%s.json", sid), nil)
+	if err != nil {
+		return "", fmt.Errorf("TwilioVoiceProvider.Status: %v", err)
+	}
+
+	var call twilioCall
+	if err := doProviderRequest(t.Client, req, &call); err != nil {
+		return "", fmt.Errorf("TwilioVoiceProvider.Status: %v", err)
+	}
+
+	return call.Status, nil
+}
+
+func (t *TwilioVoiceProvider) newRequest(method, path string, body io.Reader) (*http.Request, error) {
+	endpoint := t.Endpoint
+	if endpoint == "" {
+		endpoint = twilioEndpoint
+	}
+
+	req, err := http.NewRequest(method, fmt.Sprintf("%s/Accounts/%s%s", endpoint, t.AccountSID, path), body)
+	if err != nil {
+		return nil, err
+	}
+
+	username := t.Username
+	if username == "" {
+		username = t.AccountSID
+	}
+	req.SetBasicAuth(username, t.AuthToken)
+
+	return req, nil
+}
+
+// callFinished reports whether Twilio call status is final
+func callFinished(status string) bool {
+	switch status {
+	case "completed", "busy", "failed", "no-answer", "canceled":
+		return true
+	}
+	return false
+}
+
+// validateVoice checks the voice config when calls are enabled
+func validateVoice(v Voice) error {
+	if !v.Enabled {
+		return nil
+	}
+
+	if v.Account == "" || v.Password == "" {
+		return fmt.Errorf("account and password are required for calls")
+	}
+
+	if !e164.MatchString(v.From) {
+		return fmt.Errorf("from number %q is not in E.164 format, e.g. +15551234567", v.From)
+	}
+
+	u, err := url.Parse(v.TwiMLURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("twimlUrl %q is not http or https url", v.TwiMLURL)
+	}
+
+	return nil
+}
+
+// sendCalls calls every target with phone number and waits until the calls
+// finish, recording their final status
+func sendCalls(ctx context.Context, mails []SendingMail, opts *Options) error {
+	provider := &TwilioVoiceProvider{
+		AccountSID: opts.Voice.Account,
+		Username:   opts.Voice.Username,
+		AuthToken:  opts.Voice.Password,
+		Endpoint:   opts.Voice.Endpoint,
+	}
+
+	limiter := opts.General.limiter()
+	sendWindow := opts.General.window()
+	pause := opts.General.pacer()
+
+	for i := range mails {
+		m := &mails[i]
+		if m.Phone == "" || !e164.MatchString(m.Phone) {
+			logging.Warningf("Target %s has no phone number in E.164 format, skipping call", m.Email)
+			continue
+		}
+
+		if err := sendWindow.wait(ctx); err != nil {
+			return fmt.Errorf("sendCalls: %v", err)
+		}
+
+		if err := limiter.Wait(ctx); err != nil {
+			return fmt.Errorf("sendCalls: %v", err)
+		}
+
+		sid, err := provider.Call(m.Phone, opts.Voice.From, opts.Voice.TwiMLURL)
+		if err != nil {
+			return fmt.Errorf("sendCalls: %s: %v", m.Phone, err)
+		}
+		m.CallSID = sid
+		m.CallStatus = "queued"
+
+		if err := sleep(ctx, pause()); err != nil {
+			return fmt.Errorf("sendCalls: %v", err)
+		}
+	}
+
+	if err := waitForCalls(ctx, mails, provider, callPollInterval, callWaitTimeout); err != nil {
+		return fmt.Errorf("sendCalls: %v", err)
+	}
+
+	return nil
+}
+
+// waitForCalls polls status of the placed calls until all of them are
+// finished or timeout passes, calls which did not finish keep their last status
+func waitForCalls(ctx context.Context, mails []SendingMail, provider VoiceProvider, interval, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		pending := 0
+		for i := range mails {
+			m := &mails[i]
+			if m.CallSID == "" || callFinished(m.CallStatus) {
+				continue
+			}
+			status, err := provider.Status(m.CallSID)
+			if err != nil {
+				logging.Errorf("Error checking call to %s: %v", m.Phone, err)
+			} else {
+				m.CallStatus = status
+			}
+			if !callFinished(m.CallStatus) {
+				pending++
+			}
+		}
+
+		if pending == 0 {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			logging.Warningf("%d calls did not finish in %s", pending, timeout)
+			return nil
+		}
+
+		logging.Infof("Waiting for %d calls to finish", pending)
+		if err := sleep(ctx, interval); err != nil {
+			return err
+		}
+	}
+}
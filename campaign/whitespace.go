@@ -0,0 +1,29 @@
+package campaign
+
+import (
+	"strings"
+)
+
+// normalizeWhitespace collapses runs of spaces and tabs into single space
+// and trims every line. Lines inside of <pre> and <textarea> elements of
+// HTML bodies are kept as they are.
+func normalizeWhitespace(body string, html bool) string {
+	lines := strings.Split(body, "\n")
+	preformatted := false
+	for i, line := range lines {
+		lower := strings.ToLower(line)
+		opens := html && (strings.Contains(lower, "<pre") || strings.Contains(lower, "<textarea"))
+		closes := html && (strings.Contains(lower, "</pre>") || strings.Contains(lower, "</textarea>"))
+
+		if !preformatted && !opens {
+			lines[i] = strings.Join(strings.Fields(strings.TrimSuffix(line, "\r")), " ")
+		}
+
+		if opens && !closes {
+			preformatted = true
+		} else if closes && !opens {
+			preformatted = false
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,233 @@
+package campaign
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// xlsxWorkbook is xl/workbook.xml, listing the sheets
+type xlsxWorkbook struct {
+	Sheets []struct {
+		Name string `xml:"name,attr"`
+		RID  string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+	} `xml:"sheets>sheet"`
+}
+
+// xlsxRels is xl/_rels/workbook.xml.rels, mapping the sheets to files
+type xlsxRels struct {
+	Relationships []struct {
+		ID     string `xml:"Id,attr"`
+		Target string `xml:"Target,attr"`
+	} `xml:"Relationship"`
+}
+
+// xlsxText is string item of shared strings or inline string, rich text is
+// split into runs
+type xlsxText struct {
+	T    string `xml:"t"`
+	Runs []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxText) String() string {
+	if len(t.Runs) == 0 {
+		return t.T
+	}
+	var b strings.Builder
+	for _, r := range t.Runs {
+		b.WriteString(r.T)
+	}
+	return b.String()
+}
+
+type xlsxSharedStrings struct {
+	Items []xlsxText `xml:"si"`
+}
+
+type xlsxSheet struct {
+	Rows []struct {
+		R     int `xml:"r,attr"`
+		Cells []struct {
+			R      string   `xml:"r,attr"`
+			T      string   `xml:"t,attr"`
+			V      string   `xml:"v"`
+			Inline xlsxText `xml:"is"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+// isXLSX reports whether the targets file is Excel workbook
+func isXLSX(filename string) bool {
+	return strings.EqualFold(filepath.Ext(filename), ".xlsx")
+}
+
+// readXLSX returns rows of the sheet, the first one if sheet is empty.
+// Cells hold the values as stored, e.g. dates are serial numbers and
+// formulas their last computed value.
+func readXLSX(filename, sheet string) ([]targetRow, error) {
+	zr, err := zip.OpenReader(filename)
+	if err != nil {
+		return nil, fmt.Errorf("readXLSX: %v", err)
+	}
+	defer zr.Close()
+
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	var wb xlsxWorkbook
+	if err := decodeXLSXPart(files, "xl/workbook.xml", &wb); err != nil {
+		return nil, fmt.Errorf("readXLSX: %v", err)
+	}
+	var rels xlsxRels
+	if err := decodeXLSXPart(files, "xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return nil, fmt.Errorf("readXLSX: %v", err)
+	}
+	if len(wb.Sheets) == 0 {
+		return nil, fmt.Errorf("readXLSX: %s has no sheets", filename)
+	}
+
+	rid := wb.Sheets[0].RID
+	if sheet != "" {
+		rid = ""
+		var names []string
+		for _, s := range wb.Sheets {
+			names = append(names, s.Name)
+			if strings.EqualFold(s.Name, sheet) {
+				rid = s.RID
+			}
+		}
+		if rid == "" {
+			return nil, fmt.Errorf("readXLSX: sheet %q not found, %s has %s", sheet, filename, strings.Join(names, ", "))
+		}
+	}
+
+	var sheetPath string
+	for _, r := range rels.Relationships {
+		if r.ID == rid {
+			sheetPath = r.Target
+		}
+	}
+	if strings.HasPrefix(sheetPath, "/") {
+		sheetPath = strings.TrimPrefix(sheetPath, "/")
+	} else {
+		sheetPath = path.Join("xl", sheetPath)
+	}
+
+	var shared xlsxSharedStrings
+	if _, ok := files["xl/sharedStrings.xml"]; ok {
+		if err := decodeXLSXPart(files, "xl/sharedStrings.xml", &shared); err != nil {
+			return nil, fmt.Errorf("readXLSX: %v", err)
+		}
+	}
+
+	var ws xlsxSheet
+	if err := decodeXLSXPart(files, sheetPath, &ws); err != nil {
+		return nil, fmt.Errorf("readXLSX: %v", err)
+	}
+
+	var rows []targetRow
+	width := 0
+	for i, r := range ws.Rows {
+		row := targetRow{num: r.R}
+		if row.num == 0 {
+			row.num = i + 1
+		}
+		for j, c := range r.Cells {
+			col := j
+			if c.R != "" {
+				if col, err = xlsxColumn(c.R); err != nil {
+					return nil, fmt.Errorf("readXLSX: %v", err)
+				}
+			}
+			for len(row.cells) <= col {
+				row.cells = append(row.cells, "")
+			}
+
+			value := c.V
+			switch c.T {
+			case "s":
+				n, err := strconv.Atoi(c.V)
+				if err != nil || n < 0 || n >= len(shared.Items) {
+					return nil, fmt.Errorf("readXLSX: cell %s refers to unknown shared string %q", c.R, c.V)
+				}
+				value = shared.Items[n].String()
+			case "inlineStr":
+				value = c.Inline.String()
+			case "b":
+				value = map[string]string{"0": "FALSE", "1": "TRUE"}[c.V]
+			case "", "n":
+				value = xlsxNumber(c.V)
+			}
+			row.cells[col] = value
+		}
+		if strings.TrimSpace(strings.Join(row.cells, "")) == "" {
+			continue
+		}
+		rows = append(rows, row)
+		if len(row.cells) > width {
+			width = len(row.cells)
+		}
+	}
+
+	// empty cells at the end of row are not stored
+	for i := range rows {
+		for len(rows[i].cells) < width {
+			rows[i].cells = append(rows[i].cells, "")
+		}
+	}
+	return rows, nil
+}
+
+func decodeXLSXPart(files map[string]*zip.File, name string, v interface{}) error {
+	f, ok := files[name]
+	if !ok {
+		return fmt.Errorf("%s is missing, is it xlsx workbook?", name)
+	}
+	r, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	if err := xml.NewDecoder(r).Decode(v); err != nil && err != io.EOF {
+		return fmt.Errorf("parsing %s: %v", name, err)
+	}
+	return nil
+}
+
+// xlsxColumn returns zero based column of cell reference, e.g. 2 of C7
+func xlsxColumn(ref string) (int, error) {
+	col := 0
+	for i, r := range ref {
+		if r >= 'A' && r <= 'Z' {
+			col = col*26 + int(r-'A') + 1
+			continue
+		}
+		if i == 0 {
+			break
+		}
+		return col - 1, nil
+	}
+	return 0, fmt.Errorf("invalid cell reference %q", ref)
+}
+
+// xlsxNumber formats number without exponent, phone numbers typed into
+// Excel are stored e.g. as 1.5551234567E10
+func xlsxNumber(v string) string {
+	if !strings.ContainsAny(v, "eE") {
+		return v
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return v
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,246 @@
+package campaign
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const (
+	xlsxWorkbookXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="Staff" sheetId="1" r:id="rId1"/><sheet name="Contractors" sheetId="2" r:id="rId2"/></sheets>
+</workbook>`
+	xlsxRelsXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="/xl/worksheets/sheet2.xml"/>
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+</Relationships>`
+	xlsxSharedStringsXML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" count="5" uniqueCount="5">
+<si><t>Name</t></si>
+<si><t>Email</t></si>
+<si><t>Department</t></si>
+<si><r><rPr><b/></rPr><t>John</t></r><r><t xml:space="preserve"> Doe</t></r></si>
+<si><t>john@example.com</t></si>
+</sst>`
+	// xlsxSheet1XML has shared strings, inline string, numbers, booleans
+	// and gaps between the cells and rows, row 3 refers to missing shared
+	// string
+	xlsxSheet1XML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>
+<row r="1"><c r="A1" t="s"><v>0</v></c><c r="B1" t="s"><v>1</v></c><c r="C1" t="inlineStr"><is><t>Active</t></is></c><c r="D1" t="s"><v>2</v></c><c r="E1" t="inlineStr"><is><t>Phone</t></is></c></row>
+<row r="2"><c r="A2" t="s"><v>3</v></c><c r="B2" t="s"><v>4</v></c><c r="E2"><v>1.5551234567E10</v></c></row>
+<row r="3"><c r="A3" t="s"><v>99</v></c></row>
+<row r="4"><c r="A4"/><c r="B4" t="str"><v></v></c></row>
+<row r="6"><c r="A6" t="inlineStr"><is><r><t>Jane</t></r><r><t xml:space="preserve"> Roe</t></r></is></c><c r="B6" t="inlineStr"><is><t>jane@example.com</t></is></c><c r="C6" t="b"><v>1</v></c><c r="D6" t="str"><v>Finance</v></c></row>
+</sheetData></worksheet>`
+	xlsxSheet2XML = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>
+<row><c t="inlineStr"><is><t>Bob</t></is></c><c t="inlineStr"><is><t>bob@contractor.example.com</t></is></c></row>
+<row><c t="inlineStr"><is><t>Eve</t></is></c><c t="inlineStr"><is><t>eve@contractor.example.com</t></is></c><c><v>42</v></c></row>
+</sheetData></worksheet>`
+)
+
+// writeXLSX creates workbook from its parts
+func writeXLSX(t *testing.T, parts map[string]string) string {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), "targets.xlsx")
+	f, err := os.Create(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	zw := zip.NewWriter(f)
+	for name, content := range parts {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func testWorkbook() map[string]string {
+	return map[string]string{
+		"xl/workbook.xml":            xlsxWorkbookXML,
+		"xl/_rels/workbook.xml.rels": xlsxRelsXML,
+		"xl/sharedStrings.xml":       xlsxSharedStringsXML,
+		"xl/worksheets/sheet1.xml":   strings.Replace(xlsxSheet1XML, `<row r="3"><c r="A3" t="s"><v>99</v></c></row>`, "", 1),
+		"xl/worksheets/sheet2.xml":   xlsxSheet2XML,
+	}
+}
+
+func TestReadXLSX(t *testing.T) {
+	tests := []struct {
+		name  string
+		sheet string
+		want  []targetRow
+	}{
+		{
+			name: "first sheet",
+			want: []targetRow{
+				{num: 1, cells: []string{"Name", "Email", "Active", "Department", "Phone"}},
+				{num: 2, cells: []string{"John Doe", "john@example.com", "", "", "15551234567"}},
+				{num: 6, cells: []string{"Jane Roe", "jane@example.com", "TRUE", "Finance", ""}},
+			},
+		},
+		{
+			name:  "sheet by name",
+			sheet: "contractors",
+			want: []targetRow{
+				{num: 1, cells: []string{"Bob", "bob@contractor.example.com", ""}},
+				{num: 2, cells: []string{"Eve", "eve@contractor.example.com", "42"}},
+			},
+		},
+	}
+
+	filename := writeXLSX(t, testWorkbook())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := readXLSX(filename, tt.sheet)
+			if err != nil {
+				t.Fatalf("readXLSX() error = %v", err)
+			}
+			if !reflect.DeepEqual(rows, tt.want) {
+				t.Errorf("readXLSX() = %q, want %q", rows, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadXLSXErrors(t *testing.T) {
+	withPart := func(name, content string) map[string]string {
+		parts := testWorkbook()
+		if content == "" {
+			delete(parts, name)
+		} else {
+			parts[name] = content
+		}
+		return parts
+	}
+
+	tests := []struct {
+		name    string
+		parts   map[string]string
+		sheet   string
+		wantErr string
+	}{
+		{
+			name:    "unknown sheet",
+			parts:   testWorkbook(),
+			sheet:   "Interns",
+			wantErr: `sheet "Interns" not found`,
+		},
+		{
+			name:    "unknown shared string",
+			parts:   withPart("xl/worksheets/sheet1.xml", xlsxSheet1XML),
+			wantErr: `cell A3 refers to unknown shared string "99"`,
+		},
+		{
+			name:    "invalid cell reference",
+			parts:   withPart("xl/worksheets/sheet1.xml", strings.Replace(xlsxSheet1XML, `r="A2"`, `r="2A"`, 1)),
+			wantErr: `invalid cell reference "2A"`,
+		},
+		{
+			name:    "missing workbook",
+			parts:   withPart("xl/workbook.xml", ""),
+			wantErr: "xl/workbook.xml is missing",
+		},
+		{
+			name:    "missing sheet part",
+			parts:   withPart("xl/worksheets/sheet1.xml", ""),
+			wantErr: "xl/worksheets/sheet1.xml is missing",
+		},
+		{
+			name:    "broken xml",
+			parts:   withPart("xl/worksheets/sheet1.xml", "<worksheet><sheetData><row>"),
+			wantErr: "parsing xl/worksheets/sheet1.xml",
+		},
+		{
+			name:    "no sheets",
+			parts:   withPart("xl/workbook.xml", "<workbook><sheets/></workbook>"),
+			wantErr: "has no sheets",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := readXLSX(writeXLSX(t, tt.parts), tt.sheet)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("readXLSX() error = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err := readXLSX(writeConfig(t, "targets.xlsx", "Name,Email\n"), ""); err == nil {
+		t.Errorf("readXLSX() of csv error = nil, want error")
+	}
+}
+
+func TestLoadTargetsXLSX(t *testing.T) {
+	opts := NewOptions(WithTargetsFile(writeXLSX(t, testWorkbook())))
+	targets, err := loadTargets(opts)
+	if err != nil {
+		t.Fatalf("loadTargets() error = %v", err)
+	}
+
+	if len(targets) != 2 {
+		t.Fatalf("got %d targets, want 2", len(targets))
+	}
+	john, jane := targets[0], targets[1]
+	if john.Name != "John Doe" || john.Email != "john@example.com" || john.Phone != "15551234567" {
+		t.Errorf("first target = %+v", john)
+	}
+	if jane.Name != "Jane Roe" || jane.Fields["Department"] != "Finance" || jane.row != 6 {
+		t.Errorf("second target = %+v", jane)
+	}
+}
+
+func TestXLSXColumn(t *testing.T) {
+	tests := map[string]int{
+		"A1":      0,
+		"C7":      2,
+		"Z10":     25,
+		"AA1":     26,
+		"AZ3":     51,
+		"BA3":     52,
+		"XFD1048": 16383,
+	}
+	for ref, want := range tests {
+		if got, err := xlsxColumn(ref); err != nil || got != want {
+			t.Errorf("xlsxColumn(%q) = %d, %v, want %d", ref, got, err, want)
+		}
+	}
+
+	for _, ref := range []string{"", "A", "1A", "a1"} {
+		if _, err := xlsxColumn(ref); err == nil {
+			t.Errorf("xlsxColumn(%q) error = nil, want error", ref)
+		}
+	}
+}
+
+func TestXLSXNumber(t *testing.T) {
+	tests := map[string]string{
+		"42":              "42",
+		"3.14":            "3.14",
+		"1.5551234567E10": "15551234567",
+		"4.4e-2":          "0.044",
+		"E":               "E",
+	}
+	for v, want := range tests {
+		if got := xlsxNumber(v); got != want {
+			t.Errorf("xlsxNumber(%q) = %q, want %q", v, got, want)
+		}
+	}
+}
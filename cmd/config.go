@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+
+	"github.com/lateralusd/lateralus/campaign"
+	"github.com/lateralusd/lateralus/logging"
+	"github.com/spf13/cobra"
+)
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "work with config files",
+}
+
+var configFormatCmd = &cobra.Command{
+	Use:   "format",
+	Short: "reformat the config in place with consistent indentation",
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := cmd.Flags().GetString("config")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		if config == "" {
+			logging.Fatalf("You need to provide config filename")
+		}
+
+		if campaign.IsTOML(config) {
+			logging.Fatalf("Only yaml config can be formatted")
+		}
+
+		d, err := ioutil.ReadFile(config)
+		if err != nil {
+			logging.Fatalf("Error reading config: %v", err)
+		}
+
+		formatted, err := campaign.FormatConfig(d)
+		if err != nil {
+			logging.Fatalf("Error formatting config: %v", err)
+		}
+
+		if bytes.Equal(d, formatted) {
+			logging.Infof("\"%s\" is already formatted", config)
+			return
+		}
+
+		info, err := os.Stat(config)
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		if err := ioutil.WriteFile(config, formatted, info.Mode()); err != nil {
+			logging.Fatalf("Error writing config: %v", err)
+		}
+
+		logging.Infof("Formatted \"%s\"", config)
+	},
+}
+
+var configCanaryCmd = &cobra.Command{
+	Use:   "canary",
+	Short: "add canarytokens.org URL to the config which alerts when it is opened",
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := cmd.Flags().GetString("config")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		if config == "" {
+			logging.Fatalf("You need to provide config filename")
+		}
+
+		if campaign.IsTOML(config) {
+			logging.Fatalf("Canary token can only be added to yaml config")
+		}
+
+		alert, err := cmd.Flags().GetString("alert")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		if alert == "" {
+			logging.Fatalf("You need to provide email address or webhook URL for the alerts")
+		}
+
+		tokenURL, err := campaign.GenerateCanaryToken(config, alert)
+		if err != nil {
+			logging.Fatalf("Error adding canary token: %v", err)
+		}
+
+		logging.Infof("Added canary token %s to \"%s\", alerts go to %s", tokenURL, config, alert)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(configCmd)
+	configCmd.AddCommand(configFormatCmd)
+	configCmd.AddCommand(configCanaryCmd)
+	configFormatCmd.Flags().StringP("config", "c", "", "config filename")
+	configCanaryCmd.Flags().StringP("config", "c", "", "config filename")
+	configCanaryCmd.Flags().String("alert", "", "email address or webhook URL which is alerted when the token is opened")
+}
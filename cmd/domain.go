@@ -0,0 +1,177 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/mail"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/lateralusd/lateralus/campaign"
+	"github.com/lateralusd/lateralus/logging"
+	"github.com/lateralusd/lateralus/util"
+	te "github.com/muesli/termenv"
+	"github.com/spf13/cobra"
+)
+
+var domainCmd = &cobra.Command{
+	Use:   "domain",
+	Short: "work with campaign domains",
+}
+
+var domainCheckCmd = &cobra.Command{
+	Use:   "check",
+	Short: "verify DNS, certificate, landing page, SPF and DMARC before sending",
+	Run: func(cmd *cobra.Command, args []string) {
+		domain, err := cmd.Flags().GetString("domain")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		if domain == "" {
+			logging.Fatalf("You need to provide domain")
+		}
+
+		expectedIP, err := cmd.Flags().GetString("expected-ip")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		if expectedIP != "" && net.ParseIP(expectedIP) == nil {
+			logging.Fatalf("Invalid expected IP \"%s\"", expectedIP)
+		}
+
+		path, err := cmd.Flags().GetString("path")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		mailDomain, err := cmd.Flags().GetString("mail-domain")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		sendingIPs, err := cmd.Flags().GetStringSlice("sending-ip")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		config, err := cmd.Flags().GetString("config")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		check := util.DomainCheck{
+			Domain:     domain,
+			ExpectedIP: expectedIP,
+			Path:       path,
+			MailDomain: mailDomain,
+		}
+
+		for _, s := range sendingIPs {
+			ip := net.ParseIP(s)
+			if ip == nil {
+				logging.Fatalf("Invalid sending IP \"%s\"", s)
+			}
+			check.SendingIPs = append(check.SendingIPs, ip)
+		}
+
+		if config != "" {
+			logging.Infof("Parsing config from \"%s\"", config)
+			opts, err := campaign.ParseConfig(config)
+			if err != nil {
+				logging.Fatalf("Error parsing configuration: %v", err)
+			}
+
+			if check.MailDomain == "" {
+				if addr, err := mail.ParseAddress(opts.From()); err == nil {
+					check.MailDomain = addr.Address[strings.LastIndex(addr.Address, "@")+1:]
+				}
+			}
+
+			if len(check.SendingIPs) == 0 {
+				host := opts.MailServers.Primary().Host
+				ips, err := net.LookupIP(host)
+				if err != nil {
+					logging.Fatalf("Error resolving mail server \"%s\": %v", host, err)
+				}
+				check.SendingIPs = ips
+			}
+		}
+
+		failed := 0
+		for _, r := range util.CheckDomain(check) {
+			printCheck(r)
+			if r.Status == util.CheckFailed {
+				failed++
+			}
+		}
+
+		if failed > 0 {
+			logging.Fatalf("%d checks failed", failed)
+		}
+	},
+}
+
+var domainMonitorCmd = &cobra.Command{
+	Use:   "monitor",
+	Short: "watch Certificate Transparency logs for new certificates of the domain",
+	Run: func(cmd *cobra.Command, args []string) {
+		domain, err := cmd.Flags().GetString("domain")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		if domain == "" {
+			logging.Fatalf("You need to provide domain")
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt)
+		go func() {
+			<-interrupt
+			cancel()
+		}()
+
+		logging.Infof("Watching crt.sh for new certificates of \"%s\" every %s", domain, util.CTPollInterval)
+		err = util.MonitorCTLogs(ctx, domain, func(e util.CTEntry) {
+			logging.Warningf("New certificate for %s issued by %s, logged at %s UTC", strings.Join(e.Names, ", "), e.Issuer, e.Logged.Format("2006-01-02 15:04:05"))
+		})
+		if err != nil {
+			logging.Fatalf("Error monitoring CT logs: %v", err)
+		}
+	},
+}
+
+// printCheck prints the result with green, yellow or red light
+func printCheck(r util.CheckResult) {
+	color := te.ColorProfile().Color
+	var light te.Style
+	switch r.Status {
+	case util.CheckOK:
+		light = te.String("● OK  ").Foreground(color("#00ff00"))
+	case util.CheckWarning:
+		light = te.String("● WARN").Foreground(color("#ffff00"))
+	default:
+		light = te.String("● FAIL").Foreground(color("#ff0000"))
+	}
+	fmt.Printf("%s %-18s %s\n", light.Bold(), r.Name, r.Detail)
+}
+
+func init() {
+	RootCmd.AddCommand(domainCmd)
+	domainCmd.AddCommand(domainCheckCmd)
+	domainCmd.AddCommand(domainMonitorCmd)
+	domainCheckCmd.Flags().StringP("domain", "d", "", "domain of the landing page")
+	domainCheckCmd.Flags().String("expected-ip", "", "IP address the domain should resolve to")
+	domainCheckCmd.Flags().String("path", "/", "path of the landing page")
+	domainCheckCmd.Flags().String("mail-domain", "", "domain of the sender address checked for SPF and DMARC, --domain by default")
+	domainCheckCmd.Flags().StringSlice("sending-ip", nil, "IP addresses of the mail server checked against SPF")
+	domainCheckCmd.Flags().StringP("config", "c", "", "config whose sender address and mail server are checked")
+	domainMonitorCmd.Flags().StringP("domain", "d", "", "domain or crt.sh pattern, e.g. %.example.com for all subdomains")
+}
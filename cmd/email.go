@@ -0,0 +1,232 @@
+package cmd
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lateralusd/lateralus/email"
+	"github.com/lateralusd/lateralus/logging"
+	"github.com/lateralusd/lateralus/util"
+	"github.com/spf13/cobra"
+)
+
+const sectionSeparator = "========================================"
+
+var emailCmd = &cobra.Command{
+	Use:   "email",
+	Short: "work with raw mails",
+}
+
+var emailParseCmd = &cobra.Command{
+	Use:   "parse",
+	Short: "print headers, MIME structure, body, attachments and URLs of EML file",
+	Run: func(cmd *cobra.Command, args []string) {
+		input, err := cmd.Flags().GetString("input")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		if input == "" {
+			logging.Fatalf("You need to provide EML filename")
+		}
+
+		extract, err := cmd.Flags().GetBool("extract-urls")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		lookup, err := cmd.Flags().GetBool("whois")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		if lookup && !extract {
+			logging.Fatalf("--whois can be used only with --extract-urls")
+		}
+
+		f, err := os.Open(input)
+		if err != nil {
+			logging.Fatalf("Error opening EML file: %v", err)
+		}
+		defer f.Close()
+
+		msg, err := email.ParseMessage(f)
+		if err != nil {
+			logging.Fatalf("Error parsing EML file: %v", err)
+		}
+
+		printHeaders(msg)
+		printStructure(msg)
+		printBody(msg)
+		printAttachments(msg)
+		urls := messageURLs(msg, extract)
+		fmt.Printf("\nURLs:\n%s\n", sectionSeparator)
+		for _, u := range urls {
+			fmt.Println(u)
+		}
+
+		if extract {
+			printDomains(urls, lookup)
+		}
+	},
+}
+
+func printHeaders(msg *email.Message) {
+	width := 0
+	for _, f := range msg.Fields {
+		if len(f.Name) > width {
+			width = len(f.Name)
+		}
+	}
+
+	fmt.Printf("Headers:\n%s\n", sectionSeparator)
+	for _, f := range msg.Fields {
+		fmt.Printf("%-*s | %s\n", width, f.Name, f.Value)
+	}
+}
+
+func printStructure(msg *email.Message) {
+	fmt.Printf("\nMIME structure:\n%s\n", sectionSeparator)
+	msg.Root.Walk(func(p *email.Part, depth int) {
+		line := strings.Repeat("  ", depth) + p.ContentType
+		if charset := p.Params["charset"]; charset != "" {
+			line += "; charset=" + charset
+		}
+		if p.Parts == nil {
+			line += fmt.Sprintf(" (%d bytes)", len(p.Body))
+		}
+		if p.Filename != "" {
+			line += fmt.Sprintf(" %q", p.Filename)
+		}
+		fmt.Println(line)
+	})
+}
+
+// printBody prints HTML body, or the text one if there is no HTML part
+func printBody(msg *email.Message) {
+	part := msg.Body("text/html")
+	title := "HTML body"
+	if part == nil {
+		part = msg.Body("text/plain")
+		title = "Text body"
+	}
+
+	if part == nil {
+		fmt.Printf("\nBody:\n%s\nno text/html or text/plain part found\n", sectionSeparator)
+		return
+	}
+
+	body, err := part.Text()
+	if err != nil {
+		logging.Warningf("Printing body as is: %v", err)
+		body = string(part.Body)
+	}
+
+	fmt.Printf("\n%s:\n%s\n%s\n", title, sectionSeparator, strings.TrimRight(body, "\r\n"))
+}
+
+func printAttachments(msg *email.Message) {
+	fmt.Printf("\nAttachments:\n%s\n", sectionSeparator)
+	for _, a := range msg.Attachments() {
+		name := a.Filename
+		if name == "" {
+			name = "(unnamed)"
+		}
+		fmt.Printf("%s | %s | %d bytes\n", name, a.ContentType, len(a.Body))
+	}
+}
+
+// messageURLs returns URLs from all text parts which are not attachments,
+// together with targets of HTML links if links is set
+func messageURLs(msg *email.Message, links bool) []string {
+	var urls []string
+	seen := make(map[string]bool)
+	add := func(list []string) {
+		for _, u := range list {
+			if !seen[u] {
+				seen[u] = true
+				urls = append(urls, u)
+			}
+		}
+	}
+
+	msg.Root.Walk(func(p *email.Part, depth int) {
+		if !strings.HasPrefix(p.ContentType, "text/") || p.IsAttachment() {
+			return
+		}
+		text, err := p.Text()
+		if err != nil {
+			text = string(p.Body)
+		}
+		if links && p.ContentType == "text/html" {
+			add(email.ExtractLinks(text))
+		}
+		add(email.ExtractURLs(text))
+	})
+
+	return urls
+}
+
+// newDomainAge is the age under which the domain is flagged as suspicious
+const newDomainAge = 30 * 24 * time.Hour
+
+// printDomains prints registered domains of urls, with their WHOIS data
+// if lookup is set
+func printDomains(urls []string, lookup bool) {
+	var domains []string
+	count := make(map[string]int)
+	for _, u := range urls {
+		parsed, err := url.Parse(u)
+		if err != nil || parsed.Hostname() == "" {
+			continue
+		}
+		domain, err := util.RegisteredDomain(parsed.Hostname())
+		if err != nil {
+			domain = parsed.Hostname()
+		}
+		if count[domain] == 0 {
+			domains = append(domains, domain)
+		}
+		count[domain]++
+	}
+
+	fmt.Printf("\nDomains:\n%s\n", sectionSeparator)
+	if !lookup {
+		fmt.Println("Table in format DOMAIN, URLS")
+		for _, d := range domains {
+			fmt.Printf("%-30s | %d\n", d, count[d])
+		}
+		return
+	}
+
+	fmt.Println("Table in format DOMAIN, URLS, REGISTRAR, CREATED, AGE")
+	for _, d := range domains {
+		info, err := util.LookupDomain(d)
+		if err != nil {
+			fmt.Printf("%-30s | %d | WHOIS lookup failed: %v\n", d, count[d], err)
+			continue
+		}
+
+		created, age := "unknown", "unknown"
+		if !info.Created.IsZero() {
+			created = info.Created.Format("2006-01-02")
+			days := time.Since(info.Created)
+			age = fmt.Sprintf("%d days", int(days.Hours()/24))
+			if days < newDomainAge {
+				age += " SUSPICIOUS: newly registered"
+			}
+		}
+		fmt.Printf("%-30s | %d | %s | %s | %s\n", d, count[d], info.Registrar, created, age)
+	}
+}
+
+func init() {
+	RootCmd.AddCommand(emailCmd)
+	emailCmd.AddCommand(emailParseCmd)
+	emailParseCmd.Flags().StringP("input", "i", "", "EML filename")
+	emailParseCmd.Flags().Bool("extract-urls", false, "include targets of HTML links in URLs and list their domains")
+	emailParseCmd.Flags().Bool("whois", false, "look up registrar and age of the domains, newly registered ones are flagged")
+}
@@ -17,6 +17,9 @@ mail:
   from: Not Attacker
   subject: Not phishing mail
   custom: ""
+  priority: normal
+  charset: utf-8
+  transferEncoding: quoted-printable
   
 attack:
   targets: targets.csv
@@ -28,6 +31,7 @@ mailServer:
   username: "testusername@gmail.com"
   password: ""
   encryption: tls
+  maxBackoff: 5m
 
 general:
   bulk: False
@@ -35,6 +39,7 @@ general:
   bulkDelay: 60
   bulkSize: 3
   delay: 5
+  rate: 0
   separator: ";"
 `
 
@@ -0,0 +1,202 @@
+package cmd
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/lateralusd/lateralus/campaign"
+	"github.com/lateralusd/lateralus/logging"
+	"github.com/lateralusd/lateralus/tracking"
+	"github.com/spf13/cobra"
+)
+
+var gophishCmd = &cobra.Command{
+	Use:   "gophish",
+	Short: "import GoPhish groups and templates, export results for GoPhish",
+}
+
+var gophishGroupsCmd = &cobra.Command{
+	Use:   "groups",
+	Short: "convert GoPhish groups into targets file",
+	Run: func(cmd *cobra.Command, args []string) {
+		input, err := cmd.Flags().GetString("input")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		output, err := cmd.Flags().GetString("output")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		separator, err := cmd.Flags().GetString("separator")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		if input == "" || output == "" {
+			logging.Fatalf("You need to provide groups json and targets filename")
+		}
+
+		groups, err := campaign.ReadGophishGroups(input)
+		if err != nil {
+			logging.Fatalf("Error reading groups: %v", err)
+		}
+
+		var buf bytes.Buffer
+		n, err := campaign.WriteGophishTargets(&buf, groups, separator)
+		if err != nil {
+			logging.Fatalf("Error converting groups: %v", err)
+		}
+
+		if err := ioutil.WriteFile(output, buf.Bytes(), 0600); err != nil {
+			logging.Fatalf("Error writing targets: %v", err)
+		}
+
+		logging.Infof("Saved %d targets of %d groups in \"%s\"", n, len(groups), output)
+	},
+}
+
+var gophishTemplateCmd = &cobra.Command{
+	Use:   "template",
+	Short: "convert GoPhish template into lateralus template",
+	Run: func(cmd *cobra.Command, args []string) {
+		input, err := cmd.Flags().GetString("input")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		output, err := cmd.Flags().GetString("output")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		name, err := cmd.Flags().GetString("name")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		if input == "" || output == "" {
+			logging.Fatalf("You need to provide templates json and template filename")
+		}
+
+		templates, err := campaign.ReadGophishTemplates(input)
+		if err != nil {
+			logging.Fatalf("Error reading templates: %v", err)
+		}
+
+		var tpl *campaign.GophishTemplate
+		var names []string
+		for i := range templates {
+			names = append(names, templates[i].Name)
+			if templates[i].Name == name || (name == "" && len(templates) == 1) {
+				tpl = &templates[i]
+			}
+		}
+		if tpl == nil {
+			logging.Fatalf("You need to choose template with --name: %s", strings.Join(names, ", "))
+		}
+
+		body := tpl.HTML
+		if body == "" {
+			body = tpl.Text
+		}
+		body, unknown := campaign.ConvertGophishTemplate(body)
+		if err := ioutil.WriteFile(output, []byte(body), 0600); err != nil {
+			logging.Fatalf("Error writing template: %v", err)
+		}
+		logging.Infof("Saved template \"%s\" in \"%s\", its subject is \"%s\"", tpl.Name, output, tpl.Subject)
+
+		if tpl.HTML != "" && tpl.Text != "" {
+			text, _ := campaign.ConvertGophishTemplate(tpl.Text)
+			textOutput := strings.TrimSuffix(output, filepath.Ext(output)) + ".txt"
+			if err := ioutil.WriteFile(textOutput, []byte(text), 0600); err != nil {
+				logging.Fatalf("Error writing template: %v", err)
+			}
+			logging.Infof("Saved plain text alternative in \"%s\", use it as attack.textTemplate", textOutput)
+		}
+
+		for _, a := range tpl.Attachments {
+			d, err := a.Data()
+			if err != nil {
+				logging.Fatalf("Error decoding attachment %s: %v", a.Name, err)
+			}
+			path := filepath.Join(filepath.Dir(output), filepath.Base(a.Name))
+			if err := ioutil.WriteFile(path, d, 0600); err != nil {
+				logging.Fatalf("Error writing attachment: %v", err)
+			}
+			logging.Infof("Saved attachment in \"%s\", add it to attack.attachments", path)
+		}
+
+		if len(unknown) > 0 {
+			logging.Warningf("Template uses fields lateralus does not have, replace them: %s", strings.Join(unknown, ", "))
+		}
+	},
+}
+
+var gophishResultsCmd = &cobra.Command{
+	Use:   "results",
+	Short: "export report of the campaign as GoPhish results CSV",
+	Run: func(cmd *cobra.Command, args []string) {
+		input, err := cmd.Flags().GetString("input")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		output, err := cmd.Flags().GetString("output")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		eventsFile, err := cmd.Flags().GetString("events")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		if input == "" || output == "" {
+			logging.Fatalf("You need to provide json or xml report and results filename")
+		}
+
+		res, err := campaign.ReadReport(input)
+		if err != nil {
+			logging.Fatalf("Error reading report: %v", err)
+		}
+
+		if eventsFile != "" {
+			events, err := tracking.ReadEvents(eventsFile)
+			if err != nil {
+				logging.Fatalf("Error reading events: %v", err)
+			}
+			res.AddEvents(events)
+		}
+
+		var buf bytes.Buffer
+		if err := campaign.WriteGophishResults(&buf, res); err != nil {
+			logging.Fatalf("Error exporting results: %v", err)
+		}
+
+		if err := ioutil.WriteFile(output, buf.Bytes(), 0600); err != nil {
+			logging.Fatalf("Error writing results: %v", err)
+		}
+
+		logging.Infof("Saved results of %d targets in \"%s\"", len(res.Targets), output)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(gophishCmd)
+	gophishCmd.AddCommand(gophishGroupsCmd)
+	gophishCmd.AddCommand(gophishTemplateCmd)
+	gophishCmd.AddCommand(gophishResultsCmd)
+	gophishGroupsCmd.Flags().StringP("input", "i", "", "groups exported from GoPhish API")
+	gophishGroupsCmd.Flags().StringP("output", "o", "", "targets file to create")
+	gophishGroupsCmd.Flags().StringP("separator", "s", ",", "separator of the targets file, general.separator of the config")
+	gophishTemplateCmd.Flags().StringP("input", "i", "", "templates exported from GoPhish API")
+	gophishTemplateCmd.Flags().StringP("output", "o", "", "template file to create")
+	gophishTemplateCmd.Flags().StringP("name", "n", "", "name of the template if there are more")
+	gophishResultsCmd.Flags().StringP("input", "i", "", "report created with json or xml format")
+	gophishResultsCmd.Flags().StringP("output", "o", "", "results CSV to create")
+	gophishResultsCmd.Flags().StringP("events", "e", "", "events recorded by lateralus serve or track, added to the results")
+}
@@ -0,0 +1,224 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+
+	"github.com/lateralusd/lateralus/infra"
+	"github.com/lateralusd/lateralus/logging"
+	"github.com/lateralusd/lateralus/util"
+	"github.com/spf13/cobra"
+	"golang.org/x/mod/semver"
+)
+
+// provisionedConfig is the campaign config for provisioned domain, mails
+// are sent through Postfix on the droplet
+var provisionedConfig = `url:
+  generate: True
+  link: "https://%[1]s/?id=<CHANGE>"
+  length: 10
+
+mail:
+  name: Attacker
+  address: noreply@%[1]s
+  subject: Not phishing mail
+  priority: normal
+  charset: utf-8
+  transferEncoding: quoted-printable
+
+attack:
+  targets: targets.csv
+  template: ./template
+
+mailServer:
+  host: %[1]s
+  port: 25
+  encryption: tls
+  maxBackoff: 5m
+
+general:
+  bulk: False
+  bcc: True
+  bulkDelay: 60
+  bulkSize: 3
+  delay: 5
+  rate: 0
+  separator: ";"
+`
+
+var infraCmd = &cobra.Command{
+	Use:   "infra",
+	Short: "manage campaign infrastructure",
+}
+
+var infraProvisionCmd = &cobra.Command{
+	Use:   "provision",
+	Short: "create server with TLS certificate, NGINX and Postfix for the domain",
+	Run: func(cmd *cobra.Command, args []string) {
+		provider, err := cmd.Flags().GetString("provider")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		if provider != "digitalocean" {
+			logging.Fatalf("Unsupported provider \"%s\", only digitalocean is supported", provider)
+		}
+
+		domain, err := cmd.Flags().GetString("domain")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		if domain == "" {
+			logging.Fatalf("You need to provide domain")
+		}
+
+		token, err := cmd.Flags().GetString("do-token")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		if token == "" {
+			token = os.Getenv("DIGITALOCEAN_TOKEN")
+		}
+
+		if token == "" {
+			logging.Fatalf("You need to provide DigitalOcean token with --do-token or DIGITALOCEAN_TOKEN")
+		}
+
+		acmeEmail, err := cmd.Flags().GetString("acme-email")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		if acmeEmail == "" {
+			logging.Fatalf("You need to provide email address for Let's Encrypt account")
+		}
+
+		region, err := cmd.Flags().GetString("region")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		size, err := cmd.Flags().GetString("size")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		sshKeys, err := cmd.Flags().GetStringSlice("ssh-key")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		relayFrom, err := cmd.Flags().GetStringSlice("relay-from")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		for i, r := range relayFrom {
+			if ip := net.ParseIP(r); ip != nil {
+				relayFrom[i] = r + "/32"
+				continue
+			}
+			if _, _, err := net.ParseCIDR(r); err != nil {
+				logging.Fatalf("Invalid relay network \"%s\"", r)
+			}
+		}
+
+		redirect, err := cmd.Flags().GetString("redirect")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		version, err := cmd.Flags().GetString("release")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		if version == "" {
+			version = RootCmd.Version
+			if !semver.IsValid("v" + strings.TrimPrefix(version, "v")) {
+				release, err := util.LatestRelease(false)
+				if err != nil {
+					logging.Fatalf("Error finding release installed on the droplet: %v", err)
+				}
+				version = release.Version()
+			}
+		}
+
+		output, err := cmd.Flags().GetString("output")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		if err := os.MkdirAll(output, 0700); err != nil {
+			logging.Fatalf("Error creating output directory: %v", err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt)
+		go func() {
+			<-interrupt
+			cancel()
+		}()
+
+		do := &infra.DigitalOcean{Token: token}
+		res, err := infra.ProvisionDigitalOcean(ctx, do, infra.Provision{
+			Domain:    domain,
+			ACMEEmail: acmeEmail,
+			Region:    region,
+			Size:      size,
+			Image:     "ubuntu-22-04-x64",
+			SSHKeys:   sshKeys,
+			RelayFrom: relayFrom,
+			Version:   version,
+			Redirect:  redirect,
+		})
+		if err != nil {
+			logging.Fatalf("Error provisioning: %v", err)
+		}
+
+		smtpConf := filepath.Join(output, "smtp.conf")
+		if err := ioutil.WriteFile(smtpConf, []byte(res.SMTPConfig), 0600); err != nil {
+			logging.Fatalf("Error writing SMTP config: %v", err)
+		}
+
+		config := filepath.Join(output, "config.yaml")
+		if err := ioutil.WriteFile(config, []byte(fmt.Sprintf(provisionedConfig, domain)), 0600); err != nil {
+			logging.Fatalf("Error writing config: %v", err)
+		}
+
+		logging.Infof("Droplet %d is running at %s, it is ready once cloud-init finishes", res.DropletID, res.IP)
+		logging.Infof("Postfix config saved in \"%s\", campaign config in \"%s\"", smtpConf, config)
+		logging.Infof("lateralus %s serve records the clicks on the droplet into /var/lib/lateralus/events.jsonl", version)
+		logging.Infof("Certificate expires on %s, certbot on the droplet renews it once %s points there", res.CertExpiry.Format("2006-01-02"), domain)
+		if len(relayFrom) == 0 {
+			logging.Warningf("No --relay-from given, Postfix relays only for the droplet itself")
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(infraCmd)
+	infraCmd.AddCommand(infraProvisionCmd)
+	infraProvisionCmd.Flags().String("provider", "digitalocean", "cloud provider, only digitalocean is supported")
+	infraProvisionCmd.Flags().StringP("domain", "d", "", "domain of the server, its parent zone has to be hosted at the provider")
+	infraProvisionCmd.Flags().String("do-token", "", "DigitalOcean API token, DIGITALOCEAN_TOKEN by default")
+	infraProvisionCmd.Flags().String("acme-email", "", "email address of Let's Encrypt account")
+	infraProvisionCmd.Flags().String("region", "nyc1", "region of the droplet")
+	infraProvisionCmd.Flags().String("size", "s-1vcpu-1gb", "size of the droplet")
+	infraProvisionCmd.Flags().StringSlice("ssh-key", nil, "id or fingerprint of account SSH key added to the droplet")
+	infraProvisionCmd.Flags().StringSlice("relay-from", nil, "IP address or network allowed to send mails through the droplet")
+	infraProvisionCmd.Flags().String("redirect", "", "URL the targets are redirected to from the droplet, https://<zone>/ by default")
+	infraProvisionCmd.Flags().String("release", "", "lateralus release installed on the droplet, the running version or the latest release by default")
+	infraProvisionCmd.Flags().StringP("output", "o", ".", "directory where smtp.conf and config.yaml are saved")
+}
@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lateralusd/lateralus/campaign"
+	"github.com/lateralusd/lateralus/logging"
+	"github.com/lateralusd/lateralus/util"
+	"github.com/spf13/cobra"
+)
+
+var parseCmd = &cobra.Command{
+	Use:     "parse",
+	Aliases: []string{"parse-modlishka"},
+	Short:   "add credentials captured by Modlishka to report of the previous campaign",
+	Run: func(cmd *cobra.Command, args []string) {
+		input, err := cmd.Flags().GetString("input")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		control, err := cmd.Flags().GetString("control")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		if input == "" || control == "" {
+			logging.Fatalf("You need to provide json or xml report filename and Modlishka control panel")
+		}
+
+		username, err := cmd.Flags().GetString("username")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		password, err := cmd.Flags().GetString("password")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		output, err := cmd.Flags().GetString("output")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		if output == "" {
+			output = input
+		}
+
+		res, err := campaign.ReadReport(input)
+		if err != nil {
+			logging.Fatalf("Error reading report: %v", err)
+		}
+
+		victims, err := readModlishka(control, username, password)
+		if err != nil {
+			logging.Fatalf("Error reading Modlishka control panel: %v", err)
+		}
+
+		added := res.AddModlishka(victims)
+		logging.Infof("Added or updated %d of %d Modlishka captures from \"%s\"", added, len(victims), control)
+
+		format := "json"
+		if strings.EqualFold(filepath.Ext(output), ".xml") {
+			format = "xml"
+		}
+		if err := campaign.WriteReport(output, "", format, res); err != nil {
+			logging.Fatalf("Error saving report: %v", err)
+		}
+		logging.Infof("Report saved in \"%s\"", output)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(parseCmd)
+	parseCmd.Flags().StringP("input", "i", "", "report created with json or xml format")
+	parseCmd.Flags().String("control", "", "URL of Modlishka control panel, e.g. https://phish.example.com/SayHello2Modlishka, or the page saved from it")
+	parseCmd.Flags().StringP("username", "u", "", "username of Modlishka control panel, -controlCreds of Modlishka")
+	parseCmd.Flags().StringP("password", "p", "", "password of Modlishka control panel")
+	parseCmd.Flags().StringP("output", "o", "", "where to save the report, overwrites the input if empty")
+}
+
+// readModlishka gets the victims from the control panel at URL or from the
+// page saved from it
+func readModlishka(control, username, password string) ([]util.ModlishkaVictim, error) {
+	if strings.HasPrefix(control, "http://") || strings.HasPrefix(control, "https://") {
+		return util.FetchModlishka(context.Background(), control, username, password)
+	}
+
+	f, err := os.Open(control)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return util.ParseModlishka(f)
+}
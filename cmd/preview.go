@@ -0,0 +1,206 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lateralusd/lateralus/campaign"
+	"github.com/lateralusd/lateralus/email"
+	"github.com/lateralusd/lateralus/logging"
+	"github.com/lateralusd/lateralus/util"
+	"github.com/spf13/cobra"
+)
+
+// previewPage shows the headers of the mail above its body, the body is
+// rendered inside iframe so that its styles do not affect the headers
+var previewPage = template.Must(template.New("preview").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Subject}}</title>
+<style>
+body { margin: 0; font-family: sans-serif; }
+table { border-collapse: collapse; margin: 1em; font-size: 0.9em; }
+th { text-align: right; padding: 2px 1em 2px 0; vertical-align: top; color: #555; }
+td { padding: 2px 0; word-break: break-all; }
+iframe { width: 100%; height: 80vh; border: 0; border-top: 1px solid #ccc; }
+pre { margin: 1em; white-space: pre-wrap; border-top: 1px solid #ccc; padding-top: 1em; }
+</style>
+</head>
+<body>
+<table>
+{{range .Fields}}<tr><th>{{.Name}}</th><td>{{.Value}}</td></tr>
+{{end}}</table>
+{{if .HTML}}<iframe sandbox srcdoc="{{.Body}}"></iframe>{{else}}<pre>{{.Body}}</pre>{{end}}
+</body>
+</html>
+`))
+
+var previewCmd = &cobra.Command{
+	Use:   "preview",
+	Short: "render mails for the targets without sending them",
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := cmd.Flags().GetString("config")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		if config == "" {
+			logging.Fatalf("You need to provide config filename")
+		}
+
+		dir, err := cmd.Flags().GetString("dir")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		open, err := cmd.Flags().GetBool("open")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		limit, err := cmd.Flags().GetInt("count")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		tmpl, err := cmd.Flags().GetString("template")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		targets, err := cmd.Flags().GetString("targets")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		includeTags, err := cmd.Flags().GetStringSlice("include-tags")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		excludeTags, err := cmd.Flags().GetStringSlice("exclude-tags")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		logging.Infof("Parsing config from \"%s\"", config)
+		opts, err := campaign.ParseConfig(config)
+		if err != nil {
+			logging.Fatalf("Error parsing configuration: %v", err)
+		}
+
+		if tmpl != "" {
+			opts.Attack.Template = tmpl
+		}
+		if targets != "" {
+			opts.Attack.Targets = targets
+		}
+		if len(includeTags) > 0 {
+			opts.Attack.IncludeTags = includeTags
+		}
+		if len(excludeTags) > 0 {
+			opts.Attack.ExcludeTags = excludeTags
+		}
+
+		mails, err := campaign.New(opts).Preview(context.Background(), limit)
+		if err != nil {
+			logging.Fatalf("Error rendering mails: %v", err)
+		}
+
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			logging.Fatalf("Error creating preview directory: %v", err)
+		}
+
+		var files []string
+		for i, m := range mails {
+			base := filepath.Join(dir, previewFilename(i, m.To[0]))
+			if err := ioutil.WriteFile(base+".eml", []byte(m.Data), 0600); err != nil {
+				logging.Fatalf("Error saving preview: %v", err)
+			}
+
+			page, err := renderPreview(m.Data)
+			if err != nil {
+				logging.Fatalf("Error saving preview: %v", err)
+			}
+			if err := ioutil.WriteFile(base+".html", page, 0600); err != nil {
+				logging.Fatalf("Error saving preview: %v", err)
+			}
+			files = append(files, base+".html")
+		}
+
+		logging.Infof("Saved %d previews in \"%s\"", len(files), dir)
+
+		if open && len(files) > 0 {
+			if err := util.OpenBrowser(files[0]); err != nil {
+				logging.Errorf("Error opening browser: %v", err)
+			}
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(previewCmd)
+	previewCmd.Flags().StringP("config", "c", "", "config filename")
+	previewCmd.Flags().StringP("dir", "d", "preview", "directory where rendered mails are saved")
+	previewCmd.Flags().Bool("open", false, "open the first rendered mail in the browser")
+	previewCmd.Flags().IntP("count", "n", 0, "render only the first N targets, all of them by default")
+	previewCmd.Flags().StringP("template", "t", "", "mail template, overrides attack.template")
+	previewCmd.Flags().String("targets", "", "targets file, overrides attack.targets")
+	previewCmd.Flags().StringSlice("include-tags", nil, "render only targets with any of the tags, overrides attack.includeTags")
+	previewCmd.Flags().StringSlice("exclude-tags", nil, "skip targets with any of the tags, overrides attack.excludeTags")
+}
+
+func previewFilename(i int, email string) string {
+	name := strings.NewReplacer("@", "_at_", "/", "_", "\\", "_").Replace(email)
+	return fmt.Sprintf("%03d_%s", i+1, name)
+}
+
+// renderPreview creates HTML page with headers and body of the message
+func renderPreview(data string) ([]byte, error) {
+	msg, err := email.ParseMessage(strings.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("renderPreview: %v", err)
+	}
+
+	page := struct {
+		Subject string
+		Fields  []email.HeaderField
+		HTML    bool
+		Body    string
+	}{
+		Fields: msg.Fields,
+		HTML:   true,
+	}
+	for _, f := range msg.Fields {
+		if strings.EqualFold(f.Name, "Subject") {
+			page.Subject = f.Value
+		}
+	}
+
+	part := msg.Body("text/html")
+	if part == nil {
+		part = msg.Body("text/plain")
+		page.HTML = false
+	}
+	if part == nil {
+		part = msg.Root
+	}
+	page.Body, err = part.Text()
+	if err != nil {
+		logging.Warningf("Showing body as is: %v", err)
+		page.Body = string(part.Body)
+	}
+
+	var b bytes.Buffer
+	if err := previewPage.Execute(&b, page); err != nil {
+		return nil, fmt.Errorf("renderPreview: %v", err)
+	}
+	return b.Bytes(), nil
+}
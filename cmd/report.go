@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/lateralusd/lateralus/campaign"
+	"github.com/lateralusd/lateralus/email"
+	"github.com/lateralusd/lateralus/logging"
+	"github.com/lateralusd/lateralus/tracking"
+	"github.com/lateralusd/lateralus/util"
+	"github.com/spf13/cobra"
+)
+
+var reportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "display or convert report of the previous campaign",
+	Run: func(cmd *cobra.Command, args []string) {
+		input, err := cmd.Flags().GetString("input")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		if input == "" {
+			logging.Fatalf("You need to provide json or xml report filename")
+		}
+
+		template, err := cmd.Flags().GetString("template")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		output, err := cmd.Flags().GetString("output")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		format, err := cmd.Flags().GetString("format")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		eventsFile, err := cmd.Flags().GetString("events")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		evilginx, err := cmd.Flags().GetString("evilginx")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		receipts, err := cmd.Flags().GetString("receipts")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		replies, err := cmd.Flags().GetString("replies")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		res, err := campaign.ReadReport(input)
+		if err != nil {
+			logging.Fatalf("Error reading report: %v", err)
+		}
+
+		if eventsFile != "" {
+			events, err := tracking.ReadEvents(eventsFile)
+			if err != nil {
+				logging.Fatalf("Error reading events: %v", err)
+			}
+			added := res.AddEvents(events)
+			logging.Infof("Added %d of %d events from \"%s\"", added, len(events), eventsFile)
+		}
+
+		if evilginx != "" {
+			sessions, err := util.ParseEvilginxSessions(evilginx)
+			if err != nil {
+				logging.Fatalf("Error reading evilginx sessions: %v", err)
+			}
+			added := res.AddSessions(sessions)
+			logging.Infof("Added %d of %d evilginx sessions from \"%s\"", added, len(sessions), evilginx)
+		}
+
+		if receipts != "" {
+			messages, err := email.ReadMessages(receipts)
+			if err != nil {
+				logging.Fatalf("Error reading receipts: %v", err)
+			}
+			var mdns []*email.MDN
+			for _, msg := range messages {
+				if m, ok := email.ParseMDN(msg); ok {
+					mdns = append(mdns, m)
+				}
+			}
+			added := res.AddReceipts(mdns)
+			logging.Infof("Added %d of %d read receipts from \"%s\"", added, len(mdns), receipts)
+		}
+
+		if replies != "" {
+			messages, err := email.ReadMessages(replies)
+			if err != nil {
+				logging.Fatalf("Error reading replies: %v", err)
+			}
+			var found []*email.Reply
+			for _, msg := range messages {
+				if r, ok := email.ClassifyReply(msg); ok {
+					found = append(found, r)
+				}
+			}
+			added := res.AddReplies(found)
+			logging.Infof("Added %d of %d bounces and replies from \"%s\"", added, len(found), replies)
+		}
+
+		if output == "" {
+			if err := campaign.RenderReport(os.Stdout, template, format, res); err != nil {
+				logging.Fatalf("Error displaying report: %v", err)
+			}
+			return
+		}
+
+		if err := campaign.WriteReport(output, template, format, res); err != nil {
+			logging.Fatalf("Error creating report: %v", err)
+		}
+		logging.Infof("Report saved in \"%s\"", output)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(reportCmd)
+	reportCmd.Flags().StringP("input", "i", "", "report created with json or xml format")
+	reportCmd.Flags().StringP("template", "t", "", "template to use for report generation")
+	reportCmd.Flags().StringP("output", "o", "", "where to store output, prints to stdout if empty")
+	reportCmd.Flags().StringP("format", "f", "tpl", "tpl, xml, json, html")
+	reportCmd.Flags().StringP("events", "e", "", "events recorded by lateralus track, added to the report")
+	reportCmd.Flags().String("evilginx", "", "evilginx2 database, e.g. ~/.evilginx/data.db, whose sessions are added to the report")
+	reportCmd.Flags().String("receipts", "", "read receipts to add to the report, .eml file, directory of them or mbox")
+	reportCmd.Flags().String("replies", "", "bounces and replies to add to the report, .eml file, directory of them or mbox")
+}
@@ -0,0 +1,619 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lateralusd/lateralus/campaign"
+	"github.com/lateralusd/lateralus/logging"
+	"github.com/spf13/cobra"
+)
+
+var sendCmd = &cobra.Command{
+	Use:     "send",
+	Aliases: []string{"run"},
+	Short:   "send the campaign mails",
+	Run: func(cmd *cobra.Command, args []string) {
+		start := time.Now()
+		logging.Infof("Starting campaign at %s", start.Format("2006-01-02 15:04:05"))
+
+		config, err := cmd.Flags().GetString("config")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		if config == "" {
+			logging.Fatalf("You need to provide config filename")
+		}
+
+		template, err := cmd.Flags().GetString("template")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		if template == "" {
+			logging.Infof("Template not provided, using default template")
+		} else {
+			logging.Infof("Using template from \"%s\"", template)
+		}
+
+		output, err := cmd.Flags().GetString("output")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		format, err := cmd.Flags().GetString("format")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		htmlReport, err := cmd.Flags().GetBool("html")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		emlDir, err := cmd.Flags().GetString("eml-dir")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		dryRun, err := cmd.Flags().GetBool("dry-run")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		attachments, err := cmd.Flags().GetStringArray("attachment")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		checkpoint, err := cmd.Flags().GetString("checkpoint")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		resume, err := cmd.Flags().GetString("resume")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		logging.Infof("Parsing config from \"%s\"", config)
+		opts, err := campaign.ParseConfig(config)
+		if err != nil {
+			var cfgErr *campaign.ErrInvalidConfig
+			if errors.As(err, &cfgErr) {
+				logging.Fatalf("Configuration is not valid: %v", cfgErr)
+			}
+			logging.Fatalf("Error parsing configuration: %v", err)
+		}
+
+		for _, f := range campaign.ScanForSecrets(config) {
+			logging.Warningf("%s:%d: %s looks like %s (%s)", config, f.Line, f.Key, f.Kind, f.Value)
+		}
+
+		pubKey, err := cmd.Flags().GetString("verifySignature")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		if pubKey != "" {
+			if err := verifyConfig(config, opts, pubKey); err != nil {
+				logging.Fatalf("Config signature verification failed: %v", err)
+			}
+			logging.Infof("Config signature verified with \"%s\"", pubKey)
+		}
+
+		simulate, err := cmd.Flags().GetString("simulate-clicks")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		percent, err := parsePercent(simulate)
+		if err != nil {
+			logging.Fatalf("Invalid simulate-clicks value: %v", err)
+		}
+
+		seed, err := cmd.Flags().GetInt64("seed")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		fromFile, err := cmd.Flags().GetString("from-file")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		if fromFile != "" {
+			from, err := readFirstLine(fromFile)
+			if err != nil {
+				logging.Fatalf("Error reading From address: %v", err)
+			}
+			logging.Infof("Using From address \"%s\" from \"%s\"", from, fromFile)
+			opts.Mail.Address = from
+		}
+
+		emlTemplate, err := cmd.Flags().GetString("eml-template")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		if emlTemplate != "" {
+			t, err := campaign.ParseEML(emlTemplate)
+			if err != nil {
+				logging.Fatalf("Error parsing EML template: %v", err)
+			}
+			logging.Infof("Using subject, sender and %s body from \"%s\"", t.ContentType, emlTemplate)
+			t.Apply(opts, emlTemplate)
+		}
+
+		envelopeFrom, err := cmd.Flags().GetString("envelope-from")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		if envelopeFrom != "" {
+			opts.Mail.EnvelopeFrom = envelopeFrom
+		}
+
+		verpDomain, err := cmd.Flags().GetString("verp-domain")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		if verpDomain != "" {
+			opts.Mail.VERPDomain = verpDomain
+		}
+
+		headersFile, err := cmd.Flags().GetString("headers-file")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		headerFlags, err := cmd.Flags().GetStringArray("header")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		if headersFile != "" || len(headerFlags) > 0 {
+			// flags take precedence over the file, which takes precedence over the config
+			headers := make(map[string]string)
+			for name, value := range opts.Mail.Headers {
+				headers[name] = value
+			}
+
+			if headersFile != "" {
+				fileHeaders, err := campaign.ReadHeaders(headersFile)
+				if err != nil {
+					logging.Fatalf("Error reading headers: %v", err)
+				}
+				for name, value := range fileHeaders {
+					headers[name] = value
+				}
+			}
+
+			for _, h := range headerFlags {
+				name, value, err := parseHeader(h)
+				if err != nil {
+					logging.Fatalf("Invalid header: %v", err)
+				}
+				headers[name] = value
+			}
+
+			opts.Mail.Headers = headers
+		}
+
+		listID, err := cmd.Flags().GetString("list-id")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		if listID != "" {
+			opts.Mail.ListID = listID
+		}
+
+		smsProvider, err := cmd.Flags().GetString("sms-provider")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		if smsProvider != "" {
+			opts.SMS.Provider = smsProvider
+		}
+
+		smsFrom, err := cmd.Flags().GetString("sms-from")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		if smsFrom != "" {
+			opts.SMS.From = smsFrom
+		}
+
+		smsOnly, err := cmd.Flags().GetBool("sms-only")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		if smsOnly {
+			opts.SMS.Only = true
+		}
+
+		vishing, err := cmd.Flags().GetBool("vishing")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		if vishing {
+			opts.Voice.Enabled = true
+		}
+
+		twimlURL, err := cmd.Flags().GetString("twiml-url")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		if twimlURL != "" {
+			opts.Voice.TwiMLURL = twimlURL
+		}
+
+		slackToken, err := cmd.Flags().GetString("slack-bot-token")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		if slackToken != "" {
+			opts.Slack.Token = slackToken
+		}
+
+		slackMode, err := cmd.Flags().GetString("slack-channel-mode")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		if slackMode != "" {
+			opts.Slack.Mode = slackMode
+		}
+
+		notes, err := cmd.Flags().GetString("campaign-notes")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		if notes != "" {
+			opts.Notes = notes
+		}
+
+		notesFile, err := cmd.Flags().GetString("notes-file")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		if notesFile != "" {
+			d, err := ioutil.ReadFile(notesFile)
+			if err != nil {
+				logging.Fatalf("Error reading notes: %v", err)
+			}
+			opts.Notes = strings.TrimSpace(string(d))
+		}
+
+		throttle, err := cmd.Flags().GetInt("throttle-by-domain")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		if throttle > 0 {
+			opts.General.ThrottleByDomain = throttle
+		}
+
+		startAt, err := cmd.Flags().GetString("start-at")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		if startAt != "" {
+			opts.General.StartAt = startAt
+		}
+
+		sendWindow, err := cmd.Flags().GetString("window")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		if sendWindow != "" {
+			opts.General.Window = sendWindow
+		}
+
+		deliverAt, err := cmd.Flags().GetString("deliver-at")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		if deliverAt != "" {
+			opts.General.DeliverAt = deliverAt
+		}
+
+		timezone, err := cmd.Flags().GetString("timezone")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		if timezone != "" {
+			opts.General.Timezone = timezone
+		}
+
+		delayMin, err := cmd.Flags().GetInt("delay-min")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		delayMax, err := cmd.Flags().GetInt("delay-max")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		if delayMax > 0 {
+			opts.General.DelayMin = delayMin
+			opts.General.DelayMax = delayMax
+		} else if cmd.Flags().Changed("delay-min") {
+			if opts.General.DelayMax <= 0 {
+				logging.Fatalf("You need to provide --delay-max or general.delayMax with --delay-min")
+			}
+			opts.General.DelayMin = delayMin
+		}
+
+		sendRate, err := cmd.Flags().GetString("rate")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		if sendRate != "" {
+			opts.General.Rate = sendRate
+			opts.General.Delay = 0
+		}
+
+		burst, err := cmd.Flags().GetInt("burst")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		if burst > 0 {
+			opts.General.Burst = burst
+		}
+
+		priority, err := cmd.Flags().GetString("priority")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		if priority != "" {
+			opts.Mail.Priority = priority
+		}
+
+		precedence, err := cmd.Flags().GetString("precedence")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		if precedence != "" {
+			opts.Mail.Precedence = precedence
+		}
+
+		if opts.Mail.Precedence == "" {
+			logging.Warningf("Sending with \"Precedence: bulk\", use --precedence list for simulated newsletter campaigns")
+		}
+
+		trackingHosts, err := cmd.Flags().GetStringSlice("tracking-hosts")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		if len(trackingHosts) > 0 {
+			opts.Url.Hosts = trackingHosts
+		}
+
+		normalize, err := cmd.Flags().GetBool("normalize-whitespace")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		if normalize {
+			opts.Mail.NormalizeWhitespace = true
+		}
+
+		includeTags, err := cmd.Flags().GetStringSlice("include-tags")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		excludeTags, err := cmd.Flags().GetStringSlice("exclude-tags")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		if len(includeTags) > 0 {
+			opts.Attack.IncludeTags = includeTags
+		}
+
+		if len(excludeTags) > 0 {
+			opts.Attack.ExcludeTags = excludeTags
+		}
+
+		keepDuplicates, err := cmd.Flags().GetBool("keep-duplicates")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		if keepDuplicates {
+			opts.Attack.KeepDuplicates = true
+		}
+
+		invalidTargets, err := cmd.Flags().GetString("invalid-targets")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		if invalidTargets != "" {
+			opts.Attack.Validation.OnInvalid = invalidTargets
+		}
+
+		bodyEncoding, err := cmd.Flags().GetString("body-encoding")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		if bodyEncoding != "" {
+			opts.Mail.TransferEncoding = bodyEncoding
+		}
+
+		opts.Attack.Attachments = append(opts.Attack.Attachments, attachments...)
+
+		c := campaign.New(opts)
+		c.Output = output
+		c.Format = format
+		c.ReportTemplate = template
+		c.HTMLReport = htmlReport
+		c.EMLDir = emlDir
+		c.DryRun = dryRun
+		c.Checkpoint = checkpoint
+		c.Resume = resume
+		c.SimulateClicks = percent
+		c.Seed = seed
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt)
+		go func() {
+			<-interrupt
+			logging.Errorf("Interrupted, stopping the campaign")
+			cancel()
+		}()
+
+		if err := c.Run(ctx); err != nil {
+			var (
+				noTgtErr  *campaign.ErrNoTargets
+				tmplErr   *campaign.ErrTemplateRender
+				authErr   *campaign.ErrSMTPAuth
+				reportErr *campaign.ErrReportWrite
+			)
+			switch {
+			case errors.As(err, &noTgtErr):
+				logging.Fatalf("Nothing to do: %v", noTgtErr)
+			case errors.As(err, &tmplErr):
+				logging.Fatalf("Error rendering template \"%s\": %v", tmplErr.Template, tmplErr.Err)
+			case errors.As(err, &authErr):
+				logging.Fatalf("Check mailServer credentials: %v", authErr)
+			case errors.As(err, &reportErr):
+				logging.Fatalf("Error creating %s report \"%s\": %v", reportErr.Format, reportErr.Output, reportErr.Err)
+			default:
+				logging.Fatalf("Error running campaign: %v", err)
+			}
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(sendCmd)
+	sendCmd.Flags().StringP("config", "c", "", "config filename")
+	sendCmd.Flags().StringP("template", "t", "", "template to use for report generation")
+	sendCmd.Flags().StringP("output", "o", "", "where to store output")
+	sendCmd.Flags().String("eml-dir", "", "directory where every sent mail is saved as <ID>.eml")
+	sendCmd.Flags().Bool("dry-run", false, "build the mails without sending them, they are saved into --eml-dir or printed")
+	sendCmd.Flags().StringArray("attachment", nil, "file attached to every mail in addition to attack.attachments, can be repeated")
+	sendCmd.Flags().String("checkpoint", "", "file where state of every target is saved while sending, <output>.checkpoint by default")
+	sendCmd.Flags().String("resume", "", "checkpoint of interrupted campaign, targets which were sent the mail are skipped")
+	sendCmd.Flags().StringP("format", "f", "tpl", "tpl, xml, json, html")
+	sendCmd.Flags().Bool("html", false, "save also self-contained HTML report to <output>.html")
+	sendCmd.Flags().String("verifySignature", "", "public key used to verify config signature")
+	sendCmd.Flags().String("eml-template", "", "EML file whose subject, sender and body are used instead of the configured ones")
+	sendCmd.Flags().String("from-file", "", "file holding From address in its first non-empty line")
+	sendCmd.Flags().String("envelope-from", "", "address used in MAIL FROM receiving the bounces, overrides mail.envelopeFrom")
+	sendCmd.Flags().String("verp-domain", "", "send from bounce+<target id>@domain to match bounces with targets, overrides mail.verpDomain")
+	sendCmd.Flags().String("headers-file", "", "JSON object with headers added to every mail, e.g. {\"X-Foo\": \"bar\"}")
+	sendCmd.Flags().StringArray("header", nil, "header added to every mail, e.g. \"X-Foo: bar\", can be repeated")
+	sendCmd.Flags().String("list-id", "", "List-Id header value, e.g. campaign.example.com, overrides mail.listId")
+	sendCmd.Flags().String("start-at", "", "time to start sending at, e.g. \"2021-06-01 09:00\", overrides general.startAt")
+	sendCmd.Flags().String("window", "", "send only within the window, e.g. \"Mon-Fri 09:00-17:00\", overrides general.window")
+	sendCmd.Flags().String("deliver-at", "", "local time of every target the mail is sent at, e.g. 09:30, overrides general.deliverAt")
+	sendCmd.Flags().String("timezone", "", "timezone of --start-at, --window and targets without timezone, e.g. Europe/Berlin, overrides general.timezone")
+	sendCmd.Flags().Int("delay-min", 0, "shortest random delay in seconds between mails, used with --delay-max or general.delayMax")
+	sendCmd.Flags().Int("delay-max", 0, "longest random delay in seconds between mails, overrides general.delayMin and general.delayMax")
+	sendCmd.Flags().String("rate", "", "mails per minute or per unit, e.g. 30/h, overrides general.rate and disables the delay")
+	sendCmd.Flags().Int("burst", 0, "mails which can be sent at once within the rate, overrides general.burst")
+	sendCmd.Flags().String("priority", "", "low, normal or high, overrides mail.priority")
+	sendCmd.Flags().String("precedence", "", "bulk, list, junk or none, overrides mail.precedence (default bulk)")
+	sendCmd.Flags().StringSlice("include-tags", nil, "send only to targets with any of the tags, overrides attack.includeTags")
+	sendCmd.Flags().StringSlice("exclude-tags", nil, "skip targets with any of the tags, overrides attack.excludeTags")
+	sendCmd.Flags().Bool("keep-duplicates", false, "send to every row of the same target address, overrides attack.keepDuplicates")
+	sendCmd.Flags().String("invalid-targets", "", "skip or abort, validates the targets before sending, overrides attack.validation.onInvalid")
+	sendCmd.Flags().String("body-encoding", "", "quoted-printable, base64 or 7bit, overrides mail.transferEncoding")
+	sendCmd.Flags().Bool("normalize-whitespace", false, "collapse repeated spaces and trim every line of the rendered body")
+	sendCmd.Flags().StringSlice("tracking-hosts", nil, "hosts which replace the host of url.link, targets get them in turns")
+	sendCmd.Flags().String("sms-provider", "", "twilio or bandwidth, overrides sms.provider")
+	sendCmd.Flags().String("sms-from", "", "sending phone number, e.g. +15551234567, overrides sms.from")
+	sendCmd.Flags().Bool("sms-only", false, "send only SMS without the mails")
+	sendCmd.Flags().Bool("vishing", false, "call targets with phone number through Twilio")
+	sendCmd.Flags().String("twiml-url", "", "url with TwiML instructions for the calls, overrides voice.twimlUrl")
+	sendCmd.Flags().String("slack-bot-token", "", "send Slack messages with this bot token instead of the mails, overrides slack.token")
+	sendCmd.Flags().String("slack-channel-mode", "", "how to reach targets on Slack, only dm is supported")
+	sendCmd.Flags().String("campaign-notes", "", "notes about the engagement included in the report, overrides notes")
+	sendCmd.Flags().String("notes-file", "", "file with multi-line notes, overrides --campaign-notes")
+	sendCmd.Flags().Int("throttle-by-domain", 0, "send at most N mails per recipient domain per minute, overrides general.throttleByDomain")
+	sendCmd.Flags().String("simulate-clicks", "", "generate fake clicks for N% of sent mails, e.g. 20%")
+	sendCmd.Flags().Int64("seed", 1, "seed used for simulated clicks")
+}
+
+// readFirstLine returns the first non-empty line of the file
+func readFirstLine(filename string) (string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			return line, nil
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+
+	return "", fmt.Errorf("%q does not contain any non-empty line", filename)
+}
+
+// parseHeader splits "Name: value"
+func parseHeader(s string) (string, string, error) {
+	i := strings.Index(s, ":")
+	if i <= 0 {
+		return "", "", fmt.Errorf("%q is not in format \"Name: value\"", s)
+	}
+	return strings.TrimSpace(s[:i]), strings.TrimSpace(s[i+1:]), nil
+}
+
+// parsePercent parses values like "20" or "20%"
+func parsePercent(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+	p, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(s), "%"))
+	if err != nil {
+		return 0, err
+	}
+	if p < 0 || p > 100 {
+		return 0, fmt.Errorf("%d%% is not between 0%% and 100%%", p)
+	}
+	return p, nil
+}
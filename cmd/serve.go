@@ -0,0 +1,251 @@
+package cmd
+
+import (
+	"context"
+	"crypto/tls"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/lateralusd/lateralus/campaign"
+	"github.com/lateralusd/lateralus/logging"
+	"github.com/lateralusd/lateralus/notify"
+	"github.com/lateralusd/lateralus/tracking"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "serve landing page or redirect on the target URLs, recording clicks and submitted forms",
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := cmd.Flags().GetString("config")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		if config == "" {
+			logging.Fatalf("You need to provide config filename")
+		}
+
+		redirect, err := cmd.Flags().GetString("redirect")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		notifyOnClick, err := cmd.Flags().GetBool("notify-on-click")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		logging.Infof("Parsing config from \"%s\"", config)
+		opts, err := campaign.ParseConfig(config)
+		if err != nil {
+			logging.Fatalf("Error parsing configuration: %v", err)
+		}
+
+		if redirect != "" {
+			opts.Landing.Redirect = redirect
+		}
+		if notifyOnClick {
+			if report, _ := cmd.Flags().GetString("report"); report == "" {
+				logging.Fatalf("You need to provide --report with --notify-on-click, the alerts name the targets from it")
+			}
+			if len(opts.Notifications.Channels) == 0 {
+				logging.Warningf("No notifications.channels in the config, clicks are not posted anywhere")
+			}
+			for i := range opts.Notifications.Channels {
+				opts.Notifications.Channels[i].Clicks = true
+			}
+		}
+		if opts.Landing.Template == "" && opts.Landing.Redirect == "" {
+			logging.Fatalf("You need to provide landing.template or landing.redirect in the config")
+		}
+		if !opts.Url.Generate {
+			logging.Fatalf("Targets cannot be told apart without generated URLs, set url.generate to True")
+		}
+
+		landing, err := tracking.NewLanding(opts.Url.Link, opts.Landing.Template, opts.Landing.Redirect)
+		if err != nil {
+			logging.Fatalf("Error loading landing page: %v", err)
+		}
+
+		runServer(cmd, landing, opts.Notifiers())
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(serveCmd)
+	serveCmd.Flags().StringP("config", "c", "", "config filename")
+	serveCmd.Flags().String("redirect", "", "URL the targets are redirected to, overrides landing.redirect")
+	serveCmd.Flags().Bool("notify-on-click", false, "post opens, clicks and submissions to all notifications.channels")
+	addServerFlags(serveCmd)
+}
+
+// addServerFlags adds flags of the tracking server shared by track and serve
+func addServerFlags(c *cobra.Command) {
+	c.Flags().StringP("listen", "l", "127.0.0.1:8080", "address the server listens on, :443 with --tls-domain")
+	c.Flags().StringP("events", "e", "events.jsonl", "file where the events are appended")
+	c.Flags().StringP("report", "r", "", "json or xml report of the campaign, requests of other visitors are not recorded")
+	c.Flags().Bool("trust-proxy", false, "take client IP from X-Forwarded-For, use behind reverse proxy only")
+	c.Flags().String("server-header", "", "value of Server header of the responses, e.g. nginx")
+	c.Flags().String("tls-domain", "", "serve HTTPS with Let's Encrypt certificate for the domain, port 80 is used for HTTP")
+	c.Flags().String("acme-email", "", "email for Let's Encrypt registration, required with --tls-domain")
+	c.Flags().String("cert-cache", "certs", "directory where Let's Encrypt certificates are kept")
+	c.Flags().String("webhook-url", "", "URL receiving opens, clicks and submissions as JSON")
+	c.Flags().String("webhook-secret", "", "secret signing the webhook events with HMAC-SHA256")
+}
+
+// runServer runs the tracking server with landing until interrupted, events
+// are sent to notifiers, --webhook-url replaces the webhook among them
+func runServer(cmd *cobra.Command, landing *tracking.Landing, notifiers []notify.Notifier) {
+	listen, err := cmd.Flags().GetString("listen")
+	if err != nil {
+		logging.Fatalf("Error occurred: %v", err)
+	}
+
+	events, err := cmd.Flags().GetString("events")
+	if err != nil {
+		logging.Fatalf("Error occurred: %v", err)
+	}
+
+	trustProxy, err := cmd.Flags().GetBool("trust-proxy")
+	if err != nil {
+		logging.Fatalf("Error occurred: %v", err)
+	}
+
+	serverHeader, err := cmd.Flags().GetString("server-header")
+	if err != nil {
+		logging.Fatalf("Error occurred: %v", err)
+	}
+
+	tlsDomain, err := cmd.Flags().GetString("tls-domain")
+	if err != nil {
+		logging.Fatalf("Error occurred: %v", err)
+	}
+
+	acmeEmail, err := cmd.Flags().GetString("acme-email")
+	if err != nil {
+		logging.Fatalf("Error occurred: %v", err)
+	}
+
+	certCache, err := cmd.Flags().GetString("cert-cache")
+	if err != nil {
+		logging.Fatalf("Error occurred: %v", err)
+	}
+
+	report, err := cmd.Flags().GetString("report")
+	if err != nil {
+		logging.Fatalf("Error occurred: %v", err)
+	}
+
+	if tlsDomain != "" && acmeEmail == "" {
+		logging.Fatalf("You need to provide --acme-email together with --tls-domain")
+	}
+
+	webhookURL, err := cmd.Flags().GetString("webhook-url")
+	if err != nil {
+		logging.Fatalf("Error occurred: %v", err)
+	}
+
+	webhookSecret, err := cmd.Flags().GetString("webhook-secret")
+	if err != nil {
+		logging.Fatalf("Error occurred: %v", err)
+	}
+
+	if webhookURL != "" {
+		// keep the client of the config webhook, it connects through the proxy
+		var chats []notify.Notifier
+		var client *http.Client
+		for _, n := range notifiers {
+			if w, ok := n.(*notify.Webhook); ok {
+				client = w.Client
+			} else {
+				chats = append(chats, n)
+			}
+		}
+		notifiers = append(chats, &notify.Webhook{URL: webhookURL, Secret: webhookSecret, Client: client})
+	}
+
+	var targets map[string]tracking.Target
+	campaignID := ""
+	if report != "" {
+		res, err := campaign.ReadReport(report)
+		if err != nil {
+			logging.Fatalf("Error reading report: %v", err)
+		}
+		targets = res.TrackingTargets()
+		campaignID = res.ID
+		logging.Infof("Tracking %d targets of campaign %s", len(res.Targets), res.ID)
+	} else if len(notifiers) > 0 {
+		logging.Warningf("No --report given, notifications cannot name the targets")
+	}
+
+	log, err := tracking.OpenLog(events)
+	if err != nil {
+		logging.Fatalf("Error opening events file: %v", err)
+	}
+	defer log.Close()
+
+	dispatcher := notify.NewDispatcher(notifiers...)
+	defer dispatcher.Close()
+
+	s := &tracking.Server{
+		Log:          log,
+		TrustProxy:   trustProxy,
+		Landing:      landing,
+		ServerHeader: serverHeader,
+		Targets:      targets,
+		Events:       dispatcher,
+		Campaign:     campaignID,
+	}
+	srv := &http.Server{
+		Addr:         listen,
+		Handler:      s.Handler(),
+		ReadTimeout:  10 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+
+	var manager *autocert.Manager
+	if tlsDomain != "" {
+		manager = &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(tlsDomain),
+			Cache:      autocert.DirCache(certCache),
+			Email:      acmeEmail,
+		}
+		if !cmd.Flags().Changed("listen") {
+			srv.Addr = ":443"
+		}
+		srv.TLSConfig = manager.TLSConfig()
+		srv.TLSConfig.MinVersion = tls.VersionTLS12
+
+		// HTTP answers ACME challenges and redirects everything else to HTTPS
+		go func() {
+			if err := http.ListenAndServe(":80", manager.HTTPHandler(nil)); err != nil {
+				logging.Warningf("Error serving HTTP, certificate is obtained over TLS only: %v", err)
+			}
+		}()
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		<-interrupt
+		logging.Infof("Interrupted, stopping the server")
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(ctx)
+	}()
+
+	logging.Infof("Listening on %s, saving events into \"%s\"", srv.Addr, events)
+	if manager != nil {
+		err = srv.ListenAndServeTLS("", "")
+	} else {
+		err = srv.ListenAndServe()
+	}
+	if err != nil && err != http.ErrServerClosed {
+		logging.Fatalf("Error running server: %v", err)
+	}
+}
@@ -0,0 +1,282 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/lateralusd/lateralus/campaign"
+	"github.com/lateralusd/lateralus/logging"
+	"github.com/spf13/cobra"
+)
+
+var signCmd = &cobra.Command{
+	Use:   "sign",
+	Short: "sign the config so it can be verified before running",
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := cmd.Flags().GetString("config")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		if config == "" {
+			logging.Fatalf("You need to provide config filename")
+		}
+
+		key, err := cmd.Flags().GetString("key")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		if key == "" {
+			logging.Fatalf("You need to provide private key filename")
+		}
+
+		if _, err := campaign.ParseConfig(config); err != nil {
+			logging.Fatalf("Error parsing configuration: %v", err)
+		}
+
+		signature, err := signConfig(config, key)
+		if err != nil {
+			logging.Fatalf("Error signing configuration: %v", err)
+		}
+
+		if err := writeSignature(config, signature); err != nil {
+			logging.Fatalf("Error saving signature: %v", err)
+		}
+
+		logging.Infof("Signature saved in \"%s\"", config)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(signCmd)
+	signCmd.Flags().StringP("config", "c", "", "config filename")
+	signCmd.Flags().StringP("key", "k", "", "PEM encoded RSA or ECDSA private key")
+}
+
+// signatureLine matches the line written by writeSignature
+var signatureLine = regexp.MustCompile(`^signature ?[:=] ?"([A-Za-z0-9+/=]*)"\r?\n?$`)
+
+// configDigest returns SHA-256 hash of the config file as it is, except for
+// the signature line, so that the signature does not depend on the options
+// known to this version. The signature found in the file is returned too.
+func configDigest(filename string) ([]byte, string, error) {
+	d, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, "", fmt.Errorf("configDigest: %v", err)
+	}
+	config, signature, err := stripSignature(d, campaign.IsTOML(filename))
+	if err != nil {
+		return nil, "", fmt.Errorf("configDigest: %v", err)
+	}
+	sum := sha256.Sum256(config)
+	return sum[:], signature, nil
+}
+
+// stripSignature removes the signature line written by writeSignature, the
+// first line of toml config or the last line of yaml one, and ends the config
+// with newline the same way as writeSignature does. Any other line starting
+// with signature key is an error, as it would not be covered by the digest.
+func stripSignature(d []byte, isTOML bool) ([]byte, string, error) {
+	lines := strings.SplitAfter(string(d), "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	var signature string
+	if len(lines) > 0 {
+		i := len(lines) - 1
+		if isTOML {
+			i = 0
+		}
+		if m := signatureLine.FindStringSubmatch(lines[i]); m != nil {
+			signature = m[1]
+			lines = append(lines[:i], lines[i+1:]...)
+		}
+	}
+
+	var buf bytes.Buffer
+	for n, line := range lines {
+		key := line
+		if i := strings.IndexAny(line, ":="); i >= 0 {
+			key = line[:i]
+		}
+		if strings.TrimRight(key, " \t") == "signature" {
+			return nil, "", fmt.Errorf("line %d has signature, which is only allowed in the line written by sign", n+1)
+		}
+		buf.WriteString(line)
+	}
+
+	if buf.Len() > 0 && !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+		buf.WriteString("\n")
+	}
+	return buf.Bytes(), signature, nil
+}
+
+func signConfig(filename, keyPath string) (string, error) {
+	digest, _, err := configDigest(filename)
+	if err != nil {
+		return "", fmt.Errorf("signConfig: %v", err)
+	}
+
+	key, err := readPrivateKey(keyPath)
+	if err != nil {
+		return "", fmt.Errorf("signConfig: %v", err)
+	}
+
+	var sig []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest)
+	case *ecdsa.PrivateKey:
+		sig, err = ecdsa.SignASN1(rand.Reader, k, digest)
+	default:
+		err = fmt.Errorf("unsupported private key type %T", key)
+	}
+	if err != nil {
+		return "", fmt.Errorf("signConfig: %v", err)
+	}
+
+	return base64.StdEncoding.EncodeToString(sig), nil
+}
+
+func verifyConfig(filename string, opts *campaign.Options, keyPath string) error {
+	digest, signature, err := configDigest(filename)
+	if err != nil {
+		return fmt.Errorf("verifyConfig: %v", err)
+	}
+
+	if signature == "" {
+		return errors.New("verifyConfig: config is not signed")
+	}
+	if signature != opts.Signature {
+		return errors.New("verifyConfig: signature line does not match parsed config")
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return fmt.Errorf("verifyConfig: %v", err)
+	}
+
+	key, err := readPublicKey(keyPath)
+	if err != nil {
+		return fmt.Errorf("verifyConfig: %v", err)
+	}
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(k, crypto.SHA256, digest, sig); err != nil {
+			return errors.New("verifyConfig: signature does not match config")
+		}
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(k, digest, sig) {
+			return errors.New("verifyConfig: signature does not match config")
+		}
+	default:
+		return fmt.Errorf("verifyConfig: unsupported public key type %T", key)
+	}
+
+	return nil
+}
+
+// writeSignature appends signature to the config, replacing the previous one
+// if present. In toml config it goes first, as keys after a table belong to it.
+func writeSignature(filename, signature string) error {
+	d, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return fmt.Errorf("writeSignature: %v", err)
+	}
+
+	config, _, err := stripSignature(d, campaign.IsTOML(filename))
+	if err != nil {
+		return fmt.Errorf("writeSignature: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if campaign.IsTOML(filename) {
+		fmt.Fprintf(&buf, "signature = %q\n", signature)
+		buf.Write(config)
+	} else {
+		buf.Write(config)
+		fmt.Fprintf(&buf, "signature: %q\n", signature)
+	}
+
+	info, err := os.Stat(filename)
+	if err != nil {
+		return fmt.Errorf("writeSignature: %v", err)
+	}
+
+	if err := ioutil.WriteFile(filename, buf.Bytes(), info.Mode()); err != nil {
+		return fmt.Errorf("writeSignature: %v", err)
+	}
+
+	return nil
+}
+
+func readPEM(filename string) (*pem.Block, error) {
+	d, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		var block *pem.Block
+		block, d = pem.Decode(d)
+		if block == nil {
+			return nil, fmt.Errorf("no key found in %q", filename)
+		}
+		// openssl ecparam prepends the curve parameters to the key
+		if block.Type != "EC PARAMETERS" {
+			return block, nil
+		}
+	}
+}
+
+func readPrivateKey(filename string) (crypto.PrivateKey, error) {
+	block, err := readPEM(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+}
+
+func readPublicKey(filename string) (crypto.PublicKey, error) {
+	block, err := readPEM(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	switch block.Type {
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return cert.PublicKey, nil
+	default:
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	}
+}
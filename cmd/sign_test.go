@@ -0,0 +1,255 @@
+package cmd
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lateralusd/lateralus/campaign"
+)
+
+const (
+	signYAML = `mail:
+  name: Attacker
+  subject: Hello
+notes: |
+  signature: approved by the client
+`
+	signTOML = `notes = """
+Approved by the client.
+"""
+
+[mail]
+name = "Attacker"
+subject = "Hello"
+`
+)
+
+// writeFile writes content to name in a temporary directory
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	filename := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(filename, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+// writeKeys writes PEM encoded private and public key of the given type
+func writeKeys(t *testing.T, keyType string) (string, string) {
+	t.Helper()
+	var priv, pub interface{}
+	switch keyType {
+	case "rsa":
+		k, err := rsa.GenerateKey(rand.Reader, 1024)
+		if err != nil {
+			t.Fatal(err)
+		}
+		priv, pub = k, &k.PublicKey
+	case "ecdsa":
+		k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		priv, pub = k, &k.PublicKey
+	}
+
+	privDER, err := x509.MarshalPKCS8PrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return writeFile(t, "key.pem", string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: privDER}))),
+		writeFile(t, "key.pub", string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER})))
+}
+
+// signFile signs config the same way as sign command
+func signFile(t *testing.T, config, key string) {
+	t.Helper()
+	signature, err := signConfig(config, key)
+	if err != nil {
+		t.Fatalf("signConfig() error = %v", err)
+	}
+	if err := writeSignature(config, signature); err != nil {
+		t.Fatalf("writeSignature() error = %v", err)
+	}
+}
+
+// verifyFile parses config and verifies its signature
+func verifyFile(t *testing.T, config, pub string) error {
+	t.Helper()
+	opts, err := campaign.ParseConfig(config)
+	if err != nil {
+		t.Fatalf("ParseConfig() error = %v", err)
+	}
+	return verifyConfig(config, opts, pub)
+}
+
+func TestSignVerify(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		keyType string
+	}{
+		{name: "yaml rsa", file: "config.yaml", content: signYAML, keyType: "rsa"},
+		{name: "yaml ecdsa", file: "config.yaml", content: signYAML, keyType: "ecdsa"},
+		{name: "toml rsa", file: "config.toml", content: signTOML, keyType: "rsa"},
+		{name: "no final newline", file: "config.yaml", content: strings.TrimSuffix(signYAML, "\n"), keyType: "ecdsa"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, pub := writeKeys(t, tt.keyType)
+			config := writeFile(t, tt.file, tt.content)
+
+			signFile(t, config, key)
+			if err := verifyFile(t, config, pub); err != nil {
+				t.Fatalf("verifyConfig() error = %v", err)
+			}
+
+			d, _ := ioutil.ReadFile(config)
+			lines := strings.Split(strings.TrimSuffix(string(d), "\n"), "\n")
+			line := lines[len(lines)-1]
+			if campaign.IsTOML(config) {
+				line = lines[0]
+			}
+			if !signatureLine.MatchString(line) {
+				t.Errorf("signature line = %q", line)
+			}
+
+			// signing again replaces the signature
+			signFile(t, config, key)
+			d2, _ := ioutil.ReadFile(config)
+			if len(d2) != len(d) {
+				t.Errorf("config signed twice has %d bytes, want %d", len(d2), len(d))
+			}
+			if err := verifyFile(t, config, pub); err != nil {
+				t.Errorf("verifyConfig() after signing again error = %v", err)
+			}
+
+			_, otherPub := writeKeys(t, tt.keyType)
+			if err := verifyFile(t, config, otherPub); err == nil {
+				t.Errorf("verifyConfig() with other key error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestVerifyTampered(t *testing.T) {
+	tests := []struct {
+		name   string
+		file   string
+		tamper func(string) string
+	}{
+		{
+			name:   "changed value",
+			file:   "config.yaml",
+			tamper: func(s string) string { return strings.Replace(s, "subject: Hello", "subject: Hi", 1) },
+		},
+		{
+			name:   "appended line",
+			file:   "config.yaml",
+			tamper: func(s string) string { return s + "proxy: socks5://127.0.0.1:1080\n" },
+		},
+		{
+			name: "signature line in toml string",
+			file: "config.toml",
+			tamper: func(s string) string {
+				return strings.Replace(s, "Approved by the client.\n", "Approved by the client.\nsignature = \"visit https://evil.example.com\"\n", 1)
+			},
+		},
+		{
+			name: "second yaml signature",
+			file: "config.yaml",
+			tamper: func(s string) string {
+				i := strings.LastIndex(strings.TrimSuffix(s, "\n"), "\n") + 1
+				return s[:i] + "signature: \"c2lnbmF0dXJl\"\n" + s[i:]
+			},
+		},
+		{
+			name: "signature moved in yaml",
+			file: "config.yaml",
+			tamper: func(s string) string {
+				i := strings.LastIndex(strings.TrimSuffix(s, "\n"), "\n") + 1
+				return s[i:] + s[:i]
+			},
+		},
+	}
+
+	key, pub := writeKeys(t, "ecdsa")
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := signYAML
+			if campaign.IsTOML(tt.file) {
+				content = signTOML
+			}
+			config := writeFile(t, tt.file, content)
+			signFile(t, config, key)
+
+			d, _ := ioutil.ReadFile(config)
+			if err := ioutil.WriteFile(config, []byte(tt.tamper(string(d))), 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			// tampered config may not parse, the digest is checked anyway
+			opts, _ := campaign.ParseConfig(config)
+			if err := verifyConfig(config, opts, pub); err == nil {
+				t.Errorf("verifyConfig() of tampered config error = nil, want error")
+			}
+		})
+	}
+}
+
+func TestVerifyUnsigned(t *testing.T) {
+	_, pub := writeKeys(t, "rsa")
+	config := writeFile(t, "config.yaml", signYAML)
+	if err := verifyFile(t, config, pub); err == nil || !strings.Contains(err.Error(), "not signed") {
+		t.Errorf("verifyConfig() error = %v, want config is not signed", err)
+	}
+}
+
+func TestStripSignature(t *testing.T) {
+	const sig = `signature: "c2lnbmF0dXJl"`
+	tests := []struct {
+		name          string
+		content       string
+		isTOML        bool
+		want          string
+		wantSignature string
+		wantErr       bool
+	}{
+		{name: "unsigned", content: "mail:\n  name: A\n", want: "mail:\n  name: A\n"},
+		{name: "yaml", content: "mail:\n  name: A\n" + sig + "\n", want: "mail:\n  name: A\n", wantSignature: "c2lnbmF0dXJl"},
+		{name: "yaml crlf", content: "mail:\r\n  name: A\r\n" + sig + "\r\n", want: "mail:\r\n  name: A\r\n", wantSignature: "c2lnbmF0dXJl"},
+		{name: "yaml without newline", content: "mail:\n  name: A\n" + sig, want: "mail:\n  name: A\n", wantSignature: "c2lnbmF0dXJl"},
+		{name: "toml", content: "signature = \"c2ln\"\n[mail]\nname = \"A\"", isTOML: true, want: "[mail]\nname = \"A\"\n", wantSignature: "c2ln"},
+		{name: "indented key is kept", content: "notes:\n  signature: x\n", want: "notes:\n  signature: x\n"},
+		{name: "yaml signature first", content: sig + "\nmail:\n  name: A\n", wantErr: true},
+		{name: "toml signature last", content: "[mail]\nname = \"A\"\nsignature = \"c2ln\"\n", isTOML: true, wantErr: true},
+		{name: "two signatures", content: sig + "\n" + sig + "\n", wantErr: true},
+		{name: "other signature value", content: "mail:\n  name: A\nsignature: unquoted\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, signature, err := stripSignature([]byte(tt.content), tt.isTOML)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("stripSignature() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if string(got) != tt.want || signature != tt.wantSignature {
+				t.Errorf("stripSignature() = %q, %q, want %q, %q", got, signature, tt.want, tt.wantSignature)
+			}
+		})
+	}
+}
@@ -0,0 +1,18 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var trackCmd = &cobra.Command{
+	Use:   "track",
+	Short: "run server recording opens of the mails",
+	Run: func(cmd *cobra.Command, args []string) {
+		runServer(cmd, nil, nil)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(trackCmd)
+	addServerFlags(trackCmd)
+}
@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/lateralusd/lateralus/logging"
+	"github.com/lateralusd/lateralus/util"
+	"github.com/spf13/cobra"
+)
+
+var updateCmd = &cobra.Command{
+	Use:   "update",
+	Short: "update lateralus to the latest release",
+	Run: func(cmd *cobra.Command, args []string) {
+		checkOnly, err := cmd.Flags().GetBool("check-only")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		preRelease, err := cmd.Flags().GetBool("pre-release")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		release, err := util.LatestRelease(preRelease)
+		if err != nil {
+			logging.Fatalf("Error checking for updates: %v", err)
+		}
+
+		current := RootCmd.Version
+		if !release.Newer(current) {
+			logging.Infof("lateralus %s is up to date", current)
+			return
+		}
+
+		logging.Infof("lateralus %s is available, running %s", release.Version(), current)
+		if checkOnly {
+			return
+		}
+
+		executable, err := os.Executable()
+		if err != nil {
+			logging.Fatalf("Error locating executable: %v", err)
+		}
+
+		if err := util.Update(release, executable); err != nil {
+			logging.Fatalf("Error updating: %v", err)
+		}
+
+		logging.Infof("Updated \"%s\" to %s", executable, release.Version())
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(updateCmd)
+	updateCmd.Flags().Bool("check-only", false, "print the available version without installing it")
+	updateCmd.Flags().Bool("pre-release", false, "include pre-release versions")
+}
@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+
+	"github.com/lateralusd/lateralus/campaign"
+	"github.com/lateralusd/lateralus/logging"
+	"github.com/spf13/cobra"
+)
+
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "check the config, targets and templates without sending",
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := cmd.Flags().GetString("config")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		if config == "" {
+			logging.Fatalf("You need to provide config filename")
+		}
+
+		opts, err := campaign.ParseConfig(config)
+		if err != nil {
+			var cfgErr *campaign.ErrInvalidConfig
+			if errors.As(err, &cfgErr) {
+				logging.Fatalf("Configuration is not valid: %v", cfgErr)
+			}
+			logging.Fatalf("Error parsing configuration: %v", err)
+		}
+
+		for _, f := range campaign.ScanForSecrets(config) {
+			logging.Warningf("%s:%d: %s looks like %s (%s)", config, f.Line, f.Key, f.Kind, f.Value)
+		}
+
+		mails, err := campaign.New(opts).Render(context.Background())
+		if err != nil {
+			logging.Fatalf("Error rendering mails: %v", err)
+		}
+
+		logging.Infof("\"%s\" is valid, %d mails would be sent", config, len(mails))
+	},
+}
+
+var validateTargetsCmd = &cobra.Command{
+	Use:   "targets",
+	Short: "check the target addresses: syntax, MX records and optionally RCPT probe",
+	Run: func(cmd *cobra.Command, args []string) {
+		config, err := cmd.Flags().GetString("config")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		if config == "" {
+			logging.Fatalf("You need to provide config filename")
+		}
+
+		mx, err := cmd.Flags().GetBool("mx")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		probe, err := cmd.Flags().GetBool("probe")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		includeTags, err := cmd.Flags().GetStringSlice("include-tags")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		excludeTags, err := cmd.Flags().GetStringSlice("exclude-tags")
+		if err != nil {
+			logging.Fatalf("Error occurred: %v", err)
+		}
+
+		opts, err := campaign.ParseConfig(config)
+		if err != nil {
+			logging.Fatalf("Error parsing configuration: %v", err)
+		}
+
+		if mx {
+			opts.Attack.Validation.MX = true
+		}
+		if probe {
+			opts.Attack.Validation.Probe = true
+		}
+		if len(includeTags) > 0 {
+			opts.Attack.IncludeTags = includeTags
+		}
+		if len(excludeTags) > 0 {
+			opts.Attack.ExcludeTags = excludeTags
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt)
+		go func() {
+			<-interrupt
+			cancel()
+		}()
+
+		invalid, total, err := campaign.New(opts).ValidateTargets(ctx)
+		if err != nil {
+			logging.Fatalf("Error validating targets: %v", err)
+		}
+
+		for _, t := range invalid {
+			logging.Warningf("Row %d (%s) is invalid: %s", t.Row, t.Email, t.Reason)
+		}
+		if len(invalid) > 0 {
+			logging.Fatalf("%d of %d targets are invalid", len(invalid), total)
+		}
+		logging.Infof("All %d targets are valid", total)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(validateCmd)
+	validateCmd.Flags().StringP("config", "c", "", "config filename")
+
+	validateCmd.AddCommand(validateTargetsCmd)
+	validateTargetsCmd.Flags().StringP("config", "c", "", "config filename")
+	validateTargetsCmd.Flags().Bool("mx", false, "look up MX records of the target domains, overrides attack.validation.mx")
+	validateTargetsCmd.Flags().Bool("probe", false, "ask mail servers of the targets with RCPT TO whether they accept them, overrides attack.validation.probe")
+	validateTargetsCmd.Flags().StringSlice("include-tags", nil, "validate only targets with any of the tags, overrides attack.includeTags")
+	validateTargetsCmd.Flags().StringSlice("exclude-tags", nil, "skip targets with any of the tags, overrides attack.excludeTags")
+}
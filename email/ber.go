@@ -0,0 +1,164 @@
+package email
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Universal BER tags used by LDAP (X.690), only definite lengths are
+// supported
+const (
+	berBoolean     = 0x01
+	berInteger     = 0x02
+	berOctetString = 0x04
+	berEnumerated  = 0x0a
+	berSequence    = 0x30
+	berSet         = 0x31
+)
+
+// maxBERLength limits the size of single element read from server
+const maxBERLength = 64 << 20
+
+// berElement is decoded BER element, data holds its contents
+type berElement struct {
+	tag  byte
+	data []byte
+}
+
+func berTLV(tag byte, data []byte) []byte {
+	b := []byte{tag}
+	n := len(data)
+	if n < 0x80 {
+		b = append(b, byte(n))
+	} else {
+		var l []byte
+		for ; n > 0; n >>= 8 {
+			l = append([]byte{byte(n)}, l...)
+		}
+		b = append(b, 0x80|byte(len(l)))
+		b = append(b, l...)
+	}
+	return append(b, data...)
+}
+
+func berConstructed(tag byte, children ...[]byte) []byte {
+	return berTLV(tag, bytes.Join(children, nil))
+}
+
+func berString(tag byte, s string) []byte {
+	return berTLV(tag, []byte(s))
+}
+
+// berInt encodes v as shortest two's complement
+func berInt(tag byte, v int64) []byte {
+	var b []byte
+	for {
+		b = append([]byte{byte(v)}, b...)
+		if v >= -0x80 && v < 0x80 {
+			break
+		}
+		v >>= 8
+	}
+	return berTLV(tag, b)
+}
+
+func berBool(v bool) []byte {
+	if v {
+		return berTLV(berBoolean, []byte{0xff})
+	}
+	return berTLV(berBoolean, []byte{0})
+}
+
+// readBER reads one element from r
+func readBER(r *bufio.Reader) (berElement, error) {
+	tag, err := r.ReadByte()
+	if err != nil {
+		return berElement{}, err
+	}
+	l, err := r.ReadByte()
+	if err != nil {
+		return berElement{}, err
+	}
+	n := int(l)
+	if l&0x80 != 0 {
+		k := int(l & 0x7f)
+		if k == 0 || k > 4 {
+			return berElement{}, fmt.Errorf("unsupported BER length 0x%02x", l)
+		}
+		n = 0
+		for i := 0; i < k; i++ {
+			b, err := r.ReadByte()
+			if err != nil {
+				return berElement{}, err
+			}
+			n = n<<8 | int(b)
+		}
+	}
+	// four length bytes overflow int on 32-bit platforms
+	if n < 0 || n > maxBERLength {
+		return berElement{}, fmt.Errorf("BER element of %d bytes is too long", n)
+	}
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return berElement{}, err
+	}
+	return berElement{tag: tag, data: data}, nil
+}
+
+// parseBER decodes the first element of b and returns the rest
+func parseBER(b []byte) (berElement, []byte, error) {
+	if len(b) < 2 {
+		return berElement{}, nil, errors.New("truncated BER element")
+	}
+	tag, l := b[0], b[1]
+	b = b[2:]
+	n := int(l)
+	if l&0x80 != 0 {
+		k := int(l & 0x7f)
+		if k == 0 || k > 4 || len(b) < k {
+			return berElement{}, nil, fmt.Errorf("unsupported BER length 0x%02x", l)
+		}
+		n = 0
+		for _, c := range b[:k] {
+			n = n<<8 | int(c)
+		}
+		b = b[k:]
+	}
+	if n < 0 || n > len(b) {
+		return berElement{}, nil, errors.New("truncated BER element")
+	}
+	return berElement{tag: tag, data: b[:n]}, b[n:], nil
+}
+
+// children decodes the contents of constructed element
+func (e berElement) children() ([]berElement, error) {
+	var els []berElement
+	b := e.data
+	for len(b) > 0 {
+		el, rest, err := parseBER(b)
+		if err != nil {
+			return nil, err
+		}
+		els = append(els, el)
+		b = rest
+	}
+	return els, nil
+}
+
+func (e berElement) int() (int64, error) {
+	if len(e.data) == 0 || len(e.data) > 8 {
+		return 0, fmt.Errorf("invalid BER integer of %d bytes", len(e.data))
+	}
+	v := int64(int8(e.data[0]))
+	for _, b := range e.data[1:] {
+		v = v<<8 | int64(b)
+	}
+	return v, nil
+}
+
+func (e berElement) str() string {
+	return string(e.data)
+}
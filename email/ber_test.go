@@ -0,0 +1,174 @@
+package email
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestBERTLV(t *testing.T) {
+	tests := []struct {
+		name string
+		n    int
+		// header is the expected tag and length
+		header string
+	}{
+		{name: "empty", n: 0, header: "0400"},
+		{name: "short", n: 0x7f, header: "047f"},
+		{name: "one length byte", n: 0x80, header: "048180"},
+		{name: "two length bytes", n: 0x100, header: "04820100"},
+		{name: "three length bytes", n: 0x10000, header: "0483010000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := bytes.Repeat([]byte{'x'}, tt.n)
+			b := berTLV(berOctetString, data)
+			if got := hex.EncodeToString(b[:len(b)-tt.n]); got != tt.header {
+				t.Errorf("berTLV() header = %s, want %s", got, tt.header)
+			}
+
+			el, rest, err := parseBER(b)
+			if err != nil {
+				t.Fatalf("parseBER() error = %v", err)
+			}
+			if el.tag != berOctetString || !bytes.Equal(el.data, data) || len(rest) != 0 {
+				t.Errorf("parseBER() = tag 0x%02x, %d bytes, rest %d bytes", el.tag, len(el.data), len(rest))
+			}
+
+			el, err = readBER(bufio.NewReader(bytes.NewReader(b)))
+			if err != nil {
+				t.Fatalf("readBER() error = %v", err)
+			}
+			if el.tag != berOctetString || !bytes.Equal(el.data, data) {
+				t.Errorf("readBER() = tag 0x%02x, %d bytes", el.tag, len(el.data))
+			}
+		})
+	}
+}
+
+func TestBERInt(t *testing.T) {
+	tests := []struct {
+		v    int64
+		want string
+	}{
+		{v: 0, want: "020100"},
+		{v: 3, want: "020103"},
+		{v: 127, want: "02017f"},
+		{v: 128, want: "02020080"},
+		{v: 256, want: "02020100"},
+		{v: -1, want: "0201ff"},
+		{v: -128, want: "020180"},
+		{v: -129, want: "0202ff7f"},
+		{v: math.MaxInt32, want: "02047fffffff"},
+		{v: math.MinInt64, want: "02088000000000000000"},
+	}
+
+	for _, tt := range tests {
+		b := berInt(berInteger, tt.v)
+		if got := hex.EncodeToString(b); got != tt.want {
+			t.Errorf("berInt(%d) = %s, want %s", tt.v, got, tt.want)
+		}
+		el, _, err := parseBER(b)
+		if err != nil {
+			t.Fatalf("parseBER(%s) error = %v", tt.want, err)
+		}
+		if v, err := el.int(); err != nil || v != tt.v {
+			t.Errorf("int() of %s = %d, %v, want %d", tt.want, v, err, tt.v)
+		}
+	}
+
+	for _, data := range []string{"", "010203040506070809"} {
+		d, _ := hex.DecodeString(data)
+		if _, err := (berElement{tag: berInteger, data: d}).int(); err == nil {
+			t.Errorf("int() of %d bytes error = nil, want error", len(d))
+		}
+	}
+}
+
+func TestBERConstructed(t *testing.T) {
+	b := berConstructed(berSequence,
+		berInt(berInteger, 1),
+		berString(berOctetString, strings.Repeat("cn=Babs Jensen,", 10)),
+		berConstructed(berSet, berBool(true), berBool(false)),
+	)
+
+	el, rest, err := parseBER(append(b, 0x05, 0x00))
+	if err != nil {
+		t.Fatalf("parseBER() error = %v", err)
+	}
+	if el.tag != berSequence || hex.EncodeToString(rest) != "0500" {
+		t.Errorf("parseBER() = tag 0x%02x, rest %x", el.tag, rest)
+	}
+
+	children, err := el.children()
+	if err != nil {
+		t.Fatalf("children() error = %v", err)
+	}
+	if len(children) != 3 {
+		t.Fatalf("got %d children, want 3", len(children))
+	}
+	if v, _ := children[0].int(); v != 1 {
+		t.Errorf("first child = %d, want 1", v)
+	}
+	if s := children[1].str(); s != strings.Repeat("cn=Babs Jensen,", 10) {
+		t.Errorf("second child = %q", s)
+	}
+	set, err := children[2].children()
+	if err != nil || len(set) != 2 {
+		t.Fatalf("set children = %v, %v, want 2 booleans", set, err)
+	}
+	if hex.EncodeToString(set[0].data) != "ff" || hex.EncodeToString(set[1].data) != "00" {
+		t.Errorf("booleans = %x, %x, want ff, 00", set[0].data, set[1].data)
+	}
+}
+
+// TestBERTruncated checks that every prefix of valid element is rejected
+// instead of reading past the end
+func TestBERTruncated(t *testing.T) {
+	b := berConstructed(berSequence,
+		berInt(berInteger, 1000),
+		berString(berOctetString, strings.Repeat("a", 300)),
+	)
+
+	for i := 0; i < len(b); i++ {
+		if _, _, err := parseBER(b[:i]); err == nil {
+			t.Errorf("parseBER() of %d of %d bytes error = nil, want error", i, len(b))
+		}
+		if _, err := readBER(bufio.NewReader(bytes.NewReader(b[:i]))); err == nil {
+			t.Errorf("readBER() of %d of %d bytes error = nil, want error", i, len(b))
+		}
+	}
+
+	// element truncated inside of constructed one
+	el := berElement{tag: berSequence, data: b[4 : len(b)-1]}
+	if _, err := el.children(); err == nil {
+		t.Errorf("children() of truncated element error = nil, want error")
+	}
+}
+
+func TestBERInvalidLength(t *testing.T) {
+	tests := map[string]string{
+		"indefinite":      "3080",
+		"five bytes":      "04850000000001",
+		"too long":        "04847fffffff",
+		"overflowing int": "0484ffffffff",
+		"missing length":  "04",
+		"length past end": "0482ff",
+	}
+
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			b, _ := hex.DecodeString(data)
+			if _, _, err := parseBER(b); err == nil {
+				t.Errorf("parseBER(%s) error = nil, want error", data)
+			}
+			if _, err := readBER(bufio.NewReader(bytes.NewReader(b))); err == nil {
+				t.Errorf("readBER(%s) error = nil, want error", data)
+			}
+		})
+	}
+}
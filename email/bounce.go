@@ -0,0 +1,284 @@
+package email
+
+import (
+	"bufio"
+	"bytes"
+	"mime"
+	"net/mail"
+	"net/textproto"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Kinds of replies
+const (
+	// KindHardBounce is permanent delivery failure, e.g. unknown recipient
+	KindHardBounce = "hard bounce"
+	// KindSoftBounce is temporary failure or delay, e.g. full mailbox
+	KindSoftBounce = "soft bounce"
+	// KindAutoReply is automatic response, e.g. out of office message
+	KindAutoReply = "auto reply"
+	// KindReply is written by the recipient
+	KindReply = "reply"
+)
+
+// statusRe matches enhanced status code (RFC 3463), e.g. 5.1.1
+var statusRe = regexp.MustCompile(`\b([245]\.\d{1,3}\.\d{1,3})\b`)
+
+// messageIDRe matches Message-ID in text of bounces without the original headers
+var messageIDRe = regexp.MustCompile(`(?i)Message-ID:\s*(<[^>\s]+>)`)
+
+// bounceSenders are local parts bounces are sent from
+var bounceSenders = []string{"mailer-daemon", "postmaster"}
+
+// bounceSubjects are subjects of bounces which are not delivery status
+// notifications
+var bounceSubjects = []string{
+	"undeliverable", "undelivered", "delivery status notification", "delivery failure",
+	"delivery has failed", "failure notice", "returned mail", "mail delivery failed",
+	"mail delivery system", "could not be delivered",
+}
+
+// autoReplySubjects are prefixes of out of office and other automatic replies
+var autoReplySubjects = []string{
+	"automatic reply", "auto reply", "auto-reply", "autoreply", "auto:", "out of office",
+	"out of the office", "vacation", "abwesenheit", "absence",
+}
+
+// Reply is message received in response to a sent mail: its bounce, an
+// automatic reply or a reply of the recipient
+type Reply struct {
+	Kind string
+	// From is the sender and To the address the reply was sent to, e.g.
+	// VERP address of bounce
+	From    string
+	To      string
+	Date    time.Time
+	Subject string
+	// Recipients are the addresses the bounce reports
+	Recipients []string
+	// Status is the enhanced status code of bounce, e.g. 5.1.1, and
+	// Diagnostic the response of the remote server
+	Status     string
+	Diagnostic string
+	// References are Message-IDs of the original mail, from In-Reply-To and
+	// References of the reply or from the headers returned in bounce
+	References []string
+}
+
+// ClassifyReply tells bounces, automatic replies and replies apart. It
+// returns false for notifications of successful delivery and for read
+// receipts, which are parsed with ParseMDN.
+func ClassifyReply(msg *Message) (*Reply, bool) {
+	if _, ok := ParseMDN(msg); ok {
+		return nil, false
+	}
+
+	r := &Reply{Subject: msg.Header.Get("Subject")}
+	if subject, err := (&mime.WordDecoder{}).DecodeHeader(r.Subject); err == nil {
+		r.Subject = subject
+	}
+	if from, err := mail.ParseAddress(msg.Header.Get("From")); err == nil {
+		r.From = strings.ToLower(from.Address)
+	}
+	r.To = replyTo(msg.Header)
+	if date, err := msg.Header.Date(); err == nil {
+		r.Date = date
+	}
+
+	if report := findPart(msg, "message/delivery-status", "message/global-delivery-status"); report != nil {
+		if !r.parseDeliveryStatus(report.Body) {
+			return nil, false
+		}
+		r.References = originalMessageIDs(msg)
+		return r, true
+	}
+
+	if isBounce(r) {
+		r.Kind = KindHardBounce
+		text := bodyText(msg)
+		if m := statusRe.FindStringSubmatch(text); m != nil {
+			r.Status = m[1]
+			if strings.HasPrefix(r.Status, "4.") {
+				r.Kind = KindSoftBounce
+			}
+		}
+		r.References = originalMessageIDs(msg)
+		for _, m := range messageIDRe.FindAllStringSubmatch(text, -1) {
+			r.References = append(r.References, m[1])
+		}
+		return r, true
+	}
+
+	r.References = append(msgIDs(msg.Header.Get("In-Reply-To")), msgIDs(msg.Header.Get("References"))...)
+	if isAutoReply(msg.Header, r.Subject) {
+		r.Kind = KindAutoReply
+	} else {
+		r.Kind = KindReply
+	}
+	return r, true
+}
+
+// parseDeliveryStatus reads the recipients of delivery status notification
+// (RFC 3464) which failed or were delayed. It returns false if all of them
+// were delivered.
+func (r *Reply) parseDeliveryStatus(body []byte) bool {
+	// per message fields are followed by block of fields for every recipient
+	tp := textproto.NewReader(bufio.NewReader(bytes.NewReader(append(bytes.TrimSpace(body), "\r\n\r\n"...))))
+	if _, err := tp.ReadMIMEHeader(); err != nil {
+		return false
+	}
+
+	for {
+		fields, err := tp.ReadMIMEHeader()
+		if len(fields) == 0 {
+			break
+		}
+
+		action := strings.ToLower(strings.TrimSpace(fields.Get("Action")))
+		status := strings.TrimSpace(fields.Get("Status"))
+		if m := statusRe.FindStringSubmatch(status); m != nil {
+			status = m[1]
+		}
+
+		kind := ""
+		switch {
+		case action == "failed" && !strings.HasPrefix(status, "4."):
+			kind = KindHardBounce
+		case action == "failed" || action == "delayed":
+			kind = KindSoftBounce
+		}
+		if kind != "" {
+			// one hard bounce makes the whole report hard
+			if r.Kind != KindHardBounce {
+				r.Kind = kind
+				r.Status = status
+				r.Diagnostic = diagnostic(fields.Get("Diagnostic-Code"))
+			}
+			recipient := mdnAddress(fields.Get("Final-Recipient"))
+			if original := mdnAddress(fields.Get("Original-Recipient")); original != "" {
+				recipient = original
+			}
+			if recipient != "" {
+				r.Recipients = append(r.Recipients, recipient)
+			}
+		}
+
+		if err != nil {
+			break
+		}
+	}
+	return r.Kind != ""
+}
+
+// diagnostic returns the server response of "smtp; 550 5.1.1 User unknown"
+func diagnostic(field string) string {
+	if i := strings.IndexByte(field, ';'); i >= 0 {
+		field = field[i+1:]
+	}
+	return strings.Join(strings.Fields(field), " ")
+}
+
+// isBounce recognizes bounces which are not delivery status notifications
+// by the sender and subject
+func isBounce(r *Reply) bool {
+	local := r.From
+	if at := strings.LastIndexByte(local, '@'); at >= 0 {
+		local = local[:at]
+	}
+	for _, s := range bounceSenders {
+		if local == s {
+			return true
+		}
+	}
+	subject := strings.ToLower(r.Subject)
+	for _, s := range bounceSubjects {
+		if strings.Contains(subject, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// isAutoReply checks headers of automatic responses (RFC 3834) and the ones
+// Exchange and vacation programs add, and the usual subjects
+func isAutoReply(h mail.Header, subject string) bool {
+	if v := strings.ToLower(strings.TrimSpace(h.Get("Auto-Submitted"))); v != "" && v != "no" {
+		return true
+	}
+	if h.Get("X-Autoreply") != "" || h.Get("X-Autorespond") != "" {
+		return true
+	}
+	switch strings.ToLower(strings.TrimSpace(h.Get("Precedence"))) {
+	case "auto_reply", "bulk", "junk":
+		return true
+	}
+	subject = strings.ToLower(strings.TrimSpace(subject))
+	for _, s := range autoReplySubjects {
+		if strings.HasPrefix(subject, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// replyTo returns the address the reply was delivered to, the envelope
+// recipient if the server recorded it
+func replyTo(h mail.Header) string {
+	for _, name := range []string{"Delivered-To", "X-Original-To", "To"} {
+		if addr, err := mail.ParseAddress(h.Get(name)); err == nil {
+			return strings.ToLower(addr.Address)
+		}
+	}
+	return ""
+}
+
+// findPart returns the first part of one of the content types
+func findPart(msg *Message, contentTypes ...string) *Part {
+	var found *Part
+	msg.Root.Walk(func(p *Part, depth int) {
+		for _, ct := range contentTypes {
+			if found == nil && p.ContentType == ct {
+				found = p
+			}
+		}
+	})
+	return found
+}
+
+// originalMessageIDs returns Message-ID of the original message returned
+// in bounce
+func originalMessageIDs(msg *Message) []string {
+	part := findPart(msg, "text/rfc822-headers", "message/rfc822", "message/global-headers")
+	if part == nil {
+		return nil
+	}
+	tp := textproto.NewReader(bufio.NewReader(bytes.NewReader(append(bytes.TrimSpace(part.Body), "\r\n\r\n"...))))
+	h, _ := tp.ReadMIMEHeader()
+	return msgIDs(h.Get("Message-Id"))
+}
+
+// bodyText returns the plain text body, or HTML body if there is none
+func bodyText(msg *Message) string {
+	p := msg.Body("text/plain")
+	if p == nil {
+		p = msg.Body("text/html")
+	}
+	if p == nil {
+		return ""
+	}
+	text, _ := p.Text()
+	return text
+}
+
+// msgIDs returns the <id> tokens of In-Reply-To or References header
+func msgIDs(field string) []string {
+	var ids []string
+	for _, f := range strings.Fields(field) {
+		if strings.HasPrefix(f, "<") && strings.HasSuffix(f, ">") {
+			ids = append(ids, f)
+		}
+	}
+	return ids
+}
@@ -0,0 +1,213 @@
+package email
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DefaultDKIMHeaders are signed if they are present in the message
+var DefaultDKIMHeaders = []string{
+	"From", "Reply-To", "Subject", "Date", "To", "Cc", "Message-ID",
+	"MIME-Version", "Content-Type", "Content-Transfer-Encoding", "List-Id",
+}
+
+// DKIMSigner signs messages with DKIM (RFC 6376) using relaxed/relaxed
+// canonicalization, with rsa-sha256 or ed25519-sha256 (RFC 8463)
+type DKIMSigner struct {
+	Domain   string
+	Selector string
+	Key      crypto.Signer
+	// Headers to sign, DefaultDKIMHeaders if empty
+	Headers []string
+}
+
+// ParseDKIMKey parses PEM encoded RSA or Ed25519 private key
+func ParseDKIMKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("ParseDKIMKey: no PEM block found")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("ParseDKIMKey: %v", err)
+	}
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		return k, nil
+	case ed25519.PrivateKey:
+		return k, nil
+	default:
+		return nil, fmt.Errorf("ParseDKIMKey: unsupported key type %T", key)
+	}
+}
+
+// Sign returns msg with DKIM-Signature header prepended
+func (s *DKIMSigner) Sign(msg []byte) ([]byte, error) {
+	var algorithm string
+	var hash crypto.Hash
+	switch s.Key.(type) {
+	case *rsa.PrivateKey:
+		algorithm, hash = "rsa-sha256", crypto.SHA256
+	case ed25519.PrivateKey:
+		// Ed25519 signs the SHA-256 hash itself
+		algorithm, hash = "ed25519-sha256", crypto.Hash(0)
+	default:
+		return nil, fmt.Errorf("Sign: unsupported key type %T", s.Key)
+	}
+
+	msg = toCRLF(msg)
+	headerEnd := bytes.Index(msg, []byte("\r\n\r\n"))
+	if headerEnd < 0 {
+		return nil, errors.New("Sign: message has no body")
+	}
+	fields := splitHeader(string(msg[:headerEnd+2]))
+	body := msg[headerEnd+4:]
+
+	bodyHash := sha256.Sum256(relaxedBody(body))
+
+	names := s.Headers
+	if len(names) == 0 {
+		names = DefaultDKIMHeaders
+	}
+	// verifiers take repeated headers from the bottom
+	used := make([]bool, len(fields))
+	var signed []string
+	var canonical strings.Builder
+	for _, name := range names {
+		for i := len(fields) - 1; i >= 0; i-- {
+			if used[i] || !strings.EqualFold(fieldName(fields[i]), name) {
+				continue
+			}
+			used[i] = true
+			signed = append(signed, strings.ToLower(name))
+			canonical.WriteString(relaxedHeader(fields[i]))
+			break
+		}
+	}
+	if !contains(signed, "from") {
+		return nil, errors.New("Sign: message has no From header")
+	}
+
+	sig := fmt.Sprintf("DKIM-Signature: v=1; a=%s; c=relaxed/relaxed; d=%s; s=%s;\r\n\tt=%d; h=%s;\r\n\tbh=%s;\r\n\tb=",
+		algorithm, s.Domain, s.Selector, time.Now().Unix(), strings.Join(signed, ":"),
+		base64.StdEncoding.EncodeToString(bodyHash[:]))
+	// signature header is hashed without the trailing CRLF
+	canonical.WriteString(strings.TrimSuffix(relaxedHeader(sig+"\r\n"), "\r\n"))
+
+	digest := sha256.Sum256([]byte(canonical.String()))
+	b, err := s.Key.Sign(rand.Reader, digest[:], hash)
+	if err != nil {
+		return nil, fmt.Errorf("Sign: %v", err)
+	}
+
+	out := bytes.NewBufferString(sig)
+	out.WriteString(foldBase64(base64.StdEncoding.EncodeToString(b)))
+	out.WriteString("\r\n")
+	out.Write(msg)
+	return out.Bytes(), nil
+}
+
+// splitHeader returns header fields with their continuation lines, every
+// one ending with CRLF
+func splitHeader(header string) []string {
+	var fields []string
+	for _, line := range strings.SplitAfter(header, "\r\n") {
+		if line == "" {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(fields) > 0 {
+			fields[len(fields)-1] += line
+			continue
+		}
+		fields = append(fields, line)
+	}
+	return fields
+}
+
+func fieldName(field string) string {
+	i := strings.IndexByte(field, ':')
+	if i < 0 {
+		return ""
+	}
+	return strings.TrimSpace(field[:i])
+}
+
+// relaxedHeader canonicalizes header field: lowercase name, unfolded value
+// with whitespace runs reduced to single space
+func relaxedHeader(field string) string {
+	i := strings.IndexByte(field, ':')
+	if i < 0 {
+		return ""
+	}
+	name := strings.ToLower(strings.TrimSpace(field[:i]))
+	value := strings.NewReplacer("\r\n", "").Replace(field[i+1:])
+	return name + ":" + strings.TrimSpace(collapseWSP(value)) + "\r\n"
+}
+
+// relaxedBody canonicalizes the body: whitespace runs are reduced to single
+// space, trailing whitespace of lines and empty lines at the end are removed
+func relaxedBody(body []byte) []byte {
+	lines := strings.Split(string(body), "\r\n")
+	var out strings.Builder
+	blank := 0
+	for _, line := range lines {
+		line = strings.TrimRight(collapseWSP(line), " ")
+		if line == "" {
+			blank++
+			continue
+		}
+		out.WriteString(strings.Repeat("\r\n", blank))
+		blank = 0
+		out.WriteString(line)
+		out.WriteString("\r\n")
+	}
+	return []byte(out.String())
+}
+
+// collapseWSP reduces runs of spaces and tabs to single space
+func collapseWSP(s string) string {
+	var b strings.Builder
+	space := false
+	for i := 0; i < len(s); i++ {
+		if s[i] == ' ' || s[i] == '\t' {
+			space = true
+			continue
+		}
+		if space {
+			b.WriteByte(' ')
+			space = false
+		}
+		b.WriteByte(s[i])
+	}
+	if space {
+		b.WriteByte(' ')
+	}
+	return b.String()
+}
+
+// foldBase64 folds long signature into lines of the header
+func foldBase64(s string) string {
+	var b strings.Builder
+	for len(s) > 72 {
+		b.WriteString(s[:72])
+		b.WriteString("\r\n\t")
+		s = s[72:]
+	}
+	b.WriteString(s)
+	return b.String()
+}
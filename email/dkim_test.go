@@ -0,0 +1,234 @@
+package email
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"strings"
+	"testing"
+)
+
+// Test vector of RFC 8463 appendix A
+const (
+	rfc8463Seed   = "nWGxne/9WmC6hEr0kuwsxERJxWl7MmkZcDusAxyuf2A="
+	rfc8463Public = "11qYAYKxCrfVS/7TyWQHOg7hcvPapiMlrwIaaPcHURo="
+	rfc8463Msg    = "From: Joe SixPack <joe@football.example.com>\r\n" +
+		"To: Suzie Q <suzie@shopping.example.net>\r\n" +
+		"Subject: Is dinner ready?\r\n" +
+		"Date: Fri, 11 Jul 2003 21:00:37 -0700 (PDT)\r\n" +
+		"Message-ID: <20030712040037.46341.5F8J@football.example.com>\r\n" +
+		"\r\n" +
+		"Hi.\r\n" +
+		"\r\n" +
+		"We lost the game.  Are you hungry yet?\r\n" +
+		"\r\n" +
+		"Joe.\r\n"
+	rfc8463BodyHash = "2jUSOH9NhtVGCQWNr9BrIAPreKQjO6Sn7XIkfJVOzv8="
+	// rfc8463Headers are the headers of the message in the order of
+	// DefaultDKIMHeaders after relaxed canonicalization
+	rfc8463Headers = "from:Joe SixPack <joe@football.example.com>\r\n" +
+		"subject:Is dinner ready?\r\n" +
+		"date:Fri, 11 Jul 2003 21:00:37 -0700 (PDT)\r\n" +
+		"to:Suzie Q <suzie@shopping.example.net>\r\n" +
+		"message-id:<20030712040037.46341.5F8J@football.example.com>\r\n"
+)
+
+// dkimSignature splits signed message into the tags of DKIM-Signature and
+// the data its signature was computed over, given the canonicalized
+// headers of the message
+func dkimSignature(t *testing.T, signed []byte, headers string) (map[string]string, []byte) {
+	t.Helper()
+	out := string(signed)
+	if !strings.HasPrefix(out, "DKIM-Signature: ") {
+		t.Fatalf("signed message does not start with DKIM-Signature: %q", out)
+	}
+	// the header ends with the first line which is not continued
+	end := 0
+	for {
+		i := strings.Index(out[end:], "\r\n")
+		if i < 0 {
+			t.Fatalf("signed message has no header end: %q", out)
+		}
+		end += i
+		if out[end+2] != '\t' {
+			break
+		}
+		end += 2
+	}
+	value := strings.Replace(out[len("DKIM-Signature: "):end], "\r\n\t", " ", -1)
+
+	tags := make(map[string]string)
+	for _, tag := range strings.Split(value, ";") {
+		kv := strings.SplitN(strings.TrimSpace(tag), "=", 2)
+		if len(kv) != 2 {
+			t.Fatalf("invalid tag %q in %q", tag, value)
+		}
+		tags[kv[0]] = strings.Replace(kv[1], " ", "", -1)
+	}
+
+	b := strings.LastIndex(value, "b=")
+	data := headers + "dkim-signature:" + value[:b+len("b=")]
+	digest := sha256.Sum256([]byte(data))
+	return tags, digest[:]
+}
+
+func TestDKIMSignEd25519(t *testing.T) {
+	seed, _ := base64.StdEncoding.DecodeString(rfc8463Seed)
+	key := ed25519.NewKeyFromSeed(seed)
+	if got := base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey)); got != rfc8463Public {
+		t.Fatalf("public key = %s, want %s", got, rfc8463Public)
+	}
+
+	s := &DKIMSigner{Domain: "football.example.com", Selector: "brisbane", Key: key}
+	signed, err := s.Sign([]byte(rfc8463Msg))
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+	if !strings.HasSuffix(string(signed), "\r\n"+rfc8463Msg) {
+		t.Errorf("Sign() changed the message: %q", signed)
+	}
+
+	tags, digest := dkimSignature(t, signed, rfc8463Headers)
+	want := map[string]string{
+		"v":  "1",
+		"a":  "ed25519-sha256",
+		"c":  "relaxed/relaxed",
+		"d":  "football.example.com",
+		"s":  "brisbane",
+		"h":  "from:subject:date:to:message-id",
+		"bh": rfc8463BodyHash,
+	}
+	for tag, value := range want {
+		if tags[tag] != value {
+			t.Errorf("tag %s = %q, want %q", tag, tags[tag], value)
+		}
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(tags["b"])
+	if err != nil {
+		t.Fatalf("decoding signature %q: %v", tags["b"], err)
+	}
+	if !ed25519.Verify(key.Public().(ed25519.PublicKey), digest, sig) {
+		t.Errorf("signature does not verify with the public key")
+	}
+}
+
+func TestDKIMSignRSA(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// folded header, bare LF and repeated Subject of which the last one is signed
+	msg := "Subject: First\nFrom: Joe SixPack\n <joe@football.example.com>\nSubject:   Is   dinner\tready?  \n\nHi.  \n\n\n"
+	headers := "from:Joe SixPack <joe@football.example.com>\r\nsubject:Is dinner ready?\r\n"
+
+	s := &DKIMSigner{Domain: "football.example.com", Selector: "s1", Key: key, Headers: []string{"From", "Subject", "X-Missing"}}
+	signed, err := s.Sign([]byte(msg))
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+
+	tags, digest := dkimSignature(t, signed, headers)
+	if tags["a"] != "rsa-sha256" || tags["h"] != "from:subject" {
+		t.Errorf("tags = %v, want a=rsa-sha256 and h=from:subject", tags)
+	}
+	bodyHash := sha256.Sum256([]byte("Hi.\r\n"))
+	if want := base64.StdEncoding.EncodeToString(bodyHash[:]); tags["bh"] != want {
+		t.Errorf("bh = %s, want %s", tags["bh"], want)
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(tags["b"])
+	if err != nil {
+		t.Fatalf("decoding signature %q: %v", tags["b"], err)
+	}
+	if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA256, digest, sig); err != nil {
+		t.Errorf("signature does not verify with the public key: %v", err)
+	}
+}
+
+func TestDKIMSignErrors(t *testing.T) {
+	seed, _ := base64.StdEncoding.DecodeString(rfc8463Seed)
+	s := &DKIMSigner{Domain: "football.example.com", Selector: "brisbane", Key: ed25519.NewKeyFromSeed(seed)}
+
+	for name, msg := range map[string]string{
+		"no body": "From: joe@football.example.com\r\nSubject: Hi\r\n",
+		"no from": "To: suzie@shopping.example.net\r\n\r\nHi.\r\n",
+	} {
+		if _, err := s.Sign([]byte(msg)); err == nil {
+			t.Errorf("Sign() of message with %s error = nil, want error", name)
+		}
+	}
+}
+
+// Examples of RFC 6376 section 3.4.6
+func TestRelaxedCanonicalization(t *testing.T) {
+	header := "A: X\r\nB : Y\t\r\n\tZ  \r\n"
+	var got string
+	for _, f := range splitHeader(header) {
+		got += relaxedHeader(f)
+	}
+	if want := "a:X\r\nb:Y Z\r\n"; got != want {
+		t.Errorf("relaxed header = %q, want %q", got, want)
+	}
+
+	body := " C \r\nD \t E\r\n\r\n\r\n"
+	if got, want := string(relaxedBody([]byte(body))), " C\r\nD E\r\n"; got != want {
+		t.Errorf("relaxedBody() = %q, want %q", got, want)
+	}
+}
+
+func TestParseDKIMKey(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pkcs8 := func(key interface{}) []byte {
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	}
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr bool
+	}{
+		{name: "pkcs1 rsa", data: pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)})},
+		{name: "pkcs8 rsa", data: pkcs8(rsaKey)},
+		{name: "pkcs8 ed25519", data: pkcs8(edKey)},
+		{name: "ecdsa", data: pkcs8(ecKey), wantErr: true},
+		{name: "not pem", data: []byte("not a key"), wantErr: true},
+		{name: "invalid der", data: pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte{0x30, 0x01}}), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, err := ParseDKIMKey(tt.data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseDKIMKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && key == nil {
+				t.Errorf("ParseDKIMKey() returned nil key")
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package email
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// DSNNotify is the condition in which delivery status notification is sent
+type DSNNotify string
+
+const (
+	DSNNever   DSNNotify = "NEVER"
+	DSNSuccess DSNNotify = "SUCCESS"
+	DSNFailure DSNNotify = "FAILURE"
+	DSNDelay   DSNNotify = "DELAY"
+)
+
+// DSNReturn is the part of the message returned in the notification
+type DSNReturn string
+
+const (
+	DSNReturnHeaders DSNReturn = "HDRS"
+	DSNReturnFull    DSNReturn = "FULL"
+)
+
+// DSNOptions requests delivery status notifications (RFC 3461)
+type DSNOptions struct {
+	Notify []DSNNotify
+	Return DSNReturn
+	// EnvelopeID is returned in the notifications, e.g. campaign id
+	EnvelopeID string
+}
+
+// Validate checks that the options can be sent to the server
+func (o *DSNOptions) Validate() error {
+	for _, n := range o.Notify {
+		switch n {
+		case DSNSuccess, DSNFailure, DSNDelay:
+		case DSNNever:
+			if len(o.Notify) > 1 {
+				return errors.New("NEVER cannot be combined with other notify values")
+			}
+		default:
+			return fmt.Errorf("unknown notify value %q, expected SUCCESS, FAILURE, DELAY or NEVER", n)
+		}
+	}
+
+	switch o.Return {
+	case "", DSNReturnHeaders, DSNReturnFull:
+	default:
+		return fmt.Errorf("unknown return value %q, expected HDRS or FULL", o.Return)
+	}
+
+	return nil
+}
+
+// mailParams returns RET and ENVID parameters of MAIL FROM
+func (o *DSNOptions) mailParams() string {
+	if o == nil {
+		return ""
+	}
+	var params string
+	if o.Return != "" {
+		params += " RET=" + string(o.Return)
+	}
+	if o.EnvelopeID != "" {
+		params += " ENVID=" + xtext(o.EnvelopeID)
+	}
+	return params
+}
+
+// rcptParams returns NOTIFY parameter of RCPT TO
+func (o *DSNOptions) rcptParams() string {
+	if o == nil || len(o.Notify) == 0 {
+		return ""
+	}
+	notify := make([]string, len(o.Notify))
+	for i, n := range o.Notify {
+		notify[i] = string(n)
+	}
+	return " NOTIFY=" + strings.Join(notify, ",")
+}
+
+// xtext encodes s as described in RFC 3461 section 4
+func xtext(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < '!' || c > '~' || c == '+' || c == '=' {
+			fmt.Fprintf(&b, "+%02X", c)
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
@@ -0,0 +1,213 @@
+package email
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/http"
+	"net/mail"
+	"net/textproto"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Attachment struct holds a single file attached to the message
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// NewAttachment reads the file and detects its content type
+func NewAttachment(path string) (Attachment, error) {
+	d, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Attachment{}, fmt.Errorf("NewAttachment: %v", err)
+	}
+
+	return Attachment{
+		Filename:    filepath.Base(path),
+		ContentType: detectContentType(path, d),
+		Data:        d,
+	}, nil
+}
+
+func detectContentType(filename string, d []byte) string {
+	if ct := mime.TypeByExtension(strings.ToLower(filepath.Ext(filename))); ct != "" {
+		return ct
+	}
+	return http.DetectContentType(d)
+}
+
+// BuildMIMEMessage creates RFC 5322 message with multipart/mixed top level
+// part. It holds multipart/alternative part with text and HTML bodies,
+// followed by the attachments.
+func BuildMIMEMessage(from, to, subject, htmlBody, textBody string, attachments []Attachment) ([]byte, error) {
+	if _, err := mail.ParseAddress(from); err != nil {
+		return nil, fmt.Errorf("BuildMIMEMessage: invalid from address %q: %v", from, err)
+	}
+
+	if _, err := mail.ParseAddressList(to); err != nil {
+		return nil, fmt.Errorf("BuildMIMEMessage: invalid to address %q: %v", to, err)
+	}
+
+	if htmlBody == "" && textBody == "" {
+		return nil, errors.New("BuildMIMEMessage: message has no body")
+	}
+
+	var buf bytes.Buffer
+	mixed := multipart.NewWriter(&buf)
+
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", to)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", encodeHeader(subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/mixed;\r\n boundary=%q\r\n\r\n", mixed.Boundary())
+
+	if err := writeAlternative(mixed, htmlBody, textBody); err != nil {
+		return nil, fmt.Errorf("BuildMIMEMessage: %v", err)
+	}
+
+	for _, a := range attachments {
+		if err := writeAttachment(mixed, a); err != nil {
+			return nil, fmt.Errorf("BuildMIMEMessage: %v", err)
+		}
+	}
+
+	if err := mixed.Close(); err != nil {
+		return nil, fmt.Errorf("BuildMIMEMessage: %v", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// maxEncodedWord keeps "Subject: " followed by encoded word within 76
+// characters required by RFC 2047
+const maxEncodedWord = 66
+
+// encodeHeader returns non-ASCII header value as RFC 2047 Q encoded words,
+// one per line of the folded header
+func encodeHeader(s string) string {
+	if mime.QEncoding.Encode("utf-8", s) == s {
+		return s
+	}
+
+	var words []string
+	var word, chunk string
+	for _, r := range s {
+		next := qWord(chunk + string(r))
+		if len(next) > maxEncodedWord && chunk != "" {
+			words = append(words, word)
+			chunk, next = "", qWord(string(r))
+		}
+		chunk += string(r)
+		word = next
+	}
+	words = append(words, word)
+	return strings.Join(words, "\r\n ")
+}
+
+// qWord encodes s as single RFC 2047 Q encoded word
+func qWord(s string) string {
+	var b strings.Builder
+	b.WriteString("=?utf-8?q?")
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == ' ':
+			b.WriteByte('_')
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', strings.IndexByte("!*+-/", c) >= 0:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "=%02X", c)
+		}
+	}
+	b.WriteString("?=")
+	return b.String()
+}
+
+func writeAlternative(mixed *multipart.Writer, htmlBody, textBody string) error {
+	var buf bytes.Buffer
+	alt := multipart.NewWriter(&buf)
+
+	if textBody != "" {
+		if err := writeText(alt, "text/plain", textBody); err != nil {
+			return err
+		}
+	}
+
+	if htmlBody != "" {
+		if err := writeText(alt, "text/html", htmlBody); err != nil {
+			return err
+		}
+	}
+
+	if err := alt.Close(); err != nil {
+		return err
+	}
+
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Type", fmt.Sprintf("multipart/alternative; boundary=%q", alt.Boundary()))
+	w, err := mixed.CreatePart(h)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+func writeText(mw *multipart.Writer, contentType, body string) error {
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Type", contentType+"; charset=utf-8")
+	h.Set("Content-Transfer-Encoding", "quoted-printable")
+	w, err := mw.CreatePart(h)
+	if err != nil {
+		return err
+	}
+
+	qp := quotedprintable.NewWriter(w)
+	if _, err := io.WriteString(qp, body); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+func writeAttachment(mw *multipart.Writer, a Attachment) error {
+	contentType := a.ContentType
+	if contentType == "" {
+		contentType = detectContentType(a.Filename, a.Data)
+	}
+
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Type", mime.FormatMediaType(contentType, map[string]string{"name": a.Filename}))
+	h.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": a.Filename}))
+	h.Set("Content-Transfer-Encoding", "base64")
+	w, err := mw.CreatePart(h)
+	if err != nil {
+		return err
+	}
+
+	return writeBase64(w, a.Data)
+}
+
+// writeBase64 writes base64 encoded data wrapped into 76 characters long lines
+func writeBase64(w io.Writer, d []byte) error {
+	encoded := base64.StdEncoding.EncodeToString(d)
+	for len(encoded) > 76 {
+		if _, err := io.WriteString(w, encoded[:76]+"\r\n"); err != nil {
+			return err
+		}
+		encoded = encoded[76:]
+	}
+	_, err := io.WriteString(w, encoded+"\r\n")
+	return err
+}
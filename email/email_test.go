@@ -0,0 +1,356 @@
+package email
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// mimePart is a decoded leaf part of the message
+type mimePart struct {
+	contentType string
+	params      map[string]string
+	disposition string
+	filename    string
+	encoding    string
+	raw         []byte
+	data        []byte
+}
+
+// readMIMEMessage parses message built by BuildMIMEMessage and returns its
+// headers, the boundaries of the multipart parts and the leaf parts in order
+func readMIMEMessage(t *testing.T, msg []byte) (mail.Header, []string, []mimePart) {
+	t.Helper()
+	m, err := mail.ReadMessage(bytes.NewReader(msg))
+	if err != nil {
+		t.Fatalf("ReadMessage() error = %v", err)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(m.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/mixed" {
+		t.Fatalf("Content-Type = %q, %v, want multipart/mixed", m.Header.Get("Content-Type"), err)
+	}
+
+	boundaries := []string{params["boundary"]}
+	var parts []mimePart
+	var walk func(r io.Reader, boundary string)
+	walk = func(r io.Reader, boundary string) {
+		mr := multipart.NewReader(r, boundary)
+		for {
+			p, err := mr.NextRawPart()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				t.Fatalf("NextRawPart() error = %v", err)
+			}
+
+			mediaType, params, err := mime.ParseMediaType(p.Header.Get("Content-Type"))
+			if err != nil {
+				t.Fatalf("part Content-Type = %q: %v", p.Header.Get("Content-Type"), err)
+			}
+			if strings.HasPrefix(mediaType, "multipart/") {
+				boundaries = append(boundaries, params["boundary"])
+				walk(p, params["boundary"])
+				continue
+			}
+
+			raw, err := ioutil.ReadAll(p)
+			if err != nil {
+				t.Fatalf("reading %s part: %v", mediaType, err)
+			}
+			part := mimePart{
+				contentType: mediaType,
+				params:      params,
+				encoding:    p.Header.Get("Content-Transfer-Encoding"),
+				raw:         raw,
+			}
+			if d := p.Header.Get("Content-Disposition"); d != "" {
+				disposition, dparams, err := mime.ParseMediaType(d)
+				if err != nil {
+					t.Fatalf("Content-Disposition = %q: %v", d, err)
+				}
+				part.disposition, part.filename = disposition, dparams["filename"]
+			}
+
+			switch part.encoding {
+			case "quoted-printable":
+				part.data, err = ioutil.ReadAll(quotedprintable.NewReader(bytes.NewReader(raw)))
+			case "base64":
+				part.data, err = base64.StdEncoding.DecodeString(strings.Replace(string(raw), "\r\n", "", -1))
+			default:
+				t.Fatalf("%s part has Content-Transfer-Encoding %q", mediaType, part.encoding)
+			}
+			if err != nil {
+				t.Fatalf("decoding %s part: %v", mediaType, err)
+			}
+			parts = append(parts, part)
+		}
+	}
+	walk(m.Body, params["boundary"])
+
+	return m.Header, boundaries, parts
+}
+
+// checkLineLength fails if any line of s is longer than max characters
+func checkLineLength(t *testing.T, what, s string, max int) {
+	t.Helper()
+	for _, line := range strings.Split(s, "\r\n") {
+		if len(line) > max {
+			t.Errorf("%s has line of %d characters, want at most %d: %q", what, len(line), max, line)
+		}
+	}
+}
+
+func TestBuildMIMEMessage(t *testing.T) {
+	text := "Dear Jürgen,\n\nplease review the attached report " + strings.Repeat("before Friday ", 10) + "\n"
+	html := `<html><body><p style="color: red">Dear Jürgen, please review the attached report</p></body></html>`
+	pdf := bytes.Repeat([]byte("%PDF-1.4 \x00\xff"), 40)
+	png := []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+	msg, err := BuildMIMEMessage(
+		"IT Support <support@example.com>",
+		"John Doe <john@example.com>, jane@example.com",
+		"Quarterly report",
+		html, text,
+		[]Attachment{
+			{Filename: "Q3 report.pdf", ContentType: "application/pdf", Data: pdf},
+			{Filename: "logo.png", Data: png},
+		},
+	)
+	if err != nil {
+		t.Fatalf("BuildMIMEMessage() error = %v", err)
+	}
+	if bytes.Contains(bytes.Replace(msg, []byte("\r\n"), nil, -1), []byte("\n")) {
+		t.Errorf("message has bare LF line endings")
+	}
+
+	header, boundaries, parts := readMIMEMessage(t, msg)
+	for name, want := range map[string]string{
+		"From":         "IT Support <support@example.com>",
+		"To":           "John Doe <john@example.com>, jane@example.com",
+		"Subject":      "Quarterly report",
+		"Mime-Version": "1.0",
+	} {
+		if got := header.Get(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	if _, err := header.Date(); err != nil {
+		t.Errorf("Date = %q: %v", header.Get("Date"), err)
+	}
+
+	if len(boundaries) != 2 || boundaries[0] == boundaries[1] {
+		t.Errorf("boundaries = %q, want distinct mixed and alternative boundaries", boundaries)
+	}
+
+	if len(parts) != 4 {
+		t.Fatalf("got %d parts, want text, html and 2 attachments", len(parts))
+	}
+
+	for i, want := range []struct {
+		contentType string
+		body        string
+	}{
+		// line breaks of text are converted to CRLF of canonical form
+		{contentType: "text/plain", body: strings.Replace(text, "\n", "\r\n", -1)},
+		{contentType: "text/html", body: html},
+	} {
+		p := parts[i]
+		if p.contentType != want.contentType || p.params["charset"] != "utf-8" || p.encoding != "quoted-printable" {
+			t.Errorf("part %d = %s charset %q %s, want %s charset utf-8 quoted-printable",
+				i, p.contentType, p.params["charset"], p.encoding, want.contentType)
+		}
+		if string(p.data) != want.body {
+			t.Errorf("%s body = %q, want %q", p.contentType, p.data, want.body)
+		}
+		if p.disposition != "" {
+			t.Errorf("%s part has Content-Disposition %q", p.contentType, p.disposition)
+		}
+		checkLineLength(t, p.contentType+" part", string(p.raw), 76)
+	}
+
+	for i, want := range []struct {
+		filename    string
+		contentType string
+		data        []byte
+	}{
+		{filename: "Q3 report.pdf", contentType: "application/pdf", data: pdf},
+		{filename: "logo.png", contentType: "image/png", data: png},
+	} {
+		p := parts[2+i]
+		if p.contentType != want.contentType || p.params["name"] != want.filename {
+			t.Errorf("attachment %d Content-Type = %s name %q, want %s name %q",
+				i, p.contentType, p.params["name"], want.contentType, want.filename)
+		}
+		if p.disposition != "attachment" || p.filename != want.filename {
+			t.Errorf("attachment %d Content-Disposition = %s filename %q, want attachment filename %q",
+				i, p.disposition, p.filename, want.filename)
+		}
+		if p.encoding != "base64" || !bytes.Equal(p.data, want.data) {
+			t.Errorf("attachment %d = %s %q, want base64 of %q", i, p.encoding, p.data, want.data)
+		}
+		checkLineLength(t, want.filename, strings.TrimSuffix(string(p.raw), "\r\n"), 76)
+	}
+
+	// 400 bytes of PDF encode into 536 characters, 7 full lines and rest
+	if lines := strings.Count(string(parts[2].raw), "\r\n"); lines != 8 {
+		t.Errorf("PDF attachment has %d lines, want 8", lines)
+	}
+}
+
+func TestBuildMIMEMessageBodies(t *testing.T) {
+	tests := []struct {
+		name      string
+		html      string
+		text      string
+		wantTypes []string
+	}{
+		{name: "text only", text: "Hello", wantTypes: []string{"text/plain"}},
+		{name: "html only", html: "<p>Hello</p>", wantTypes: []string{"text/html"}},
+		{name: "both", html: "<p>Hello</p>", text: "Hello", wantTypes: []string{"text/plain", "text/html"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := BuildMIMEMessage("support@example.com", "john@example.com", "Hello", tt.html, tt.text, nil)
+			if err != nil {
+				t.Fatalf("BuildMIMEMessage() error = %v", err)
+			}
+
+			_, boundaries, parts := readMIMEMessage(t, msg)
+			if len(boundaries) != 2 {
+				t.Errorf("got %d multipart parts, want mixed and alternative", len(boundaries))
+			}
+			var types []string
+			for _, p := range parts {
+				types = append(types, p.contentType)
+			}
+			if strings.Join(types, ",") != strings.Join(tt.wantTypes, ",") {
+				t.Errorf("parts = %v, want %v", types, tt.wantTypes)
+			}
+		})
+	}
+}
+
+func TestBuildMIMEMessageSubject(t *testing.T) {
+	tests := []struct {
+		name    string
+		subject string
+		// wantLines is the number of lines of the Subject header
+		wantLines int
+	}{
+		{name: "ascii", subject: "Action required: password expiry", wantLines: 1},
+		{name: "short utf-8", subject: "Überprüfung", wantLines: 1},
+		{name: "long utf-8", subject: strings.Repeat("Überprüfung Ihres Kontos erforderlich ", 4), wantLines: 4},
+		{name: "long cyrillic", subject: strings.Repeat("Требуется проверка учётной записи ", 3), wantLines: 12},
+	}
+
+	dec := new(mime.WordDecoder)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msg, err := BuildMIMEMessage("support@example.com", "john@example.com", tt.subject, "", "Hello", nil)
+			if err != nil {
+				t.Fatalf("BuildMIMEMessage() error = %v", err)
+			}
+
+			end := bytes.Index(msg, []byte("\r\n\r\n"))
+			if end < 0 {
+				t.Fatalf("message has no header end: %q", msg)
+			}
+			headers := string(msg[:end])
+			checkLineLength(t, "header", headers, 78)
+
+			start := strings.Index(headers, "\r\nSubject: ") + 2
+			var lines []string
+			for _, line := range strings.Split(headers[start:], "\r\n") {
+				if len(lines) > 0 && !strings.HasPrefix(line, " ") {
+					break
+				}
+				lines = append(lines, line)
+			}
+			if len(lines) != tt.wantLines {
+				t.Errorf("Subject has %d lines, want %d: %q", len(lines), tt.wantLines, lines)
+			}
+
+			header, _, _ := readMIMEMessage(t, msg)
+			got, err := dec.DecodeHeader(header.Get("Subject"))
+			if err != nil {
+				t.Fatalf("DecodeHeader(%q) error = %v", header.Get("Subject"), err)
+			}
+			if got != tt.subject {
+				t.Errorf("Subject = %q, want %q", got, tt.subject)
+			}
+		})
+	}
+}
+
+func TestBuildMIMEMessageErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		from    string
+		to      string
+		text    string
+		wantErr string
+	}{
+		{name: "invalid from", from: "support", to: "john@example.com", text: "Hi", wantErr: "invalid from address"},
+		{name: "empty from", to: "john@example.com", text: "Hi", wantErr: "invalid from address"},
+		{name: "invalid to", from: "support@example.com", to: "john@example.com, jane", text: "Hi", wantErr: "invalid to address"},
+		{name: "no body", from: "support@example.com", to: "john@example.com", wantErr: "message has no body"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := BuildMIMEMessage(tt.from, tt.to, "Hi", "", tt.text, nil)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("BuildMIMEMessage() error = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewAttachment(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string][]byte{
+		"Notes.TXT": []byte("meeting notes"),
+		"scan":      []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"),
+	}
+	for name, d := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), d, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		file            string
+		wantContentType string
+	}{
+		{file: "Notes.TXT", wantContentType: "text/plain"},
+		{file: "scan", wantContentType: "image/png"},
+	}
+
+	for _, tt := range tests {
+		a, err := NewAttachment(filepath.Join(dir, tt.file))
+		if err != nil {
+			t.Fatalf("NewAttachment(%s) error = %v", tt.file, err)
+		}
+		if a.Filename != tt.file || !bytes.Equal(a.Data, files[tt.file]) {
+			t.Errorf("NewAttachment(%s) = %q with %q", tt.file, a.Filename, a.Data)
+		}
+		if mediaType, _, _ := mime.ParseMediaType(a.ContentType); mediaType != tt.wantContentType {
+			t.Errorf("NewAttachment(%s) ContentType = %q, want %s", tt.file, a.ContentType, tt.wantContentType)
+		}
+	}
+
+	if _, err := NewAttachment(filepath.Join(dir, "missing.pdf")); err == nil {
+		t.Errorf("NewAttachment() of missing file error = nil, want error")
+	}
+}
@@ -0,0 +1,259 @@
+package email
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// literalRe matches {123} announcing literal at the end of response line
+var literalRe = regexp.MustCompile(`\{(\d+)\+?\}$`)
+
+// fetchUIDRe matches UID item of FETCH response
+var fetchUIDRe = regexp.MustCompile(`\bUID (\d+)`)
+
+// IMAP is authenticated connection to IMAP server (RFC 3501). Only what is
+// needed to read messages from mailbox is supported.
+type IMAP struct {
+	conn    net.Conn
+	r       *bufio.Reader
+	timeout time.Duration
+	tag     int
+}
+
+// imapResponse is untagged response line, the literals it contained are
+// cut out of the text
+type imapResponse struct {
+	text     string
+	literals [][]byte
+}
+
+// DialIMAP connects to IMAP server with the same settings as Dial and logs
+// in. Port is usually 993 with EncryptionSSL and 143 otherwise.
+func (d *Dialer) DialIMAP() (*IMAP, error) {
+	conn, tlsConfig, timeout, err := d.connect()
+	if err != nil {
+		return nil, fmt.Errorf("DialIMAP: %w", err)
+	}
+
+	c := &IMAP{
+		conn:    conn,
+		r:       bufio.NewReader(conn),
+		timeout: timeout,
+	}
+
+	if err := c.handshake(d, tlsConfig); err != nil {
+		c.conn.Close()
+		return nil, fmt.Errorf("DialIMAP: %w", err)
+	}
+
+	return c, nil
+}
+
+func (c *IMAP) handshake(d *Dialer, tlsConfig *tls.Config) error {
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+	defer c.conn.SetDeadline(time.Time{})
+
+	greeting, err := c.r.ReadString('\n')
+	if err != nil {
+		return err
+	}
+	if strings.HasPrefix(greeting, "* PREAUTH") {
+		return nil
+	}
+	if !strings.HasPrefix(greeting, "* OK") {
+		return fmt.Errorf("unexpected greeting %q", strings.TrimSpace(greeting))
+	}
+
+	if d.Encryption == EncryptionSTARTTLS {
+		if _, err := c.cmd("STARTTLS"); err != nil {
+			return err
+		}
+		c.conn = tls.Client(c.conn, tlsConfig)
+		c.r = bufio.NewReader(c.conn)
+	}
+
+	if err := d.checkPlainAuth(); err != nil {
+		return err
+	}
+	if d.Token != nil {
+		token, err := d.Token()
+		if err != nil {
+			return err
+		}
+		resp := base64.StdEncoding.EncodeToString([]byte("user=" + d.Username + "\x01auth=Bearer " + token + "\x01\x01"))
+		_, err = c.cmd("AUTHENTICATE XOAUTH2 %s", resp)
+		return err
+	}
+
+	_, err = c.cmd("LOGIN %s %s", quote(d.Username), quote(d.Password))
+	return err
+}
+
+// cmd sends tagged command and reads the responses until its completion.
+// Continuation request is answered with empty line, which is what rejected
+// XOAUTH2 expects.
+func (c *IMAP) cmd(format string, args ...interface{}) ([]imapResponse, error) {
+	c.tag++
+	tag := "a" + strconv.Itoa(c.tag)
+	if _, err := fmt.Fprintf(c.conn, tag+" "+format+"\r\n", args...); err != nil {
+		return nil, err
+	}
+
+	var responses []imapResponse
+	for {
+		resp, err := c.readResponse()
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case strings.HasPrefix(resp.text, "+"):
+			if _, err := io.WriteString(c.conn, "\r\n"); err != nil {
+				return nil, err
+			}
+		case strings.HasPrefix(resp.text, "* "):
+			resp.text = resp.text[2:]
+			responses = append(responses, resp)
+		case strings.HasPrefix(resp.text, tag+" "):
+			status := strings.TrimPrefix(resp.text, tag+" ")
+			if !strings.HasPrefix(status, "OK") {
+				return nil, fmt.Errorf("%s failed: %s", strings.Fields(format)[0], status)
+			}
+			return responses, nil
+		}
+	}
+}
+
+// readResponse reads response line together with the literals in it
+func (c *IMAP) readResponse() (imapResponse, error) {
+	var resp imapResponse
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return resp, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		m := literalRe.FindStringSubmatch(line)
+		if m == nil {
+			resp.text += line
+			return resp, nil
+		}
+		resp.text += line[:len(line)-len(m[0])]
+
+		n, err := strconv.Atoi(m[1])
+		if err != nil {
+			return resp, err
+		}
+		literal := make([]byte, n)
+		if _, err := io.ReadFull(c.r, literal); err != nil {
+			return resp, err
+		}
+		resp.literals = append(resp.literals, literal)
+	}
+}
+
+// Examine opens mailbox read-only, so that fetched messages are not marked
+// as seen
+func (c *IMAP) Examine(mailbox string) error {
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+	defer c.conn.SetDeadline(time.Time{})
+
+	if _, err := c.cmd("EXAMINE %s", quote(mailbox)); err != nil {
+		return fmt.Errorf("Examine: %v", err)
+	}
+	return nil
+}
+
+// SearchSince returns UIDs of messages received on the day of since or later
+func (c *IMAP) SearchSince(since time.Time) ([]uint32, error) {
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+	defer c.conn.SetDeadline(time.Time{})
+
+	responses, err := c.cmd("UID SEARCH SINCE %s", since.Format("2-Jan-2006"))
+	if err != nil {
+		return nil, fmt.Errorf("SearchSince: %v", err)
+	}
+
+	var uids []uint32
+	for _, resp := range responses {
+		fields := strings.Fields(resp.text)
+		if len(fields) == 0 || !strings.EqualFold(fields[0], "SEARCH") {
+			continue
+		}
+		for _, f := range fields[1:] {
+			uid, err := strconv.ParseUint(f, 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("SearchSince: invalid UID %q", f)
+			}
+			uids = append(uids, uint32(uid))
+		}
+	}
+	sort.Slice(uids, func(i, j int) bool { return uids[i] < uids[j] })
+	return uids, nil
+}
+
+// Fetch returns raw messages of the UIDs
+func (c *IMAP) Fetch(uids []uint32) (map[uint32][]byte, error) {
+	messages := make(map[uint32][]byte, len(uids))
+	if len(uids) == 0 {
+		return messages, nil
+	}
+
+	set := make([]string, len(uids))
+	for i, uid := range uids {
+		set[i] = strconv.FormatUint(uint64(uid), 10)
+	}
+
+	// messages can be large, the timeout applies to every one of them
+	c.conn.SetDeadline(time.Now().Add(c.timeout * time.Duration(len(uids))))
+	defer c.conn.SetDeadline(time.Time{})
+
+	responses, err := c.cmd("UID FETCH %s (UID BODY.PEEK[])", strings.Join(set, ","))
+	if err != nil {
+		return nil, fmt.Errorf("Fetch: %v", err)
+	}
+
+	for _, resp := range responses {
+		m := fetchUIDRe.FindStringSubmatch(resp.text)
+		if m == nil || len(resp.literals) == 0 {
+			continue
+		}
+		uid, err := strconv.ParseUint(m[1], 10, 32)
+		if err != nil {
+			continue
+		}
+		messages[uint32(uid)] = resp.literals[0]
+	}
+	return messages, nil
+}
+
+// Logout ends the session and closes the connection
+func (c *IMAP) Logout() error {
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+	_, err := c.cmd("LOGOUT")
+	c.conn.Close()
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("Logout: %v", err)
+	}
+	return nil
+}
+
+// Close closes the connection without logging out
+func (c *IMAP) Close() error {
+	return c.conn.Close()
+}
+
+// quote returns s as IMAP quoted string
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,381 @@
+package email
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeIMAP is IMAP server at the other end of net.Pipe. respond returns the
+// untagged responses, written as they are, and the status of command,
+// everything is OK if it is nil. Untagged response starting with + is
+// continuation request and the line answering it is recorded with the
+// commands.
+type fakeIMAP struct {
+	greeting string
+	respond  func(cmd string) (untagged, status string)
+
+	// cmds are the received commands without tags
+	cmds []string
+	done chan struct{}
+}
+
+func (s *fakeIMAP) serve(conn net.Conn) {
+	defer close(s.done)
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	if _, err := io.WriteString(conn, s.greeting+"\r\n"); err != nil {
+		return
+	}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		parts := strings.SplitN(strings.TrimRight(line, "\r\n"), " ", 2)
+		if len(parts) != 2 {
+			return
+		}
+		tag, cmd := parts[0], parts[1]
+		s.cmds = append(s.cmds, cmd)
+
+		untagged, status := "", "OK completed"
+		if s.respond != nil {
+			untagged, status = s.respond(cmd)
+		}
+		if strings.HasPrefix(untagged, "+") {
+			if _, err := io.WriteString(conn, untagged+"\r\n"); err != nil {
+				return
+			}
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			s.cmds = append(s.cmds, strings.TrimRight(line, "\r\n"))
+			untagged = ""
+		}
+		if _, err := io.WriteString(conn, untagged+tag+" "+status+"\r\n"); err != nil {
+			return
+		}
+		if cmd == "LOGOUT" {
+			return
+		}
+	}
+}
+
+// dialFakeIMAP runs the handshake of DialIMAP against s
+func dialFakeIMAP(t *testing.T, s *fakeIMAP, d *Dialer) (*IMAP, error) {
+	t.Helper()
+	if s.greeting == "" {
+		s.greeting = "* OK [CAPABILITY IMAP4rev1 AUTH=PLAIN AUTH=XOAUTH2] ready"
+	}
+	client, server := net.Pipe()
+	s.done = make(chan struct{})
+	go s.serve(server)
+
+	c := &IMAP{
+		conn:    client,
+		r:       bufio.NewReader(client),
+		timeout: 5 * time.Second,
+	}
+	if err := c.handshake(d, &tls.Config{}); err != nil {
+		client.Close()
+		<-s.done
+		return nil, err
+	}
+	t.Cleanup(func() {
+		c.Close()
+		<-s.done
+	})
+	return c, nil
+}
+
+func TestIMAPLogin(t *testing.T) {
+	xoauth2 := func(token string) string {
+		return "AUTHENTICATE XOAUTH2 " + base64.StdEncoding.EncodeToString([]byte("user=user@example.com\x01auth=Bearer "+token+"\x01\x01"))
+	}
+	token := func(token string) func() (string, error) {
+		return func() (string, error) { return token, nil }
+	}
+
+	tests := []struct {
+		name     string
+		greeting string
+		dialer   Dialer
+		respond  func(cmd string) (string, string)
+		wantErr  string
+		cmds     []string
+	}{
+		{
+			name:   "login",
+			dialer: Dialer{Username: `user\"name`, Password: `pa"ss`, Encryption: EncryptionSSL},
+			cmds:   []string{`LOGIN "user\\\"name" "pa\"ss"`},
+		},
+		{
+			name:     "preauthenticated",
+			greeting: "* PREAUTH IMAP4rev1 server logged in as Smith",
+			dialer:   Dialer{Username: "user@example.com", Password: "secret", Encryption: EncryptionSSL},
+		},
+		{
+			name:     "bye greeting",
+			greeting: "* BYE Autologout; idle for too long",
+			dialer:   Dialer{Username: "user@example.com", Password: "secret", Encryption: EncryptionSSL},
+			wantErr:  "unexpected greeting",
+		},
+		{
+			name:   "rejected login",
+			dialer: Dialer{Username: "user@example.com", Password: "wrong", Encryption: EncryptionSSL},
+			respond: func(string) (string, string) {
+				return "", "NO [AUTHENTICATIONFAILED] Invalid credentials (Failure)"
+			},
+			wantErr: "LOGIN failed: NO [AUTHENTICATIONFAILED] Invalid credentials (Failure)",
+			cmds:    []string{`LOGIN "user@example.com" "wrong"`},
+		},
+		{
+			name:    "plain text refused",
+			dialer:  Dialer{Username: "user@example.com", Password: "secret"},
+			wantErr: ErrPlainAuth.Error(),
+		},
+		{
+			name:   "plain text allowed",
+			dialer: Dialer{Username: "user@example.com", Password: "secret", PlainAuth: true},
+			cmds:   []string{`LOGIN "user@example.com" "secret"`},
+		},
+		{
+			name:   "xoauth2",
+			dialer: Dialer{Username: "user@example.com", Token: token("ya29.valid"), Encryption: EncryptionSSL},
+			cmds:   []string{xoauth2("ya29.valid")},
+		},
+		{
+			name:   "rejected xoauth2",
+			dialer: Dialer{Username: "user@example.com", Token: token("expired"), Encryption: EncryptionSSL},
+			respond: func(string) (string, string) {
+				return "+ " + base64.StdEncoding.EncodeToString([]byte(`{"status":"400","schemes":"Bearer"}`)), "NO [AUTHENTICATIONFAILED] Invalid credentials (Failure)"
+			},
+			wantErr: "AUTHENTICATE failed: NO [AUTHENTICATIONFAILED]",
+			// continuation is answered with empty line
+			cmds: []string{xoauth2("expired"), ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &fakeIMAP{greeting: tt.greeting, respond: tt.respond}
+			c, err := dialFakeIMAP(t, s, &tt.dialer)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("handshake() error = %v, want error containing %q", err, tt.wantErr)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("handshake() error = %v", err)
+				}
+				c.Close()
+				<-s.done
+			}
+
+			if fmt.Sprint(s.cmds) != fmt.Sprint(tt.cmds) {
+				t.Errorf("server got %q, want %q", s.cmds, tt.cmds)
+			}
+		})
+	}
+}
+
+func TestIMAPSearchSince(t *testing.T) {
+	s := &fakeIMAP{respond: func(cmd string) (string, string) {
+		switch {
+		case strings.HasPrefix(cmd, "EXAMINE"):
+			return "* 172 EXISTS\r\n* 1 RECENT\r\n* OK [UIDVALIDITY 3857529045] UIDs valid\r\n* FLAGS (\\Answered \\Flagged \\Deleted \\Seen \\Draft)\r\n", "OK [READ-ONLY] EXAMINE completed"
+		case strings.HasPrefix(cmd, "UID SEARCH SINCE 1-Feb"):
+			return "* SEARCH\r\n", "OK SEARCH completed"
+		case strings.HasPrefix(cmd, "UID SEARCH"):
+			return "* SEARCH 12 5 9\r\n* 173 EXISTS\r\n* SEARCH 7\r\n", "OK SEARCH completed"
+		}
+		return "", "OK completed"
+	}}
+	c, err := dialFakeIMAP(t, s, &Dialer{Username: "user@example.com", Password: "secret", Encryption: EncryptionSSL})
+	if err != nil {
+		t.Fatalf("handshake() error = %v", err)
+	}
+
+	if err := c.Examine(`Sent "Items"`); err != nil {
+		t.Fatalf("Examine() error = %v", err)
+	}
+	uids, err := c.SearchSince(time.Date(2021, time.January, 5, 13, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("SearchSince() error = %v", err)
+	}
+	if want := []uint32{5, 7, 9, 12}; !reflect.DeepEqual(uids, want) {
+		t.Errorf("SearchSince() = %v, want %v", uids, want)
+	}
+	uids, err = c.SearchSince(time.Date(2021, time.February, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil || len(uids) != 0 {
+		t.Errorf("SearchSince() = %v, %v, want no UIDs", uids, err)
+	}
+	if err := c.Logout(); err != nil {
+		t.Errorf("Logout() error = %v", err)
+	}
+	<-s.done
+
+	want := []string{
+		`LOGIN "user@example.com" "secret"`,
+		`EXAMINE "Sent \"Items\""`,
+		"UID SEARCH SINCE 5-Jan-2021",
+		"UID SEARCH SINCE 1-Feb-2021",
+		"LOGOUT",
+	}
+	if fmt.Sprint(s.cmds) != fmt.Sprint(want) {
+		t.Errorf("server got %q, want %q", s.cmds, want)
+	}
+}
+
+func TestIMAPErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		call    func(c *IMAP) error
+		respond func(cmd string) (string, string)
+		wantErr string
+	}{
+		{
+			name: "examine missing mailbox",
+			call: func(c *IMAP) error { return c.Examine("Missing") },
+			respond: func(string) (string, string) {
+				return "", "NO [NONEXISTENT] Unknown Mailbox: Missing (Failure)"
+			},
+			wantErr: "Examine: EXAMINE failed: NO [NONEXISTENT] Unknown Mailbox",
+		},
+		{
+			name: "bad search",
+			call: func(c *IMAP) error {
+				_, err := c.SearchSince(time.Now())
+				return err
+			},
+			respond: func(string) (string, string) {
+				return "", "BAD Could not parse command"
+			},
+			wantErr: "SearchSince: UID failed: BAD Could not parse command",
+		},
+		{
+			name: "invalid uid",
+			call: func(c *IMAP) error {
+				_, err := c.SearchSince(time.Now())
+				return err
+			},
+			respond: func(string) (string, string) {
+				return "* SEARCH 1 two\r\n", "OK SEARCH completed"
+			},
+			wantErr: `invalid UID "two"`,
+		},
+		{
+			name: "fetch rejected",
+			call: func(c *IMAP) error {
+				_, err := c.Fetch([]uint32{1})
+				return err
+			},
+			respond: func(string) (string, string) {
+				return "* BYE server shutting down\r\n", "NO server is going away"
+			},
+			wantErr: "Fetch: UID failed: NO server is going away",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &fakeIMAP{greeting: "* PREAUTH ready", respond: tt.respond}
+			c, err := dialFakeIMAP(t, s, &Dialer{})
+			if err != nil {
+				t.Fatalf("handshake() error = %v", err)
+			}
+			if err := tt.call(c); err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestIMAPFetch(t *testing.T) {
+	msg1 := "Subject: Re: Invoice\r\n\r\nSee {5}\r\n)\r\n* 9 FETCH (UID 1 BODY[] {3}\r\n"
+	msg2 := "Subject: Out of office\r\n\r\nBack on Monday.\r\n"
+
+	s := &fakeIMAP{greeting: "* PREAUTH ready", respond: func(cmd string) (string, string) {
+		untagged := fmt.Sprintf("* 1 FETCH (UID 42 BODY[] {%d}\r\n%s)\r\n", len(msg1), msg1) +
+			"* 2 FETCH (FLAGS (\\Seen))\r\n" +
+			fmt.Sprintf("* 3 FETCH (BODY[] {%d+}\r\n%s UID 43)\r\n", len(msg2), msg2) +
+			"* OK [ALERT] mailbox is almost full\r\n"
+		return untagged, "OK FETCH completed"
+	}}
+	c, err := dialFakeIMAP(t, s, &Dialer{})
+	if err != nil {
+		t.Fatalf("handshake() error = %v", err)
+	}
+
+	messages, err := c.Fetch([]uint32{42, 43, 44})
+	if err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	want := map[uint32][]byte{42: []byte(msg1), 43: []byte(msg2)}
+	if !reflect.DeepEqual(messages, want) {
+		t.Errorf("Fetch() = %q, want %q", messages, want)
+	}
+
+	if messages, err := c.Fetch(nil); err != nil || len(messages) != 0 {
+		t.Errorf("Fetch(nil) = %v, %v, want no messages", messages, err)
+	}
+	c.Close()
+	<-s.done
+
+	if want := []string{"UID FETCH 42,43,44 (UID BODY.PEEK[])"}; fmt.Sprint(s.cmds) != fmt.Sprint(want) {
+		t.Errorf("server got %q, want %q", s.cmds, want)
+	}
+}
+
+func TestIMAPTruncatedLiteral(t *testing.T) {
+	// literal announces more than the server sends
+	s := &fakeIMAP{greeting: "* PREAUTH ready", respond: func(string) (string, string) {
+		return "* 1 FETCH (UID 42 BODY[] {100}\r\nSubject: cut", ""
+	}}
+	c, err := dialFakeIMAP(t, s, &Dialer{})
+	if err != nil {
+		t.Fatalf("handshake() error = %v", err)
+	}
+	c.timeout = 100 * time.Millisecond
+
+	if _, err := c.Fetch([]uint32{42}); err == nil {
+		t.Fatal("Fetch() error = nil, want error")
+	}
+}
+
+func TestIMAPLogoutBye(t *testing.T) {
+	s := &fakeIMAP{greeting: "* PREAUTH ready", respond: func(string) (string, string) {
+		return "* BYE logging out\r\n", "OK LOGOUT completed"
+	}}
+	c, err := dialFakeIMAP(t, s, &Dialer{})
+	if err != nil {
+		t.Fatalf("handshake() error = %v", err)
+	}
+	if err := c.Logout(); err != nil {
+		t.Errorf("Logout() error = %v", err)
+	}
+}
+
+func TestQuote(t *testing.T) {
+	tests := map[string]string{
+		"INBOX":        `"INBOX"`,
+		`Sent "Items"`: `"Sent \"Items\""`,
+		`a\b`:          `"a\\b"`,
+		"":             `""`,
+	}
+	for in, want := range tests {
+		if got := quote(in); got != want {
+			t.Errorf("quote(%q) = %s, want %s", in, got, want)
+		}
+	}
+}
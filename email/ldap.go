@@ -0,0 +1,571 @@
+package email
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// LDAP protocol operations and controls (RFC 4511)
+const (
+	ldapBindRequest           = 0x60
+	ldapBindResponse          = 0x61
+	ldapUnbindRequest         = 0x42
+	ldapSearchRequest         = 0x63
+	ldapSearchResultEntry     = 0x64
+	ldapSearchResultDone      = 0x65
+	ldapSearchResultReference = 0x73
+	ldapExtendedRequest       = 0x77
+	ldapExtendedResponse      = 0x78
+	ldapControls              = 0xa0
+
+	ldapStartTLSOID     = "1.3.6.1.4.1.1466.20037"
+	ldapPagedResultsOID = "1.2.840.113556.1.4.319"
+)
+
+// ldapResultNames are the result codes which are worth explaining
+var ldapResultNames = map[int64]string{
+	4:  "size limit exceeded",
+	8:  "stronger authentication required",
+	32: "no such object",
+	34: "invalid DN syntax",
+	49: "invalid credentials",
+	50: "insufficient access rights",
+	53: "unwilling to perform",
+}
+
+// LDAP is bound connection to LDAP directory (RFC 4511), e.g. Active
+// Directory. Only what is needed to search for users is supported.
+type LDAP struct {
+	conn    net.Conn
+	r       *bufio.Reader
+	timeout time.Duration
+	msgID   int64
+}
+
+// LDAPEntry is object found by Search
+type LDAPEntry struct {
+	DN string
+	// Attributes are keyed by the names the server returned
+	Attributes map[string][]string
+}
+
+// Get returns the first value of attribute, its name is matched in any case
+func (e LDAPEntry) Get(attribute string) string {
+	for name, values := range e.Attributes {
+		if strings.EqualFold(name, attribute) && len(values) > 0 {
+			return values[0]
+		}
+	}
+	return ""
+}
+
+// LDAPError is result of operation other than success
+type LDAPError struct {
+	Code    int64
+	Message string
+}
+
+func (e *LDAPError) Error() string {
+	msg := fmt.Sprintf("LDAP result %d", e.Code)
+	if name, ok := ldapResultNames[e.Code]; ok {
+		msg += " (" + name + ")"
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	return msg
+}
+
+// ldapMessage is decoded LDAPMessage
+type ldapMessage struct {
+	op       berElement
+	controls []berElement
+}
+
+// DialLDAP connects to LDAP server with the same settings as Dial and binds
+// as Username, DN or e.g. user@example.com with Active Directory, with
+// Password. The bind is anonymous without Username. Port is usually 636
+// with EncryptionSSL and 389 otherwise.
+func (d *Dialer) DialLDAP() (*LDAP, error) {
+	conn, tlsConfig, timeout, err := d.connect()
+	if err != nil {
+		return nil, fmt.Errorf("DialLDAP: %w", err)
+	}
+
+	c := &LDAP{
+		conn:    conn,
+		r:       bufio.NewReader(conn),
+		timeout: timeout,
+	}
+
+	if err := c.handshake(d, tlsConfig); err != nil {
+		c.conn.Close()
+		return nil, fmt.Errorf("DialLDAP: %w", err)
+	}
+
+	return c, nil
+}
+
+func (c *LDAP) handshake(d *Dialer, tlsConfig *tls.Config) error {
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+	defer c.conn.SetDeadline(time.Time{})
+
+	if d.Encryption == EncryptionSTARTTLS {
+		resp, err := c.request(berConstructed(ldapExtendedRequest, berString(0x80, ldapStartTLSOID)), nil)
+		if err != nil {
+			return err
+		}
+		if resp.op.tag != ldapExtendedResponse {
+			return fmt.Errorf("unexpected response 0x%02x to StartTLS", resp.op.tag)
+		}
+		if err := ldapResult(resp.op); err != nil {
+			return fmt.Errorf("StartTLS: %w", err)
+		}
+		c.conn = tls.Client(c.conn, tlsConfig)
+		c.r = bufio.NewReader(c.conn)
+	}
+
+	if d.Username == "" {
+		return nil
+	}
+	// bind with empty password is unauthenticated, servers accept it
+	// without checking anything (RFC 4513)
+	if d.Password == "" {
+		return errors.New("password of bind is empty")
+	}
+	if err := d.checkPlainAuth(); err != nil {
+		return err
+	}
+	resp, err := c.request(berConstructed(ldapBindRequest,
+		berInt(berInteger, 3),
+		berString(berOctetString, d.Username),
+		berString(0x80, d.Password),
+	), nil)
+	if err != nil {
+		return err
+	}
+	if resp.op.tag != ldapBindResponse {
+		return fmt.Errorf("unexpected response 0x%02x to bind", resp.op.tag)
+	}
+	return ldapResult(resp.op)
+}
+
+// Search returns the objects under baseDN matching filter (RFC 4515), e.g.
+// (&(objectClass=user)(mail=*)), with the attributes. With pageSize the
+// objects are fetched in pages, Active Directory returns at most 1000
+// objects otherwise.
+func (c *LDAP) Search(baseDN, filter string, attributes []string, pageSize int) ([]LDAPEntry, error) {
+	f, err := ldapFilter(filter)
+	if err != nil {
+		return nil, fmt.Errorf("Search: %v", err)
+	}
+	var attrs [][]byte
+	for _, a := range attributes {
+		attrs = append(attrs, berString(berOctetString, a))
+	}
+	op := berConstructed(ldapSearchRequest,
+		berString(berOctetString, baseDN),
+		berInt(berEnumerated, 2), // whole subtree
+		berInt(berEnumerated, 0), // never dereference aliases
+		berInt(berInteger, 0),
+		berInt(berInteger, 0),
+		berBool(false),
+		f,
+		berConstructed(berSequence, attrs...),
+	)
+
+	var entries []LDAPEntry
+	var cookie []byte
+	for {
+		var controls []byte
+		if pageSize > 0 {
+			value := berConstructed(berSequence, berInt(berInteger, int64(pageSize)), berTLV(berOctetString, cookie))
+			controls = berConstructed(ldapControls, berConstructed(berSequence,
+				berString(berOctetString, ldapPagedResultsOID),
+				berTLV(berOctetString, value),
+			))
+		}
+
+		page, done, err := c.searchPage(op, controls)
+		entries = append(entries, page...)
+		if err != nil {
+			return entries, fmt.Errorf("Search: %w", err)
+		}
+		if cookie = pagedCookie(done.controls); len(cookie) == 0 {
+			return entries, nil
+		}
+	}
+}
+
+// searchPage sends search request and reads the entries until it is done,
+// referrals to other servers are skipped
+func (c *LDAP) searchPage(op, controls []byte) ([]LDAPEntry, ldapMessage, error) {
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+	defer c.conn.SetDeadline(time.Time{})
+
+	id, err := c.send(op, controls)
+	if err != nil {
+		return nil, ldapMessage{}, err
+	}
+
+	var entries []LDAPEntry
+	for {
+		m, err := c.read(id)
+		if err != nil {
+			return entries, ldapMessage{}, err
+		}
+		switch m.op.tag {
+		case ldapSearchResultEntry:
+			e, err := parseLDAPEntry(m.op)
+			if err != nil {
+				return entries, ldapMessage{}, err
+			}
+			entries = append(entries, e)
+			// large directories take longer than timeout to return
+			c.conn.SetDeadline(time.Now().Add(c.timeout))
+		case ldapSearchResultReference:
+		case ldapSearchResultDone:
+			return entries, m, ldapResult(m.op)
+		default:
+			return entries, ldapMessage{}, fmt.Errorf("unexpected response 0x%02x to search", m.op.tag)
+		}
+	}
+}
+
+// Close unbinds and closes the connection
+func (c *LDAP) Close() error {
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+	c.send(berTLV(ldapUnbindRequest, nil), nil)
+	return c.conn.Close()
+}
+
+// request sends operation and reads its response
+func (c *LDAP) request(op, controls []byte) (ldapMessage, error) {
+	id, err := c.send(op, controls)
+	if err != nil {
+		return ldapMessage{}, err
+	}
+	return c.read(id)
+}
+
+func (c *LDAP) send(op, controls []byte) (int64, error) {
+	c.msgID++
+	msg := [][]byte{berInt(berInteger, c.msgID), op}
+	if controls != nil {
+		msg = append(msg, controls)
+	}
+	_, err := c.conn.Write(berConstructed(berSequence, msg...))
+	return c.msgID, err
+}
+
+// read returns the next message responding to request id
+func (c *LDAP) read(id int64) (ldapMessage, error) {
+	for {
+		el, err := readBER(c.r)
+		if err != nil {
+			return ldapMessage{}, err
+		}
+		parts, err := el.children()
+		if err != nil {
+			return ldapMessage{}, err
+		}
+		if el.tag != berSequence || len(parts) < 2 {
+			return ldapMessage{}, errors.New("invalid LDAP message")
+		}
+		msgID, err := parts[0].int()
+		if err != nil {
+			return ldapMessage{}, err
+		}
+		if msgID == 0 {
+			// unsolicited notification, e.g. notice of disconnection
+			if err := ldapResult(parts[1]); err != nil {
+				return ldapMessage{}, err
+			}
+			return ldapMessage{}, errors.New("server sent unsolicited notification")
+		}
+		if msgID != id {
+			continue
+		}
+		m := ldapMessage{op: parts[1]}
+		if len(parts) > 2 && parts[2].tag == ldapControls {
+			m.controls, _ = parts[2].children()
+		}
+		return m, nil
+	}
+}
+
+// ldapResult returns LDAPResult of response as error, nil on success
+func ldapResult(op berElement) error {
+	parts, err := op.children()
+	if err != nil {
+		return err
+	}
+	if len(parts) < 3 {
+		return fmt.Errorf("invalid LDAP result of 0x%02x", op.tag)
+	}
+	code, err := parts[0].int()
+	if err != nil {
+		return err
+	}
+	if code == 0 {
+		return nil
+	}
+	return &LDAPError{Code: code, Message: strings.TrimRight(parts[2].str(), "\x00\n")}
+}
+
+func parseLDAPEntry(op berElement) (LDAPEntry, error) {
+	parts, err := op.children()
+	if err != nil {
+		return LDAPEntry{}, err
+	}
+	if len(parts) < 2 {
+		return LDAPEntry{}, errors.New("invalid LDAP search result entry")
+	}
+	e := LDAPEntry{DN: parts[0].str(), Attributes: make(map[string][]string)}
+	attrs, err := parts[1].children()
+	if err != nil {
+		return LDAPEntry{}, err
+	}
+	for _, a := range attrs {
+		av, err := a.children()
+		if err != nil || len(av) < 2 {
+			return LDAPEntry{}, errors.New("invalid LDAP attribute")
+		}
+		values, err := av[1].children()
+		if err != nil {
+			return LDAPEntry{}, err
+		}
+		name := av[0].str()
+		for _, v := range values {
+			e.Attributes[name] = append(e.Attributes[name], v.str())
+		}
+	}
+	return e, nil
+}
+
+// pagedCookie returns the cookie of paged results control, empty after the
+// last page
+func pagedCookie(controls []berElement) []byte {
+	for _, control := range controls {
+		parts, err := control.children()
+		if err != nil || len(parts) < 2 || parts[0].str() != ldapPagedResultsOID {
+			continue
+		}
+		value, _, err := parseBER(parts[len(parts)-1].data)
+		if err != nil {
+			return nil
+		}
+		fields, err := value.children()
+		if err != nil || len(fields) < 2 {
+			return nil
+		}
+		return fields[1].data
+	}
+	return nil
+}
+
+// ldapFilter encodes string filter (RFC 4515), the outer parentheses can
+// be left out
+func ldapFilter(s string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "(") {
+		s = "(" + s + ")"
+	}
+	p := &filterParser{s: s}
+	f, err := p.filter()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.s) {
+		return nil, fmt.Errorf("unexpected %q at the end of filter", p.s[p.pos:])
+	}
+	return f, nil
+}
+
+// CheckLDAPFilter returns error if filter is not valid
+func CheckLDAPFilter(filter string) error {
+	_, err := ldapFilter(filter)
+	return err
+}
+
+type filterParser struct {
+	s   string
+	pos int
+}
+
+func (p *filterParser) filter() ([]byte, error) {
+	if p.pos >= len(p.s) || p.s[p.pos] != '(' {
+		return nil, fmt.Errorf("expected ( at %d of filter", p.pos)
+	}
+	p.pos++
+	if p.pos >= len(p.s) {
+		return nil, errors.New("filter ends unexpectedly")
+	}
+
+	var f []byte
+	var err error
+	switch p.s[p.pos] {
+	case '&', '|':
+		tag := byte(0xa0)
+		if p.s[p.pos] == '|' {
+			tag = 0xa1
+		}
+		p.pos++
+		var children [][]byte
+		for p.pos < len(p.s) && p.s[p.pos] == '(' {
+			c, err := p.filter()
+			if err != nil {
+				return nil, err
+			}
+			children = append(children, c)
+		}
+		f = berConstructed(tag, children...)
+	case '!':
+		p.pos++
+		var c []byte
+		if c, err = p.filter(); err == nil {
+			f = berConstructed(0xa2, c)
+		}
+	default:
+		f, err = p.item()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if p.pos >= len(p.s) || p.s[p.pos] != ')' {
+		return nil, fmt.Errorf("expected ) at %d of filter", p.pos)
+	}
+	p.pos++
+	return f, nil
+}
+
+// item encodes comparison, e.g. mail=*@example.com, up to closing parenthesis
+func (p *filterParser) item() ([]byte, error) {
+	end := strings.IndexByte(p.s[p.pos:], ')')
+	if end < 0 {
+		return nil, errors.New("filter is missing )")
+	}
+	item := p.s[p.pos : p.pos+end]
+	p.pos += end
+
+	eq := strings.IndexByte(item, '=')
+	if eq <= 0 {
+		return nil, fmt.Errorf("invalid filter item %q", item)
+	}
+	attr, value := item[:eq], item[eq+1:]
+	switch {
+	case strings.HasSuffix(attr, ">"):
+		return filterAssertion(0xa5, attr[:len(attr)-1], value)
+	case strings.HasSuffix(attr, "<"):
+		return filterAssertion(0xa6, attr[:len(attr)-1], value)
+	case strings.HasSuffix(attr, "~"):
+		return filterAssertion(0xa8, attr[:len(attr)-1], value)
+	case strings.HasSuffix(attr, ":"):
+		return filterExtensible(attr[:len(attr)-1], value)
+	case strings.ContainsAny(attr, "()*\\:"):
+		return nil, fmt.Errorf("invalid attribute %q in filter", attr)
+	case value == "*":
+		return berString(0x87, attr), nil
+	case strings.Contains(value, "*"):
+		return filterSubstrings(attr, value)
+	}
+	return filterAssertion(0xa3, attr, value)
+}
+
+func filterAssertion(tag byte, attr, value string) ([]byte, error) {
+	v, err := ldapUnescape(value)
+	if err != nil {
+		return nil, err
+	}
+	return berConstructed(tag, berString(berOctetString, attr), berTLV(berOctetString, v)), nil
+}
+
+func filterSubstrings(attr, value string) ([]byte, error) {
+	parts := strings.Split(value, "*")
+	var subs [][]byte
+	for i, part := range parts {
+		if part == "" {
+			continue
+		}
+		v, err := ldapUnescape(part)
+		if err != nil {
+			return nil, err
+		}
+		tag := byte(0x81)
+		switch i {
+		case 0:
+			tag = 0x80
+		case len(parts) - 1:
+			tag = 0x82
+		}
+		subs = append(subs, berTLV(tag, v))
+	}
+	return berConstructed(0xa4, berString(berOctetString, attr), berConstructed(berSequence, subs...)), nil
+}
+
+// filterExtensible encodes e.g. userAccountControl:1.2.840.113556.1.4.803:=2,
+// spec is what precedes :=
+func filterExtensible(spec, value string) ([]byte, error) {
+	parts := strings.Split(spec, ":")
+	attr := parts[0]
+	var rule string
+	dn := false
+	for _, part := range parts[1:] {
+		switch {
+		case strings.EqualFold(part, "dn"):
+			dn = true
+		case part != "" && rule == "":
+			rule = part
+		default:
+			return nil, fmt.Errorf("invalid extensible match %q in filter", spec)
+		}
+	}
+	if attr == "" && rule == "" {
+		return nil, fmt.Errorf("extensible match %q needs attribute or matching rule", spec)
+	}
+	v, err := ldapUnescape(value)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields [][]byte
+	if rule != "" {
+		fields = append(fields, berString(0x81, rule))
+	}
+	if attr != "" {
+		fields = append(fields, berString(0x82, attr))
+	}
+	fields = append(fields, berTLV(0x83, v))
+	if dn {
+		fields = append(fields, berTLV(0x84, []byte{0xff}))
+	}
+	return berConstructed(0xa9, fields...), nil
+}
+
+// ldapUnescape decodes \XX hex escapes of filter value
+func ldapUnescape(s string) ([]byte, error) {
+	var b []byte
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b = append(b, s[i])
+			continue
+		}
+		if i+3 > len(s) {
+			return nil, fmt.Errorf("invalid escape in filter value %q", s)
+		}
+		c, err := hex.DecodeString(s[i+1 : i+3])
+		if err != nil {
+			return nil, fmt.Errorf("invalid escape in filter value %q", s)
+		}
+		b = append(b, c...)
+		i += 2
+	}
+	return b, nil
+}
@@ -0,0 +1,447 @@
+package email
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// ldapMsg encodes LDAPMessage with id, op and optional controls
+func ldapMsg(id int64, op []byte, controls ...[]byte) []byte {
+	msg := [][]byte{berInt(berInteger, id), op}
+	if len(controls) > 0 {
+		msg = append(msg, berConstructed(ldapControls, controls...))
+	}
+	return berConstructed(berSequence, msg...)
+}
+
+func ldapResultOp(tag byte, code int64, message string) []byte {
+	return berConstructed(tag, berInt(berEnumerated, code), berString(berOctetString, ""), berString(berOctetString, message))
+}
+
+func ldapEntryOp(dn string, attrs map[string][]string, order ...string) []byte {
+	var list [][]byte
+	for _, name := range order {
+		var values [][]byte
+		for _, v := range attrs[name] {
+			values = append(values, berString(berOctetString, v))
+		}
+		list = append(list, berConstructed(berSequence, berString(berOctetString, name), berConstructed(berSet, values...)))
+	}
+	return berConstructed(ldapSearchResultEntry, berString(berOctetString, dn), berConstructed(berSequence, list...))
+}
+
+// pagedControl is paged results control of response with cookie
+func pagedControl(cookie string) []byte {
+	value := berConstructed(berSequence, berInt(berInteger, 0), berString(berOctetString, cookie))
+	return berConstructed(berSequence, berString(berOctetString, ldapPagedResultsOID), berTLV(berOctetString, value))
+}
+
+// fakeLDAP is LDAP server at the other end of net.Pipe, respond returns
+// the encoded messages sent back to request with id
+type fakeLDAP struct {
+	respond func(id int64, op berElement, controls []berElement) [][]byte
+	// requests are the received operations
+	requests []berElement
+	controls [][]berElement
+	done     chan struct{}
+}
+
+func (s *fakeLDAP) serve(conn net.Conn) {
+	defer close(s.done)
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	for {
+		el, err := readBER(r)
+		if err != nil {
+			return
+		}
+		parts, err := el.children()
+		if err != nil || len(parts) < 2 {
+			return
+		}
+		id, _ := parts[0].int()
+		var controls []berElement
+		if len(parts) > 2 {
+			controls, _ = parts[2].children()
+		}
+		s.requests = append(s.requests, parts[1])
+		s.controls = append(s.controls, controls)
+		if parts[1].tag == ldapUnbindRequest {
+			return
+		}
+		for _, resp := range s.respond(id, parts[1], controls) {
+			if _, err := conn.Write(resp); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// dialFakeLDAP runs the handshake of DialLDAP against s
+func dialFakeLDAP(t *testing.T, s *fakeLDAP, d *Dialer) (*LDAP, error) {
+	t.Helper()
+	client, server := net.Pipe()
+	s.done = make(chan struct{})
+	go s.serve(server)
+
+	c := &LDAP{
+		conn:    client,
+		r:       bufio.NewReader(client),
+		timeout: 5 * time.Second,
+	}
+	if err := c.handshake(d, &tls.Config{}); err != nil {
+		client.Close()
+		<-s.done
+		return nil, err
+	}
+	t.Cleanup(func() {
+		c.conn.Close()
+		<-s.done
+	})
+	return c, nil
+}
+
+func TestLDAPBind(t *testing.T) {
+	tests := []struct {
+		name   string
+		dialer Dialer
+		code   int64
+		// wantErr is set if bind has to fail before sending anything
+		wantErr bool
+		binds   int
+	}{
+		{
+			name:   "simple bind",
+			dialer: Dialer{Username: "CN=Svc,DC=example,DC=com", Password: "secret", Encryption: EncryptionSSL},
+			binds:  1,
+		},
+		{
+			name:   "plain text allowed",
+			dialer: Dialer{Username: "svc@example.com", Password: "secret", PlainAuth: true},
+			binds:  1,
+		},
+		{
+			name:   "invalid credentials",
+			dialer: Dialer{Username: "svc@example.com", Password: "wrong", Encryption: EncryptionSSL},
+			code:   49,
+			binds:  1,
+		},
+		{
+			name: "anonymous",
+		},
+		{
+			name:    "empty password",
+			dialer:  Dialer{Username: "svc@example.com", Encryption: EncryptionSSL},
+			wantErr: true,
+		},
+		{
+			name:    "plain text refused",
+			dialer:  Dialer{Username: "svc@example.com", Password: "secret"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &fakeLDAP{respond: func(id int64, op berElement, _ []berElement) [][]byte {
+				code, message := int64(0), ""
+				if tt.code != 0 {
+					code, message = tt.code, "80090308: LdapErr: DSID-0C09042A, comment: AcceptSecurityContext error, data 52e, v3839\x00"
+				}
+				return [][]byte{ldapMsg(id, ldapResultOp(ldapBindResponse, code, message))}
+			}}
+			c, err := dialFakeLDAP(t, s, &tt.dialer)
+
+			var ldapErr *LDAPError
+			switch {
+			case tt.wantErr:
+				if err == nil {
+					t.Fatalf("handshake() error = nil, want error")
+				}
+			case tt.code != 0:
+				if !errors.As(err, &ldapErr) || ldapErr.Code != tt.code {
+					t.Fatalf("handshake() error = %v, want LDAP result %d", err, tt.code)
+				}
+				if want := "LDAP result 49 (invalid credentials): 80090308: LdapErr: DSID-0C09042A, comment: AcceptSecurityContext error, data 52e, v3839"; err.Error() != want {
+					t.Errorf("error = %q, want %q", err.Error(), want)
+				}
+			case err != nil:
+				t.Fatalf("handshake() error = %v", err)
+			default:
+				c.Close()
+			}
+			<-s.done
+
+			binds := 0
+			for _, op := range s.requests {
+				if op.tag != ldapBindRequest {
+					continue
+				}
+				binds++
+				parts, err := op.children()
+				if err != nil || len(parts) != 3 {
+					t.Fatalf("bind request = %v, %v", parts, err)
+				}
+				if v, _ := parts[0].int(); v != 3 || parts[1].str() != tt.dialer.Username || parts[2].tag != 0x80 || parts[2].str() != tt.dialer.Password {
+					t.Errorf("bind request = version %d, %q, 0x%02x %q", v, parts[1].str(), parts[2].tag, parts[2].str())
+				}
+			}
+			if binds != tt.binds {
+				t.Errorf("got %d bind requests, want %d", binds, tt.binds)
+			}
+		})
+	}
+}
+
+func TestLDAPSearch(t *testing.T) {
+	pages := [][][]byte{
+		{
+			ldapEntryOp("CN=John Doe,OU=Staff,DC=example,DC=com", map[string][]string{
+				"cn": {"John Doe"}, "mail": {"john@example.com"}, "proxyAddresses": {"SMTP:john@example.com", "smtp:jd@example.com"},
+			}, "cn", "mail", "proxyAddresses"),
+			berConstructed(ldapSearchResultReference, berString(berOctetString, "ldap://other.example.com/DC=other,DC=example,DC=com")),
+			ldapEntryOp("CN=Jane Roe,OU=Staff,DC=example,DC=com", map[string][]string{
+				"cn": {"Jane Roe"}, "mail": {"jane@example.com"},
+			}, "cn", "mail"),
+		},
+		{
+			ldapEntryOp("CN=Empty,OU=Staff,DC=example,DC=com", nil),
+		},
+	}
+
+	s := &fakeLDAP{respond: func(id int64, op berElement, controls []berElement) [][]byte {
+		page := 0
+		if cookie := pagedCookie(controls); string(cookie) == "page2" {
+			page = 1
+		}
+		var resp [][]byte
+		// response to another request has to be skipped
+		resp = append(resp, ldapMsg(id+100, ldapResultOp(ldapSearchResultDone, 0, "")))
+		for _, op := range pages[page] {
+			resp = append(resp, ldapMsg(id, op))
+		}
+		cookie := ""
+		if page == 0 {
+			cookie = "page2"
+		}
+		return append(resp, ldapMsg(id, ldapResultOp(ldapSearchResultDone, 0, ""), pagedControl(cookie)))
+	}}
+	c, err := dialFakeLDAP(t, s, &Dialer{})
+	if err != nil {
+		t.Fatalf("handshake() error = %v", err)
+	}
+
+	entries, err := c.Search("DC=example,DC=com", "(&(objectClass=user)(mail=*))", []string{"cn", "mail", "proxyAddresses"}, 2)
+	if err != nil {
+		t.Fatalf("Search() error = %v", err)
+	}
+	c.Close()
+	<-s.done
+
+	want := []LDAPEntry{
+		{DN: "CN=John Doe,OU=Staff,DC=example,DC=com", Attributes: map[string][]string{
+			"cn": {"John Doe"}, "mail": {"john@example.com"}, "proxyAddresses": {"SMTP:john@example.com", "smtp:jd@example.com"},
+		}},
+		{DN: "CN=Jane Roe,OU=Staff,DC=example,DC=com", Attributes: map[string][]string{
+			"cn": {"Jane Roe"}, "mail": {"jane@example.com"},
+		}},
+		{DN: "CN=Empty,OU=Staff,DC=example,DC=com", Attributes: map[string][]string{}},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("Search() = %+v, want %+v", entries, want)
+	}
+	if got := entries[0].Get("PROXYADDRESSES"); got != "SMTP:john@example.com" {
+		t.Errorf("Get() = %q, want the first value", got)
+	}
+
+	// two search requests and unbind
+	if len(s.requests) != 3 {
+		t.Fatalf("server got %d requests, want 3", len(s.requests))
+	}
+	parts, err := s.requests[0].children()
+	if err != nil || len(parts) != 8 {
+		t.Fatalf("search request = %v, %v", parts, err)
+	}
+	if parts[0].str() != "DC=example,DC=com" {
+		t.Errorf("base DN = %q", parts[0].str())
+	}
+	if cookie := pagedCookie(s.controls[1]); string(cookie) != "page2" {
+		t.Errorf("second request cookie = %q, want page2", cookie)
+	}
+}
+
+func TestLDAPSearchErrors(t *testing.T) {
+	entry := ldapMsg(1, ldapEntryOp("CN=John Doe,DC=example,DC=com", map[string][]string{"mail": {"john@example.com"}}, "mail"))
+
+	tests := []struct {
+		name string
+		resp [][]byte
+		// code is the expected LDAP result, 0 for any other error
+		code int64
+	}{
+		{
+			name: "no such object",
+			resp: [][]byte{ldapMsg(1, ldapResultOp(ldapSearchResultDone, 32, "0000208D: NameErr: DSID-03100241, problem 2001 (NO_OBJECT)"))},
+			code: 32,
+		},
+		{
+			name: "notice of disconnection",
+			resp: [][]byte{ldapMsg(0, ldapResultOp(ldapExtendedResponse, 52, "server is shutting down"))},
+			code: 52,
+		},
+		{
+			name: "unexpected response",
+			resp: [][]byte{ldapMsg(1, ldapResultOp(ldapBindResponse, 0, ""))},
+		},
+		{
+			name: "truncated entry",
+			resp: [][]byte{entry[:len(entry)-3]},
+		},
+		{
+			name: "invalid entry",
+			resp: [][]byte{ldapMsg(1, berConstructed(ldapSearchResultEntry, berString(berOctetString, "CN=x")))},
+		},
+		{
+			name: "invalid attribute",
+			resp: [][]byte{ldapMsg(1, berConstructed(ldapSearchResultEntry,
+				berString(berOctetString, "CN=x"),
+				berConstructed(berSequence, berConstructed(berSequence, berString(berOctetString, "mail"))),
+			))},
+		},
+		{
+			name: "invalid message",
+			resp: [][]byte{berConstructed(berSequence, berInt(berInteger, 1))},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &fakeLDAP{respond: func(int64, berElement, []berElement) [][]byte {
+				return tt.resp
+			}}
+			c, err := dialFakeLDAP(t, s, &Dialer{})
+			if err != nil {
+				t.Fatalf("handshake() error = %v", err)
+			}
+
+			// truncated message times out waiting for the rest
+			c.timeout = 100 * time.Millisecond
+			_, err = c.Search("DC=example,DC=com", "(mail=*)", []string{"mail"}, 0)
+			if err == nil {
+				t.Fatalf("Search() error = nil, want error")
+			}
+			var ldapErr *LDAPError
+			if tt.code != 0 && (!errors.As(err, &ldapErr) || ldapErr.Code != tt.code) {
+				t.Errorf("Search() error = %v, want LDAP result %d", err, tt.code)
+			}
+		})
+	}
+}
+
+// TestLDAPTruncatedMessage reads every prefix of search result entry and
+// done, they have to fail instead of panicking
+func TestLDAPTruncatedMessage(t *testing.T) {
+	msgs := [][]byte{
+		ldapMsg(1, ldapEntryOp("CN=John Doe,DC=example,DC=com", map[string][]string{
+			"cn": {"John Doe"}, "mail": {"john@example.com", "jd@example.com"},
+		}, "cn", "mail")),
+		ldapMsg(1, ldapResultOp(ldapSearchResultDone, 0, ""), pagedControl("cookie")),
+	}
+
+	for _, msg := range msgs {
+		for i := 0; i < len(msg); i++ {
+			c := &LDAP{r: bufio.NewReader(bytes.NewReader(msg[:i]))}
+			if _, err := c.read(1); err == nil {
+				t.Errorf("read() of %d of %d bytes error = nil, want error", i, len(msg))
+			}
+		}
+
+		// contents cut inside of the operation, lengths of the outer
+		// elements do not match
+		el, _, err := parseBER(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts, err := el.children()
+		if err != nil {
+			t.Fatal(err)
+		}
+		op := parts[1]
+		for i := 0; i < len(op.data); i++ {
+			cut := berElement{tag: op.tag, data: op.data[:i]}
+			if op.tag == ldapSearchResultEntry {
+				parseLDAPEntry(cut)
+			} else {
+				ldapResult(cut)
+			}
+		}
+	}
+}
+
+func TestLDAPFilter(t *testing.T) {
+	tests := []struct {
+		filter string
+		want   string
+	}{
+		// examples of RFC 4511 appendix and RFC 4515 section 4
+		{filter: "(cn=Babs Jensen)", want: "a3110402636e040b42616273204a656e73656e"},
+		{filter: "cn=Babs Jensen", want: "a3110402636e040b42616273204a656e73656e"},
+		{filter: "(objectClass=*)", want: "870b6f626a656374436c617373"},
+		{filter: "(!(cn=Tim Howes))", want: "a211a30f0402636e040954696d20486f776573"},
+		{filter: "(cn=*a*b*)", want: encodeHex(berConstructed(0xa4, berString(berOctetString, "cn"), berConstructed(berSequence, berString(0x81, "a"), berString(0x81, "b"))))},
+		{filter: "(o=Parens R Us \\28for all your parenthetical needs\\29)", want: encodeHex(berConstructed(0xa3, berString(berOctetString, "o"), berString(berOctetString, "Parens R Us (for all your parenthetical needs)")))},
+		{filter: "(userAccountControl:1.2.840.113556.1.4.803:=2)", want: encodeHex(berConstructed(0xa9, berString(0x81, "1.2.840.113556.1.4.803"), berString(0x82, "userAccountControl"), berString(0x83, "2")))},
+		{filter: "(&(mail=*@example.com)(|(department=Finance)(title>=M)))", want: encodeHex(berConstructed(0xa0,
+			berConstructed(0xa4, berString(berOctetString, "mail"), berConstructed(berSequence, berString(0x82, "@example.com"))),
+			berConstructed(0xa1,
+				berConstructed(0xa3, berString(berOctetString, "department"), berString(berOctetString, "Finance")),
+				berConstructed(0xa5, berString(berOctetString, "title"), berString(berOctetString, "M")),
+			),
+		))},
+	}
+
+	for _, tt := range tests {
+		got, err := ldapFilter(tt.filter)
+		if err != nil {
+			t.Errorf("ldapFilter(%q) error = %v", tt.filter, err)
+			continue
+		}
+		if hex.EncodeToString(got) != tt.want {
+			t.Errorf("ldapFilter(%q) = %x, want %s", tt.filter, got, tt.want)
+		}
+	}
+}
+
+func encodeHex(b []byte) string {
+	return hex.EncodeToString(b)
+}
+
+func TestLDAPFilterInvalid(t *testing.T) {
+	for _, filter := range []string{
+		"",
+		"(",
+		"(cn=x",
+		"(cn=x))",
+		"(&(cn=x)",
+		"(!cn=x)",
+		"(=x)",
+		"(cn)",
+		"(c(n=x)",
+		"(cn=\\2)",
+		"(cn=\\zz)",
+		"(:=x)",
+		"(cn:rule:other:=x)",
+	} {
+		if err := CheckLDAPFilter(filter); err == nil {
+			t.Errorf("CheckLDAPFilter(%q) error = nil, want error", filter)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package email
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// MDN is message disposition notification (RFC 8098), the read receipt sent
+// by mail client when the message is opened
+type MDN struct {
+	// To is the address the receipt was sent to
+	To          string
+	Date        time.Time
+	ReportingUA string
+	// OriginalRecipient and FinalRecipient are addresses of the reader
+	OriginalRecipient string
+	FinalRecipient    string
+	OriginalMessageID string
+	// Disposition is displayed, deleted, dispatched or processed
+	Disposition string
+}
+
+// ParseMDN returns the receipt in msg, false if msg is not a receipt
+func ParseMDN(msg *Message) (*MDN, bool) {
+	var report *Part
+	msg.Root.Walk(func(p *Part, depth int) {
+		if report == nil && p.ContentType == "message/disposition-notification" {
+			report = p
+		}
+	})
+	if report == nil {
+		return nil, false
+	}
+
+	// the fields are formatted as header, it ends with the part
+	r := textproto.NewReader(bufio.NewReader(bytes.NewReader(append(bytes.TrimSpace(report.Body), "\r\n\r\n"...))))
+	fields, err := r.ReadMIMEHeader()
+	if err != nil && len(fields) == 0 {
+		return nil, false
+	}
+
+	m := &MDN{
+		ReportingUA:       strings.TrimSpace(fields.Get("Reporting-UA")),
+		OriginalRecipient: mdnAddress(fields.Get("Original-Recipient")),
+		FinalRecipient:    mdnAddress(fields.Get("Final-Recipient")),
+		OriginalMessageID: strings.TrimSpace(fields.Get("Original-Message-ID")),
+		Disposition:       mdnDisposition(fields.Get("Disposition")),
+	}
+	if to, err := mail.ParseAddress(msg.Header.Get("To")); err == nil {
+		m.To = to.Address
+	}
+	if date, err := msg.Header.Date(); err == nil {
+		m.Date = date
+	}
+	return m, true
+}
+
+// mdnAddress returns address of "rfc822; john@example.com"
+func mdnAddress(field string) string {
+	if i := strings.IndexByte(field, ';'); i >= 0 {
+		field = field[i+1:]
+	}
+	return strings.ToLower(strings.Trim(strings.TrimSpace(field), "<>"))
+}
+
+// mdnDisposition returns type of "manual-action/MDN-sent-manually; displayed"
+func mdnDisposition(field string) string {
+	if i := strings.IndexByte(field, ';'); i >= 0 {
+		field = field[i+1:]
+	}
+	if i := strings.IndexByte(field, '/'); i >= 0 {
+		field = field[:i]
+	}
+	return strings.ToLower(strings.TrimSpace(field))
+}
+
+// ReadMessages parses single .eml file, every .eml file of directory or
+// every message of mbox file
+func ReadMessages(path string) ([]*Message, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("ReadMessages: %v", err)
+	}
+
+	var raw [][]byte
+	if info.IsDir() {
+		files, err := filepath.Glob(filepath.Join(path, "*.eml"))
+		if err != nil {
+			return nil, fmt.Errorf("ReadMessages: %v", err)
+		}
+		for _, f := range files {
+			d, err := ioutil.ReadFile(f)
+			if err != nil {
+				return nil, fmt.Errorf("ReadMessages: %v", err)
+			}
+			raw = append(raw, d)
+		}
+	} else {
+		d, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("ReadMessages: %v", err)
+		}
+		if bytes.HasPrefix(d, []byte("From ")) {
+			raw = splitMbox(d)
+		} else {
+			raw = [][]byte{d}
+		}
+	}
+
+	var messages []*Message
+	for i, d := range raw {
+		msg, err := ParseMessage(bytes.NewReader(d))
+		if err != nil {
+			return nil, fmt.Errorf("ReadMessages: message %d of %s: %v", i+1, path, err)
+		}
+		messages = append(messages, msg)
+	}
+	return messages, nil
+}
+
+// splitMbox splits mbox file on "From " lines following empty line,
+// unescaping ">From " lines of mboxrd format
+func splitMbox(d []byte) [][]byte {
+	var messages [][]byte
+	var cur *bytes.Buffer
+	blank := true
+	for _, line := range bytes.SplitAfter(d, []byte("\n")) {
+		separator := blank && bytes.HasPrefix(line, []byte("From "))
+		blank = len(bytes.TrimRight(line, "\r\n")) == 0
+		if separator {
+			if cur != nil {
+				messages = append(messages, cur.Bytes())
+			}
+			cur = new(bytes.Buffer)
+			continue
+		}
+		if cur == nil {
+			continue
+		}
+		unquoted := bytes.TrimLeft(line, ">")
+		if len(unquoted) < len(line) && bytes.HasPrefix(unquoted, []byte("From ")) {
+			line = line[1:]
+		}
+		cur.Write(line)
+	}
+	if cur != nil {
+		messages = append(messages, cur.Bytes())
+	}
+	return messages
+}
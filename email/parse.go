@@ -0,0 +1,275 @@
+package email
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// HeaderField is single header of parsed message, in the order it appeared
+type HeaderField struct {
+	Name  string
+	Value string
+}
+
+// Message is parsed RFC 5322 message
+type Message struct {
+	// Fields hold the top level headers with decoded values
+	Fields []HeaderField
+	Header mail.Header
+	Root   *Part
+}
+
+// Part is single node of MIME structure, Parts are set for multipart
+// parts and Body for the others
+type Part struct {
+	Header      textproto.MIMEHeader
+	ContentType string
+	Params      map[string]string
+	Filename    string
+	// Body is the content with Content-Transfer-Encoding decoded
+	Body  []byte
+	Parts []*Part
+}
+
+// ParseMessage reads the message and decodes its MIME structure
+func ParseMessage(r io.Reader) (*Message, error) {
+	d, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("ParseMessage: %v", err)
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(d))
+	if err != nil {
+		return nil, fmt.Errorf("ParseMessage: %v", err)
+	}
+
+	root, err := parsePart(textproto.MIMEHeader(msg.Header), msg.Body)
+	if err != nil {
+		return nil, fmt.Errorf("ParseMessage: %v", err)
+	}
+
+	return &Message{
+		Fields: headerFields(d),
+		Header: msg.Header,
+		Root:   root,
+	}, nil
+}
+
+// headerFields reads the header block keeping the order and duplicates,
+// which mail.Header loses
+func headerFields(d []byte) []HeaderField {
+	var fields []HeaderField
+	dec := &mime.WordDecoder{}
+	s := bufio.NewScanner(bytes.NewReader(d))
+	s.Buffer(nil, len(d)+1)
+	for s.Scan() {
+		line := strings.TrimRight(s.Text(), "\r")
+		if line == "" {
+			break
+		}
+		if (line[0] == ' ' || line[0] == '\t') && len(fields) > 0 {
+			fields[len(fields)-1].Value += " " + strings.TrimSpace(line)
+			continue
+		}
+		i := strings.Index(line, ":")
+		if i < 0 {
+			continue
+		}
+		fields = append(fields, HeaderField{
+			Name:  line[:i],
+			Value: strings.TrimSpace(line[i+1:]),
+		})
+	}
+
+	for i, f := range fields {
+		if v, err := dec.DecodeHeader(f.Value); err == nil {
+			fields[i].Value = v
+		}
+	}
+	return fields
+}
+
+func parsePart(h textproto.MIMEHeader, r io.Reader) (*Part, error) {
+	p := &Part{Header: h}
+
+	var err error
+	p.ContentType, p.Params, err = mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		// missing or broken Content-Type means plain text (RFC 2045)
+		p.ContentType, p.Params = "text/plain", map[string]string{}
+	}
+
+	if _, params, err := mime.ParseMediaType(h.Get("Content-Disposition")); err == nil {
+		p.Filename = params["filename"]
+	}
+	if p.Filename == "" {
+		p.Filename = p.Params["name"]
+	}
+	if name, err := (&mime.WordDecoder{}).DecodeHeader(p.Filename); err == nil {
+		p.Filename = name
+	}
+
+	if !strings.HasPrefix(p.ContentType, "multipart/") {
+		p.Body, err = ioutil.ReadAll(decodeTransfer(r, h.Get("Content-Transfer-Encoding")))
+		if err != nil {
+			return nil, fmt.Errorf("decoding %s part: %v", p.ContentType, err)
+		}
+		return p, nil
+	}
+
+	mr := multipart.NewReader(r, p.Params["boundary"])
+	for {
+		raw, err := mr.NextRawPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		child, err := parsePart(raw.Header, raw)
+		if err != nil {
+			return nil, err
+		}
+		p.Parts = append(p.Parts, child)
+	}
+
+	return p, nil
+}
+
+// decodeTransfer decodes quoted-printable and base64 Content-Transfer-Encoding
+func decodeTransfer(r io.Reader, encoding string) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, r)
+	default:
+		return r
+	}
+}
+
+// IsAttachment reports whether the part is a file rather than a body
+func (p *Part) IsAttachment() bool {
+	return strings.HasPrefix(strings.ToLower(p.Header.Get("Content-Disposition")), "attachment") || p.Filename != ""
+}
+
+// Text returns the body converted to UTF-8. Only utf-8, us-ascii and
+// iso-8859-1 charsets are supported.
+func (p *Part) Text() (string, error) {
+	switch charset := strings.ToLower(p.Params["charset"]); charset {
+	case "", "utf-8", "utf8", "us-ascii", "ascii":
+		return string(p.Body), nil
+	case "iso-8859-1", "latin1":
+		runes := make([]rune, len(p.Body))
+		for i, b := range p.Body {
+			runes[i] = rune(b)
+		}
+		return string(runes), nil
+	default:
+		return "", fmt.Errorf("unsupported charset %q", charset)
+	}
+}
+
+// Walk calls fn for the part and all parts nested in it, depth first
+func (p *Part) Walk(fn func(p *Part, depth int)) {
+	p.walk(fn, 0)
+}
+
+func (p *Part) walk(fn func(p *Part, depth int), depth int) {
+	fn(p, depth)
+	for _, c := range p.Parts {
+		c.walk(fn, depth+1)
+	}
+}
+
+// Body returns the first part of mediaType which is not an attachment, or
+// nil if there is none
+func (m *Message) Body(mediaType string) *Part {
+	var found *Part
+	m.Root.Walk(func(p *Part, depth int) {
+		if found == nil && p.ContentType == mediaType && !p.IsAttachment() {
+			found = p
+		}
+	})
+	return found
+}
+
+// Attachments returns all parts which are attachments
+func (m *Message) Attachments() []*Part {
+	var attachments []*Part
+	m.Root.Walk(func(p *Part, depth int) {
+		if p.Parts == nil && p.IsAttachment() {
+			attachments = append(attachments, p)
+		}
+	})
+	return attachments
+}
+
+var urlPattern = regexp.MustCompile(`(?i)\bhttps?://[^\s"'<>()\[\]{}]+`)
+
+// ExtractURLs returns unique http and https URLs found in text, in the
+// order of their first occurrence. HTML entities in them are decoded.
+func ExtractURLs(text string) []string {
+	var urls []string
+	seen := make(map[string]bool)
+	for _, u := range urlPattern.FindAllString(text, -1) {
+		u = strings.TrimRight(html.UnescapeString(u), ".,;:!?")
+		if !seen[u] {
+			seen[u] = true
+			urls = append(urls, u)
+		}
+	}
+	return urls
+}
+
+// ExtractLinks returns unique targets of <a> and <area> elements in HTML
+// body, in the order of their first occurrence. Only http, https and
+// protocol relative links are returned, the latter with https scheme.
+func ExtractLinks(body string) []string {
+	var links []string
+	seen := make(map[string]bool)
+	z := html.NewTokenizer(strings.NewReader(body))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			return links
+		}
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			continue
+		}
+		t := z.Token()
+		if t.Data != "a" && t.Data != "area" {
+			continue
+		}
+		for _, attr := range t.Attr {
+			if attr.Key != "href" {
+				continue
+			}
+			link := strings.TrimSpace(attr.Val)
+			if strings.HasPrefix(link, "//") {
+				link = "https:" + link
+			}
+			lower := strings.ToLower(link)
+			if !strings.HasPrefix(lower, "http://") && !strings.HasPrefix(lower, "https://") {
+				continue
+			}
+			if !seen[link] {
+				seen[link] = true
+				links = append(links, link)
+			}
+		}
+	}
+}
@@ -0,0 +1,592 @@
+package email
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/textproto"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Encryption of the connection to SMTP server
+type Encryption int
+
+const (
+	// EncryptionNone sends everything in plain text
+	EncryptionNone Encryption = iota
+	// EncryptionSSL starts TLS right after connecting, usually on port 465
+	EncryptionSSL
+	// EncryptionSTARTTLS upgrades the connection with STARTTLS, the server
+	// has to support it
+	EncryptionSTARTTLS
+)
+
+const defaultTimeout = 10 * time.Second
+
+// idleCheck is how long connection can be idle before Reusable checks it
+// with NOOP, servers drop idle clients after a while
+const idleCheck = 30 * time.Second
+
+// Dialer holds the settings for connecting to SMTP server
+type Dialer struct {
+	Host       string
+	Port       int
+	Username   string
+	Password   string
+	Encryption Encryption
+	// LocalName is sent in EHLO, localhost by default
+	LocalName string
+	// Timeout applies to connecting and to sending every mail, 10s by default
+	Timeout   time.Duration
+	TLSConfig *tls.Config
+	// Token returns OAuth 2.0 access token, if it is set the connection is
+	// authenticated with XOAUTH2 instead of Password
+	Token func() (string, error)
+	// Proxy is socks5:// or http:// URL of proxy to connect through
+	Proxy *url.URL
+	// PlainAuth allows sending the credentials with EncryptionNone, they are
+	// refused to be sent over unencrypted connection otherwise
+	PlainAuth bool
+}
+
+// SMTP is authenticated connection to SMTP server
+type SMTP struct {
+	conn    net.Conn
+	text    *textproto.Conn
+	timeout time.Duration
+	// ext holds extensions advertised in EHLO response
+	ext map[string]string
+	// sent counts messages accepted over the connection
+	sent   int
+	used   time.Time
+	closed bool
+}
+
+// ErrNoSTARTTLS is returned by Dial with EncryptionSTARTTLS when the server
+// does not advertise STARTTLS
+var ErrNoSTARTTLS = errors.New("server does not support STARTTLS")
+
+// ErrPlainAuth is returned by Dial when credentials would be sent over
+// unencrypted connection without PlainAuth
+var ErrPlainAuth = errors.New("refusing to send credentials over unencrypted connection")
+
+// DroppedError is returned by Send when the connection failed before the
+// message was transferred, so it can be safely sent again over new one
+type DroppedError struct {
+	Err error
+}
+
+func (e *DroppedError) Error() string {
+	return "connection dropped before sending the message: " + e.Err.Error()
+}
+
+func (e *DroppedError) Unwrap() error {
+	return e.Err
+}
+
+// Dial connects to the server, upgrades the connection to TLS and
+// authenticates as configured
+func (d *Dialer) Dial() (*SMTP, error) {
+	conn, tlsConfig, timeout, err := d.connect()
+	if err != nil {
+		return nil, fmt.Errorf("Dial: %w", err)
+	}
+
+	c := &SMTP{
+		conn:    conn,
+		text:    textproto.NewConn(conn),
+		timeout: timeout,
+		used:    time.Now(),
+	}
+
+	if err := c.handshake(d, tlsConfig); err != nil {
+		c.conn.Close()
+		return nil, fmt.Errorf("Dial: %w", err)
+	}
+
+	return c, nil
+}
+
+// connect opens the connection, through the proxy if it is set, and starts
+// TLS with EncryptionSSL. It returns the TLS config for STARTTLS and the
+// timeout in effect.
+func (d *Dialer) connect() (net.Conn, *tls.Config, time.Duration, error) {
+	timeout := d.Timeout
+	if timeout == 0 {
+		timeout = defaultTimeout
+	}
+
+	tlsConfig := d.TLSConfig
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{ServerName: d.Host}
+	}
+
+	addr := net.JoinHostPort(d.Host, strconv.Itoa(d.Port))
+	dialer := &net.Dialer{Timeout: timeout}
+
+	var conn net.Conn
+	var err error
+	switch {
+	case d.Proxy != nil:
+		conn, err = dialProxy(d.Proxy, addr, timeout)
+		if err == nil && d.Encryption == EncryptionSSL {
+			tlsConn := tls.Client(conn, tlsConfig)
+			tlsConn.SetDeadline(time.Now().Add(timeout))
+			if err = tlsConn.Handshake(); err != nil {
+				conn.Close()
+			}
+			conn = tlsConn
+		}
+	case d.Encryption == EncryptionSSL:
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	default:
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	return conn, tlsConfig, timeout, nil
+}
+
+func (c *SMTP) handshake(d *Dialer, tlsConfig *tls.Config) error {
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+	defer c.conn.SetDeadline(time.Time{})
+
+	if _, _, err := c.text.ReadResponse(220); err != nil {
+		return err
+	}
+
+	localName := d.LocalName
+	if localName == "" {
+		localName = "localhost"
+	}
+
+	if err := c.hello(localName); err != nil {
+		return err
+	}
+
+	if d.Encryption == EncryptionSTARTTLS {
+		if _, ok := c.ext["STARTTLS"]; !ok {
+			return ErrNoSTARTTLS
+		}
+		if _, _, err := c.cmd(220, "STARTTLS"); err != nil {
+			return err
+		}
+		c.conn = tls.Client(c.conn, tlsConfig)
+		c.text = textproto.NewConn(c.conn)
+		if err := c.hello(localName); err != nil {
+			return err
+		}
+	}
+
+	if d.Token != nil {
+		if err := d.checkPlainAuth(); err != nil {
+			return err
+		}
+		token, err := d.Token()
+		if err != nil {
+			return err
+		}
+		return c.xoauth2(d.Username, token)
+	}
+
+	if d.Username != "" || d.Password != "" {
+		if _, ok := c.ext["AUTH"]; ok {
+			if err := d.checkPlainAuth(); err != nil {
+				return err
+			}
+			if err := c.auth(d.Username, d.Password); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkPlainAuth refuses to authenticate over unencrypted connection
+// unless PlainAuth is set
+func (d *Dialer) checkPlainAuth() error {
+	if d.Encryption == EncryptionNone && !d.PlainAuth {
+		return ErrPlainAuth
+	}
+	return nil
+}
+
+// hello sends EHLO, falling back to HELO for servers without ESMTP
+func (c *SMTP) hello(localName string) error {
+	c.ext = make(map[string]string)
+
+	_, msg, err := c.cmd(250, "EHLO %s", localName)
+	if err != nil {
+		var tpErr *textproto.Error
+		if !errors.As(err, &tpErr) || tpErr.Code/100 != 5 {
+			return err
+		}
+		_, _, err = c.cmd(250, "HELO %s", localName)
+		return err
+	}
+
+	// first line is the greeting, the rest are extensions
+	lines := strings.Split(msg, "\n")
+	for _, line := range lines[1:] {
+		parts := strings.SplitN(line, " ", 2)
+		args := ""
+		if len(parts) > 1 {
+			args = parts[1]
+		}
+		c.ext[strings.ToUpper(parts[0])] = args
+	}
+
+	return nil
+}
+
+// auth authenticates with PLAIN, or with LOGIN if it is the only one of
+// them the server supports
+func (c *SMTP) auth(username, password string) error {
+	mechanisms := strings.Fields(strings.ToUpper(c.ext["AUTH"]))
+	if !contains(mechanisms, "PLAIN") && contains(mechanisms, "LOGIN") {
+		if _, _, err := c.cmd(334, "AUTH LOGIN"); err != nil {
+			return err
+		}
+		if _, _, err := c.cmd(334, "%s", base64.StdEncoding.EncodeToString([]byte(username))); err != nil {
+			return err
+		}
+		_, _, err := c.cmd(235, "%s", base64.StdEncoding.EncodeToString([]byte(password)))
+		return err
+	}
+
+	resp := base64.StdEncoding.EncodeToString([]byte("\x00" + username + "\x00" + password))
+	_, _, err := c.cmd(235, "AUTH PLAIN %s", resp)
+	return err
+}
+
+// xoauth2 authenticates with the access token as Gmail and Office 365 expect
+func (c *SMTP) xoauth2(username, token string) error {
+	if !contains(strings.Fields(strings.ToUpper(c.ext["AUTH"])), "XOAUTH2") {
+		return errors.New("server does not support AUTH XOAUTH2")
+	}
+
+	resp := base64.StdEncoding.EncodeToString([]byte("user=" + username + "\x01auth=Bearer " + token + "\x01\x01"))
+	code, msg, err := c.cmd(235, "AUTH XOAUTH2 %s", resp)
+	if code != 334 {
+		return err
+	}
+	// rejected token, the challenge holds the error as base64 JSON and the
+	// final reply comes after an empty response
+	_, _, err = c.cmd(235, "")
+	if detail, decodeErr := base64.StdEncoding.DecodeString(msg); decodeErr == nil {
+		var tpErr *textproto.Error
+		if errors.As(err, &tpErr) {
+			tpErr.Msg += " " + string(detail)
+		}
+	}
+	return err
+}
+
+// Extension reports whether the server supports ext and returns its parameters
+func (c *SMTP) Extension(ext string) (bool, string) {
+	args, ok := c.ext[strings.ToUpper(ext)]
+	return ok, args
+}
+
+// Send delivers msg to all recipients in single transaction. If the server
+// supports PIPELINING, MAIL FROM, RCPT TO and DATA are sent at once. If it
+// supports CHUNKING, the message is sent with BDAT instead of DATA.
+func (c *SMTP) Send(from string, to []string, msg []byte) error {
+	return c.SendDSN(from, to, msg, nil)
+}
+
+// SendDSN is Send which also requests delivery status notifications if dsn
+// is not nil and the server supports DSN extension
+func (c *SMTP) SendDSN(from string, to []string, msg []byte, dsn *DSNOptions) error {
+	if len(to) == 0 {
+		return errors.New("Send: no recipient specified")
+	}
+	if c.closed {
+		return fmt.Errorf("Send: %w", &DroppedError{Err: errors.New("connection is closed")})
+	}
+	c.used = time.Now()
+
+	if _, ok := c.ext["DSN"]; !ok {
+		dsn = nil
+	}
+
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+	defer c.conn.SetDeadline(time.Time{})
+
+	_, chunking := c.ext["CHUNKING"]
+	if chunking {
+		// BDAT sends the message as is, so line endings have to be correct
+		msg = toCRLF(msg)
+	}
+
+	mailCmd := fmt.Sprintf("MAIL FROM:<%s>", from)
+	if _, ok := c.ext["SIZE"]; ok {
+		mailCmd += fmt.Sprintf(" SIZE=%d", len(msg))
+	}
+	mailCmd += dsn.mailParams()
+
+	var err error
+	if _, ok := c.ext["PIPELINING"]; ok {
+		err = c.sendPipelined(mailCmd, to, dsn.rcptParams(), !chunking)
+	} else {
+		err = c.sendSequential(mailCmd, to, dsn.rcptParams(), !chunking)
+	}
+	if err != nil {
+		if !isProtocolError(err) {
+			c.Close()
+			err = &DroppedError{Err: err}
+		}
+		return fmt.Errorf("Send: %w", err)
+	}
+
+	if chunking {
+		err = c.bdat(msg)
+	} else {
+		err = c.data(msg)
+	}
+	if err != nil {
+		return fmt.Errorf("Send: %w", err)
+	}
+
+	c.sent++
+	return nil
+}
+
+// Verify asks the server whether it accepts mail for the recipient with
+// MAIL FROM and RCPT TO, followed by RSET so that nothing is sent. Rejection
+// is returned as *textproto.Error.
+func (c *SMTP) Verify(from, to string) error {
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+	defer c.conn.SetDeadline(time.Time{})
+	c.used = time.Now()
+
+	if _, _, err := c.cmd(250, "MAIL FROM:<%s>", from); err != nil {
+		c.reset(err)
+		return fmt.Errorf("Verify: %w", err)
+	}
+	_, _, err := c.cmd(25, "RCPT TO:<%s>", to)
+	c.cmd(250, "RSET")
+	if err != nil {
+		return fmt.Errorf("Verify: %w", err)
+	}
+	return nil
+}
+
+// Sent returns number of messages sent over the connection
+func (c *SMTP) Sent() int {
+	return c.sent
+}
+
+// Reusable reports whether another message can be sent over the connection:
+// it was not closed, fewer than max messages were sent over it (any number
+// if max is 0) and if it was idle for a while, it still answers NOOP
+func (c *SMTP) Reusable(max int) bool {
+	if c.closed || (max > 0 && c.sent >= max) {
+		return false
+	}
+	if time.Since(c.used) < idleCheck {
+		return true
+	}
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+	defer c.conn.SetDeadline(time.Time{})
+	if err := c.Noop(); err != nil {
+		return false
+	}
+	c.used = time.Now()
+	return true
+}
+
+// sendSequential sends the envelope waiting for reply to every command,
+// ending with DATA if withData is set
+func (c *SMTP) sendSequential(mailCmd string, to []string, rcptParams string, withData bool) error {
+	if _, _, err := c.cmd(250, "%s", mailCmd); err != nil {
+		c.reset(err)
+		return err
+	}
+
+	for _, addr := range to {
+		if _, _, err := c.cmd(25, "RCPT TO:<%s>%s", addr, rcptParams); err != nil {
+			c.reset(err)
+			return err
+		}
+	}
+
+	if !withData {
+		return nil
+	}
+
+	_, _, err := c.cmd(354, "DATA")
+	if err != nil {
+		c.reset(err)
+	}
+	return err
+}
+
+// sendPipelined writes the whole envelope, together with DATA if withData is
+// set, and reads the replies afterwards (RFC 2920). If DATA is accepted
+// although a recipient was rejected, the connection is closed so that the
+// message is not delivered only to part of the recipients.
+func (c *SMTP) sendPipelined(mailCmd string, to []string, rcptParams string, withData bool) error {
+	w := c.text.Writer.W
+	fmt.Fprintf(w, "%s\r\n", mailCmd)
+	for _, addr := range to {
+		fmt.Fprintf(w, "RCPT TO:<%s>%s\r\n", addr, rcptParams)
+	}
+	if withData {
+		fmt.Fprintf(w, "DATA\r\n")
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	var envErr error
+	if _, _, err := c.text.ReadResponse(250); err != nil {
+		if !isProtocolError(err) {
+			return err
+		}
+		envErr = err
+	}
+
+	for range to {
+		if _, _, err := c.text.ReadResponse(25); err != nil {
+			if !isProtocolError(err) {
+				return err
+			}
+			if envErr == nil {
+				envErr = err
+			}
+		}
+	}
+
+	if !withData {
+		if envErr != nil {
+			c.reset(envErr)
+		}
+		return envErr
+	}
+
+	_, _, dataErr := c.text.ReadResponse(354)
+	if dataErr != nil && !isProtocolError(dataErr) {
+		return dataErr
+	}
+
+	if envErr != nil {
+		if dataErr == nil {
+			c.Close()
+			return envErr
+		}
+		c.reset(envErr)
+		return envErr
+	}
+
+	if dataErr != nil {
+		c.reset(dataErr)
+	}
+	return dataErr
+}
+
+// data writes the message after DATA was accepted
+func (c *SMTP) data(msg []byte) error {
+	w := c.text.DotWriter()
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	_, _, err := c.text.ReadResponse(250)
+	return err
+}
+
+// bdat sends the message in single BDAT chunk (RFC 3030), without dot
+// stuffing
+func (c *SMTP) bdat(msg []byte) error {
+	w := c.text.Writer.W
+	fmt.Fprintf(w, "BDAT %d LAST\r\n", len(msg))
+	w.Write(msg)
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	_, _, err := c.text.ReadResponse(250)
+	if err != nil {
+		c.reset(err)
+	}
+	return err
+}
+
+// toCRLF converts bare LF line endings to CRLF
+func toCRLF(msg []byte) []byte {
+	var buf bytes.Buffer
+	buf.Grow(len(msg))
+	for i, b := range msg {
+		if b == '\n' && (i == 0 || msg[i-1] != '\r') {
+			buf.WriteByte('\r')
+		}
+		buf.WriteByte(b)
+	}
+	return buf.Bytes()
+}
+
+// reset aborts the transaction after err, unless the server is closing
+// the connection anyway
+func (c *SMTP) reset(err error) {
+	var tpErr *textproto.Error
+	if errors.As(err, &tpErr) && tpErr.Code != 421 {
+		c.cmd(250, "RSET")
+	}
+}
+
+// Noop checks that the connection is still usable
+func (c *SMTP) Noop() error {
+	_, _, err := c.cmd(250, "NOOP")
+	return err
+}
+
+// Quit ends the session and closes the connection
+func (c *SMTP) Quit() error {
+	c.conn.SetDeadline(time.Now().Add(c.timeout))
+	_, _, err := c.cmd(221, "QUIT")
+	c.Close()
+	return err
+}
+
+// Close closes the connection without ending the session
+func (c *SMTP) Close() error {
+	if c.closed {
+		return nil
+	}
+	c.closed = true
+	return c.text.Close()
+}
+
+func (c *SMTP) cmd(expectCode int, format string, args ...interface{}) (int, string, error) {
+	id, err := c.text.Cmd(format, args...)
+	if err != nil {
+		return 0, "", err
+	}
+	c.text.StartResponse(id)
+	defer c.text.EndResponse(id)
+	return c.text.ReadResponse(expectCode)
+}
+
+func isProtocolError(err error) bool {
+	var tpErr *textproto.Error
+	return errors.As(err, &tpErr)
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,598 @@
+package email
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeServer is SMTP server at the other end of net.Pipe, it accepts
+// everything unless told otherwise
+type fakeServer struct {
+	// ext are the extensions advertised in EHLO reply, nil makes EHLO
+	// fail so that the client falls back to HELO
+	ext []string
+	// replies overrides the reply to commands starting with the key, the
+	// reply can span several lines
+	replies map[string]string
+	// drop closes the connection on command starting with it
+	drop string
+
+	// cmds are the received commands and pipelined the ones received
+	// while the next command was already waiting in the buffer
+	cmds      []string
+	pipelined []string
+	// msgs are the messages received with DATA or BDAT
+	msgs []string
+	done chan struct{}
+}
+
+func (s *fakeServer) serve(conn net.Conn) {
+	defer close(s.done)
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	reply := func(lines string) bool {
+		_, err := io.WriteString(conn, strings.Replace(lines, "\n", "\r\n", -1)+"\r\n")
+		return err == nil
+	}
+	readLine := func() (string, bool) {
+		line, err := r.ReadString('\n')
+		return strings.TrimRight(line, "\r\n"), err == nil
+	}
+
+	if !reply("220 fake.example.com ESMTP") {
+		return
+	}
+	for {
+		cmd, ok := readLine()
+		if !ok {
+			return
+		}
+		s.cmds = append(s.cmds, cmd)
+		if r.Buffered() > 0 {
+			s.pipelined = append(s.pipelined, cmd)
+		}
+		if s.drop != "" && strings.HasPrefix(cmd, s.drop) {
+			return
+		}
+
+		resp := "250 2.0.0 OK"
+		for prefix, r := range s.replies {
+			if strings.HasPrefix(cmd, prefix) {
+				resp = r
+			}
+		}
+		verb := strings.ToUpper(strings.Fields(cmd + " ")[0])
+
+		switch {
+		case verb == "EHLO" && s.ext == nil:
+			resp = "502 5.5.2 EHLO not supported"
+		case verb == "EHLO":
+			resp = "250-fake.example.com greets you"
+			for _, e := range s.ext {
+				resp += "\n250-" + e
+			}
+			resp = resp[:strings.LastIndex(resp, "250-")] + "250 " + resp[strings.LastIndex(resp, "250-")+4:]
+		case verb == "AUTH" && strings.HasPrefix(cmd, "AUTH LOGIN") && resp == "250 2.0.0 OK":
+			for _, prompt := range []string{"334 VXNlcm5hbWU6", "334 UGFzc3dvcmQ6"} {
+				if !reply(prompt) {
+					return
+				}
+				line, ok := readLine()
+				if !ok {
+					return
+				}
+				s.cmds = append(s.cmds, line)
+			}
+			resp = "235 2.7.0 Authentication successful"
+		case verb == "AUTH" && strings.HasPrefix(cmd, "AUTH XOAUTH2"):
+			token, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(cmd, "AUTH XOAUTH2 "))
+			if !strings.Contains(string(token), "auth=Bearer expired") {
+				resp = "235 2.7.0 Accepted"
+				break
+			}
+			if !reply("334 " + base64.StdEncoding.EncodeToString([]byte(`{"status":"401","schemes":"bearer"}`))) {
+				return
+			}
+			if _, ok := readLine(); !ok {
+				return
+			}
+			resp = "535 5.7.8 Username and Password not accepted"
+		case verb == "AUTH" && resp == "250 2.0.0 OK":
+			resp = "235 2.7.0 Authentication successful"
+		case verb == "DATA" && resp == "250 2.0.0 OK":
+			if !reply("354 End data with <CR><LF>.<CR><LF>") {
+				return
+			}
+			var msg []string
+			for {
+				line, ok := readLine()
+				if !ok {
+					return
+				}
+				if line == "." {
+					break
+				}
+				msg = append(msg, strings.TrimPrefix(line, "."))
+			}
+			s.msgs = append(s.msgs, strings.Join(msg, "\r\n")+"\r\n")
+			resp = s.replies["."]
+			if resp == "" {
+				resp = "250 2.0.0 Queued"
+			}
+		case verb == "BDAT":
+			n, _ := strconv.Atoi(strings.Fields(cmd)[1])
+			msg := make([]byte, n)
+			if _, err := io.ReadFull(r, msg); err != nil {
+				return
+			}
+			s.msgs = append(s.msgs, string(msg))
+		case verb == "QUIT":
+			reply("221 2.0.0 Bye")
+			return
+		}
+
+		if !reply(resp) {
+			return
+		}
+	}
+}
+
+// dialFake runs the handshake of Dial against s
+func dialFake(t *testing.T, s *fakeServer, d *Dialer) (*SMTP, error) {
+	t.Helper()
+	client, server := net.Pipe()
+	s.done = make(chan struct{})
+	go s.serve(server)
+
+	c := &SMTP{
+		conn:    client,
+		text:    textproto.NewConn(client),
+		timeout: 5 * time.Second,
+		used:    time.Now(),
+	}
+	if err := c.handshake(d, &tls.Config{}); err != nil {
+		client.Close()
+		<-s.done
+		return nil, err
+	}
+	t.Cleanup(func() {
+		c.Close()
+		<-s.done
+	})
+	return c, nil
+}
+
+// wait closes the connection and waits until the server handled everything
+func (s *fakeServer) wait(c *SMTP) {
+	c.Close()
+	<-s.done
+}
+
+func TestHandshake(t *testing.T) {
+	plain := "AUTH PLAIN " + base64.StdEncoding.EncodeToString([]byte("\x00user@example.com\x00secret"))
+
+	tests := []struct {
+		name    string
+		server  fakeServer
+		dialer  Dialer
+		wantErr error
+		// code is the expected reply code of protocol error
+		code int
+		cmds []string
+	}{
+		{
+			name:   "plain auth",
+			server: fakeServer{ext: []string{"PIPELINING", "AUTH LOGIN PLAIN"}},
+			dialer: Dialer{Username: "user@example.com", Password: "secret", PlainAuth: true},
+			cmds:   []string{"EHLO localhost", plain},
+		},
+		{
+			name:   "login auth",
+			server: fakeServer{ext: []string{"AUTH LOGIN"}},
+			dialer: Dialer{Username: "user@example.com", Password: "secret", PlainAuth: true, LocalName: "mail.example.com"},
+			cmds: []string{
+				"EHLO mail.example.com",
+				"AUTH LOGIN",
+				base64.StdEncoding.EncodeToString([]byte("user@example.com")),
+				base64.StdEncoding.EncodeToString([]byte("secret")),
+			},
+		},
+		{
+			name:   "server without auth",
+			server: fakeServer{ext: []string{"8BITMIME"}},
+			dialer: Dialer{Username: "user@example.com", Password: "secret"},
+			cmds:   []string{"EHLO localhost"},
+		},
+		{
+			name:   "helo fallback",
+			server: fakeServer{},
+			cmds:   []string{"EHLO localhost", "HELO localhost"},
+		},
+		{
+			name:    "credentials over plain text",
+			server:  fakeServer{ext: []string{"AUTH PLAIN"}},
+			dialer:  Dialer{Username: "user@example.com", Password: "secret"},
+			wantErr: ErrPlainAuth,
+			cmds:    []string{"EHLO localhost"},
+		},
+		{
+			name:    "missing starttls",
+			server:  fakeServer{ext: []string{"AUTH PLAIN"}},
+			dialer:  Dialer{Username: "user@example.com", Password: "secret", Encryption: EncryptionSTARTTLS},
+			wantErr: ErrNoSTARTTLS,
+			cmds:    []string{"EHLO localhost"},
+		},
+		{
+			name: "rejected credentials",
+			server: fakeServer{
+				ext:     []string{"AUTH PLAIN"},
+				replies: map[string]string{"AUTH": "535 5.7.8 Authentication credentials invalid"},
+			},
+			dialer: Dialer{Username: "user@example.com", Password: "secret", PlainAuth: true},
+			code:   535,
+			cmds:   []string{"EHLO localhost", plain},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := tt.server
+			c, err := dialFake(t, &s, &tt.dialer)
+			switch {
+			case tt.wantErr != nil:
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("handshake() error = %v, want %v", err, tt.wantErr)
+				}
+			case tt.code != 0:
+				var tpErr *textproto.Error
+				if !errors.As(err, &tpErr) || tpErr.Code != tt.code {
+					t.Fatalf("handshake() error = %v, want reply %d", err, tt.code)
+				}
+			case err != nil:
+				t.Fatalf("handshake() error = %v", err)
+			default:
+				s.wait(c)
+			}
+
+			if fmt.Sprint(s.cmds) != fmt.Sprint(tt.cmds) {
+				t.Errorf("server got %q, want %q", s.cmds, tt.cmds)
+			}
+		})
+	}
+}
+
+func TestXOAUTH2(t *testing.T) {
+	tests := []struct {
+		name    string
+		ext     []string
+		token   string
+		wantErr string
+	}{
+		{name: "accepted", ext: []string{"AUTH PLAIN XOAUTH2"}, token: "ya29.valid"},
+		{name: "expired token", ext: []string{"AUTH XOAUTH2"}, token: "expired", wantErr: "schemes"},
+		{name: "not supported", ext: []string{"AUTH PLAIN"}, token: "ya29.valid", wantErr: "does not support AUTH XOAUTH2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &fakeServer{ext: tt.ext}
+			d := &Dialer{
+				Username:   "user@example.com",
+				Encryption: EncryptionSSL,
+				Token:      func() (string, error) { return tt.token, nil },
+			}
+			c, err := dialFake(t, s, d)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("handshake() error = %v, want error containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("handshake() error = %v", err)
+			}
+			s.wait(c)
+
+			want := "AUTH XOAUTH2 " + base64.StdEncoding.EncodeToString([]byte("user=user@example.com\x01auth=Bearer ya29.valid\x01\x01"))
+			if len(s.cmds) != 2 || s.cmds[1] != want {
+				t.Errorf("server got %q, want %q", s.cmds, want)
+			}
+		})
+	}
+}
+
+func TestExtensions(t *testing.T) {
+	s := &fakeServer{ext: []string{"SIZE 35882577", "8BITMIME", "auth LOGIN PLAIN", "ENHANCEDSTATUSCODES"}}
+	c, err := dialFake(t, s, &Dialer{})
+	if err != nil {
+		t.Fatalf("handshake() error = %v", err)
+	}
+
+	tests := []struct {
+		ext  string
+		ok   bool
+		args string
+	}{
+		{ext: "SIZE", ok: true, args: "35882577"},
+		{ext: "size", ok: true, args: "35882577"},
+		{ext: "AUTH", ok: true, args: "LOGIN PLAIN"},
+		{ext: "8BITMIME", ok: true},
+		{ext: "CHUNKING"},
+	}
+	for _, tt := range tests {
+		ok, args := c.Extension(tt.ext)
+		if ok != tt.ok || args != tt.args {
+			t.Errorf("Extension(%q) = %v, %q, want %v, %q", tt.ext, ok, args, tt.ok, tt.args)
+		}
+	}
+}
+
+func TestSend(t *testing.T) {
+	msg := "Subject: Test\r\n\r\nHello\r\n.leading dot\r\n"
+	to := []string{"john@example.com", "jane@example.com"}
+
+	tests := []struct {
+		name string
+		ext  []string
+		dsn  *DSNOptions
+		// bareLF sends the message with LF line endings
+		bareLF bool
+		cmds   []string
+		// pipelined are the commands which have to arrive together with
+		// the next one
+		pipelined []string
+		msg       string
+	}{
+		{
+			name: "sequential",
+			ext:  []string{"8BITMIME"},
+			cmds: []string{"MAIL FROM:<a@example.com>", "RCPT TO:<john@example.com>", "RCPT TO:<jane@example.com>", "DATA"},
+			msg:  msg,
+		},
+		{
+			name:      "pipelining",
+			ext:       []string{"PIPELINING"},
+			cmds:      []string{"MAIL FROM:<a@example.com>", "RCPT TO:<john@example.com>", "RCPT TO:<jane@example.com>", "DATA"},
+			pipelined: []string{"MAIL FROM:<a@example.com>", "RCPT TO:<john@example.com>", "RCPT TO:<jane@example.com>"},
+			msg:       msg,
+		},
+		{
+			name:   "chunking",
+			ext:    []string{"CHUNKING", "SIZE 1000"},
+			bareLF: true,
+			cmds: []string{
+				"MAIL FROM:<a@example.com> SIZE=38",
+				"RCPT TO:<john@example.com>",
+				"RCPT TO:<jane@example.com>",
+				"BDAT 38 LAST",
+			},
+			// the message follows BDAT without waiting for reply
+			pipelined: []string{"BDAT 38 LAST"},
+			msg:       "Subject: Test\r\n\r\nHello\r\n.leading dot\r\n",
+		},
+		{
+			name: "dsn",
+			ext:  []string{"DSN"},
+			dsn:  &DSNOptions{Notify: []DSNNotify{DSNSuccess, DSNFailure}, Return: DSNReturnHeaders, EnvelopeID: "camp=1 a+b"},
+			cmds: []string{
+				"MAIL FROM:<a@example.com> RET=HDRS ENVID=camp+3D1+20a+2Bb",
+				"RCPT TO:<john@example.com> NOTIFY=SUCCESS,FAILURE",
+				"RCPT TO:<jane@example.com> NOTIFY=SUCCESS,FAILURE",
+				"DATA",
+			},
+			msg: msg,
+		},
+		{
+			name: "dsn not supported",
+			dsn:  &DSNOptions{Notify: []DSNNotify{DSNNever}, Return: DSNReturnFull},
+			ext:  []string{"8BITMIME"},
+			cmds: []string{"MAIL FROM:<a@example.com>", "RCPT TO:<john@example.com>", "RCPT TO:<jane@example.com>", "DATA"},
+			msg:  msg,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &fakeServer{ext: tt.ext}
+			c, err := dialFake(t, s, &Dialer{})
+			if err != nil {
+				t.Fatalf("handshake() error = %v", err)
+			}
+
+			body := msg
+			if tt.bareLF {
+				body = strings.Replace(msg, "\r\n", "\n", -1)
+			}
+			if err := c.SendDSN("a@example.com", to, []byte(body), tt.dsn); err != nil {
+				t.Fatalf("SendDSN() error = %v", err)
+			}
+			if c.Sent() != 1 {
+				t.Errorf("Sent() = %d, want 1", c.Sent())
+			}
+			s.wait(c)
+
+			if got := s.cmds[1:]; fmt.Sprint(got) != fmt.Sprint(tt.cmds) {
+				t.Errorf("server got %q, want %q", got, tt.cmds)
+			}
+			if got := s.pipelined; fmt.Sprint(got) != fmt.Sprint(tt.pipelined) {
+				t.Errorf("pipelined %q, want %q", got, tt.pipelined)
+			}
+			if len(s.msgs) != 1 || s.msgs[0] != tt.msg {
+				t.Errorf("server got messages %q, want %q", s.msgs, tt.msg)
+			}
+		})
+	}
+}
+
+func TestSendRejected(t *testing.T) {
+	to := []string{"john@example.com", "nobody@example.com"}
+	rejectRcpt := map[string]string{"RCPT TO:<nobody@": "550-5.1.1 The email account that you tried to reach does not exist.\n550 5.1.1 Please try double-checking the recipient's email address"}
+
+	tests := []struct {
+		name    string
+		ext     []string
+		replies map[string]string
+		code    int
+		// closed is set if the connection has to be closed, RSET has to
+		// be sent otherwise
+		closed bool
+	}{
+		{
+			name:    "sequential",
+			ext:     []string{"8BITMIME"},
+			replies: rejectRcpt,
+			code:    550,
+		},
+		{
+			name:    "pipelined with data accepted",
+			ext:     []string{"PIPELINING"},
+			replies: rejectRcpt,
+			code:    550,
+			closed:  true,
+		},
+		{
+			name: "pipelined with data rejected",
+			ext:  []string{"PIPELINING"},
+			replies: map[string]string{
+				"RCPT TO:<nobody@": "550 5.1.1 User unknown",
+				"DATA":             "554 5.5.1 No valid recipients",
+			},
+			code: 550,
+		},
+		{
+			name:    "pipelined sender rejected",
+			ext:     []string{"PIPELINING"},
+			replies: map[string]string{"MAIL": "553 5.7.1 Sender address rejected", "DATA": "503 5.5.1 No recipients"},
+			code:    553,
+		},
+		{
+			name:    "message rejected",
+			ext:     []string{"PIPELINING"},
+			replies: map[string]string{".": "554 5.7.1 Message rejected as spam"},
+			code:    554,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &fakeServer{ext: tt.ext, replies: tt.replies}
+			c, err := dialFake(t, s, &Dialer{})
+			if err != nil {
+				t.Fatalf("handshake() error = %v", err)
+			}
+
+			err = c.Send("a@example.com", to, []byte("Subject: Test\r\n\r\nHello\r\n"))
+			var tpErr *textproto.Error
+			if !errors.As(err, &tpErr) || tpErr.Code != tt.code {
+				t.Fatalf("Send() error = %v, want reply %d", err, tt.code)
+			}
+			var dropped *DroppedError
+			if errors.As(err, &dropped) {
+				t.Errorf("Send() error = %v, rejection is not dropped connection", err)
+			}
+			if c.Sent() != 0 {
+				t.Errorf("Sent() = %d, want 0", c.Sent())
+			}
+			if c.closed != tt.closed {
+				t.Errorf("connection closed = %v, want %v", c.closed, tt.closed)
+			}
+			if tt.name == "sequential" && !strings.Contains(tpErr.Msg, "does not exist.\n5.1.1 Please try") {
+				t.Errorf("multiline reply = %q, want both lines", tpErr.Msg)
+			}
+			if tt.name == "message rejected" {
+				// the message was transferred, only accepting it failed
+				return
+			}
+
+			if !tt.closed {
+				if err := c.Noop(); err != nil {
+					t.Fatalf("Noop() after rejection error = %v", err)
+				}
+			}
+			s.wait(c)
+
+			if !tt.closed && !contains(s.cmds, "RSET") {
+				t.Errorf("server got %q, want RSET after rejection", s.cmds)
+			}
+			if len(s.msgs) != 0 {
+				t.Errorf("server got messages %q, want none", s.msgs)
+			}
+		})
+	}
+}
+
+func TestSendDropped(t *testing.T) {
+	s := &fakeServer{ext: []string{"PIPELINING"}, drop: "MAIL"}
+	c, err := dialFake(t, s, &Dialer{})
+	if err != nil {
+		t.Fatalf("handshake() error = %v", err)
+	}
+
+	err = c.Send("a@example.com", []string{"john@example.com"}, []byte("Subject: Test\r\n\r\nHello\r\n"))
+	var dropped *DroppedError
+	if !errors.As(err, &dropped) {
+		t.Fatalf("Send() error = %v, want DroppedError", err)
+	}
+	if c.Reusable(0) {
+		t.Errorf("Reusable() = true after dropped connection")
+	}
+
+	err = c.Send("a@example.com", []string{"john@example.com"}, []byte("Subject: Test\r\n\r\nHello\r\n"))
+	if !errors.As(err, &dropped) {
+		t.Errorf("Send() over closed connection error = %v, want DroppedError", err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	s := &fakeServer{
+		ext:     []string{"PIPELINING"},
+		replies: map[string]string{"RCPT TO:<nobody@": "550 5.1.1 User unknown"},
+	}
+	c, err := dialFake(t, s, &Dialer{})
+	if err != nil {
+		t.Fatalf("handshake() error = %v", err)
+	}
+
+	if err := c.Verify("a@example.com", "john@example.com"); err != nil {
+		t.Errorf("Verify() error = %v", err)
+	}
+	var tpErr *textproto.Error
+	if err := c.Verify("a@example.com", "nobody@example.com"); !errors.As(err, &tpErr) || tpErr.Code != 550 {
+		t.Errorf("Verify() error = %v, want reply 550", err)
+	}
+	s.wait(c)
+
+	want := []string{
+		"MAIL FROM:<a@example.com>", "RCPT TO:<john@example.com>", "RSET",
+		"MAIL FROM:<a@example.com>", "RCPT TO:<nobody@example.com>", "RSET",
+	}
+	if got := s.cmds[1:]; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("server got %q, want %q", got, want)
+	}
+}
+
+func TestToCRLF(t *testing.T) {
+	tests := map[string]string{
+		"a\nb\n":      "a\r\nb\r\n",
+		"a\r\nb\r\n":  "a\r\nb\r\n",
+		"\na\r\n\nb":  "\r\na\r\n\r\nb",
+		"no newline":  "no newline",
+		"mixed\r\n\n": "mixed\r\n\r\n",
+	}
+	for in, want := range tests {
+		if got := string(toCRLF([]byte(in))); got != want {
+			t.Errorf("toCRLF(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -3,10 +3,18 @@ module github.com/lateralusd/lateralus
 go 1.15
 
 require (
+	github.com/BurntSushi/toml v0.3.1
 	github.com/cheggaaa/pb/v3 v3.0.8
 	github.com/google/uuid v1.2.0
+	github.com/likexian/whois v1.12.1
+	github.com/likexian/whois-parser v1.20.3
 	github.com/muesli/termenv v0.8.1
 	github.com/spf13/cobra v1.1.3
 	github.com/xhit/go-simple-mail/v2 v2.9.0
+	golang.org/x/crypto v0.0.0-20210513164829-c07d793c2f9a
+	golang.org/x/mod v0.4.2
+	golang.org/x/net v0.0.0-20210510120150-4163338589ed
+	golang.org/x/time v0.0.0-20210220033141-f8bda1e9f3ba
 	gopkg.in/yaml.v2 v2.4.0
+	gopkg.in/yaml.v3 v3.0.1
 )
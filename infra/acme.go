@@ -0,0 +1,136 @@
+package infra
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/acme"
+)
+
+// DNSProvider creates TXT records for DNS-01 challenges
+type DNSProvider interface {
+	// SetTXT creates the record and waits until it is served, the returned
+	// function removes it
+	SetTXT(ctx context.Context, zone, fqdn, value string) (func(), error)
+}
+
+// ObtainCertificate gets certificate for domain from ACME server at
+// directoryURL, Let's Encrypt by default, solving DNS-01 challenge with
+// dns. Certificate chain and private key are returned PEM encoded.
+func ObtainCertificate(ctx context.Context, directoryURL, email, zone, domain string, dns DNSProvider) ([]byte, []byte, error) {
+	if directoryURL == "" {
+		directoryURL = acme.LetsEncryptURL
+	}
+
+	accountKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ObtainCertificate: %v", err)
+	}
+
+	client := &acme.Client{Key: accountKey, DirectoryURL: directoryURL}
+	account := &acme.Account{Contact: []string{"mailto:" + email}}
+	if _, err := client.Register(ctx, account, acme.AcceptTOS); err != nil {
+		return nil, nil, fmt.Errorf("ObtainCertificate: registering account: %v", err)
+	}
+
+	order, err := client.AuthorizeOrder(ctx, acme.DomainIDs(domain))
+	if err != nil {
+		return nil, nil, fmt.Errorf("ObtainCertificate: %v", err)
+	}
+
+	for _, authzURL := range order.AuthzURLs {
+		if err := authorize(ctx, client, authzURL, zone, dns); err != nil {
+			return nil, nil, fmt.Errorf("ObtainCertificate: %v", err)
+		}
+	}
+
+	order, err = client.WaitOrder(ctx, order.URI)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ObtainCertificate: %v", err)
+	}
+
+	certKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ObtainCertificate: %v", err)
+	}
+
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: domain},
+		DNSNames: []string{domain},
+	}, certKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ObtainCertificate: %v", err)
+	}
+
+	chain, _, err := client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ObtainCertificate: %v", err)
+	}
+
+	var certPEM []byte
+	for _, der := range chain {
+		certPEM = append(certPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+
+	keyPEM, err := encodeKey(certKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ObtainCertificate: %v", err)
+	}
+
+	return certPEM, keyPEM, nil
+}
+
+// authorize solves DNS-01 challenge of the authorization
+func authorize(ctx context.Context, client *acme.Client, authzURL, zone string, dns DNSProvider) error {
+	authz, err := client.GetAuthorization(ctx, authzURL)
+	if err != nil {
+		return err
+	}
+	if authz.Status == acme.StatusValid {
+		return nil
+	}
+
+	var chal *acme.Challenge
+	for _, c := range authz.Challenges {
+		if c.Type == "dns-01" {
+			chal = c
+			break
+		}
+	}
+	if chal == nil {
+		return errors.New("ACME server offers no dns-01 challenge")
+	}
+
+	value, err := client.DNS01ChallengeRecord(chal.Token)
+	if err != nil {
+		return err
+	}
+
+	cleanup, err := dns.SetTXT(ctx, zone, "_acme-challenge."+authz.Identifier.Value, value)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
+	if _, err := client.Accept(ctx, chal); err != nil {
+		return err
+	}
+	_, err = client.WaitAuthorization(ctx, authzURL)
+	return err
+}
+
+func encodeKey(key crypto.Signer) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
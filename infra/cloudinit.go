@@ -0,0 +1,218 @@
+package infra
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+)
+
+// landingPort is where NGINX forwards the requests, lateralus serve listens
+// there
+const landingPort = 8080
+
+// releaseURL is the download URL of release asset, formatted with the
+// version without v prefix and the asset name
+const releaseURL = "https://github.com/lateralusd/lateralus/releases/download/v%s/%s"
+
+// webroot is where certbot puts HTTP-01 challenges, NGINX serves it on port 80
+const webroot = "/var/www/letsencrypt"
+
+// postfixTemplate is smtp.conf, Postfix main.cf which relays mails only
+// for the listed networks
+var postfixTemplate = template.Must(template.New("smtp.conf").Parse(`# Postfix main.cf generated by lateralus
+myhostname = {{ .Domain }}
+mydomain = {{ .Domain }}
+myorigin = $mydomain
+mydestination = localhost
+inet_interfaces = all
+inet_protocols = ipv4
+mynetworks = 127.0.0.0/8{{ range .RelayFrom }} {{ . }}{{ end }}
+smtpd_relay_restrictions = permit_mynetworks, reject_unauth_destination
+smtpd_banner = $myhostname ESMTP
+disable_vrfy_command = yes
+
+smtpd_tls_cert_file = /etc/lateralus/cert.pem
+smtpd_tls_key_file = /etc/lateralus/key.pem
+smtpd_tls_security_level = may
+smtp_tls_security_level = may
+`))
+
+var nginxTemplate = template.Must(template.New("nginx").Parse(`server {
+    listen 80;
+    server_name {{ .Domain }};
+
+    location /.well-known/acme-challenge/ {
+        root {{ .Webroot }};
+    }
+
+    location / {
+        return 301 https://$host$request_uri;
+    }
+}
+
+server {
+    listen 443 ssl;
+    server_name {{ .Domain }};
+
+    ssl_certificate /etc/lateralus/cert.pem;
+    ssl_certificate_key /etc/lateralus/key.pem;
+
+    location / {
+        proxy_pass http://127.0.0.1:{{ .Port }};
+        proxy_set_header Host $host;
+        proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+        proxy_set_header X-Forwarded-Proto $scheme;
+    }
+}
+`))
+
+// serveConfigTemplate is the config of lateralus serve on the droplet, it
+// records the clicks and redirects the targets
+var serveConfigTemplate = template.Must(template.New("serve.yaml").Parse(`url:
+  generate: True
+  link: "https://{{ .Domain }}/?id=<CHANGE>"
+
+landing:
+  redirect: "{{ .Redirect }}"
+`))
+
+var serviceTemplate = template.Must(template.New("lateralus.service").Parse(`[Unit]
+Description=lateralus landing server
+After=network-online.target
+Wants=network-online.target
+
+[Service]
+ExecStart=/usr/local/bin/lateralus serve -c /etc/lateralus/serve.yaml --listen 127.0.0.1:{{ .Port }} --trust-proxy --events /var/lib/lateralus/events.jsonl
+DynamicUser=yes
+StateDirectory=lateralus
+Restart=always
+
+[Install]
+WantedBy=multi-user.target
+`))
+
+// certbotCronTemplate renews the certificate over HTTP-01 once the domain points to
+// the droplet. The certificate from provisioning is replaced by the first run
+// and certbot renews it from then on, copying it to the paths used by NGINX
+// and Postfix.
+var certbotCronTemplate = template.Must(template.New("lateralus-certbot").Parse(`# renewal of the certificate generated by lateralus
+SHELL=/bin/sh
+PATH=/usr/sbin:/usr/bin:/sbin:/bin
+17 3 * * * root certbot certonly --non-interactive --agree-tos --keep-until-expiring --webroot -w {{ .Webroot }} -d {{ .Domain }} -m {{ .Email }}{{ if .Directory }} --server {{ .Directory }}{{ end }} --deploy-hook "install -m 0644 \$RENEWED_LINEAGE/fullchain.pem /etc/lateralus/cert.pem && install -m 0600 \$RENEWED_LINEAGE/privkey.pem /etc/lateralus/key.pem && systemctl reload nginx postfix" >/dev/null 2>&1
+`))
+
+var cloudConfigTemplate = template.Must(template.New("cloud-config").Funcs(template.FuncMap{
+	"indent": func(s string) string {
+		return "      " + strings.ReplaceAll(strings.TrimRight(s, "\n"), "\n", "\n      ")
+	},
+}).Parse(`#cloud-config
+package_update: true
+packages:
+  - nginx
+  - postfix
+  - ufw
+  - certbot
+  - curl
+write_files:
+  - path: /etc/lateralus/cert.pem
+    permissions: "0644"
+    content: |
+{{ indent .Cert }}
+  - path: /etc/lateralus/key.pem
+    permissions: "0600"
+    content: |
+{{ indent .Key }}
+  - path: /etc/nginx/sites-available/lateralus
+    content: |
+{{ indent .Nginx }}
+  - path: /etc/lateralus/main.cf
+    content: |
+{{ indent .SMTP }}
+  - path: /etc/lateralus/serve.yaml
+    permissions: "0644"
+    content: |
+{{ indent .Serve }}
+  - path: /etc/systemd/system/lateralus.service
+    content: |
+{{ indent .Service }}
+  - path: /etc/cron.d/lateralus-certbot
+    content: |
+{{ indent .Certbot }}
+runcmd:
+  - mkdir -p {{ .Webroot }}
+  - cd /tmp && curl -fsSLO {{ .ArchiveURL }} && curl -fsSLO {{ .ChecksumsURL }} && sha256sum --ignore-missing -c {{ .Checksums }} && tar -xzf {{ .Archive }} -C /usr/local/bin lateralus
+  - systemctl daemon-reload
+  - systemctl enable --now lateralus
+  - rm -f /etc/nginx/sites-enabled/default
+  - ln -sf /etc/nginx/sites-available/lateralus /etc/nginx/sites-enabled/lateralus
+  - systemctl restart nginx
+  - cp /etc/lateralus/main.cf /etc/postfix/main.cf
+  - systemctl restart postfix
+  - ufw allow 22/tcp
+  - ufw allow 25/tcp
+  - ufw allow 80/tcp
+  - ufw allow 443/tcp
+  - ufw --force enable
+`))
+
+// SMTPConfig returns Postfix main.cf for domain relaying mails from
+// relayFrom networks
+func SMTPConfig(domain string, relayFrom []string) (string, error) {
+	var buf bytes.Buffer
+	err := postfixTemplate.Execute(&buf, struct {
+		Domain    string
+		RelayFrom []string
+	}{domain, relayFrom})
+	if err != nil {
+		return "", fmt.Errorf("SMTPConfig: %v", err)
+	}
+	return buf.String(), nil
+}
+
+// cloudConfig returns user data which installs the certificate with its
+// renewal, NGINX in front of lateralus serve of p.Version and Postfix with
+// smtpConf
+func cloudConfig(p Provision, domain string, cert, key []byte, smtpConf string) (string, error) {
+	var nginx, serve, service, certbot bytes.Buffer
+	err := nginxTemplate.Execute(&nginx, struct {
+		Domain  string
+		Port    int
+		Webroot string
+	}{domain, landingPort, webroot})
+	if err != nil {
+		return "", err
+	}
+
+	if err := serveConfigTemplate.Execute(&serve, struct{ Domain, Redirect string }{domain, p.Redirect}); err != nil {
+		return "", err
+	}
+
+	if err := serviceTemplate.Execute(&service, struct{ Port int }{landingPort}); err != nil {
+		return "", err
+	}
+
+	err = certbotCronTemplate.Execute(&certbot, struct {
+		Domain, Email, Directory, Webroot string
+	}{domain, p.ACMEEmail, p.ACMEDirectory, webroot})
+	if err != nil {
+		return "", err
+	}
+
+	version := strings.TrimPrefix(p.Version, "v")
+	archive := fmt.Sprintf("lateralus_%s_linux_amd64.tar.gz", version)
+	checksums := fmt.Sprintf("lateralus_%s_checksums.txt", version)
+
+	var buf bytes.Buffer
+	err = cloudConfigTemplate.Execute(&buf, struct {
+		Cert, Key, Nginx, SMTP, Serve, Service, Certbot       string
+		Webroot, Archive, ArchiveURL, Checksums, ChecksumsURL string
+	}{
+		string(cert), string(key), nginx.String(), smtpConf, serve.String(), service.String(), certbot.String(),
+		webroot, archive, fmt.Sprintf(releaseURL, version, archive), checksums, fmt.Sprintf(releaseURL, version, checksums),
+	})
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
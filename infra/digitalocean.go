@@ -0,0 +1,233 @@
+package infra
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const digitalOceanEndpoint = "https://api.digitalocean.com/v2"
+
+// digitalOceanNameserver serves the DNS zones hosted at DigitalOcean
+const digitalOceanNameserver = "ns1.digitalocean.com:53"
+
+// DigitalOcean creates droplets and DNS records with DigitalOcean API
+type DigitalOcean struct {
+	Token string
+	// Endpoint is the API base URL, DigitalOcean API by default
+	Endpoint string
+	// Nameserver is queried for created records, ns1.digitalocean.com by default
+	Nameserver string
+	Client     *http.Client
+}
+
+// Droplet describes the droplet to create
+type Droplet struct {
+	Name     string   `json:"name"`
+	Region   string   `json:"region"`
+	Size     string   `json:"size"`
+	Image    string   `json:"image"`
+	SSHKeys  []string `json:"ssh_keys,omitempty"`
+	UserData string   `json:"user_data,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+}
+
+// doRequest sends JSON body and decodes the response into v if it is not nil
+func (d *DigitalOcean) doRequest(ctx context.Context, method, path string, body, v interface{}) error {
+	endpoint := d.Endpoint
+	if endpoint == "" {
+		endpoint = digitalOceanEndpoint
+	}
+	client := d.Client
+	if client == nil {
+		client = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, endpoint+path, r)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+d.Token)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		var apiErr struct {
+			ID      string `json:"id"`
+			Message string `json:"message"`
+		}
+		json.NewDecoder(resp.Body).Decode(&apiErr)
+		return fmt.Errorf("%s %s: %s: %s", method, path, resp.Status, apiErr.Message)
+	}
+
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// HasZone reports whether zone is DNS zone of the account
+func (d *DigitalOcean) HasZone(ctx context.Context, zone string) error {
+	if err := d.doRequest(ctx, http.MethodGet, "/domains/"+zone, nil, nil); err != nil {
+		return fmt.Errorf("HasZone: %v", err)
+	}
+	return nil
+}
+
+// CreateRecord adds DNS record to zone, name is relative to the zone with
+// @ for the zone itself
+func (d *DigitalOcean) CreateRecord(ctx context.Context, zone, recordType, name, data string) (int64, error) {
+	req := map[string]interface{}{
+		"type": recordType,
+		"name": name,
+		"data": data,
+		"ttl":  60,
+	}
+	var res struct {
+		Record struct {
+			ID int64 `json:"id"`
+		} `json:"domain_record"`
+	}
+	if err := d.doRequest(ctx, http.MethodPost, "/domains/"+zone+"/records", req, &res); err != nil {
+		return 0, fmt.Errorf("CreateRecord: %v", err)
+	}
+	return res.Record.ID, nil
+}
+
+// DeleteRecord removes DNS record from zone
+func (d *DigitalOcean) DeleteRecord(ctx context.Context, zone string, id int64) error {
+	if err := d.doRequest(ctx, http.MethodDelete, fmt.Sprintf("/domains/%s/records/%d", zone, id), nil, nil); err != nil {
+		return fmt.Errorf("DeleteRecord: %v", err)
+	}
+	return nil
+}
+
+// SetTXT creates TXT record for fqdn in zone and waits until DigitalOcean
+// nameserver serves it
+func (d *DigitalOcean) SetTXT(ctx context.Context, zone, fqdn, value string) (func(), error) {
+	name := relativeName(fqdn, zone)
+	id, err := d.CreateRecord(ctx, zone, "TXT", name, value)
+	if err != nil {
+		return nil, fmt.Errorf("SetTXT: %v", err)
+	}
+	cleanup := func() {
+		d.DeleteRecord(context.Background(), zone, id)
+	}
+
+	nameserver := d.Nameserver
+	if nameserver == "" {
+		nameserver = digitalOceanNameserver
+	}
+	if err := waitForTXT(ctx, nameserver, fqdn, value); err != nil {
+		cleanup()
+		return nil, fmt.Errorf("SetTXT: %v", err)
+	}
+
+	return cleanup, nil
+}
+
+// CreateDroplet creates the droplet and returns its id
+func (d *DigitalOcean) CreateDroplet(ctx context.Context, droplet Droplet) (int64, error) {
+	var res struct {
+		Droplet struct {
+			ID int64 `json:"id"`
+		} `json:"droplet"`
+	}
+	if err := d.doRequest(ctx, http.MethodPost, "/droplets", droplet, &res); err != nil {
+		return 0, fmt.Errorf("CreateDroplet: %v", err)
+	}
+	return res.Droplet.ID, nil
+}
+
+// WaitForDroplet polls the droplet until it is active and returns its
+// public IPv4 address
+func (d *DigitalOcean) WaitForDroplet(ctx context.Context, id int64) (string, error) {
+	for {
+		var res struct {
+			Droplet struct {
+				Status   string `json:"status"`
+				Networks struct {
+					V4 []struct {
+						IPAddress string `json:"ip_address"`
+						Type      string `json:"type"`
+					} `json:"v4"`
+				} `json:"networks"`
+			} `json:"droplet"`
+		}
+		if err := d.doRequest(ctx, http.MethodGet, fmt.Sprintf("/droplets/%d", id), nil, &res); err != nil {
+			return "", fmt.Errorf("WaitForDroplet: %v", err)
+		}
+
+		if res.Droplet.Status == "active" {
+			for _, n := range res.Droplet.Networks.V4 {
+				if n.Type == "public" {
+					return n.IPAddress, nil
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", fmt.Errorf("WaitForDroplet: %v", ctx.Err())
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+// relativeName returns fqdn relative to zone, @ for the zone itself
+func relativeName(fqdn, zone string) string {
+	fqdn = strings.TrimSuffix(fqdn, ".")
+	if fqdn == zone {
+		return "@"
+	}
+	return strings.TrimSuffix(fqdn, "."+zone)
+}
+
+// waitForTXT queries nameserver until it returns value for fqdn, so that
+// ACME server sees the record
+func waitForTXT(ctx context.Context, nameserver, fqdn, value string) error {
+	resolver := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, nameserver)
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Minute)
+	defer cancel()
+	for {
+		txts, _ := resolver.LookupTXT(ctx, fqdn)
+		for _, t := range txts {
+			if t == value {
+				return nil
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("TXT record of %s not visible: %v", fqdn, ctx.Err())
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
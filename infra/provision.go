@@ -0,0 +1,124 @@
+package infra
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lateralusd/lateralus/logging"
+	"github.com/lateralusd/lateralus/util"
+)
+
+// Provision describes the infrastructure to create
+type Provision struct {
+	Domain string
+	// ACMEEmail is registered with Let's Encrypt
+	ACMEEmail string
+	// ACMEDirectory is the ACME server, Let's Encrypt by default
+	ACMEDirectory string
+	Region        string
+	Size          string
+	Image         string
+	// SSHKeys are ids or fingerprints of the account SSH keys added to droplet
+	SSHKeys []string
+	// RelayFrom are networks which may send mails through the droplet
+	RelayFrom []string
+	// Version of lateralus release installed on the droplet
+	Version string
+	// Redirect is where lateralus serve on the droplet sends the targets,
+	// https://<zone>/ by default
+	Redirect string
+}
+
+// Result holds what was created
+type Result struct {
+	DropletID int64
+	IP        string
+	// CertExpiry is when the certificate obtained for provisioning expires,
+	// certbot on the droplet renews it before
+	CertExpiry time.Time
+	// SMTPConfig is Postfix main.cf installed on the droplet
+	SMTPConfig string
+}
+
+// ProvisionDigitalOcean obtains certificate for p.Domain, creates droplet
+// running NGINX and Postfix with it and points the domain to the droplet.
+// Parent domain of p.Domain has to be DNS zone of the account.
+func ProvisionDigitalOcean(ctx context.Context, do *DigitalOcean, p Provision) (*Result, error) {
+	domain := strings.ToLower(strings.TrimSuffix(p.Domain, "."))
+	zone, err := util.RegisteredDomain(domain)
+	if err != nil {
+		return nil, fmt.Errorf("ProvisionDigitalOcean: %v", err)
+	}
+
+	if err := do.HasZone(ctx, zone); err != nil {
+		return nil, fmt.Errorf("ProvisionDigitalOcean: zone %s is not hosted at DigitalOcean: %v", zone, err)
+	}
+
+	logging.Infof("Obtaining certificate for %s", domain)
+	cert, key, err := ObtainCertificate(ctx, p.ACMEDirectory, p.ACMEEmail, zone, domain, do)
+	if err != nil {
+		return nil, fmt.Errorf("ProvisionDigitalOcean: %v", err)
+	}
+
+	smtpConf, err := SMTPConfig(domain, p.RelayFrom)
+	if err != nil {
+		return nil, fmt.Errorf("ProvisionDigitalOcean: %v", err)
+	}
+
+	expiry, err := certExpiry(cert)
+	if err != nil {
+		return nil, fmt.Errorf("ProvisionDigitalOcean: %v", err)
+	}
+
+	if p.Redirect == "" {
+		p.Redirect = "https://" + zone + "/"
+	}
+	userData, err := cloudConfig(p, domain, cert, key, smtpConf)
+	if err != nil {
+		return nil, fmt.Errorf("ProvisionDigitalOcean: %v", err)
+	}
+
+	logging.Infof("Creating droplet in %s", p.Region)
+	id, err := do.CreateDroplet(ctx, Droplet{
+		Name:     strings.ReplaceAll(domain, ".", "-"),
+		Region:   p.Region,
+		Size:     p.Size,
+		Image:    p.Image,
+		SSHKeys:  p.SSHKeys,
+		UserData: userData,
+		Tags:     []string{"lateralus"},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("ProvisionDigitalOcean: %v", err)
+	}
+
+	ip, err := do.WaitForDroplet(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("ProvisionDigitalOcean: %v", err)
+	}
+
+	logging.Infof("Pointing %s to %s", domain, ip)
+	if _, err := do.CreateRecord(ctx, zone, "A", relativeName(domain, zone), ip); err != nil {
+		return nil, fmt.Errorf("ProvisionDigitalOcean: %v", err)
+	}
+
+	return &Result{DropletID: id, IP: ip, CertExpiry: expiry, SMTPConfig: smtpConf}, nil
+}
+
+// certExpiry returns when the first certificate of PEM encoded chain expires
+func certExpiry(chain []byte) (time.Time, error) {
+	block, _ := pem.Decode(chain)
+	if block == nil {
+		return time.Time{}, errors.New("no certificate in the chain")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return cert.NotAfter, nil
+}
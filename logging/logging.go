@@ -17,6 +17,11 @@ func Infof(format string, args ...interface{}) {
 	printLog("info", format, args...)
 }
 
+// Warningf will log messages to os.Stdout with WARNING level
+func Warningf(format string, args ...interface{}) {
+	printLog("warning", format, args...)
+}
+
 // Errorf will log messages to os.Stdout with ERROR level
 func Errorf(format string, args ...interface{}) {
 	printLog("error", format, args...)
@@ -4,6 +4,10 @@ import (
 	"github.com/lateralusd/lateralus/cmd"
 )
 
+// version is set by GoReleaser
+var version = "dev"
+
 func main() {
+	cmd.RootCmd.Version = version
 	cmd.RootCmd.Execute()
 }
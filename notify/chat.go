@@ -0,0 +1,145 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Chat providers
+const (
+	Slack    = "slack"
+	Telegram = "telegram"
+	Discord  = "discord"
+	Teams    = "teams"
+)
+
+const telegramEndpoint = "https://api.telegram.org"
+
+// Chat posts summaries of the campaign to Slack, Telegram, Discord or
+// Microsoft Teams
+type Chat struct {
+	Provider string
+	// URL is incoming webhook of Slack, Discord or Teams
+	URL string
+	// Token of Telegram bot and ChatID of the chat it posts to
+	Token  string
+	ChatID string
+	// Targets enables posting of opens, clicks and form submissions
+	Targets bool
+	// Endpoint is Telegram API base URL, api.telegram.org by default
+	Endpoint string
+	Client   *http.Client
+}
+
+// Notify posts the event, events about single targets are skipped unless
+// Targets is set and sent mails are never posted
+func (c *Chat) Notify(ctx context.Context, e Event) error {
+	if !summarized(e, c.Targets) {
+		return nil
+	}
+
+	var url string
+	var body interface{}
+	text := Message(e)
+	switch c.Provider {
+	case Slack, Teams:
+		url, body = c.URL, map[string]string{"text": text}
+	case Discord:
+		url, body = c.URL, map[string]string{"content": text}
+	case Telegram:
+		endpoint := c.Endpoint
+		if endpoint == "" {
+			endpoint = telegramEndpoint
+		}
+		url = fmt.Sprintf("%s/bot%s/sendMessage", endpoint, c.Token)
+		body = map[string]string{"chat_id": c.ChatID, "text": text}
+	default:
+		return fmt.Errorf("Notify: unknown provider %q", c.Provider)
+	}
+
+	if err := c.post(ctx, url, body); err != nil {
+		return fmt.Errorf("Notify: %s: %v", c.Provider, err)
+	}
+	return nil
+}
+
+// summarized reports whether the event is posted to chats and mailed,
+// events about single targets only if targets is set
+func summarized(e Event, targets bool) bool {
+	switch e.Type {
+	case CampaignStarted, CampaignProgress, CampaignFinished:
+		return true
+	case EmailOpened, LinkClicked, FormSubmitted:
+		return targets
+	}
+	return false
+}
+
+func (c *Chat) post(ctx context.Context, url string, body interface{}) error {
+	d, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(d))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		if c.Token != "" {
+			// the error holds the URL, which contains the Telegram token
+			return errors.New(strings.Replace(err.Error(), c.Token, "****", -1))
+		}
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return errors.New(resp.Status)
+	}
+	return nil
+}
+
+// Message describes the event in single line of text
+func Message(e Event) string {
+	target := e.Email
+	if e.Name != "" {
+		target = fmt.Sprintf("%s <%s>", e.Name, e.Email)
+	}
+	if target == "" {
+		target = "unknown target " + e.ID
+	}
+	at := e.Time.Local().Format("2006-01-02 15:04:05")
+
+	switch e.Type {
+	case CampaignStarted:
+		return fmt.Sprintf("Campaign %s started at %s, sending %d mails", e.Campaign, at, e.Total)
+	case CampaignProgress:
+		return fmt.Sprintf("Campaign %s: %d of %d mails sent, %d failed", e.Campaign, e.Sent, e.Total, e.Failed)
+	case CampaignFinished:
+		return fmt.Sprintf("Campaign %s finished at %s: %d of %d mails sent, %d failed", e.Campaign, at, e.Sent, e.Total, e.Failed)
+	case EmailOpened:
+		return fmt.Sprintf("%s opened the mail at %s from %s (%s)", target, at, e.IP, e.UserAgent)
+	case LinkClicked:
+		return fmt.Sprintf("%s clicked the link at %s from %s (%s)", target, at, e.IP, e.UserAgent)
+	case FormSubmitted:
+		return fmt.Sprintf("%s submitted %s at %s from %s (%s)", target, strings.Join(e.Fields, ", "), at, e.IP, e.UserAgent)
+	case EmailSent:
+		return fmt.Sprintf("Mail to %s was sent", target)
+	case SendFailed:
+		return fmt.Sprintf("Mail to %s failed: %s", target, e.Error)
+	}
+	return e.Type
+}
@@ -0,0 +1,156 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// request is single request received by the chat server
+type request struct {
+	path string
+	body map[string]string
+}
+
+// newChatServer records the JSON bodies posted to it, responding with status
+func newChatServer(t *testing.T, status int) (*httptest.Server, chan request) {
+	t.Helper()
+	requests := make(chan request, 10)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("decoding body: %v", err)
+		}
+		if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("Content-Type = %q, want application/json", ct)
+		}
+		requests <- request{path: r.URL.Path, body: body}
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(ts.Close)
+	return ts, requests
+}
+
+func TestChatNotify(t *testing.T) {
+	ts, requests := newChatServer(t, http.StatusOK)
+	e := Event{Type: CampaignFinished, Campaign: "q3", Total: 10, Sent: 9, Failed: 1}
+	text := Message(e)
+
+	tests := []struct {
+		chat     *Chat
+		wantPath string
+		want     map[string]string
+	}{
+		{chat: &Chat{Provider: Slack, URL: ts.URL + "/slack"}, wantPath: "/slack", want: map[string]string{"text": text}},
+		{chat: &Chat{Provider: Teams, URL: ts.URL + "/teams"}, wantPath: "/teams", want: map[string]string{"text": text}},
+		{chat: &Chat{Provider: Discord, URL: ts.URL + "/discord"}, wantPath: "/discord", want: map[string]string{"content": text}},
+		{
+			chat:     &Chat{Provider: Telegram, Token: "123:abc", ChatID: "-100", Endpoint: ts.URL},
+			wantPath: "/bot123:abc/sendMessage",
+			want:     map[string]string{"chat_id": "-100", "text": text},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.chat.Provider, func(t *testing.T) {
+			if err := tt.chat.Notify(context.Background(), e); err != nil {
+				t.Fatalf("Notify() error = %v", err)
+			}
+			r := <-requests
+			if r.path != tt.wantPath {
+				t.Errorf("posted to %s, want %s", r.path, tt.wantPath)
+			}
+			if len(r.body) != len(tt.want) {
+				t.Errorf("body = %v, want %v", r.body, tt.want)
+			}
+			for k, v := range tt.want {
+				if r.body[k] != v {
+					t.Errorf("%s = %q, want %q", k, r.body[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestChatNotifySkipped(t *testing.T) {
+	ts, requests := newChatServer(t, http.StatusOK)
+	chat := &Chat{Provider: Slack, URL: ts.URL}
+
+	for _, typ := range []string{EmailSent, SendFailed, EmailOpened, LinkClicked, FormSubmitted} {
+		if err := chat.Notify(context.Background(), Event{Type: typ}); err != nil {
+			t.Errorf("Notify(%s) error = %v", typ, err)
+		}
+	}
+	if len(requests) != 0 {
+		t.Errorf("%d events posted, want none", len(requests))
+	}
+
+	chat.Targets = true
+	if err := chat.Notify(context.Background(), Event{Type: LinkClicked, Email: "john@example.com"}); err != nil {
+		t.Errorf("Notify() error = %v", err)
+	}
+	if len(requests) != 1 {
+		t.Errorf("%d events posted, want click", len(requests))
+	}
+}
+
+func TestChatNotifyErrors(t *testing.T) {
+	ts, _ := newChatServer(t, http.StatusForbidden)
+	e := Event{Type: CampaignStarted}
+
+	if err := (&Chat{Provider: Slack, URL: ts.URL}).Notify(context.Background(), e); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("Notify() error = %v, want 403", err)
+	}
+	if err := (&Chat{Provider: "irc", URL: ts.URL}).Notify(context.Background(), e); err == nil {
+		t.Errorf("Notify() of unknown provider error = nil, want error")
+	}
+
+	// the token is part of the URL and must not show up in the error
+	chat := &Chat{Provider: Telegram, Token: "123:secret", ChatID: "-100", Endpoint: "http://127.0.0.1:1"}
+	err := chat.Notify(context.Background(), e)
+	if err == nil || strings.Contains(err.Error(), "secret") {
+		t.Errorf("Notify() error = %v, want error without the token", err)
+	}
+}
+
+func TestMessage(t *testing.T) {
+	at := time.Date(2026, 10, 15, 9, 3, 44, 0, time.Local)
+	tests := []struct {
+		name string
+		e    Event
+		want string
+	}{
+		{
+			name: "name and email",
+			e:    Event{Type: LinkClicked, Name: "John Doe", Email: "john@example.com", Time: at, IP: "198.51.100.7", UserAgent: "curl"},
+			want: "John Doe <john@example.com> clicked the link at 2026-10-15 09:03:44 from 198.51.100.7 (curl)",
+		},
+		{
+			name: "email only",
+			e:    Event{Type: EmailOpened, Email: "john@example.com", Time: at, IP: "198.51.100.7", UserAgent: "curl"},
+			want: "john@example.com opened the mail at 2026-10-15 09:03:44 from 198.51.100.7 (curl)",
+		},
+		{
+			name: "unknown target",
+			e:    Event{Type: FormSubmitted, ID: "abc123", Fields: []string{"user", "password"}, Time: at, IP: "198.51.100.7", UserAgent: "curl"},
+			want: "unknown target abc123 submitted user, password at 2026-10-15 09:03:44 from 198.51.100.7 (curl)",
+		},
+		{
+			name: "progress",
+			e:    Event{Type: CampaignProgress, Campaign: "q3", Total: 10, Sent: 5, Failed: 1},
+			want: "Campaign q3: 5 of 10 mails sent, 1 failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Message(tt.e); got != tt.want {
+				t.Errorf("Message() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
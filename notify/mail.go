@@ -0,0 +1,47 @@
+package notify
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/lateralusd/lateralus/email"
+)
+
+// Mail sends the events as mails to To through the mail server of Dialer
+type Mail struct {
+	From string
+	To   []string
+	// Targets enables mails about opens, clicks and form submissions
+	Targets bool
+	Dialer  *email.Dialer
+}
+
+// Notify mails the event, the same events as Chat posts are sent
+func (m *Mail) Notify(ctx context.Context, e Event) error {
+	if !summarized(e, m.Targets) {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("Notify: %v", err)
+	}
+
+	text := Message(e)
+	msg, err := email.BuildMIMEMessage(m.From, strings.Join(m.To, ", "), "lateralus: "+text, "", text+"\n", nil)
+	if err != nil {
+		return fmt.Errorf("Notify: %v", err)
+	}
+
+	c, err := m.Dialer.Dial()
+	if err != nil {
+		return fmt.Errorf("Notify: %v", err)
+	}
+	defer c.Close()
+
+	if err := c.Send(m.From, m.To, msg); err != nil {
+		return fmt.Errorf("Notify: %v", err)
+	}
+	// the mail is accepted already, failed QUIT does not matter
+	c.Quit()
+	return nil
+}
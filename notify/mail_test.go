@@ -0,0 +1,164 @@
+package notify
+
+import (
+	"context"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/lateralusd/lateralus/email"
+)
+
+// smtpMessage is a mail received by the fake SMTP server
+type smtpMessage struct {
+	from string
+	to   []string
+	data string
+}
+
+// newSMTPServer accepts mails from any sender to any recipient without
+// authentication, the received ones are sent to the channel
+func newSMTPServer(t *testing.T) (*email.Dialer, chan smtpMessage) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	msgs := make(chan smtpMessage, 10)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveSMTP(conn, msgs)
+		}
+	}()
+
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	p, _ := strconv.Atoi(port)
+	return &email.Dialer{Host: "127.0.0.1", Port: p, Encryption: email.EncryptionNone}, msgs
+}
+
+func serveSMTP(conn net.Conn, msgs chan smtpMessage) {
+	defer conn.Close()
+	text := textproto.NewConn(conn)
+	text.PrintfLine("220 localhost ESMTP")
+
+	var msg smtpMessage
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"):
+			text.PrintfLine("250-localhost\r\n250 8BITMIME")
+		case strings.HasPrefix(cmd, "MAIL FROM:"):
+			msg = smtpMessage{from: strings.Trim(line[len("MAIL FROM:"):], "<> ")}
+			text.PrintfLine("250 OK")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			msg.to = append(msg.to, strings.Trim(line[len("RCPT TO:"):], "<> "))
+			text.PrintfLine("250 OK")
+		case cmd == "DATA":
+			text.PrintfLine("354 Go ahead")
+			d, err := ioutil.ReadAll(text.DotReader())
+			if err != nil {
+				return
+			}
+			msg.data = string(d)
+			msgs <- msg
+			text.PrintfLine("250 OK")
+		case cmd == "QUIT":
+			text.PrintfLine("221 Bye")
+			return
+		default:
+			text.PrintfLine("502 Not implemented")
+		}
+	}
+}
+
+func TestMailNotify(t *testing.T) {
+	dialer, msgs := newSMTPServer(t)
+	m := &Mail{
+		From:    "phish@example.com",
+		To:      []string{"redteam@example.com", "lead@example.com"},
+		Targets: true,
+		Dialer:  dialer,
+	}
+
+	e := Event{Type: LinkClicked, Name: "Jürgen Müller", Email: "juergen@example.com", IP: "198.51.100.7", UserAgent: "curl"}
+	if err := m.Notify(context.Background(), e); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+
+	got := <-msgs
+	if got.from != m.From || strings.Join(got.to, ",") != "redteam@example.com,lead@example.com" {
+		t.Errorf("mail from %s to %v, want from %s to %v", got.from, got.to, m.From, m.To)
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(got.data))
+	if err != nil {
+		t.Fatalf("ReadMessage() error = %v", err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil {
+		t.Fatalf("DecodeHeader() error = %v", err)
+	}
+	if want := "lateralus: " + Message(e); subject != want {
+		t.Errorf("Subject = %q, want %q", subject, want)
+	}
+	if !strings.Contains(got.data, "clicked the link") {
+		t.Errorf("mail has no message:\n%s", got.data)
+	}
+}
+
+func TestMailNotifySkipped(t *testing.T) {
+	dialer, msgs := newSMTPServer(t)
+	m := &Mail{From: "phish@example.com", To: []string{"redteam@example.com"}, Dialer: dialer}
+
+	for _, typ := range []string{EmailSent, LinkClicked} {
+		if err := m.Notify(context.Background(), Event{Type: typ}); err != nil {
+			t.Errorf("Notify(%s) error = %v", typ, err)
+		}
+	}
+	if err := m.Notify(context.Background(), Event{Type: CampaignStarted, Campaign: "q3", Total: 3}); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+	if got := <-msgs; !strings.Contains(got.data, "Campaign q3 started") {
+		t.Errorf("first mail is not about the start:\n%s", got.data)
+	}
+	if len(msgs) != 0 {
+		t.Errorf("%d more mails sent, want none", len(msgs))
+	}
+}
+
+func TestMailNotifyErrors(t *testing.T) {
+	dialer, _ := newSMTPServer(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	m := &Mail{From: "phish@example.com", To: []string{"redteam@example.com"}, Dialer: dialer}
+	if err := m.Notify(ctx, Event{Type: CampaignStarted}); err == nil {
+		t.Errorf("Notify() with canceled context error = nil, want error")
+	}
+
+	m.To = []string{"not an address"}
+	if err := m.Notify(context.Background(), Event{Type: CampaignStarted}); err == nil {
+		t.Errorf("Notify() to invalid address error = nil, want error")
+	}
+
+	m.To = []string{"redteam@example.com"}
+	m.Dialer = &email.Dialer{Host: "127.0.0.1", Port: 1, Encryption: email.EncryptionNone}
+	if err := m.Notify(context.Background(), Event{Type: CampaignStarted}); err == nil {
+		t.Errorf("Notify() without server error = nil, want error")
+	}
+}
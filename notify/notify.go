@@ -0,0 +1,110 @@
+package notify
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/lateralusd/lateralus/logging"
+)
+
+// Types of the events
+const (
+	CampaignStarted  = "campaign_started"
+	CampaignProgress = "campaign_progress"
+	CampaignFinished = "campaign_finished"
+	EmailSent        = "email_sent"
+	SendFailed       = "send_failed"
+	EmailOpened      = "email_opened"
+	LinkClicked      = "link_clicked"
+	FormSubmitted    = "form_submitted"
+)
+
+// Event is something that happened to the campaign or to single target
+type Event struct {
+	Type     string    `json:"type"`
+	Campaign string    `json:"campaign,omitempty"`
+	Time     time.Time `json:"time"`
+	// ID identifies the target, it is the target ID or the token of its URL
+	ID        string `json:"id,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Email     string `json:"email,omitempty"`
+	IP        string `json:"ip,omitempty"`
+	UserAgent string `json:"userAgent,omitempty"`
+	// Error is the rejection of the mail for send_failed
+	Error string `json:"error,omitempty"`
+	// Fields are the names of submitted form fields, values are never sent
+	Fields []string `json:"fields,omitempty"`
+	// Total, Sent and Failed count the mails of the campaign events
+	Total  int `json:"total,omitempty"`
+	Sent   int `json:"sent,omitempty"`
+	Failed int `json:"failed,omitempty"`
+}
+
+// Notifier delivers events to a single destination
+type Notifier interface {
+	Notify(ctx context.Context, e Event) error
+}
+
+// queueSize is the number of events waiting for delivery, newer events are
+// dropped when it is full
+const queueSize = 1000
+
+// notifyTimeout limits delivery of single event to single notifier
+const notifyTimeout = 10 * time.Second
+
+// Dispatcher delivers events to the notifiers in the background, so that
+// sending mails or answering targets is never delayed by them
+type Dispatcher struct {
+	notifiers []Notifier
+	queue     chan Event
+	wg        sync.WaitGroup
+}
+
+// NewDispatcher starts delivering events to notifiers
+func NewDispatcher(notifiers ...Notifier) *Dispatcher {
+	d := &Dispatcher{
+		notifiers: notifiers,
+		queue:     make(chan Event, queueSize),
+	}
+	d.wg.Add(1)
+	go d.run()
+	return d
+}
+
+func (d *Dispatcher) run() {
+	defer d.wg.Done()
+	for e := range d.queue {
+		for _, n := range d.notifiers {
+			ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+			if err := n.Notify(ctx, e); err != nil {
+				logging.Warningf("Error delivering %s event: %v", e.Type, err)
+			}
+			cancel()
+		}
+	}
+}
+
+// Notify queues the event, nil Dispatcher drops it
+func (d *Dispatcher) Notify(e Event) {
+	if d == nil {
+		return
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	select {
+	case d.queue <- e:
+	default:
+		logging.Warningf("Too many events waiting for delivery, dropping %s event", e.Type)
+	}
+}
+
+// Close waits until the queued events are delivered
+func (d *Dispatcher) Close() {
+	if d == nil {
+		return
+	}
+	close(d.queue)
+	d.wg.Wait()
+}
@@ -0,0 +1,65 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// SignatureHeader holds hex encoded HMAC-SHA256 of the body, prefixed with
+// sha256=, when the webhook has a secret
+const SignatureHeader = "X-Lateralus-Signature"
+
+// Webhook POSTs events as JSON to URL
+type Webhook struct {
+	URL string
+	// Secret signs the body, receiver verifies it with SignatureHeader
+	Secret string
+	Client *http.Client
+}
+
+// Notify sends single event, any 2xx status is success
+func (w *Webhook) Notify(ctx context.Context, e Event) error {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("Notify: %v", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("Notify: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "lateralus")
+	req.Header.Set("X-Lateralus-Event", e.Type)
+	if w.Secret != "" {
+		req.Header.Set(SignatureHeader, "sha256="+Sign(w.Secret, body))
+	}
+
+	client := w.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return fmt.Errorf("Notify: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("Notify: webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// Sign returns hex encoded HMAC-SHA256 of body with secret
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,133 @@
+package notify
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSign(t *testing.T) {
+	// RFC 4231 test case 2
+	got := Sign("Jefe", []byte("what do ya want for nothing?"))
+	want := "5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843"
+	if got != want {
+		t.Errorf("Sign() = %s, want %s", got, want)
+	}
+}
+
+func TestWebhookNotify(t *testing.T) {
+	tests := []struct {
+		name   string
+		secret string
+	}{
+		{name: "signed", secret: "s3cret"},
+		{name: "unsigned"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var body []byte
+			var header http.Header
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ = ioutil.ReadAll(r.Body)
+				header = r.Header
+				w.WriteHeader(http.StatusNoContent)
+			}))
+			defer ts.Close()
+
+			e := Event{Type: LinkClicked, Campaign: "q3", ID: "abc123", Email: "john@example.com", Fields: []string{"password"}}
+			w := &Webhook{URL: ts.URL, Secret: tt.secret}
+			if err := w.Notify(context.Background(), e); err != nil {
+				t.Fatalf("Notify() error = %v", err)
+			}
+
+			var got Event
+			if err := json.Unmarshal(body, &got); err != nil {
+				t.Fatalf("body is not event: %v", err)
+			}
+			if got.Type != e.Type || got.ID != e.ID || got.Email != e.Email {
+				t.Errorf("posted event = %+v, want %+v", got, e)
+			}
+			if header.Get("X-Lateralus-Event") != LinkClicked {
+				t.Errorf("X-Lateralus-Event = %q, want %s", header.Get("X-Lateralus-Event"), LinkClicked)
+			}
+
+			signature := header.Get(SignatureHeader)
+			if tt.secret == "" {
+				if signature != "" {
+					t.Errorf("%s = %q without secret, want none", SignatureHeader, signature)
+				}
+				return
+			}
+			// verified as the receiver does it
+			mac := hmac.New(sha256.New, []byte(tt.secret))
+			mac.Write(body)
+			want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+			if !hmac.Equal([]byte(signature), []byte(want)) {
+				t.Errorf("%s = %q, want %q", SignatureHeader, signature, want)
+			}
+		})
+	}
+}
+
+func TestWebhookNotifyErrors(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer ts.Close()
+
+	if err := (&Webhook{URL: ts.URL}).Notify(context.Background(), Event{Type: EmailSent}); err == nil || !strings.Contains(err.Error(), "500") {
+		t.Errorf("Notify() error = %v, want 500", err)
+	}
+	if err := (&Webhook{URL: "http://127.0.0.1:1"}).Notify(context.Background(), Event{Type: EmailSent}); err == nil {
+		t.Errorf("Notify() without server error = nil, want error")
+	}
+}
+
+// notifierFunc turns function into Notifier
+type notifierFunc func(ctx context.Context, e Event) error
+
+func (f notifierFunc) Notify(ctx context.Context, e Event) error {
+	return f(ctx, e)
+}
+
+func TestDispatcher(t *testing.T) {
+	var mu sync.Mutex
+	var got []string
+	record := notifierFunc(func(ctx context.Context, e Event) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if e.Time.IsZero() {
+			t.Errorf("event %s has no time", e.Type)
+		}
+		got = append(got, e.Type)
+		return nil
+	})
+	failing := notifierFunc(func(ctx context.Context, e Event) error {
+		return context.DeadlineExceeded
+	})
+
+	d := NewDispatcher(failing, record)
+	d.Notify(Event{Type: CampaignStarted})
+	d.Notify(Event{Type: EmailSent, Time: time.Now()})
+	d.Notify(Event{Type: CampaignFinished})
+	d.Close()
+
+	// failing notifier does not stop delivery to the others
+	if strings.Join(got, ",") != "campaign_started,email_sent,campaign_finished" {
+		t.Errorf("delivered %v, want the events in order", got)
+	}
+
+	var nilDispatcher *Dispatcher
+	nilDispatcher.Notify(Event{Type: CampaignStarted})
+	nilDispatcher.Close()
+}
@@ -0,0 +1,107 @@
+package tracking
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lateralusd/lateralus/logging"
+)
+
+// Types of the events
+const (
+	// EventOpen is recorded when the tracking pixel of the mail is loaded
+	EventOpen = "open"
+	// EventClick is recorded when the target visits its URL
+	EventClick = "click"
+	// EventSubmit is recorded when the target submits the landing page form
+	EventSubmit = "submit"
+)
+
+// Event is single request of the target to the tracking server
+type Event struct {
+	Type string `json:"type"`
+	// ID identifies the target, it is the target ID for opens and the token
+	// of its URL for clicks and submissions
+	ID        string    `json:"id"`
+	Time      time.Time `json:"time"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"userAgent"`
+	// Fields hold the submitted form
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+// maxEventLine limits the size of a line read from the events file. Field
+// values are cut in record, but the names of up to maxFormSize long form
+// can grow several times when escaped in JSON.
+const maxEventLine = 8 * maxFormSize
+
+// Log appends events to a file as JSON lines, it can be used from several
+// goroutines
+type Log struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+// OpenLog opens the events file, new events are appended to the existing ones
+func OpenLog(filename string) (*Log, error) {
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("OpenLog: %v", err)
+	}
+	return &Log{f: f}, nil
+}
+
+// Record writes the event to the file
+func (l *Log) Record(e Event) error {
+	d, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("Record: %v", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.f.Write(append(d, '\n')); err != nil {
+		return fmt.Errorf("Record: %v", err)
+	}
+	return nil
+}
+
+// Close closes the events file
+func (l *Log) Close() error {
+	return l.f.Close()
+}
+
+// ReadEvents returns all events from the file in the order they were recorded
+func ReadEvents(filename string) ([]Event, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("ReadEvents: %v", err)
+	}
+	defer f.Close()
+
+	var events []Event
+	s := bufio.NewScanner(f)
+	s.Buffer(make([]byte, 64<<10), maxEventLine)
+	for line := 1; s.Scan(); line++ {
+		if strings.TrimSpace(s.Text()) == "" {
+			continue
+		}
+		var e Event
+		if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+			// the last line may be cut short when the server was killed
+			logging.Warningf("Skipping line %d of events \"%s\": %v", line, filename, err)
+			continue
+		}
+		events = append(events, e)
+	}
+	if err := s.Err(); err != nil {
+		return nil, fmt.Errorf("ReadEvents: %v", err)
+	}
+
+	return events, nil
+}
@@ -0,0 +1,115 @@
+package tracking
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/lateralusd/lateralus/logging"
+)
+
+// maxFormSize limits the size of submitted forms
+const maxFormSize = 1 << 20
+
+// Landing serves the landing page on the target URLs and captures the
+// submitted forms. Without Page the targets are redirected straight away.
+type Landing struct {
+	Link *Link
+	Page *template.Template
+	// Redirect is where the target is sent after submitting the form, or
+	// right away if there is no Page. The page is shown again if it is empty.
+	Redirect string
+}
+
+// LandingPage is the data of landing page template
+type LandingPage struct {
+	// Token identifies the target, the form posted to the same URL is
+	// matched with the target by it
+	Token string
+}
+
+// NewLanding parses landing page template from filename. If filename is
+// empty the clicks are only recorded and redirected.
+func NewLanding(link, filename, redirect string) (*Landing, error) {
+	if filename == "" && redirect == "" {
+		return nil, errors.New("NewLanding: landing page or redirect is needed")
+	}
+	l, err := NewLink(link)
+	if err != nil {
+		return nil, fmt.Errorf("NewLanding: %v", err)
+	}
+	landing := &Landing{Link: l, Redirect: redirect}
+	if filename != "" {
+		landing.Page, err = template.New(filepath.Base(filename)).ParseFiles(filename)
+		if err != nil {
+			return nil, fmt.Errorf("NewLanding: %v", err)
+		}
+	}
+	return landing, nil
+}
+
+func (s *Server) handleLanding(w http.ResponseWriter, r *http.Request) {
+	token, ok := s.Landing.Link.Token(r.URL.RequestURI())
+	if !ok || !s.isKnown(token) {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		s.record(Event{Type: EventClick, ID: token}, r)
+		if s.Landing.Page == nil {
+			w.Header().Set("Cache-Control", "no-store")
+			http.Redirect(w, r, s.Landing.Redirect, http.StatusFound)
+			return
+		}
+	case http.MethodPost:
+		if s.Landing.Page == nil {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, maxFormSize)
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+		s.record(Event{Type: EventSubmit, ID: token, Fields: formFields(r)}, r)
+		if s.Landing.Redirect != "" {
+			http.Redirect(w, r, s.Landing.Redirect, http.StatusFound)
+			return
+		}
+	default:
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := s.Landing.Page.Execute(w, LandingPage{Token: token}); err != nil {
+		logging.Errorf("Error rendering landing page: %v", err)
+	}
+}
+
+// formFields returns posted fields, values of repeated fields are joined
+// with comma
+func formFields(r *http.Request) map[string]string {
+	fields := make(map[string]string)
+	for k, v := range r.PostForm {
+		fields[k] = strings.Join(v, ",")
+	}
+	return fields
+}
+
+// fieldNames returns sorted names of the fields, values are not logged
+func fieldNames(fields map[string]string) []string {
+	var names []string
+	for k := range fields {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
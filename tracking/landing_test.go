@@ -0,0 +1,261 @@
+package tracking
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/lateralusd/lateralus/notify"
+)
+
+const testLink = "https://login.example.com/signin?id=" + Placeholder
+
+// newTestServer starts tracking server with landing page showing the token,
+// events are written to the returned file
+func newTestServer(t *testing.T, redirect string) (*httptest.Server, string) {
+	t.Helper()
+	dir := t.TempDir()
+	page := filepath.Join(dir, "landing.html")
+	if err := ioutil.WriteFile(page, []byte(`<form method="post"><input name="token" value="{{.Token}}"></form>`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	landing, err := NewLanding(testLink, page, redirect)
+	if err != nil {
+		t.Fatalf("NewLanding() error = %v", err)
+	}
+
+	events := filepath.Join(dir, "events.jsonl")
+	log, err := OpenLog(events)
+	if err != nil {
+		t.Fatalf("OpenLog() error = %v", err)
+	}
+
+	s := &Server{Log: log, Landing: landing, Targets: map[string]Target{"abc123": {Name: "John Doe", Email: "john@example.com"}}}
+	ts := httptest.NewServer(s.Handler())
+	t.Cleanup(func() {
+		ts.Close()
+		log.Close()
+	})
+	return ts, events
+}
+
+// noRedirect returns client which does not follow redirects
+func noRedirect() *http.Client {
+	return &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+}
+
+func TestLanding(t *testing.T) {
+	ts, events := newTestServer(t, "")
+
+	resp, err := http.Get(ts.URL + "/signin?id=abc123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !strings.Contains(string(body), `value="abc123"`) {
+		t.Errorf("GET landing = %s %q, want page with the token", resp.Status, body)
+	}
+
+	resp, err = http.PostForm(ts.URL+"/signin?id=abc123", url.Values{"user": {"john"}, "password": {"secret"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("POST landing = %s, want 200 OK", resp.Status)
+	}
+
+	for _, u := range []string{"/signin?id=unknown", "/signin?id=../x", "/other?id=abc123"} {
+		resp, err := http.Get(ts.URL + u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("GET %s = %s, want 404", u, resp.Status)
+		}
+	}
+
+	got, err := ReadEvents(events)
+	if err != nil {
+		t.Fatalf("ReadEvents() error = %v", err)
+	}
+	if len(got) != 2 {
+		t.Fatalf("got %d events, want click and submit: %+v", len(got), got)
+	}
+	if got[0].Type != EventClick || got[0].ID != "abc123" || got[0].IP != "127.0.0.1" {
+		t.Errorf("first event = %+v, want click of abc123 from 127.0.0.1", got[0])
+	}
+	if got[1].Type != EventSubmit || got[1].Fields["user"] != "john" || got[1].Fields["password"] != "secret" {
+		t.Errorf("second event = %+v, want submit with user and password", got[1])
+	}
+}
+
+func TestLandingRedirect(t *testing.T) {
+	ts, _ := newTestServer(t, "https://www.example.com/")
+
+	resp, err := noRedirect().PostForm(ts.URL+"/signin?id=abc123", url.Values{"user": {"john"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound || resp.Header.Get("Location") != "https://www.example.com/" {
+		t.Errorf("POST landing = %s to %q, want redirect to https://www.example.com/", resp.Status, resp.Header.Get("Location"))
+	}
+}
+
+// TestLandingLargeForm checks that events of forms longer than the default
+// line limit of bufio.Scanner are read back with the values cut
+func TestLandingLargeForm(t *testing.T) {
+	ts, events := newTestServer(t, "")
+
+	form := url.Values{"password": {strings.Repeat("ü", 50<<10)}}
+	for i := 0; i < 2000; i++ {
+		form.Set(fmt.Sprintf("field%040d", i), "x")
+	}
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+"/signin?id=abc123", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", strings.Repeat("Mozilla/5.0 ", 1000))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	// event after the long one is read too
+	resp, err = http.Get(ts.URL + "/signin?id=abc123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if fi, err := ioutil.ReadFile(events); err != nil || len(fi) <= 64<<10 {
+		t.Fatalf("events file has %d bytes, %v, want longer than 64 KB", len(fi), err)
+	}
+
+	got, err := ReadEvents(events)
+	if err != nil {
+		t.Fatalf("ReadEvents() error = %v", err)
+	}
+	if len(got) != 2 || got[0].Type != EventSubmit || got[1].Type != EventClick {
+		t.Fatalf("got %d events, want submit and click", len(got))
+	}
+
+	submit := got[0]
+	if len(submit.Fields) != 2001 {
+		t.Errorf("submit has %d fields, want 2001", len(submit.Fields))
+	}
+	if p := submit.Fields["password"]; len(p) != maxField || !utf8.ValidString(p) {
+		t.Errorf("password has %d bytes, want %d bytes of valid UTF-8", len(p), maxField)
+	}
+	if len(submit.UserAgent) != maxUserAgent {
+		t.Errorf("user agent has %d bytes, want %d", len(submit.UserAgent), maxUserAgent)
+	}
+}
+
+func TestLandingFormTooLarge(t *testing.T) {
+	ts, events := newTestServer(t, "")
+
+	body := "password=" + strings.Repeat("a", maxFormSize)
+	resp, err := http.Post(ts.URL+"/signin?id=abc123", "application/x-www-form-urlencoded", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("POST of %d bytes = %s, want 400", len(body), resp.Status)
+	}
+
+	if got, err := ReadEvents(events); err != nil || len(got) != 0 {
+		t.Errorf("ReadEvents() = %d events, %v, want none", len(got), err)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		s    string
+		n    int
+		want string
+	}{
+		{s: "hello", n: 10, want: "hello"},
+		{s: "hello", n: 5, want: "hello"},
+		{s: "hello", n: 3, want: "hel"},
+		{s: "süß", n: 2, want: "s"},
+		{s: "süß", n: 3, want: "sü"},
+		{s: "ü", n: 1, want: ""},
+	}
+	for _, tt := range tests {
+		if got := truncate(tt.s, tt.n); got != tt.want {
+			t.Errorf("truncate(%q, %d) = %q, want %q", tt.s, tt.n, got, tt.want)
+		}
+	}
+}
+
+// eventRecorder collects the notified events
+type eventRecorder struct {
+	events []notify.Event
+}
+
+func (r *eventRecorder) Notify(_ context.Context, e notify.Event) error {
+	r.events = append(r.events, e)
+	return nil
+}
+
+func TestLandingNotify(t *testing.T) {
+	dir := t.TempDir()
+	page := filepath.Join(dir, "landing.html")
+	if err := ioutil.WriteFile(page, []byte("<form></form>"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	landing, err := NewLanding(testLink, page, "")
+	if err != nil {
+		t.Fatalf("NewLanding() error = %v", err)
+	}
+	log, err := OpenLog(filepath.Join(dir, "events.jsonl"))
+	if err != nil {
+		t.Fatalf("OpenLog() error = %v", err)
+	}
+	defer log.Close()
+
+	rec := &eventRecorder{}
+	events := notify.NewDispatcher(rec)
+	s := &Server{
+		Log:      log,
+		Landing:  landing,
+		Targets:  map[string]Target{"abc123": {Name: "John Doe", Email: "john@example.com"}},
+		Events:   events,
+		Campaign: "q3",
+	}
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	for _, id := range []string{"abc123", "unknown"} {
+		resp, err := http.Get(ts.URL + "/signin?id=" + id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	events.Close()
+
+	if len(rec.events) != 1 {
+		t.Fatalf("got %d events, want click of the known target: %+v", len(rec.events), rec.events)
+	}
+	e := rec.events[0]
+	if e.Type != notify.LinkClicked || e.Campaign != "q3" || e.ID != "abc123" || e.Name != "John Doe" || e.Email != "john@example.com" {
+		t.Errorf("event = %+v, want click of John Doe <john@example.com> in q3", e)
+	}
+	if !strings.HasPrefix(notify.Message(e), "John Doe <john@example.com> clicked the link") {
+		t.Errorf("Message() = %q, want the target named", notify.Message(e))
+	}
+}
@@ -0,0 +1,58 @@
+package tracking
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Placeholder marks the generated part of url.link
+const Placeholder = "<CHANGE>"
+
+// Link finds the token, the part generated for every target, in the URLs
+// created from url.link
+type Link struct {
+	prefix string
+}
+
+// NewLink returns Link for url.link, which has to contain Placeholder
+func NewLink(link string) (*Link, error) {
+	i := strings.Index(link, Placeholder)
+	if i < 0 {
+		return nil, fmt.Errorf("NewLink: %q has no %s placeholder", link, Placeholder)
+	}
+	return &Link{prefix: requestURI(link[:i])}, nil
+}
+
+// Token returns the token of the target URL, which can be full URL or only
+// its path and query as received by the server
+func (l *Link) Token(u string) (string, bool) {
+	uri := requestURI(u)
+	if !strings.HasPrefix(uri, l.prefix) {
+		return "", false
+	}
+	token := uri[len(l.prefix):]
+	if i := strings.IndexAny(token, "&#"); i >= 0 {
+		token = token[:i]
+	}
+	if !idPattern.MatchString(token) {
+		return "", false
+	}
+	return token, true
+}
+
+// requestURI strips scheme and host from u, so that URLs with rotated
+// hosts match the same link
+func requestURI(u string) string {
+	if i := strings.Index(u, "://"); i >= 0 {
+		u = u[i+len("://"):]
+		if j := strings.IndexAny(u, "/?#"); j >= 0 {
+			u = u[j:]
+		} else {
+			u = ""
+		}
+	}
+	if !strings.HasPrefix(u, "/") {
+		u = "/" + u
+	}
+	return u
+}
@@ -0,0 +1,41 @@
+package tracking
+
+import "testing"
+
+func TestLinkToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		link   string
+		u      string
+		want   string
+		wantOK bool
+	}{
+		{name: "query", link: "https://login.example.com/signin?id=<CHANGE>", u: "https://login.example.com/signin?id=abc123", want: "abc123", wantOK: true},
+		{name: "request uri", link: "https://login.example.com/signin?id=<CHANGE>", u: "/signin?id=abc123", want: "abc123", wantOK: true},
+		{name: "rotated host", link: "https://login.example.com/signin?id=<CHANGE>", u: "https://portal.example.net/signin?id=abc123", want: "abc123", wantOK: true},
+		{name: "more parameters", link: "https://login.example.com/signin?id=<CHANGE>", u: "/signin?id=abc123&lang=en", want: "abc123", wantOK: true},
+		{name: "fragment", link: "https://login.example.com/signin?id=<CHANGE>", u: "/signin?id=abc123#top", want: "abc123", wantOK: true},
+		{name: "path", link: "https://login.example.com/s/<CHANGE>", u: "/s/abc123", want: "abc123", wantOK: true},
+		{name: "host only", link: "https://example.com?id=<CHANGE>", u: "https://example.com?id=abc123", want: "abc123", wantOK: true},
+		{name: "other path", link: "https://login.example.com/signin?id=<CHANGE>", u: "/login?id=abc123"},
+		{name: "empty token", link: "https://login.example.com/signin?id=<CHANGE>", u: "/signin?id="},
+		{name: "invalid token", link: "https://login.example.com/s/<CHANGE>", u: "/s/../etc/passwd"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, err := NewLink(tt.link)
+			if err != nil {
+				t.Fatalf("NewLink() error = %v", err)
+			}
+			got, ok := l.Token(tt.u)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("Token(%q) = %q, %v, want %q, %v", tt.u, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+
+	if _, err := NewLink("https://login.example.com/signin"); err == nil {
+		t.Errorf("NewLink() without placeholder error = nil, want error")
+	}
+}
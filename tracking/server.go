@@ -0,0 +1,175 @@
+package tracking
+
+import (
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/lateralusd/lateralus/logging"
+	"github.com/lateralusd/lateralus/notify"
+)
+
+// OpenPath is the path of tracking pixels, followed by <ID>.gif
+const OpenPath = "/o/"
+
+// pixel is transparent 1x1 GIF
+var pixel = []byte{
+	0x47, 0x49, 0x46, 0x38, 0x39, 0x61, 0x01, 0x00, 0x01, 0x00, 0x80, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0xff, 0xff, 0xff, 0x21, 0xf9, 0x04, 0x01, 0x00,
+	0x00, 0x00, 0x00, 0x2c, 0x00, 0x00, 0x00, 0x00, 0x01, 0x00, 0x01, 0x00,
+	0x00, 0x02, 0x02, 0x44, 0x01, 0x00, 0x3b,
+}
+
+// Limits of the values stored in events, longer ones are cut
+const (
+	maxUserAgent = 1 << 10
+	maxField     = 4 << 10
+)
+
+// idPattern matches ids generated for the targets, requests with anything
+// else are not recorded
+var idPattern = regexp.MustCompile(`^[0-9a-zA-Z-]{1,64}$`)
+
+// PixelURL returns URL of the tracking pixel for target id on the tracking
+// server running at base, e.g. https://track.example.com
+func PixelURL(base, id string) string {
+	return strings.TrimRight(base, "/") + OpenPath + id + ".gif"
+}
+
+// Server records requests of the targets into Log
+type Server struct {
+	Log *Log
+	// TrustProxy takes client IP from X-Forwarded-For header, set it only
+	// when the server runs behind reverse proxy
+	TrustProxy bool
+	// Landing serves the landing page, other requests than for tracking
+	// pixels get 404 if it is nil
+	Landing *Landing
+	// ServerHeader is sent in Server header of every response, e.g. nginx
+	ServerHeader string
+	// Targets map target IDs and URL tokens to the targets. If it is set,
+	// requests of other ids are not recorded and landing page is not served
+	// to them.
+	Targets map[string]Target
+	// Events get every recorded request as open, click or form submission,
+	// Campaign is the ID of the campaign sent with them
+	Events   *notify.Dispatcher
+	Campaign string
+}
+
+// Target is the target the tracking ID belongs to
+type Target struct {
+	Name  string
+	Email string
+}
+
+// notifyTypes maps recorded events to the notified ones
+var notifyTypes = map[string]string{
+	EventOpen:   notify.EmailOpened,
+	EventClick:  notify.LinkClicked,
+	EventSubmit: notify.FormSubmitted,
+}
+
+// Handler returns handler serving the tracking pixels and the landing page
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(OpenPath, s.handleOpen)
+	if s.Landing != nil {
+		mux.HandleFunc("/", s.handleLanding)
+	}
+	if s.ServerHeader == "" {
+		return mux
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", s.ServerHeader)
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) handleOpen(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, OpenPath), ".gif")
+	if idPattern.MatchString(id) && s.isKnown(id) {
+		s.record(Event{Type: EventOpen, ID: id}, r)
+	}
+
+	// the pixel is served for unknown ids too, so that they cannot be probed
+	w.Header().Set("Content-Type", "image/gif")
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	w.Header().Set("Expires", "0")
+	w.Write(pixel)
+}
+
+// record completes the event with the client and saves it
+func (s *Server) record(e Event, r *http.Request) {
+	e.Time = time.Now().UTC()
+	e.IP = s.clientIP(r)
+	e.UserAgent = truncate(r.UserAgent(), maxUserAgent)
+	for k, v := range e.Fields {
+		e.Fields[k] = truncate(v, maxField)
+	}
+	if err := s.Log.Record(e); err != nil {
+		logging.Errorf("Error recording %s of %s: %v", e.Type, e.ID, err)
+		return
+	}
+	t := s.Targets[e.ID]
+	s.Events.Notify(notify.Event{
+		Type:      notifyTypes[e.Type],
+		Campaign:  s.Campaign,
+		Time:      e.Time,
+		ID:        e.ID,
+		Name:      t.Name,
+		Email:     t.Email,
+		IP:        e.IP,
+		UserAgent: e.UserAgent,
+		Fields:    fieldNames(e.Fields),
+	})
+
+	target := e.ID
+	if t.Email != "" {
+		target = t.Email
+	}
+	if e.Fields != nil {
+		logging.Infof("Recorded %s of %s from %s with fields %s", e.Type, target, e.IP, strings.Join(fieldNames(e.Fields), ", "))
+		return
+	}
+	logging.Infof("Recorded %s of %s from %s", e.Type, target, e.IP)
+}
+
+// truncate cuts s to at most n bytes without splitting UTF-8 characters
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// isKnown reports whether id belongs to a target, every id does if Targets
+// are not set
+func (s *Server) isKnown(id string) bool {
+	if s.Targets == nil {
+		return true
+	}
+	_, ok := s.Targets[id]
+	return ok
+}
+
+// clientIP returns address of the client, the first address of
+// X-Forwarded-For if the proxy is trusted
+func (s *Server) clientIP(r *http.Request) string {
+	if s.TrustProxy {
+		if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+			return strings.TrimSpace(strings.Split(xff, ",")[0])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
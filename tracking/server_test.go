@@ -0,0 +1,179 @@
+package tracking
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+// openLog opens events log in a temporary directory
+func openLog(t *testing.T) (*Log, string) {
+	t.Helper()
+	events := filepath.Join(t.TempDir(), "events.jsonl")
+	log, err := OpenLog(events)
+	if err != nil {
+		t.Fatalf("OpenLog() error = %v", err)
+	}
+	t.Cleanup(func() { log.Close() })
+	return log, events
+}
+
+func TestPixelURL(t *testing.T) {
+	for _, base := range []string{"https://track.example.com", "https://track.example.com/"} {
+		if got := PixelURL(base, "abc123"); got != "https://track.example.com/o/abc123.gif" {
+			t.Errorf("PixelURL(%q) = %s, want https://track.example.com/o/abc123.gif", base, got)
+		}
+	}
+}
+
+func TestOpen(t *testing.T) {
+	log, events := openLog(t)
+	s := &Server{Log: log, Targets: map[string]Target{"abc123": {Email: "john@example.com"}}}
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+
+	// the pixel is the same for known, unknown and invalid ids
+	for _, id := range []string{"abc123", "unknown", "not%20valid"} {
+		resp, err := http.Get(ts.URL + OpenPath + id + ".gif")
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "image/gif" || !bytes.Equal(body, pixel) {
+			t.Errorf("GET pixel of %s = %s %s, want the pixel", id, resp.Status, resp.Header.Get("Content-Type"))
+		}
+		if resp.Header.Get("Cache-Control") == "" {
+			t.Errorf("pixel of %s can be cached", id)
+		}
+	}
+
+	// there is no landing page
+	resp, err := http.Get(ts.URL + "/signin?id=abc123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("GET without landing page = %s, want 404", resp.Status)
+	}
+
+	got, err := ReadEvents(events)
+	if err != nil {
+		t.Fatalf("ReadEvents() error = %v", err)
+	}
+	if len(got) != 1 || got[0].Type != EventOpen || got[0].ID != "abc123" {
+		t.Errorf("events = %+v, want open of abc123 only", got)
+	}
+}
+
+func TestOpenWithoutTargets(t *testing.T) {
+	log, events := openLog(t)
+	ts := httptest.NewServer((&Server{Log: log}).Handler())
+	defer ts.Close()
+
+	for _, id := range []string{"abc123", "xyz789"} {
+		resp, err := http.Get(ts.URL + OpenPath + id + ".gif")
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+
+	// every valid id is recorded without targets
+	if got, err := ReadEvents(events); err != nil || len(got) != 2 {
+		t.Errorf("ReadEvents() = %+v, %v, want both opens", got, err)
+	}
+}
+
+func TestRedirectOnlyLanding(t *testing.T) {
+	landing, err := NewLanding(testLink, "", "https://www.example.com/")
+	if err != nil {
+		t.Fatalf("NewLanding() error = %v", err)
+	}
+	log, events := openLog(t)
+	ts := httptest.NewServer((&Server{Log: log, Landing: landing, Targets: map[string]Target{"abc123": {}}}).Handler())
+	defer ts.Close()
+
+	resp, err := noRedirect().Get(ts.URL + "/signin?id=abc123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound || resp.Header.Get("Location") != "https://www.example.com/" {
+		t.Errorf("GET landing = %s to %q, want redirect to https://www.example.com/", resp.Status, resp.Header.Get("Location"))
+	}
+
+	resp, err = noRedirect().Post(ts.URL+"/signin?id=abc123", "application/x-www-form-urlencoded", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST without landing page = %s, want 405", resp.Status)
+	}
+
+	got, err := ReadEvents(events)
+	if err != nil {
+		t.Fatalf("ReadEvents() error = %v", err)
+	}
+	if len(got) != 1 || got[0].Type != EventClick {
+		t.Errorf("events = %+v, want the click only", got)
+	}
+
+	if _, err := NewLanding(testLink, "", ""); err == nil {
+		t.Errorf("NewLanding() without page and redirect error = nil, want error")
+	}
+	if _, err := NewLanding("https://login.example.com/", "", "https://www.example.com/"); err == nil {
+		t.Errorf("NewLanding() of link without placeholder error = nil, want error")
+	}
+}
+
+func TestServerHeader(t *testing.T) {
+	log, _ := openLog(t)
+	ts := httptest.NewServer((&Server{Log: log, ServerHeader: "nginx"}).Handler())
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "/anything")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.Header.Get("Server") != "nginx" {
+		t.Errorf("Server = %q, want nginx", resp.Header.Get("Server"))
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		trustProxy bool
+		remoteAddr string
+		xff        string
+		want       string
+	}{
+		{name: "remote address", remoteAddr: "192.0.2.1:51234", want: "192.0.2.1"},
+		{name: "ipv6", remoteAddr: "[2001:db8::1]:51234", want: "2001:db8::1"},
+		{name: "untrusted proxy", remoteAddr: "192.0.2.1:51234", xff: "198.51.100.7", want: "192.0.2.1"},
+		{name: "trusted proxy", trustProxy: true, remoteAddr: "127.0.0.1:51234", xff: "198.51.100.7, 10.0.0.1", want: "198.51.100.7"},
+		{name: "trusted proxy without header", trustProxy: true, remoteAddr: "127.0.0.1:51234", want: "127.0.0.1"},
+		{name: "no port", remoteAddr: "192.0.2.1", want: "192.0.2.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.xff != "" {
+				r.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			s := &Server{TrustProxy: tt.trustProxy}
+			if got := s.clientIP(r); got != tt.want {
+				t.Errorf("clientIP() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
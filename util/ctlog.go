@@ -0,0 +1,137 @@
+package util
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lateralusd/lateralus/logging"
+)
+
+// CTPollInterval is how often crt.sh is queried for new certificates, it
+// is slow and rate limits frequent clients
+var CTPollInterval = 5 * time.Minute
+
+const crtshURL = "https://crt.sh/"
+
+// CTEntry is single certificate logged in Certificate Transparency logs
+type CTEntry struct {
+	ID         int64
+	Issuer     string
+	CommonName string
+	// Names are the DNS names the certificate is valid for
+	Names     []string
+	NotBefore time.Time
+	NotAfter  time.Time
+	// Logged is when crt.sh saw the certificate in CT log
+	Logged time.Time
+}
+
+// crtshEntry is the JSON format of crt.sh, times are in UTC without zone
+type crtshEntry struct {
+	ID             int64  `json:"id"`
+	IssuerName     string `json:"issuer_name"`
+	CommonName     string `json:"common_name"`
+	NameValue      string `json:"name_value"`
+	NotBefore      string `json:"not_before"`
+	NotAfter       string `json:"not_after"`
+	EntryTimestamp string `json:"entry_timestamp"`
+}
+
+// MonitorCTLogs polls crt.sh and calls callback for every certificate
+// matching domain issued after monitoring started, until ctx is done.
+// Domain can be crt.sh pattern, e.g. %.example.com for all subdomains.
+// Only the first query has to succeed, later failures are logged and
+// retried in next poll.
+func MonitorCTLogs(ctx context.Context, domain string, callback func(CTEntry)) error {
+	client := &http.Client{Timeout: time.Minute}
+
+	entries, err := queryCrtsh(ctx, client, domain)
+	if err != nil {
+		return fmt.Errorf("MonitorCTLogs: %v", err)
+	}
+
+	seen := make(map[int64]bool)
+	for _, e := range entries {
+		seen[e.ID] = true
+	}
+
+	ticker := time.NewTicker(CTPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		entries, err := queryCrtsh(ctx, client, domain)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			logging.Warningf("Querying crt.sh for %s failed, retrying in %s: %v", domain, CTPollInterval, err)
+			continue
+		}
+
+		for _, e := range entries {
+			if !seen[e.ID] {
+				seen[e.ID] = true
+				callback(e)
+			}
+		}
+	}
+}
+
+// queryCrtsh returns certificates matching domain, oldest first
+func queryCrtsh(ctx context.Context, client *http.Client, domain string) ([]CTEntry, error) {
+	q := url.Values{"q": {domain}, "output": {"json"}}
+	req, err := http.NewRequest(http.MethodGet, crtshURL+"?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("crt.sh responded %s", resp.Status)
+	}
+
+	var raw []crtshEntry
+	if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("decoding crt.sh response: %v", err)
+	}
+
+	entries := make([]CTEntry, 0, len(raw))
+	for _, r := range raw {
+		entries = append(entries, CTEntry{
+			ID:         r.ID,
+			Issuer:     r.IssuerName,
+			CommonName: r.CommonName,
+			Names:      strings.Fields(r.NameValue),
+			NotBefore:  parseCrtshTime(r.NotBefore),
+			NotAfter:   parseCrtshTime(r.NotAfter),
+			Logged:     parseCrtshTime(r.EntryTimestamp),
+		})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].ID < entries[j].ID
+	})
+
+	return entries, nil
+}
+
+func parseCrtshTime(s string) time.Time {
+	t, _ := time.Parse("2006-01-02T15:04:05", s)
+	return t
+}
@@ -0,0 +1,60 @@
+package util
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var imgFileSrc = regexp.MustCompile(`(?i)(<img\b[^>]*?\bsrc\s*=\s*)(["'])file://([^"']+)(["'])`)
+
+// InlineImagesAsDataURI replaces src of every <img src="file://..."> tag
+// with data: URI holding base64 encoded content of the referenced file
+func InlineImagesAsDataURI(htmlBody string) (string, error) {
+	var outErr error
+	res := imgFileSrc.ReplaceAllStringFunc(htmlBody, func(tag string) string {
+		if outErr != nil {
+			return tag
+		}
+
+		m := imgFileSrc.FindStringSubmatch(tag)
+		uri, err := fileDataURI(m[3])
+		if err != nil {
+			outErr = err
+			return tag
+		}
+
+		return m[1] + m[2] + uri + m[4]
+	})
+
+	if outErr != nil {
+		return "", fmt.Errorf("InlineImagesAsDataURI: %v", outErr)
+	}
+
+	return res, nil
+}
+
+func fileDataURI(path string) (string, error) {
+	path, err := url.PathUnescape(path)
+	if err != nil {
+		return "", err
+	}
+
+	d, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	mimeType := mime.TypeByExtension(strings.ToLower(filepath.Ext(path)))
+	if mimeType == "" {
+		mimeType = http.DetectContentType(d)
+	}
+
+	return fmt.Sprintf("data:%s;base64,%s", mimeType, base64.StdEncoding.EncodeToString(d)), nil
+}
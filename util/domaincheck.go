@@ -0,0 +1,275 @@
+package util
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// CheckStatus is the traffic light of single infrastructure check
+type CheckStatus int
+
+const (
+	// CheckOK means the check passed
+	CheckOK CheckStatus = iota
+	// CheckWarning means the campaign can run, but something may hurt it
+	CheckWarning
+	// CheckFailed means the infrastructure is not ready
+	CheckFailed
+)
+
+// certExpiryWarning is how soon before the certificate expires the check warns
+const certExpiryWarning = 14 * 24 * time.Hour
+
+// CheckResult is the outcome of single infrastructure check
+type CheckResult struct {
+	Name   string
+	Status CheckStatus
+	Detail string
+}
+
+// DomainCheck describes the infrastructure to check
+type DomainCheck struct {
+	// Domain hosts the landing page
+	Domain string
+	// ExpectedIP is the address Domain should resolve to, the A record
+	// check only lists the addresses if it is empty
+	ExpectedIP string
+	// Path of the landing page, / by default
+	Path string
+	// MailDomain is the domain of the sender address, Domain by default
+	MailDomain string
+	// SendingIPs are the addresses of the mail server, SPF is not checked
+	// without them
+	SendingIPs []net.IP
+	Timeout    time.Duration
+}
+
+// CheckDomain verifies DNS, HTTPS certificate, landing page, SPF and DMARC
+// of the campaign domain
+func CheckDomain(c DomainCheck) []CheckResult {
+	if c.Path == "" {
+		c.Path = "/"
+	}
+	if c.MailDomain == "" {
+		c.MailDomain = c.Domain
+	}
+	if c.Timeout == 0 {
+		c.Timeout = 10 * time.Second
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 4*c.Timeout)
+	defer cancel()
+
+	return []CheckResult{
+		checkA(ctx, c),
+		checkCertificate(c),
+		checkLandingPage(c),
+		checkSPFRecord(ctx, c),
+		checkDMARC(ctx, c.MailDomain),
+	}
+}
+
+func checkA(ctx context.Context, c DomainCheck) CheckResult {
+	r := CheckResult{Name: "DNS A record"}
+
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, c.Domain)
+	if err != nil {
+		r.Status, r.Detail = CheckFailed, err.Error()
+		return r
+	}
+
+	var ips []string
+	found := false
+	for _, a := range addrs {
+		if a.IP.To4() == nil {
+			continue
+		}
+		ips = append(ips, a.IP.String())
+		if a.IP.Equal(net.ParseIP(c.ExpectedIP)) {
+			found = true
+		}
+	}
+
+	switch {
+	case len(ips) == 0:
+		r.Status, r.Detail = CheckFailed, "no A record"
+	case c.ExpectedIP == "":
+		r.Status, r.Detail = CheckWarning, "resolves to "+strings.Join(ips, ", ")+", no expected IP given"
+	case found:
+		r.Status, r.Detail = CheckOK, "resolves to "+strings.Join(ips, ", ")
+	default:
+		r.Status, r.Detail = CheckFailed, fmt.Sprintf("resolves to %s, expected %s", strings.Join(ips, ", "), c.ExpectedIP)
+	}
+	return r
+}
+
+func checkCertificate(c DomainCheck) CheckResult {
+	r := CheckResult{Name: "HTTPS certificate"}
+
+	dialer := &net.Dialer{Timeout: c.Timeout}
+	conn, err := tls.DialWithDialer(dialer, "tcp", net.JoinHostPort(c.Domain, "443"), &tls.Config{ServerName: c.Domain})
+	if err != nil {
+		r.Status, r.Detail = CheckFailed, err.Error()
+		return r
+	}
+	defer conn.Close()
+
+	cert := conn.ConnectionState().PeerCertificates[0]
+	r.Detail = fmt.Sprintf("issued by %s, valid until %s", cert.Issuer.CommonName, cert.NotAfter.Format("2006-01-02"))
+	if time.Until(cert.NotAfter) < certExpiryWarning {
+		r.Status = CheckWarning
+		r.Detail += ", expires soon"
+	}
+	return r
+}
+
+// checkLandingPage requests the page without following redirects. The
+// certificate is not verified here, checkCertificate reports it.
+func checkLandingPage(c DomainCheck) CheckResult {
+	url := "https://" + c.Domain + c.Path
+	r := CheckResult{Name: "Landing page"}
+
+	client := &http.Client{
+		Timeout: c.Timeout,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	resp, err := client.Get(url)
+	if err != nil {
+		r.Status, r.Detail = CheckFailed, err.Error()
+		return r
+	}
+	resp.Body.Close()
+
+	r.Detail = fmt.Sprintf("%s responded %s", url, resp.Status)
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		r.Status = CheckOK
+	case resp.StatusCode >= 300 && resp.StatusCode < 400:
+		r.Status = CheckWarning
+		r.Detail += " to " + resp.Header.Get("Location")
+	default:
+		r.Status = CheckFailed
+	}
+	return r
+}
+
+func checkSPFRecord(ctx context.Context, c DomainCheck) CheckResult {
+	r := CheckResult{Name: "SPF"}
+
+	if len(c.SendingIPs) == 0 {
+		r.Status, r.Detail = CheckWarning, "not checked, sending server is unknown"
+		return r
+	}
+
+	r.Status = CheckOK
+	var details []string
+	for _, ip := range c.SendingIPs {
+		result, term, err := CheckSPF(ctx, c.MailDomain, ip)
+		if err != nil {
+			r.Status, r.Detail = CheckFailed, err.Error()
+			return r
+		}
+
+		detail := fmt.Sprintf("%s: %s", ip, result)
+		if term != "" {
+			detail += " (" + term + ")"
+		}
+		details = append(details, detail)
+
+		switch result {
+		case SPFPass:
+		case SPFNone, SPFNeutral, SPFSoftFail:
+			if r.Status == CheckOK {
+				r.Status = CheckWarning
+			}
+		default:
+			r.Status = CheckFailed
+		}
+	}
+
+	r.Detail = c.MailDomain + " " + strings.Join(details, ", ")
+	return r
+}
+
+// checkDMARC looks up the policy of domain, falling back to subdomain
+// policy of the organizational domain (RFC 7489 section 6.6.3)
+func checkDMARC(ctx context.Context, domain string) CheckResult {
+	r := CheckResult{Name: "DMARC"}
+
+	tags, err := lookupDMARC(ctx, domain)
+	if err != nil {
+		r.Status, r.Detail = CheckFailed, err.Error()
+		return r
+	}
+
+	policy := tags["p"]
+	source := "_dmarc." + domain
+	if tags == nil {
+		org, err := RegisteredDomain(domain)
+		if err == nil && org != domain {
+			tags, err = lookupDMARC(ctx, org)
+			if err != nil {
+				r.Status, r.Detail = CheckFailed, err.Error()
+				return r
+			}
+			policy = tags["sp"]
+			if policy == "" {
+				policy = tags["p"]
+			}
+			source = "_dmarc." + org
+		}
+	}
+
+	if tags == nil {
+		r.Status, r.Detail = CheckOK, "no DMARC record"
+		return r
+	}
+
+	r.Detail = fmt.Sprintf("p=%s in %s", policy, source)
+	switch strings.ToLower(policy) {
+	case "reject":
+		r.Status = CheckFailed
+	case "quarantine":
+		r.Status = CheckWarning
+	default:
+		r.Status = CheckOK
+	}
+	return r
+}
+
+// lookupDMARC returns tags of DMARC record of domain, nil if there is none
+func lookupDMARC(ctx context.Context, domain string) (map[string]string, error) {
+	txts, err := net.DefaultResolver.LookupTXT(ctx, "_dmarc."+domain)
+	if IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, txt := range txts {
+		if !strings.HasPrefix(strings.ToLower(txt), "v=dmarc1") {
+			continue
+		}
+		tags := make(map[string]string)
+		for _, tag := range strings.Split(txt, ";") {
+			kv := strings.SplitN(tag, "=", 2)
+			if len(kv) == 2 {
+				tags[strings.ToLower(strings.TrimSpace(kv[0]))] = strings.TrimSpace(kv[1])
+			}
+		}
+		return tags, nil
+	}
+	return nil, nil
+}
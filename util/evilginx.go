@@ -0,0 +1,220 @@
+package util
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EvilginxSession is session captured by Evilginx2 proxy
+type EvilginxSession struct {
+	ID         int
+	Phishlet   string
+	LandingURL string
+	Username   string
+	Password   string
+	// Custom holds custom captured values and the params of the lure
+	Custom     map[string]string
+	SessionID  string
+	UserAgent  string
+	RemoteAddr string
+	Created    time.Time
+	Updated    time.Time
+	// Tokens is the number of captured cookie, body and http tokens
+	Tokens int
+}
+
+// evilginxSession is the JSON format of sessions in Evilginx2 database
+type evilginxSession struct {
+	ID           int                                   `json:"id"`
+	Phishlet     string                                `json:"phishlet"`
+	LandingURL   string                                `json:"landing_url"`
+	Username     string                                `json:"username"`
+	Password     string                                `json:"password"`
+	Custom       map[string]string                     `json:"custom"`
+	BodyTokens   map[string]string                     `json:"body_tokens"`
+	HTTPTokens   map[string]string                     `json:"http_tokens"`
+	CookieTokens map[string]map[string]json.RawMessage `json:"tokens"`
+	SessionID    string                                `json:"session_id"`
+	UserAgent    string                                `json:"useragent"`
+	RemoteAddr   string                                `json:"remote_addr"`
+	CreateTime   int64                                 `json:"create_time"`
+	UpdateTime   int64                                 `json:"update_time"`
+}
+
+var sessionKey = regexp.MustCompile(`^sessions:\d+$`)
+
+// ParseEvilginxSessions reads sessions from Evilginx2 database, which is
+// buntdb append only file of set and del commands, usually
+// ~/.evilginx/data.db
+func ParseEvilginxSessions(filename string) ([]EvilginxSession, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("ParseEvilginxSessions: %v", err)
+	}
+	defer f.Close()
+
+	values := make(map[string]string)
+	r := bufio.NewReader(f)
+	for {
+		args, err := readCommand(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("ParseEvilginxSessions: %v", err)
+		}
+		switch strings.ToLower(args[0]) {
+		case "set":
+			if len(args) >= 3 {
+				values[args[1]] = args[2]
+			}
+		case "del":
+			if len(args) >= 2 {
+				delete(values, args[1])
+			}
+		case "flushdb":
+			values = make(map[string]string)
+		}
+	}
+
+	var sessions []EvilginxSession
+	for k, v := range values {
+		if !sessionKey.MatchString(k) {
+			continue
+		}
+		var s evilginxSession
+		if err := json.Unmarshal([]byte(v), &s); err != nil {
+			return nil, fmt.Errorf("ParseEvilginxSessions: %s: %v", k, err)
+		}
+		sessions = append(sessions, EvilginxSession{
+			ID:         s.ID,
+			Phishlet:   s.Phishlet,
+			LandingURL: s.LandingURL,
+			Username:   s.Username,
+			Password:   s.Password,
+			Custom:     s.Custom,
+			SessionID:  s.SessionID,
+			UserAgent:  s.UserAgent,
+			RemoteAddr: s.RemoteAddr,
+			Created:    time.Unix(s.CreateTime, 0),
+			Updated:    time.Unix(s.UpdateTime, 0),
+			Tokens:     len(s.BodyTokens) + len(s.HTTPTokens) + cookieTokens(s.CookieTokens),
+		})
+	}
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].ID < sessions[j].ID })
+	return sessions, nil
+}
+
+func cookieTokens(domains map[string]map[string]json.RawMessage) int {
+	n := 0
+	for _, tokens := range domains {
+		n += len(tokens)
+	}
+	return n
+}
+
+// readCommand reads single RESP array of bulk strings, e.g.
+// *2\r\n$3\r\ndel\r\n$10\r\nsessions:1\r\n
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		if err == io.EOF && line != "" {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if !strings.HasPrefix(line, "*") {
+		return nil, fmt.Errorf("unexpected line %q", line)
+	}
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("invalid command length %q", line)
+	}
+
+	args := make([]string, n)
+	for i := range args {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, io.ErrUnexpectedEOF
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if !strings.HasPrefix(line, "$") {
+			return nil, fmt.Errorf("unexpected line %q", line)
+		}
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 {
+			return nil, fmt.Errorf("invalid string length %q", line)
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, io.ErrUnexpectedEOF
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+// evilginxLure is the JSON format of exported lure URLs
+type evilginxLure struct {
+	URL    string            `json:"url"`
+	Params map[string]string `json:"params"`
+}
+
+// ParseEvilginxLures reads lure URLs exported by Evilginx2 with
+// "lures get-url <id> import <file> export <file> csv|json", the import file
+// needs email column. It returns the URLs keyed by lowercase email.
+func ParseEvilginxLures(filename string) (map[string]string, error) {
+	d, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("ParseEvilginxLures: %v", err)
+	}
+
+	var lures []evilginxLure
+	if trimmed := strings.TrimSpace(string(d)); strings.HasPrefix(trimmed, "[") {
+		if err := json.Unmarshal(d, &lures); err != nil {
+			return nil, fmt.Errorf("ParseEvilginxLures: %v", err)
+		}
+	} else {
+		records, err := csv.NewReader(strings.NewReader(trimmed)).ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("ParseEvilginxLures: %v", err)
+		}
+		if len(records) == 0 || len(records[0]) < 2 || records[0][0] != "url" {
+			return nil, errors.New("ParseEvilginxLures: expected csv or json export with params")
+		}
+		for _, rec := range records[1:] {
+			params := make(map[string]string)
+			for i, name := range records[0][1:] {
+				params[name] = rec[i+1]
+			}
+			lures = append(lures, evilginxLure{URL: rec[0], Params: params})
+		}
+	}
+
+	urls := make(map[string]string)
+	for _, l := range lures {
+		email := ""
+		for k, v := range l.Params {
+			if strings.EqualFold(k, "email") {
+				email = strings.ToLower(strings.TrimSpace(v))
+			}
+		}
+		if email == "" {
+			return nil, fmt.Errorf("ParseEvilginxLures: lure %s has no email param", l.URL)
+		}
+		urls[email] = l.URL
+	}
+	return urls, nil
+}
@@ -0,0 +1,122 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// ModlishkaVictim is single row of Modlishka control panel, UUID is the
+// value of its tracking param, e.g. ident, in the URL the target visited
+type ModlishkaVictim struct {
+	UUID     string
+	Username string
+	Password string
+}
+
+// FetchModlishka gets the victims from Modlishka control panel at
+// controlURL, e.g. https://phish.example.com/SayHello2Modlishka, username
+// and password are the -controlCreds of Modlishka
+func FetchModlishka(ctx context.Context, controlURL, username, password string) ([]ModlishkaVictim, error) {
+	req, err := http.NewRequest(http.MethodGet, controlURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("FetchModlishka: %v", err)
+	}
+	if username != "" || password != "" {
+		req.SetBasicAuth(username, password)
+	}
+
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, fmt.Errorf("FetchModlishka: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("FetchModlishka: control panel returned %s", resp.Status)
+	}
+
+	victims, err := ParseModlishka(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("FetchModlishka: %v", err)
+	}
+	return victims, nil
+}
+
+// ParseModlishka reads the victims table of Modlishka control panel page,
+// the columns are found by their headers UUID, Username and Password
+func ParseModlishka(r io.Reader) ([]ModlishkaVictim, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return nil, fmt.Errorf("ParseModlishka: %v", err)
+	}
+
+	var rows [][]string
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "tr" {
+			var cells []string
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				if c.Type == html.ElementNode && (c.Data == "td" || c.Data == "th") {
+					cells = append(cells, strings.TrimSpace(nodeText(c)))
+				}
+			}
+			rows = append(rows, cells)
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	uuid, user, pass := -1, -1, -1
+	var victims []ModlishkaVictim
+	for _, cells := range rows {
+		if uuid < 0 {
+			for i, c := range cells {
+				switch strings.ToLower(c) {
+				case "uuid", "id":
+					uuid = i
+				case "username", "login":
+					user = i
+				case "password":
+					pass = i
+				}
+			}
+			continue
+		}
+		if len(cells) <= uuid || cells[uuid] == "" {
+			continue
+		}
+		v := ModlishkaVictim{UUID: cells[uuid]}
+		if user >= 0 && user < len(cells) {
+			v.Username = cells[user]
+		}
+		if pass >= 0 && pass < len(cells) {
+			v.Password = cells[pass]
+		}
+		victims = append(victims, v)
+	}
+	if uuid < 0 {
+		return nil, errors.New("ParseModlishka: no table with UUID column, is it the control panel?")
+	}
+	return victims, nil
+}
+
+// nodeText returns the text inside n
+func nodeText(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		b.WriteString(nodeText(c))
+	}
+	return b.String()
+}
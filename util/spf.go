@@ -0,0 +1,251 @@
+package util
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// spfLookupLimit is the maximum number of DNS lookups during SPF evaluation (RFC 7208)
+const spfLookupLimit = 10
+
+// SPF results, see RFC 7208 section 2.6
+const (
+	SPFPass     = "pass"
+	SPFFail     = "fail"
+	SPFSoftFail = "softfail"
+	SPFNeutral  = "neutral"
+	SPFNone     = "none"
+)
+
+var errNoSPF = errors.New("no SPF record")
+
+// CheckSPF evaluates SPF policy of domain for mails sent from ip and
+// returns the result together with the term which matched. Macros and
+// ptr mechanism are not supported, the terms using them never match.
+func CheckSPF(ctx context.Context, domain string, ip net.IP) (string, string, error) {
+	lookups := 0
+	result, term, err := checkSPF(ctx, domain, ip, &lookups)
+	if errors.Is(err, errNoSPF) {
+		return SPFNone, "", nil
+	}
+	if err != nil {
+		return "", "", fmt.Errorf("CheckSPF: %v", err)
+	}
+	return result, term, nil
+}
+
+func checkSPF(ctx context.Context, domain string, ip net.IP, lookups *int) (string, string, error) {
+	record, err := lookupSPF(ctx, domain)
+	if err != nil {
+		return "", "", err
+	}
+
+	redirect := ""
+	for _, term := range strings.Fields(record)[1:] {
+		lower := strings.ToLower(term)
+		if strings.HasPrefix(lower, "redirect=") {
+			redirect = term[len("redirect="):]
+			continue
+		}
+		if strings.Contains(term, "=") {
+			// other modifiers, e.g. exp=, do not affect the result
+			continue
+		}
+
+		result := SPFPass
+		switch term[0] {
+		case '+':
+			term = term[1:]
+		case '-':
+			result, term = SPFFail, term[1:]
+		case '~':
+			result, term = SPFSoftFail, term[1:]
+		case '?':
+			result, term = SPFNeutral, term[1:]
+		}
+
+		match, err := matchSPF(ctx, domain, term, ip, lookups)
+		if err != nil {
+			return "", "", err
+		}
+		if match {
+			return result, term, nil
+		}
+	}
+
+	if redirect != "" {
+		if err := countLookup(lookups); err != nil {
+			return "", "", err
+		}
+		result, term, err := checkSPF(ctx, redirect, ip, lookups)
+		if errors.Is(err, errNoSPF) {
+			return "", "", fmt.Errorf("redirect to %s: %v", redirect, err)
+		}
+		return result, term, err
+	}
+
+	return SPFNeutral, "", nil
+}
+
+// lookupSPF returns the only SPF record of domain
+func lookupSPF(ctx context.Context, domain string) (string, error) {
+	txts, err := net.DefaultResolver.LookupTXT(ctx, domain)
+	if IsNotFound(err) {
+		return "", errNoSPF
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var records []string
+	for _, txt := range txts {
+		lower := strings.ToLower(txt)
+		if lower == "v=spf1" || strings.HasPrefix(lower, "v=spf1 ") {
+			records = append(records, txt)
+		}
+	}
+
+	switch len(records) {
+	case 0:
+		return "", errNoSPF
+	case 1:
+		return records[0], nil
+	default:
+		return "", fmt.Errorf("%s has %d SPF records", domain, len(records))
+	}
+}
+
+func matchSPF(ctx context.Context, domain, term string, ip net.IP, lookups *int) (bool, error) {
+	if strings.Contains(term, "%") {
+		return false, nil
+	}
+
+	name, arg := term, ""
+	if i := strings.IndexAny(term, ":/"); i >= 0 {
+		name, arg = term[:i], term[i:]
+	}
+	arg = strings.TrimPrefix(arg, ":")
+
+	switch strings.ToLower(name) {
+	case "all":
+		return true, nil
+	case "ip4", "ip6":
+		if !strings.Contains(arg, "/") {
+			return ip.Equal(net.ParseIP(arg)), nil
+		}
+		_, network, err := net.ParseCIDR(arg)
+		if err != nil {
+			return false, fmt.Errorf("invalid %s: %v", term, err)
+		}
+		return network.Contains(ip), nil
+	case "a", "mx":
+		if err := countLookup(lookups); err != nil {
+			return false, err
+		}
+		target, ones4, ones6, err := splitDualCIDR(arg)
+		if err != nil {
+			return false, fmt.Errorf("invalid %s: %v", term, err)
+		}
+		if target == "" {
+			target = domain
+		}
+
+		hosts := []string{target}
+		if strings.ToLower(name) == "mx" {
+			mxs, err := net.DefaultResolver.LookupMX(ctx, target)
+			if err != nil && !IsNotFound(err) {
+				return false, err
+			}
+			hosts = hosts[:0]
+			for _, mx := range mxs {
+				hosts = append(hosts, mx.Host)
+			}
+		}
+
+		for _, h := range hosts {
+			addrs, err := net.DefaultResolver.LookupIPAddr(ctx, h)
+			if err != nil && !IsNotFound(err) {
+				return false, err
+			}
+			for _, a := range addrs {
+				if inPrefix(a.IP, ip, ones4, ones6) {
+					return true, nil
+				}
+			}
+		}
+		return false, nil
+	case "include":
+		if err := countLookup(lookups); err != nil {
+			return false, err
+		}
+		result, _, err := checkSPF(ctx, arg, ip, lookups)
+		if err != nil {
+			return false, fmt.Errorf("include:%s: %v", arg, err)
+		}
+		return result == SPFPass, nil
+	case "exists":
+		if err := countLookup(lookups); err != nil {
+			return false, err
+		}
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, arg)
+		if err != nil && !IsNotFound(err) {
+			return false, err
+		}
+		return len(addrs) > 0, nil
+	default:
+		// ptr and unknown mechanisms
+		return false, nil
+	}
+}
+
+// splitDualCIDR splits domain/ip4-cidr//ip6-cidr argument of a and mx
+// mechanisms
+func splitDualCIDR(arg string) (string, int, int, error) {
+	ones4, ones6 := 32, 128
+	if i := strings.Index(arg, "//"); i >= 0 {
+		n, err := strconv.Atoi(arg[i+2:])
+		if err != nil || n < 0 || n > 128 {
+			return "", 0, 0, fmt.Errorf("invalid ip6 prefix length")
+		}
+		ones6, arg = n, arg[:i]
+	}
+	if i := strings.Index(arg, "/"); i >= 0 {
+		n, err := strconv.Atoi(arg[i+1:])
+		if err != nil || n < 0 || n > 32 {
+			return "", 0, 0, fmt.Errorf("invalid ip4 prefix length")
+		}
+		ones4, arg = n, arg[:i]
+	}
+	return arg, ones4, ones6, nil
+}
+
+func inPrefix(addr, ip net.IP, ones4, ones6 int) bool {
+	if addr4, ip4 := addr.To4(), ip.To4(); addr4 != nil || ip4 != nil {
+		if addr4 == nil || ip4 == nil {
+			return false
+		}
+		mask := net.CIDRMask(ones4, 32)
+		return addr4.Mask(mask).Equal(ip4.Mask(mask))
+	}
+	mask := net.CIDRMask(ones6, 128)
+	return addr.Mask(mask).Equal(ip.Mask(mask))
+}
+
+func countLookup(lookups *int) error {
+	*lookups++
+	if *lookups > spfLookupLimit {
+		return fmt.Errorf("more than %d DNS lookups", spfLookupLimit)
+	}
+	return nil
+}
+
+// IsNotFound reports whether DNS lookup failed because the name or record
+// does not exist
+func IsNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
@@ -0,0 +1,218 @@
+package util
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"golang.org/x/mod/semver"
+)
+
+// releasesURL lists the releases published by GoReleaser
+var releasesURL = "https://api.github.com/repos/lateralusd/lateralus/releases"
+
+// Release is GitHub release of lateralus
+type Release struct {
+	Tag        string `json:"tag_name"`
+	Prerelease bool   `json:"prerelease"`
+	Draft      bool   `json:"draft"`
+	Assets     []struct {
+		Name string `json:"name"`
+		URL  string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+// Version returns the release version without v prefix, as GoReleaser
+// names the archives
+func (r *Release) Version() string {
+	return strings.TrimPrefix(r.Tag, "v")
+}
+
+// Newer reports whether the release is newer than current version. Current
+// version which is not semantic version, e.g. dev build, is older than any
+// release.
+func (r *Release) Newer(current string) bool {
+	current = "v" + strings.TrimPrefix(current, "v")
+	if !semver.IsValid(current) {
+		return true
+	}
+	return semver.Compare("v"+r.Version(), current) > 0
+}
+
+func (r *Release) assetURL(name string) (string, error) {
+	for _, a := range r.Assets {
+		if a.Name == name {
+			return a.URL, nil
+		}
+	}
+	return "", fmt.Errorf("release %s has no %s", r.Tag, name)
+}
+
+var updateClient = &http.Client{Timeout: 5 * time.Minute}
+
+// LatestRelease returns the newest published release, pre-releases are
+// considered only if preRelease is true
+func LatestRelease(preRelease bool) (*Release, error) {
+	resp, err := updateClient.Get(releasesURL)
+	if err != nil {
+		return nil, fmt.Errorf("LatestRelease: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("LatestRelease: GitHub responded %s", resp.Status)
+	}
+
+	var releases []*Release
+	if err := json.NewDecoder(resp.Body).Decode(&releases); err != nil {
+		return nil, fmt.Errorf("LatestRelease: %v", err)
+	}
+
+	var latest *Release
+	for _, r := range releases {
+		if r.Draft || (r.Prerelease && !preRelease) || !semver.IsValid("v"+r.Version()) {
+			continue
+		}
+		if latest == nil || semver.Compare("v"+r.Version(), "v"+latest.Version()) > 0 {
+			latest = r
+		}
+	}
+
+	if latest == nil {
+		return nil, errors.New("LatestRelease: no release found")
+	}
+
+	return latest, nil
+}
+
+// Update downloads the release archive for current OS and architecture,
+// verifies its SHA256 checksum and replaces executable with the binary
+// from it
+func Update(r *Release, executable string) error {
+	archive := fmt.Sprintf("lateralus_%s_%s_%s.tar.gz", r.Version(), runtime.GOOS, runtime.GOARCH)
+	archiveURL, err := r.assetURL(archive)
+	if err != nil {
+		return fmt.Errorf("Update: %v", err)
+	}
+	checksumsURL, err := r.assetURL(fmt.Sprintf("lateralus_%s_checksums.txt", r.Version()))
+	if err != nil {
+		return fmt.Errorf("Update: %v", err)
+	}
+
+	checksums, err := download(checksumsURL)
+	if err != nil {
+		return fmt.Errorf("Update: %v", err)
+	}
+	expected, err := findChecksum(checksums, archive)
+	if err != nil {
+		return fmt.Errorf("Update: %v", err)
+	}
+
+	d, err := download(archiveURL)
+	if err != nil {
+		return fmt.Errorf("Update: %v", err)
+	}
+	sum := sha256.Sum256(d)
+	if hex.EncodeToString(sum[:]) != expected {
+		return fmt.Errorf("Update: checksum of %s does not match", archive)
+	}
+
+	binary, err := extractBinary(d)
+	if err != nil {
+		return fmt.Errorf("Update: %v", err)
+	}
+
+	info, err := os.Stat(executable)
+	if err != nil {
+		return fmt.Errorf("Update: %v", err)
+	}
+
+	// temporary file has to be in the same directory for rename to be atomic
+	f, err := ioutil.TempFile(filepath.Dir(executable), ".lateralus-update-")
+	if err != nil {
+		return fmt.Errorf("Update: %v", err)
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(binary); err != nil {
+		f.Close()
+		return fmt.Errorf("Update: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("Update: %v", err)
+	}
+	if err := os.Chmod(f.Name(), info.Mode()); err != nil {
+		return fmt.Errorf("Update: %v", err)
+	}
+
+	if err := os.Rename(f.Name(), executable); err != nil {
+		return fmt.Errorf("Update: %v", err)
+	}
+
+	return nil
+}
+
+func download(url string) ([]byte, error) {
+	resp, err := updateClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("downloading %s: %s", url, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// findChecksum returns hex SHA256 of name from sha256sum formatted list
+func findChecksum(checksums []byte, name string) (string, error) {
+	for _, line := range strings.Split(string(checksums), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[1] == name {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	return "", fmt.Errorf("no checksum of %s", name)
+}
+
+// extractBinary returns lateralus executable from tar.gz archive
+func extractBinary(archive []byte) ([]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	name := "lateralus"
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("archive has no %s", name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag == tar.TypeReg && filepath.Base(hdr.Name) == name {
+			return ioutil.ReadAll(tr)
+		}
+	}
+}
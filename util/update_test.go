@@ -0,0 +1,286 @@
+package util
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// releaseFiles are the assets served by the release server, keyed by name
+type releaseFiles map[string][]byte
+
+// newReleaseServer serves releases as GitHub API does, with the files of
+// every release as its assets
+func newReleaseServer(t *testing.T, releases []map[string]interface{}, files releaseFiles) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+
+	for _, r := range releases {
+		var assets []map[string]string
+		for name := range files {
+			assets = append(assets, map[string]string{"name": name, "browser_download_url": ts.URL + "/download/" + name})
+		}
+		r["assets"] = assets
+	}
+	mux.HandleFunc("/releases", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(releases)
+	})
+	mux.HandleFunc("/download/", func(w http.ResponseWriter, r *http.Request) {
+		d, ok := files[strings.TrimPrefix(r.URL.Path, "/download/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(d)
+	})
+
+	old := releasesURL
+	releasesURL = ts.URL + "/releases"
+	t.Cleanup(func() { releasesURL = old })
+	return ts
+}
+
+// tarGz returns archive with the files, keyed by name
+func tarGz(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0755, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(content))
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// release returns the files of release version with archive holding binary
+func release(t *testing.T, version, binary string) (releaseFiles, string) {
+	t.Helper()
+	name := "lateralus"
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	archiveName := fmt.Sprintf("lateralus_%s_%s_%s.tar.gz", version, runtime.GOOS, runtime.GOARCH)
+	archive := tarGz(t, map[string]string{"README.md": "readme", name: binary})
+	sum := sha256.Sum256(archive)
+	checksums := fmt.Sprintf("%x  lateralus_%s_other_arch.tar.gz\n%x  %s\n", sha256.Sum256(nil), version, sum, archiveName)
+	return releaseFiles{
+		archiveName: archive,
+		fmt.Sprintf("lateralus_%s_checksums.txt", version): []byte(checksums),
+	}, archiveName
+}
+
+// writeExecutable writes the current executable to a temporary directory
+func writeExecutable(t *testing.T) string {
+	t.Helper()
+	executable := filepath.Join(t.TempDir(), "lateralus")
+	if err := ioutil.WriteFile(executable, []byte("old binary"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return executable
+}
+
+func TestLatestRelease(t *testing.T) {
+	releases := []map[string]interface{}{
+		{"tag_name": "v1.9.0"},
+		{"tag_name": "v1.10.0"},
+		{"tag_name": "v1.11.0-rc.1", "prerelease": true},
+		{"tag_name": "v2.0.0", "draft": true},
+		{"tag_name": "nightly"},
+		{"tag_name": "v1.2.0"},
+	}
+	newReleaseServer(t, releases, nil)
+
+	r, err := LatestRelease(false)
+	if err != nil {
+		t.Fatalf("LatestRelease() error = %v", err)
+	}
+	// 1.10.0 is newer than 1.9.0, though older as string
+	if r.Tag != "v1.10.0" {
+		t.Errorf("LatestRelease() = %s, want v1.10.0", r.Tag)
+	}
+
+	r, err = LatestRelease(true)
+	if err != nil {
+		t.Fatalf("LatestRelease() error = %v", err)
+	}
+	if r.Tag != "v1.11.0-rc.1" {
+		t.Errorf("LatestRelease() with pre-releases = %s, want v1.11.0-rc.1", r.Tag)
+	}
+}
+
+func TestLatestReleaseErrors(t *testing.T) {
+	newReleaseServer(t, []map[string]interface{}{{"tag_name": "v2.0.0", "draft": true}}, nil)
+	if _, err := LatestRelease(false); err == nil {
+		t.Errorf("LatestRelease() of drafts only error = nil, want error")
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "rate limit exceeded", http.StatusForbidden)
+	}))
+	defer ts.Close()
+	releasesURL = ts.URL
+	if _, err := LatestRelease(false); err == nil || !strings.Contains(err.Error(), "403") {
+		t.Errorf("LatestRelease() error = %v, want 403", err)
+	}
+}
+
+func TestNewer(t *testing.T) {
+	tests := []struct {
+		tag     string
+		current string
+		want    bool
+	}{
+		{tag: "v1.10.0", current: "1.9.0", want: true},
+		{tag: "v1.10.0", current: "v1.9.0", want: true},
+		{tag: "v1.9.0", current: "1.10.0", want: false},
+		{tag: "v1.9.0", current: "1.9.0", want: false},
+		{tag: "v1.9.0", current: "1.9.0-rc.1", want: true},
+		{tag: "v1.9.0", current: "dev", want: true},
+	}
+	for _, tt := range tests {
+		r := &Release{Tag: tt.tag}
+		if got := r.Newer(tt.current); got != tt.want {
+			t.Errorf("Release{%s}.Newer(%q) = %v, want %v", tt.tag, tt.current, got, tt.want)
+		}
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	files, _ := release(t, "1.10.0", "new binary")
+	newReleaseServer(t, []map[string]interface{}{{"tag_name": "v1.10.0"}}, files)
+
+	r, err := LatestRelease(false)
+	if err != nil {
+		t.Fatalf("LatestRelease() error = %v", err)
+	}
+	executable := writeExecutable(t)
+	if err := Update(r, executable); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+
+	if d, _ := ioutil.ReadFile(executable); string(d) != "new binary" {
+		t.Errorf("executable = %q, want new binary", d)
+	}
+	if info, err := os.Stat(executable); err != nil || (runtime.GOOS != "windows" && info.Mode().Perm() != 0755) {
+		t.Errorf("executable mode = %v, %v, want 0755", info.Mode(), err)
+	}
+	if entries, _ := ioutil.ReadDir(filepath.Dir(executable)); len(entries) != 1 {
+		t.Errorf("directory has %d files after update, want the executable only", len(entries))
+	}
+}
+
+func TestUpdateFails(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(files releaseFiles, archive string)
+		want   string
+	}{
+		{
+			name: "checksum mismatch",
+			change: func(files releaseFiles, archive string) {
+				files[archive] = append(files[archive], 0)
+			},
+			want: "does not match",
+		},
+		{
+			name: "no checksum entry",
+			change: func(files releaseFiles, archive string) {
+				files["lateralus_1.10.0_checksums.txt"] = []byte("0000  lateralus_1.10.0_other_arch.tar.gz\n")
+			},
+			want: "no checksum of " + fmt.Sprintf("lateralus_1.10.0_%s_%s.tar.gz", runtime.GOOS, runtime.GOARCH),
+		},
+		{
+			name: "no archive asset",
+			change: func(files releaseFiles, archive string) {
+				delete(files, archive)
+			},
+			want: "has no",
+		},
+		{
+			name: "no checksums asset",
+			change: func(files releaseFiles, archive string) {
+				delete(files, "lateralus_1.10.0_checksums.txt")
+			},
+			want: "has no",
+		},
+		{
+			name: "no binary in archive",
+			change: func(files releaseFiles, archive string) {
+				files[archive] = tarGz(t, map[string]string{"README.md": "readme"})
+				files["lateralus_1.10.0_checksums.txt"] = []byte(fmt.Sprintf("%x  %s\n", sha256.Sum256(files[archive]), archive))
+			},
+			want: "archive has no",
+		},
+		{
+			name: "archive is not gzip",
+			change: func(files releaseFiles, archive string) {
+				files[archive] = []byte("plain text, not a gzip archive")
+				files["lateralus_1.10.0_checksums.txt"] = []byte(fmt.Sprintf("%x  %s\n", sha256.Sum256(files[archive]), archive))
+			},
+			want: "gzip",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, archive := release(t, "1.10.0", "new binary")
+			tt.change(files, archive)
+			newReleaseServer(t, []map[string]interface{}{{"tag_name": "v1.10.0"}}, files)
+
+			r, err := LatestRelease(false)
+			if err != nil {
+				t.Fatalf("LatestRelease() error = %v", err)
+			}
+			executable := writeExecutable(t)
+			if err := Update(r, executable); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Update() error = %v, want %q", err, tt.want)
+			}
+
+			if d, _ := ioutil.ReadFile(executable); string(d) != "old binary" {
+				t.Errorf("executable = %q after failed update, want old binary", d)
+			}
+			if entries, _ := ioutil.ReadDir(filepath.Dir(executable)); len(entries) != 1 {
+				t.Errorf("directory has %d files after failed update, want the executable only", len(entries))
+			}
+		})
+	}
+}
+
+func TestUpdateMissingExecutable(t *testing.T) {
+	files, _ := release(t, "1.10.0", "new binary")
+	newReleaseServer(t, []map[string]interface{}{{"tag_name": "v1.10.0"}}, files)
+
+	r, err := LatestRelease(false)
+	if err != nil {
+		t.Fatalf("LatestRelease() error = %v", err)
+	}
+	executable := filepath.Join(t.TempDir(), "lateralus")
+	if err := Update(r, executable); err == nil {
+		t.Errorf("Update() of missing executable error = nil, want error")
+	}
+	if _, err := os.Stat(executable); !os.IsNotExist(err) {
+		t.Errorf("executable is created by failed update: %v", err)
+	}
+}
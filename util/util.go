@@ -1,9 +1,28 @@
 package util
 
-import "github.com/google/uuid"
+import (
+	"os/exec"
+	"runtime"
+
+	"github.com/google/uuid"
+)
 
 // GenerateUUID will be used to generate random part of url
 func GenerateUUID(length int) string {
 	id := uuid.New()
 	return id.String()[:length]
 }
+
+// OpenBrowser opens the file or url in the default browser
+func OpenBrowser(target string) error {
+	var cmd *exec.Cmd
+	switch runtime.GOOS {
+	case "windows":
+		cmd = exec.Command("rundll32", "url.dll,FileProtocolHandler", target)
+	case "darwin":
+		cmd = exec.Command("open", target)
+	default:
+		cmd = exec.Command("xdg-open", target)
+	}
+	return cmd.Start()
+}
@@ -0,0 +1,80 @@
+package util
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/likexian/whois"
+	whoisparser "github.com/likexian/whois-parser"
+	"golang.org/x/net/publicsuffix"
+)
+
+// DomainInfo holds registration data of the domain from WHOIS
+type DomainInfo struct {
+	Domain    string
+	Registrar string
+	// Created is zero if WHOIS response has no creation date in known format
+	Created time.Time
+}
+
+// createdLayouts are the creation date formats used by registries
+var createdLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04:05 MST",
+	"2006-01-02",
+	"02-Jan-2006",
+	"2006.01.02",
+	"02.01.2006",
+	"2006/01/02",
+}
+
+// RegisteredDomain returns the part of host registered with registrar,
+// e.g. example.co.uk for login.example.co.uk
+func RegisteredDomain(host string) (string, error) {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return "", fmt.Errorf("RegisteredDomain: %v", err)
+	}
+	return domain, nil
+}
+
+// LookupDomain queries WHOIS for registrar and creation date of domain
+func LookupDomain(domain string) (*DomainInfo, error) {
+	client := whois.NewClient()
+	client.SetTimeout(10 * time.Second)
+
+	raw, err := client.Whois(domain)
+	if err != nil {
+		return nil, fmt.Errorf("LookupDomain: %v", err)
+	}
+
+	parsed, err := whoisparser.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("LookupDomain: %v", err)
+	}
+
+	info := &DomainInfo{Domain: domain}
+	if parsed.Registrar != nil {
+		info.Registrar = parsed.Registrar.Name
+	}
+	if parsed.Domain != nil {
+		info.Created = parseCreated(parsed.Domain.CreatedDate)
+	}
+
+	return info, nil
+}
+
+func parseCreated(s string) time.Time {
+	s = strings.TrimSpace(s)
+	for _, layout := range createdLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}